@@ -0,0 +1,237 @@
+// Package accounts keeps optional user accounts: a username and a bcrypt
+// password hash behind a pluggable Store. Each account has a stable
+// ClientID, which the room server uses in place of the random per-browser
+// ID so a signed-in player keeps their slot across devices.
+package accounts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ClientIDPrefix starts every account's ClientID. Browser-generated IDs
+// are bare hex, so the two never collide, and the room server can tell
+// which clientIDs need a session.
+const ClientIDPrefix = "u-"
+
+const (
+	minPasswordLen = 8
+	// maxPasswordLen is bcrypt's input limit.
+	maxPasswordLen = 72
+	bcryptCost     = 12
+)
+
+var (
+	ErrUsernameTaken      = errors.New("accounts: username taken")
+	ErrNotFound           = errors.New("accounts: no such user")
+	ErrInvalidCredentials = errors.New("accounts: wrong username or password")
+	ErrInvalidUsername    = errors.New("accounts: usernames are 3-32 letters, digits, '_' or '-'")
+	ErrInvalidPassword    = fmt.Errorf("accounts: passwords are %d-%d bytes", minPasswordLen, maxPasswordLen)
+)
+
+var usernameRegexp = regexp.MustCompile(`^[a-z0-9_-]{3,32}$`)
+
+// User is one account.
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"passwordHash"`
+	Created      time.Time `json:"created"`
+}
+
+// ClientID is the user's clientID in rooms.
+func (u User) ClientID() string {
+	return ClientIDPrefix + u.ID
+}
+
+// Store persists users. Usernames are unique and stored normalised.
+type Store interface {
+	// Add saves a new user, or returns ErrUsernameTaken.
+	Add(u User) error
+	// ByUsername and ByID return ErrNotFound for unknown users.
+	ByUsername(username string) (User, error)
+	ByID(id string) (User, error)
+}
+
+// NormalizeUsername folds a username to the form stored and compared.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Register creates an account.
+func Register(s Store, username, password string) (User, error) {
+	username = NormalizeUsername(username)
+	if !usernameRegexp.MatchString(username) {
+		return User{}, ErrInvalidUsername
+	}
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return User{}, ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return User{}, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return User{}, err
+	}
+	u := User{ID: hex.EncodeToString(id), Username: username, PasswordHash: hash, Created: time.Now().UTC()}
+	if err := s.Add(u); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// Authenticate checks a username and password. Unknown users and wrong
+// passwords both give ErrInvalidCredentials.
+func Authenticate(s Store, username, password string) (User, error) {
+	u, err := s.ByUsername(NormalizeUsername(username))
+	if errors.Is(err, ErrNotFound) {
+		// Spend the same time as a real check so response times don't
+		// reveal which usernames exist.
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return User{}, ErrInvalidCredentials
+	} else if err != nil {
+		return User{}, err
+	}
+	if bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a real password"), bcryptCost)
+	return hash
+})
+
+// MemoryStore keeps users in memory only.
+type MemoryStore struct {
+	mu     sync.Mutex
+	byID   map[string]User
+	byName map[string]string // username -> ID
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{byID: make(map[string]User), byName: make(map[string]string)}
+}
+
+func (s *MemoryStore) Add(u User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(u)
+}
+
+func (s *MemoryStore) add(u User) error {
+	if _, taken := s.byName[u.Username]; taken {
+		return ErrUsernameTaken
+	}
+	s.byID[u.ID] = u
+	s.byName[u.Username] = u.ID
+	return nil
+}
+
+func (s *MemoryStore) ByUsername(username string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.byName[username]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return s.byID[id], nil
+}
+
+func (s *MemoryStore) ByID(id string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// FileStore is a MemoryStore backed by a JSON file, rewritten atomically
+// on every Add. It suits a single server with modest sign-ups.
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+// OpenFileStore loads the users in path, which need not exist yet.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	s.byID, s.byName = make(map[string]User), make(map[string]string)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("accounts: %s: %v", path, err)
+	}
+	for _, u := range users {
+		if err := s.add(u); err != nil {
+			return nil, fmt.Errorf("accounts: %s: duplicate user %q", path, u.Username)
+		}
+	}
+	return s, nil
+}
+
+func (s *FileStore) Add(u User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.add(u); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		delete(s.byID, u.ID)
+		delete(s.byName, u.Username)
+		return err
+	}
+	return nil
+}
+
+// save writes every user to a temporary file and renames it over path.
+func (s *FileStore) save() error {
+	users := make([]User, 0, len(s.byID))
+	for _, u := range s.byID {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Created.Before(users[j].Created) })
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".users-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,63 @@
+package accounts
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegisterAndAuthenticate(t *testing.T) {
+	s := NewMemoryStore()
+	u, err := Register(s, " Alice ", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" || !strings.HasPrefix(u.ClientID(), ClientIDPrefix) || string(u.PasswordHash) == "correct horse" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+	if _, err := Register(s, "ALICE", "another password"); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("duplicate username: got %v", err)
+	}
+	for _, c := range []struct{ name, password string }{{"al", "long enough"}, {"bad name", "long enough"}, {"bob", "short"}} {
+		if _, err := Register(s, c.name, c.password); err == nil {
+			t.Errorf("registered %q with %q", c.name, c.password)
+		}
+	}
+
+	if got, err := Authenticate(s, "alice", "correct horse"); err != nil || got.ID != u.ID {
+		t.Fatalf("authenticate: got %+v, %v", got, err)
+	}
+	if _, err := Authenticate(s, "alice", "wrong horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got %v", err)
+	}
+	if _, err := Authenticate(s, "nobody", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user: got %v", err)
+	}
+}
+
+func TestFileStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users", "users.json")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := Register(s, "alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.ByID(u.ID); err != nil || got.Username != "alice" {
+		t.Fatalf("after reopening: got %+v, %v", got, err)
+	}
+	if _, err := Authenticate(reopened, "alice", "correct horse"); err != nil {
+		t.Fatalf("authenticate after reopening: %v", err)
+	}
+	if _, err := Register(reopened, "alice", "correct horse"); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("duplicate after reopening: got %v", err)
+	}
+}
@@ -1,17 +1,87 @@
 package app
 
 import (
+	"github.com/josephhammerman1979/josephhammerman.com/app/accounts"
+	"github.com/josephhammerman1979/josephhammerman.com/app/asyncpig"
 	"github.com/josephhammerman1979/josephhammerman.com/app/controllers"
+	"github.com/josephhammerman1979/josephhammerman.com/app/stun"
+	"github.com/josephhammerman1979/josephhammerman.com/app/turnserver"
 
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 )
 
 func Run(listenAndServe func(string, http.Handler) error, port string) error {
 	log.Println("Listening on port: ", port)
+	cfg := LoadConfig()
+	if cfg.ICE.STUNPort > 0 {
+		go func() {
+			addr := net.JoinHostPort("", strconv.Itoa(cfg.ICE.STUNPort))
+			if err := stun.ListenAndServe(addr, "josephhammerman.com"); err != nil {
+				log.Printf("[STUN] server stopped: %v", err)
+			}
+		}()
+	}
+	if turn := cfg.ICE.TURN; turn.Enabled() {
+		relay, err := turnserver.Start(turnserver.Config{
+			ListenAddr:            net.JoinHostPort("", strconv.Itoa(turn.Port)),
+			Realm:                 turn.Realm,
+			Secret:                turn.Secret,
+			RelayIP:               net.ParseIP(turn.RelayIP),
+			MinPort:               uint16(turn.MinPort),
+			MaxPort:               uint16(turn.MaxPort),
+			MaxAllocationsPerUser: turn.MaxAllocationsPerUser,
+			MaxAllocations:        turn.MaxAllocations,
+		})
+		if err != nil {
+			return err
+		}
+		defer relay.Close()
+	}
 	tm := controllers.NewTopicManager()
-	if err := listenAndServe(net.JoinHostPort("", port), controllers.Router(tm)); err != nil {
+	if cfg.SFU.Enabled {
+		if err := tm.EnableSFU(cfg.SFU); err != nil {
+			return err
+		}
+		log.Printf("[SFU] enabled, up to %d participants per room", cfg.SFU.MaxParticipants)
+	}
+	if cfg.Audit.Dir != "" {
+		if err := tm.EnableAudit(cfg.Audit); err != nil {
+			return err
+		}
+		log.Printf("[Audit] writing to %s", cfg.Audit.Dir)
+	}
+	if cfg.Stats.File != "" {
+		if err := tm.EnableStats(cfg.Stats); err != nil {
+			return err
+		}
+		log.Printf("[Stats] game results in %s", cfg.Stats.File)
+	}
+	if cfg.AsyncGames.File != "" {
+		store, err := asyncpig.OpenFileStore(cfg.AsyncGames.File)
+		if err != nil {
+			return err
+		}
+		tm.EnableAsyncGames(store)
+		log.Printf("[AsyncGames] games in %s", cfg.AsyncGames.File)
+	}
+	if cfg.Accounts.File != "" {
+		store, err := accounts.OpenFileStore(cfg.Accounts.File)
+		if err != nil {
+			return err
+		}
+		if err := tm.EnableAccounts(store, cfg.Accounts); err != nil {
+			return err
+		}
+		log.Printf("[Accounts] users in %s", cfg.Accounts.File)
+	}
+	if len(cfg.Webhooks.Subscriptions) > 0 {
+		tm.EnableWebhooks(cfg.Webhooks)
+		log.Printf("[Webhooks] delivering to %d subscribers", len(cfg.Webhooks.Subscriptions))
+	}
+	if err := listenAndServe(net.JoinHostPort("", port), controllers.Router(tm, cfg)); err != nil {
 		return err
 	}
 	return nil
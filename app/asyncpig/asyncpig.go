@@ -0,0 +1,304 @@
+// Package asyncpig plays Pig by turns: the server holds each game's state
+// and rolls the dice, and players take their turn whenever they next
+// visit. The rules match the live dice game in dicegames — classic Pig
+// with one die, or Big Pig with two — and first to WinningScore wins.
+//
+// A game may give each turn a deadline. When it passes, the turn ends on
+// the player's behalf: TimeoutHold banks what they had rolled so far,
+// TimeoutForfeit takes them out of the game.
+package asyncpig
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	VariantPig    = "pig"
+	VariantBigPig = "bigpig"
+
+	WinningScore = 100
+	MinPlayers   = 2
+	MaxPlayers   = 6
+
+	TimeoutHold    = "hold"
+	TimeoutForfeit = "forfeit"
+
+	StatusWaiting = "waiting" // seats still free
+	StatusPlaying = "playing"
+	StatusOver    = "over"
+
+	// Turn outcomes.
+	OutcomeHold      = "hold"
+	OutcomeBust      = "bust"       // rolled a 1; turn points lost
+	OutcomeSnakeEyes = "snake_eyes" // Big Pig 1+1; all points lost
+	OutcomeTimeout   = "timeout"    // deadline passed; turn banked
+	OutcomeForfeit   = "forfeit"    // deadline passed or resigned; out of the game
+)
+
+var (
+	ErrNotFound      = errors.New("asyncpig: no such game")
+	ErrInvalidGame   = fmt.Errorf("asyncpig: games have %d-%d players, variant %q or %q", MinPlayers, MaxPlayers, VariantPig, VariantBigPig)
+	ErrGameFull      = errors.New("asyncpig: every seat is taken")
+	ErrAlreadyJoined = errors.New("asyncpig: already in this game")
+	ErrNotPlayer     = errors.New("asyncpig: not a player in this game")
+	ErrNotStarted    = errors.New("asyncpig: waiting for players")
+	ErrGameOver      = errors.New("asyncpig: the game is over")
+	ErrNotYourTurn   = errors.New("asyncpig: not your turn")
+	ErrMustRoll      = errors.New("asyncpig: roll at least once before holding")
+)
+
+// Player is one seat. ID identifies whoever plays it and is never shown.
+type Player struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Score         int    `json:"score"`
+	Turns         int    `json:"turns"`
+	BiggestTurn   int    `json:"biggestTurn"`
+	LongestStreak int    `json:"longestStreak"`
+	Forfeited     bool   `json:"forfeited,omitempty"`
+}
+
+// Turn is one finished turn in a game's history.
+type Turn struct {
+	Player  int       `json:"player"`
+	Rolls   [][]int   `json:"rolls"`
+	Outcome string    `json:"outcome"`
+	Points  int       `json:"points"` // banked by the turn
+	Ended   time.Time `json:"ended"`
+}
+
+// Game is the whole state of one game.
+type Game struct {
+	ID      string    `json:"id"`
+	Variant string    `json:"variant"`
+	Seats   int       `json:"seats"`
+	Created time.Time `json:"created"`
+	// TurnLimit is how long each turn may take; zero means no deadline.
+	TurnLimit time.Duration `json:"turnLimit,omitempty"`
+	OnTimeout string        `json:"onTimeout,omitempty"`
+
+	Status  string   `json:"status"`
+	Players []Player `json:"players"`
+	Current int      `json:"current"`
+	// Rolls and TurnScore are the current turn so far.
+	Rolls       [][]int   `json:"rolls,omitempty"`
+	TurnScore   int       `json:"turnScore"`
+	TurnStarted time.Time `json:"turnStarted"`
+	History     []Turn    `json:"history"`
+	Winner      int       `json:"winner"` // seat, or -1
+	Ended       time.Time `json:"ended,omitempty"`
+}
+
+// New returns a game waiting for seats players.
+func New(id, variant string, seats int, turnLimit time.Duration, onTimeout string, now time.Time) (*Game, error) {
+	if (variant != VariantPig && variant != VariantBigPig) || seats < MinPlayers || seats > MaxPlayers || turnLimit < 0 {
+		return nil, ErrInvalidGame
+	}
+	if onTimeout != TimeoutForfeit {
+		onTimeout = TimeoutHold
+	}
+	return &Game{
+		ID: id, Variant: variant, Seats: seats, Created: now,
+		TurnLimit: turnLimit, OnTimeout: onTimeout,
+		Status: StatusWaiting, Winner: -1,
+	}, nil
+}
+
+// Seat returns playerID's seat, or -1.
+func (g *Game) Seat(playerID string) int {
+	for i, p := range g.Players {
+		if p.ID == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Join seats a player; the game starts when the last seat is taken.
+func (g *Game) Join(playerID, name string, now time.Time) error {
+	if g.Seat(playerID) >= 0 {
+		return ErrAlreadyJoined
+	}
+	if g.Status != StatusWaiting {
+		return ErrGameFull
+	}
+	g.Players = append(g.Players, Player{ID: playerID, Name: name})
+	if len(g.Players) == g.Seats {
+		g.Status = StatusPlaying
+		g.TurnStarted = now
+	}
+	return nil
+}
+
+// Deadline returns when the current turn times out, if it can.
+func (g *Game) Deadline() (time.Time, bool) {
+	if g.Status != StatusPlaying || g.TurnLimit <= 0 {
+		return time.Time{}, false
+	}
+	return g.TurnStarted.Add(g.TurnLimit), true
+}
+
+// Expire ends the current turn if its deadline has passed, and reports
+// whether it did. The next turn starts at now.
+func (g *Game) Expire(now time.Time) bool {
+	deadline, ok := g.Deadline()
+	if !ok || now.Before(deadline) {
+		return false
+	}
+	if g.OnTimeout == TimeoutForfeit {
+		g.forfeit(g.Current, now)
+		return true
+	}
+	g.bank(OutcomeTimeout, now)
+	return true
+}
+
+// turn checks that playerID may act now, after any timeout.
+func (g *Game) turn(playerID string, now time.Time) error {
+	g.Expire(now)
+	seat := g.Seat(playerID)
+	switch {
+	case seat < 0:
+		return ErrNotPlayer
+	case g.Status == StatusWaiting:
+		return ErrNotStarted
+	case g.Status == StatusOver:
+		return ErrGameOver
+	case seat != g.Current:
+		return ErrNotYourTurn
+	}
+	return nil
+}
+
+// Roll rolls for playerID with die, which returns 1-6.
+func (g *Game) Roll(playerID string, now time.Time, die func() int) error {
+	if err := g.turn(playerID, now); err != nil {
+		return err
+	}
+	values := []int{die()}
+	if g.Variant == VariantBigPig {
+		values = append(values, die())
+	}
+	g.Rolls = append(g.Rolls, values)
+
+	switch d1 := values[0]; {
+	case len(values) == 2 && d1 == 1 && values[1] == 1:
+		g.Players[g.Current].Score = 0
+		g.endTurn(OutcomeSnakeEyes, 0, now)
+	case slices.Contains(values, 1):
+		g.endTurn(OutcomeBust, 0, now)
+	case len(values) == 2 && d1 == values[1]:
+		g.TurnScore += 4 * d1
+	default:
+		for _, v := range values {
+			g.TurnScore += v
+		}
+	}
+	return nil
+}
+
+// Hold banks playerID's turn.
+func (g *Game) Hold(playerID string, now time.Time) error {
+	if err := g.turn(playerID, now); err != nil {
+		return err
+	}
+	if len(g.Rolls) == 0 {
+		return ErrMustRoll
+	}
+	g.bank(OutcomeHold, now)
+	return nil
+}
+
+// Resign takes playerID out of a game in progress, on their turn or not.
+func (g *Game) Resign(playerID string, now time.Time) error {
+	g.Expire(now)
+	seat := g.Seat(playerID)
+	switch {
+	case seat < 0:
+		return ErrNotPlayer
+	case g.Status == StatusWaiting:
+		return ErrNotStarted
+	case g.Status == StatusOver || g.Players[seat].Forfeited:
+		return ErrGameOver
+	}
+	g.forfeit(seat, now)
+	return nil
+}
+
+// bank adds the turn score to the current player and ends the turn.
+func (g *Game) bank(outcome string, now time.Time) {
+	p := &g.Players[g.Current]
+	p.Score += g.TurnScore
+	p.BiggestTurn = max(p.BiggestTurn, g.TurnScore)
+	g.endTurn(outcome, g.TurnScore, now)
+}
+
+// endTurn records the current turn and passes play on.
+func (g *Game) endTurn(outcome string, points int, now time.Time) {
+	p := &g.Players[g.Current]
+	p.Turns++
+	streak := len(g.Rolls)
+	if outcome == OutcomeBust || outcome == OutcomeSnakeEyes {
+		streak-- // the last roll scored nothing
+	}
+	p.LongestStreak = max(p.LongestStreak, streak)
+	g.History = append(g.History, Turn{Player: g.Current, Rolls: g.Rolls, Outcome: outcome, Points: points, Ended: now})
+	g.Rolls, g.TurnScore = nil, 0
+
+	if p.Score >= WinningScore {
+		g.finish(g.Current, now)
+		return
+	}
+	g.advance(now)
+}
+
+// forfeit takes seat out of the game, ending it if one player is left.
+func (g *Game) forfeit(seat int, now time.Time) {
+	g.Players[seat].Forfeited = true
+	if seat == g.Current {
+		g.History = append(g.History, Turn{Player: seat, Rolls: g.Rolls, Outcome: OutcomeForfeit, Ended: now})
+		g.Rolls, g.TurnScore = nil, 0
+	} else {
+		g.History = append(g.History, Turn{Player: seat, Outcome: OutcomeForfeit, Ended: now})
+	}
+	left := -1
+	for i, p := range g.Players {
+		if !p.Forfeited {
+			if left >= 0 {
+				if seat == g.Current {
+					g.advance(now)
+				}
+				return
+			}
+			left = i
+		}
+	}
+	g.finish(left, now)
+}
+
+// advance passes the turn to the next player still in the game.
+func (g *Game) advance(now time.Time) {
+	for i := 1; i <= len(g.Players); i++ {
+		if next := (g.Current + i) % len(g.Players); !g.Players[next].Forfeited {
+			g.Current = next
+			break
+		}
+	}
+	g.TurnStarted = now
+}
+
+func (g *Game) finish(winner int, now time.Time) {
+	g.Status, g.Winner, g.Ended = StatusOver, winner, now
+}
+
+// Clone returns a deep copy of g.
+func (g *Game) Clone() *Game {
+	c := *g
+	c.Players = slices.Clone(g.Players)
+	c.Rolls = slices.Clone(g.Rolls)
+	c.History = slices.Clone(g.History)
+	return &c
+}
@@ -0,0 +1,173 @@
+package asyncpig
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// dice returns a die that rolls values in order.
+func dice(values ...int) func() int {
+	return func() int {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+}
+
+func newGame(t *testing.T, variant string, limit time.Duration, onTimeout string, now time.Time) *Game {
+	t.Helper()
+	g, err := New("gameid0001", variant, 2, limit, onTimeout, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Join("alice", "Alice", now); err != nil {
+		t.Fatal(err)
+	}
+	if g.Status != StatusWaiting {
+		t.Fatalf("started with one player: %s", g.Status)
+	}
+	if err := g.Join("bob", "Bob", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Join("carol", "Carol", now); !errors.Is(err, ErrGameFull) {
+		t.Fatalf("third player in a two-seat game: got %v", err)
+	}
+	return g
+}
+
+func TestPigTurns(t *testing.T) {
+	now := time.Now()
+	g := newGame(t, VariantPig, 0, "", now)
+
+	if err := g.Roll("bob", now, dice(6)); !errors.Is(err, ErrNotYourTurn) {
+		t.Fatalf("rolled out of turn: got %v", err)
+	}
+	if err := g.Hold("alice", now); !errors.Is(err, ErrMustRoll) {
+		t.Fatalf("held without rolling: got %v", err)
+	}
+	die := dice(4, 5, 3, 1)
+	g.Roll("alice", now, die)
+	g.Roll("alice", now, die)
+	if err := g.Hold("alice", now); err != nil {
+		t.Fatal(err)
+	}
+	g.Roll("bob", now, die)
+	g.Roll("bob", now, die)
+
+	alice, bob := g.Players[0], g.Players[1]
+	if alice.Score != 9 || alice.BiggestTurn != 9 || alice.LongestStreak != 2 || alice.Turns != 1 {
+		t.Fatalf("unexpected alice %+v", alice)
+	}
+	if bob.Score != 0 || bob.LongestStreak != 1 || bob.Turns != 1 || g.Current != 0 {
+		t.Fatalf("unexpected bob %+v, current %d", bob, g.Current)
+	}
+	if len(g.History) != 2 || g.History[0].Outcome != OutcomeHold || g.History[0].Points != 9 ||
+		g.History[1].Outcome != OutcomeBust || len(g.History[1].Rolls) != 2 {
+		t.Fatalf("unexpected history %+v", g.History)
+	}
+
+	// Bank 96 more to win.
+	for range 16 {
+		g.Roll("alice", now, dice(6))
+	}
+	g.Hold("alice", now)
+	if g.Status != StatusOver || g.Winner != 0 || g.Players[0].Score != 105 {
+		t.Fatalf("expected alice to win, got %s winner %d score %d", g.Status, g.Winner, g.Players[0].Score)
+	}
+	if err := g.Roll("bob", now, dice(6)); !errors.Is(err, ErrGameOver) {
+		t.Fatalf("rolled after the game: got %v", err)
+	}
+}
+
+func TestBigPigRolls(t *testing.T) {
+	now := time.Now()
+	g := newGame(t, VariantBigPig, 0, "", now)
+
+	die := dice(3, 3, 2, 5)
+	g.Roll("alice", now, die)
+	g.Roll("alice", now, die)
+	if g.TurnScore != 19 {
+		t.Fatalf("doubles then 2+5: turn score %d, want 19", g.TurnScore)
+	}
+	g.Hold("alice", now)
+	g.Roll("bob", now, dice(4, 1))
+	g.Roll("alice", now, dice(1, 1))
+	if p := g.Players[0]; p.Score != 0 || g.History[2].Outcome != OutcomeSnakeEyes || g.Current != 1 {
+		t.Fatalf("snake eyes: got %+v, %+v", p, g.History[2])
+	}
+}
+
+func TestTurnDeadlines(t *testing.T) {
+	start := time.Now()
+	late := start.Add(2 * time.Hour)
+
+	g := newGame(t, VariantPig, time.Hour, TimeoutHold, start)
+	g.Roll("alice", start, dice(5))
+	if g.Expire(start.Add(time.Minute)) {
+		t.Fatal("expired before the deadline")
+	}
+	if err := g.Roll("alice", late, dice(6)); !errors.Is(err, ErrNotYourTurn) {
+		t.Fatalf("rolled after the deadline: got %v", err)
+	}
+	if g.Players[0].Score != 5 || g.History[0].Outcome != OutcomeTimeout || g.Current != 1 {
+		t.Fatalf("timeout should hold: got %+v", g.History[0])
+	}
+	if d, _ := g.Deadline(); !d.Equal(late.Add(time.Hour)) {
+		t.Fatalf("next deadline %v, want an hour after the timeout", d)
+	}
+
+	g = newGame(t, VariantPig, time.Hour, TimeoutForfeit, start)
+	if !g.Expire(late) || g.Status != StatusOver || g.Winner != 1 || !g.Players[0].Forfeited {
+		t.Fatalf("timeout should forfeit: got %s winner %d", g.Status, g.Winner)
+	}
+
+	g = newGame(t, VariantPig, 0, "", start)
+	if g.Expire(late) {
+		t.Fatal("expired without a turn limit")
+	}
+	if err := g.Resign("bob", start); err != nil || g.Winner != 0 {
+		t.Fatalf("resign: got %v, winner %d", err, g.Winner)
+	}
+}
+
+func TestFileStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games", "games.json")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	if err := s.Add(newGame(t, VariantPig, time.Hour, TimeoutHold, now)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Update("gameid0001", func(g *Game) error { return g.Roll("alice", now, dice(4)) }); err != nil {
+		t.Fatal(err)
+	}
+	// A failed move changes nothing.
+	if _, err := s.Update("gameid0001", func(g *Game) error {
+		g.Roll("alice", now, dice(6))
+		return g.Hold("bob", now)
+	}); !errors.Is(err, ErrNotYourTurn) {
+		t.Fatalf("hold out of turn: got %v", err)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := reopened.Get("gameid0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Status != StatusPlaying || g.TurnScore != 4 || len(g.Rolls) != 1 || g.TurnLimit != time.Hour || g.Players[1].Name != "Bob" {
+		t.Fatalf("after reopening: got %+v", g)
+	}
+	if err := reopened.Delete("gameid0001"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("gameid0001"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("after delete: got %v", err)
+	}
+}
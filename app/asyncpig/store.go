@@ -0,0 +1,172 @@
+package asyncpig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store persists games. Games handed out are copies; changes go through
+// Update so each one is applied and saved as a unit.
+type Store interface {
+	// Add saves a new game.
+	Add(g *Game) error
+	// Get returns a copy of a game, or ErrNotFound.
+	Get(id string) (*Game, error)
+	// Update applies fn to a copy of the game and saves the result unless
+	// fn fails, returning the saved game.
+	Update(id string, fn func(*Game) error) (*Game, error)
+	// Delete drops a game.
+	Delete(id string) error
+	// All returns copies of every game.
+	All() ([]*Game, error)
+}
+
+// MemoryStore keeps games in memory only.
+type MemoryStore struct {
+	mu    sync.Mutex
+	games map[string]*Game
+	// saved is called after every change, with mu held.
+	saved func() error
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{games: make(map[string]*Game)}
+}
+
+func (s *MemoryStore) Add(g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, dup := s.games[g.ID]; dup {
+		return fmt.Errorf("asyncpig: duplicate game %q", g.ID)
+	}
+	s.games[g.ID] = g.Clone()
+	if err := s.save(); err != nil {
+		delete(s.games, g.ID)
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.games[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return g.Clone(), nil
+}
+
+func (s *MemoryStore) Update(id string, fn func(*Game) error) (*Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.games[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	g := old.Clone()
+	if err := fn(g); err != nil {
+		return nil, err
+	}
+	s.games[id] = g
+	if err := s.save(); err != nil {
+		s.games[id] = old
+		return nil, err
+	}
+	return g.Clone(), nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.games[id]
+	if !ok {
+		return nil
+	}
+	delete(s.games, id)
+	if err := s.save(); err != nil {
+		s.games[id] = old
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStore) All() ([]*Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.all(), nil
+}
+
+// all returns copies of the games, oldest first.
+func (s *MemoryStore) all() []*Game {
+	games := make([]*Game, 0, len(s.games))
+	for _, g := range s.games {
+		games = append(games, g.Clone())
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].Created.Before(games[j].Created) })
+	return games
+}
+
+func (s *MemoryStore) save() error {
+	if s.saved == nil {
+		return nil
+	}
+	return s.saved()
+}
+
+// FileStore is a MemoryStore backed by a JSON file, rewritten atomically
+// on every change. It suits a single server with a few hundred games.
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+// OpenFileStore loads the games in path, which need not exist yet.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	s.games = make(map[string]*Game)
+	s.saved = s.write
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var games []*Game
+	if err := json.Unmarshal(data, &games); err != nil {
+		return nil, fmt.Errorf("asyncpig: %s: %v", path, err)
+	}
+	for _, g := range games {
+		s.games[g.ID] = g
+	}
+	return s, nil
+}
+
+// write writes every game to a temporary file and renames it over path.
+func (s *FileStore) write() error {
+	data, err := json.MarshalIndent(s.all(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".games-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/controllers"
+)
+
+// LoadConfig builds the server configuration from the defaults plus any
+// overrides in the environment.
+func LoadConfig() controllers.Config {
+	cfg := controllers.DefaultConfig()
+
+	cfg.Security.TLS = envBool("TLS", cfg.Security.TLS)
+	cfg.Security.HSTSMaxAge = envDuration("HSTS_MAX_AGE", cfg.Security.HSTSMaxAge)
+	cfg.Security.ReferrerPolicy = envString("REFERRER_POLICY", cfg.Security.ReferrerPolicy)
+	cfg.Security.FrameAncestors = envString("FRAME_ANCESTORS", cfg.Security.FrameAncestors)
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		proxies, err := controllers.ParseTrustedProxies(v)
+		if err != nil {
+			log.Printf("[Config] ignoring TRUSTED_PROXIES: %v", err)
+		} else {
+			cfg.Security.TrustedProxies = proxies
+		}
+	}
+
+	if v, ok := os.LookupEnv("ICE_SERVERS"); ok {
+		cfg.ICE.Servers = parseICEServers(v)
+	}
+	cfg.ICE.STUNPort = envInt("STUN_PORT", cfg.ICE.STUNPort)
+	cfg.ICE.STUNHost = envString("STUN_HOST", cfg.ICE.STUNHost)
+
+	turn := &cfg.ICE.TURN
+	turn.Port = envInt("TURN_PORT", turn.Port)
+	turn.Secret = envString("TURN_SECRET", turn.Secret)
+	turn.Realm = envString("TURN_REALM", turn.Realm)
+	turn.Host = envString("TURN_HOST", turn.Host)
+	turn.RelayIP = envString("TURN_RELAY_IP", turn.RelayIP)
+	turn.MinPort = envInt("TURN_MIN_PORT", turn.MinPort)
+	turn.MaxPort = envInt("TURN_MAX_PORT", turn.MaxPort)
+	turn.MaxAllocationsPerUser = envInt("TURN_MAX_ALLOCATIONS_PER_USER", turn.MaxAllocationsPerUser)
+	turn.MaxAllocations = envInt("TURN_MAX_ALLOCATIONS", turn.MaxAllocations)
+	turn.CredentialTTL = envDuration("TURN_CREDENTIAL_TTL", turn.CredentialTTL)
+
+	sfu := &cfg.SFU
+	sfu.Enabled = envBool("SFU_ENABLED", sfu.Enabled)
+	sfu.MaxParticipants = envInt("SFU_MAX_PARTICIPANTS", sfu.MaxParticipants)
+	if v, ok := os.LookupEnv("SFU_PUBLIC_IPS"); ok {
+		sfu.PublicIPs = splitList(v)
+	}
+	sfu.MinPort = envInt("SFU_MIN_PORT", sfu.MinPort)
+	sfu.MaxPort = envInt("SFU_MAX_PORT", sfu.MaxPort)
+	sfu.RecordingDir = envString("SFU_RECORDING_DIR", sfu.RecordingDir)
+
+	hooks := &cfg.Webhooks
+	if v, ok := os.LookupEnv("WEBHOOKS"); ok {
+		subs, err := controllers.ParseWebhookSubscriptions(v)
+		if err != nil {
+			log.Printf("[Config] ignoring WEBHOOKS: %v", err)
+		} else {
+			hooks.Subscriptions = subs
+		}
+	}
+	hooks.QueueSize = envInt("WEBHOOK_QUEUE_SIZE", hooks.QueueSize)
+	hooks.MaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", hooks.MaxAttempts)
+	hooks.RetryBase = envDuration("WEBHOOK_RETRY_BASE", hooks.RetryBase)
+	hooks.Timeout = envDuration("WEBHOOK_TIMEOUT", hooks.Timeout)
+
+	audit := &cfg.Audit
+	audit.Dir = envString("AUDIT_DIR", audit.Dir)
+	audit.MaxBytes = envInt("AUDIT_MAX_BYTES", audit.MaxBytes)
+	audit.MaxFiles = envInt("AUDIT_MAX_FILES", audit.MaxFiles)
+	audit.Salt = envString("AUDIT_SALT", audit.Salt)
+
+	cfg.Stats.File = envString("STATS_FILE", cfg.Stats.File)
+	cfg.AsyncGames.File = envString("ASYNC_GAMES_FILE", cfg.AsyncGames.File)
+	cfg.Schedule.EarlyOpen = envDuration("ROOM_EARLY_OPEN", cfg.Schedule.EarlyOpen)
+
+	acct := &cfg.Accounts
+	acct.File = envString("ACCOUNTS_FILE", acct.File)
+	acct.SessionSecret = envString("SESSION_SECRET", acct.SessionSecret)
+	acct.SessionTTL = envDuration("SESSION_TTL", acct.SessionTTL)
+
+	cfg.AdminToken = envString("ADMIN_TOKEN", cfg.AdminToken)
+
+	return cfg
+}
+
+// parseICEServers turns a comma-separated URL list into one ICE server per
+// URL, e.g. "stun:stun.example.com:3478,stun:stun2.example.com".
+func parseICEServers(v string) []controllers.ICEServer {
+	var servers []controllers.ICEServer
+	for _, u := range splitList(v) {
+		servers = append(servers, controllers.ICEServer{URLs: []string{u}})
+	}
+	return servers
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("[Config] ignoring %s=%q: %v", key, v, err)
+		return def
+	}
+	return n
+}
+
+func envBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("[Config] ignoring %s=%q: %v", key, v, err)
+		return def
+	}
+	return b
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("[Config] ignoring %s=%q: %v", key, v, err)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/accounts"
+)
+
+// Accounts are optional. Without one a player is whatever random clientID
+// their browser made up; signed in, they play as their account's stable
+// clientID, so assignSlot gives them their slot back from any device. The
+// session is a signed cookie naming the user and its expiry. Account
+// clientIDs (accounts.ClientIDPrefix) are only accepted from a browser
+// signed in as that account.
+
+// AccountsConfig configures user accounts.
+type AccountsConfig struct {
+	// File is the JSON user store; empty disables accounts.
+	File string
+	// SessionSecret signs session cookies. Empty picks a random one at
+	// startup, which signs everyone out on restart.
+	SessionSecret string
+	// SessionTTL is how long a sign-in lasts.
+	SessionTTL time.Duration
+}
+
+// DefaultAccountsConfig leaves accounts off.
+func DefaultAccountsConfig() AccountsConfig {
+	return AccountsConfig{SessionTTL: 30 * 24 * time.Hour}
+}
+
+const accountCookie = "account_session"
+
+var accountTemplatePath = append([]string{templatePath + "account.gohtml"}, baseTemplatePaths...)
+
+// userAccounts holds the store and session key once accounts are enabled.
+type userAccounts struct {
+	store accounts.Store
+	key   []byte
+	ttl   time.Duration
+}
+
+// EnableAccounts turns on sign-in with users kept in store.
+func (tm *TopicManager) EnableAccounts(store accounts.Store, cfg AccountsConfig) error {
+	key := []byte(cfg.SessionSecret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.accounts = &userAccounts{store: store, key: key, ttl: cfg.SessionTTL}
+	return nil
+}
+
+func (tm *TopicManager) userAccounts() *userAccounts {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.accounts
+}
+
+func (ua *userAccounts) sign(payload string) string {
+	mac := hmac.New(sha256.New, ua.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// startSession sets the session cookie for u.
+func (ua *userAccounts) startSession(w http.ResponseWriter, u accounts.User, secure bool) {
+	payload := u.ID + "." + strconv.FormatInt(time.Now().Add(ua.ttl).Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     accountCookie,
+		Value:    payload + "." + ua.sign(payload),
+		Path:     "/",
+		MaxAge:   int(ua.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func endSession(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: accountCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+}
+
+// user returns the signed-in user of r, if any.
+func (ua *userAccounts) user(r *http.Request) (accounts.User, bool) {
+	c, err := r.Cookie(accountCookie)
+	if err != nil {
+		return accounts.User{}, false
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return accounts.User{}, false
+	}
+	payload, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(ua.sign(payload))) {
+		return accounts.User{}, false
+	}
+	id, expiry, ok := strings.Cut(payload, ".")
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if !ok || err != nil || time.Now().Unix() > exp {
+		return accounts.User{}, false
+	}
+	u, err := ua.store.ByID(id)
+	if err != nil {
+		return accounts.User{}, false
+	}
+	return u, true
+}
+
+// currentUser returns the signed-in user of r, if accounts are on.
+func (tm *TopicManager) currentUser(r *http.Request) (accounts.User, bool) {
+	ua := tm.userAccounts()
+	if ua == nil {
+		return accounts.User{}, false
+	}
+	return ua.user(r)
+}
+
+// clientIDAllowed reports whether r may join as clientID: anyone may use
+// a browser-generated ID, but an account's ID needs its session.
+func (tm *TopicManager) clientIDAllowed(r *http.Request, clientID string) bool {
+	if !strings.HasPrefix(clientID, accounts.ClientIDPrefix) {
+		return true
+	}
+	u, ok := tm.currentUser(r)
+	return ok && u.ClientID() == clientID
+}
+
+type accountPage struct {
+	Nonce    string
+	Register bool
+	Username string
+	Next     string
+	Error    string
+}
+
+// safeNext returns next if it is a path on this site, else "/rooms".
+func safeNext(next string) string {
+	if strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") && !strings.HasPrefix(next, "/\\") {
+		return next
+	}
+	return "/rooms"
+}
+
+func renderAccountPage(w http.ResponseWriter, data accountPage, status int) {
+	tmpl, err := parseTemplates(accountTemplatePath...)
+	if err != nil {
+		internalError(err, w)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("[Accounts] render: %v", err)
+	}
+}
+
+// GET /login and /register – the sign-in and sign-up forms.
+func AccountForm(tm *TopicManager, register bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if tm.userAccounts() == nil {
+			http.NotFound(w, r)
+			return
+		}
+		next := safeNext(r.URL.Query().Get("next"))
+		if _, ok := tm.currentUser(r); ok {
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		renderAccountPage(w, accountPage{Nonce: cspNonce(r), Register: register, Next: next}, http.StatusOK)
+	}
+}
+
+// POST /login and /register – check or create the account, then sign in
+// and go to the form's next page.
+func AccountSubmit(tm *TopicManager, cfg Config, register bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ua := tm.userAccounts()
+		if ua == nil {
+			http.NotFound(w, r)
+			return
+		}
+		username, password := r.FormValue("username"), r.FormValue("password")
+		page := accountPage{Nonce: cspNonce(r), Register: register, Username: username, Next: safeNext(r.FormValue("next"))}
+
+		var u accounts.User
+		var err error
+		if register {
+			if password != r.FormValue("confirm") {
+				page.Error = "The passwords don't match."
+				renderAccountPage(w, page, http.StatusBadRequest)
+				return
+			}
+			u, err = accounts.Register(ua.store, username, password)
+		} else {
+			u, err = accounts.Authenticate(ua.store, username, password)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, accounts.ErrInvalidCredentials):
+			page.Error = "Wrong username or password."
+			renderAccountPage(w, page, http.StatusUnauthorized)
+			return
+		case errors.Is(err, accounts.ErrUsernameTaken):
+			page.Error = "That username is taken."
+			renderAccountPage(w, page, http.StatusConflict)
+			return
+		case errors.Is(err, accounts.ErrInvalidUsername), errors.Is(err, accounts.ErrInvalidPassword):
+			page.Error = strings.TrimPrefix(err.Error(), "accounts: ")
+			renderAccountPage(w, page, http.StatusBadRequest)
+			return
+		default:
+			internalError(err, w)
+			return
+		}
+		ua.startSession(w, u, cfg.Security.TLS || r.TLS != nil)
+		http.Redirect(w, r, page.Next, http.StatusSeeOther)
+	}
+}
+
+// POST /logout – sign out.
+func AccountLogout(w http.ResponseWriter, r *http.Request) {
+	endSession(w)
+	http.Redirect(w, r, safeNext(r.FormValue("next")), http.StatusSeeOther)
+}
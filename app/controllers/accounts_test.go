@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/accounts"
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+// newAccountsServer serves the full router with accounts in memory.
+func newAccountsServer(t *testing.T) (*httptest.Server, *TopicManager) {
+	t.Helper()
+	tm := NewTopicManager()
+	if err := tm.EnableAccounts(accounts.NewMemoryStore(), DefaultAccountsConfig()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(Router(tm, DefaultConfig()))
+	t.Cleanup(func() {
+		srv.Close()
+		close(tm.shutdown)
+	})
+	return srv, tm
+}
+
+// browser is an HTTP client with its own cookies, like one device.
+func browser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}
+}
+
+// pageBody reads a response; a failed request reads as status 0.
+func pageBody(resp *http.Response, err error) (int, string) {
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// dialAs joins roomID as clientID with the cookies of client.
+func dialAs(t *testing.T, srv *httptest.Server, client *http.Client, roomID, clientID string) (*roomclient.Client, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := roomclient.Dial(ctx, srv.URL, roomID, clientID,
+		roomclient.WithReconnect(0, 0), roomclient.WithDialer(&websocket.Dialer{Jar: client.Jar}))
+	if err == nil {
+		t.Cleanup(func() { c.Close() })
+	}
+	return c, err
+}
+
+func TestAccountSlotFollowsUserAcrossDevices(t *testing.T) {
+	srv, tm := newAccountsServer(t)
+
+	laptop := browser(t)
+	code, _ := pageBody(laptop.PostForm(srv.URL+"/register", url.Values{
+		"username": {"Alice"}, "password": {"correct horse"}, "confirm": {"correct horse"}, "next": {"/rooms/acctroom"},
+	}))
+	if code != http.StatusOK {
+		t.Fatalf("register: got %d", code)
+	}
+	u, err := tm.userAccounts().store.ByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientID := u.ClientID()
+
+	// Registering signs in and lands on the room page, which plays as the
+	// account's clientID.
+	if _, page := pageBody(laptop.Get(srv.URL + "/rooms/acctroom")); !strings.Contains(page, `data-client-id="`+clientID+`"`) {
+		t.Fatal("room page lacks the account's clientID")
+	}
+
+	host := joinRoom(t, srv.URL, "acctroom", "playeraa")
+	waitFor[roomclient.Peers](t, host)
+	a, err := dialAs(t, srv, laptop, "acctroom", clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := waitFor[roomclient.Peers](t, a); p.MySlot != 1 {
+		t.Fatalf("expected slot 1, got %d", p.MySlot)
+	}
+	a.Close()
+	waitFor[roomclient.PlayerLeft](t, host)
+
+	// Nobody else may use the account's clientID...
+	if _, err := dialAs(t, srv, browser(t), "acctroom", clientID); err == nil {
+		t.Fatal("joined as an account without signing in")
+	}
+
+	// ...but the same user on another device gets their slot back.
+	phone := browser(t)
+	if code, _ := pageBody(phone.PostForm(srv.URL+"/login", url.Values{"username": {"alice"}, "password": {"wrong horse"}})); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: got %d", code)
+	}
+	pageBody(phone.PostForm(srv.URL+"/login", url.Values{"username": {"alice"}, "password": {"correct horse"}}))
+	b, err := dialAs(t, srv, phone, "acctroom", clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := waitFor[roomclient.Peers](t, b); p.MySlot != 1 {
+		t.Fatalf("expected slot 1 on the second device, got %d", p.MySlot)
+	}
+
+	pageBody(phone.PostForm(srv.URL+"/logout", nil))
+	if _, page := pageBody(phone.Get(srv.URL + "/rooms/acctroom")); strings.Contains(page, "data-client-id") {
+		t.Fatal("still signed in after logging out")
+	}
+}
+
+func TestAccountSessionCookies(t *testing.T) {
+	_, tm := newAccountsServer(t)
+	ua := tm.userAccounts()
+	u, err := accounts.Register(ua.store, "bobby", "hunter2hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	ua.startSession(rec, u, true)
+	cookie := rec.Result().Cookies()[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected cookie %+v", cookie)
+	}
+
+	withCookie := func(value string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: accountCookie, Value: value})
+		_, ok := tm.currentUser(req)
+		return ok
+	}
+	if !withCookie(cookie.Value) {
+		t.Fatal("valid session rejected")
+	}
+	forged := strings.Replace(cookie.Value, u.ID, "0000000000000000", 1)
+	if withCookie(forged) {
+		t.Fatal("forged session accepted")
+	}
+	ua.ttl = -time.Minute
+	rec = httptest.NewRecorder()
+	ua.startSession(rec, u, true)
+	if withCookie(rec.Result().Cookies()[0].Value) {
+		t.Fatal("expired session accepted")
+	}
+
+	for next, want := range map[string]string{"/rooms/abc": "/rooms/abc", "//evil.example": "/rooms", "https://evil.example": "/rooms", "": "/rooms"} {
+		if got := safeNext(next); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
@@ -0,0 +1,534 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Admin endpoints live under /admin and need the configured admin token,
+// either as a bearer token or through the session cookie the dashboard's
+// login form sets. With no token configured they do not exist.
+
+const adminCookie = "admin_session"
+
+// A dashboard session cookie is "<nonce>.<expiry-unix>.<signature>",
+// signed with the admin token, so changing the token logs everyone out.
+// The nonce must also still be live in tm.adminSessions: logging out ends
+// the session server-side, and a restart ends them all.
+
+func adminSessionSignature(token, payload string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("admin-session:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// startAdminSession records a new session and returns its cookie value.
+func (tm *TopicManager) startAdminSession(token string, now time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce, expiry := hex.EncodeToString(b), now.Add(adminSessionTTL)
+	tm.mu.Lock()
+	for n, exp := range tm.adminSessions {
+		if now.After(exp) {
+			delete(tm.adminSessions, n)
+		}
+	}
+	tm.adminSessions[nonce] = expiry
+	tm.mu.Unlock()
+	payload := nonce + "." + strconv.FormatInt(expiry.Unix(), 10)
+	return payload + "." + adminSessionSignature(token, payload), nil
+}
+
+// adminSession returns the nonce of the live session value belongs to.
+func (tm *TopicManager) adminSession(token, value string, now time.Time) (string, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, sig := value[:i], value[i+1:]
+	if subtle.ConstantTimeCompare([]byte(sig), []byte(adminSessionSignature(token, payload))) != 1 {
+		return "", false
+	}
+	nonce, expiry, ok := strings.Cut(payload, ".")
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if !ok || err != nil || now.Unix() > exp {
+		return "", false
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if live, ok := tm.adminSessions[nonce]; !ok || now.After(live) {
+		return "", false
+	}
+	return nonce, true
+}
+
+// endAdminSession ends the session value belongs to, if it is live.
+func (tm *TopicManager) endAdminSession(token, value string) {
+	if nonce, ok := tm.adminSession(token, value, time.Now()); ok {
+		tm.mu.Lock()
+		delete(tm.adminSessions, nonce)
+		tm.mu.Unlock()
+	}
+}
+
+// adminAuthorized reports whether r carries the admin token or a live
+// session cookie for it. Cookie-authenticated writes must show they come
+// from our own pages with an Origin or Referer header.
+func (tm *TopicManager) adminAuthorized(r *http.Request, token string) bool {
+	if got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+	}
+	c, err := r.Cookie(adminCookie)
+	if err != nil {
+		return false
+	}
+	if _, ok := tm.adminSession(token, c.Value, time.Now()); !ok {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return sameOrigin(r)
+	}
+	return true
+}
+
+// sameOrigin reports whether r's Origin, or failing that its Referer,
+// names the host it was sent to. Requests with neither fail.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host == r.Host
+}
+
+// requireAdmin wraps an admin handler. Missing or wrong tokens get 401;
+// an unset token makes the endpoint 404 so its existence isn't advertised.
+func requireAdmin(tm *TopicManager, token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !tm.adminAuthorized(r, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// The admin API, under /admin/api, lets operators see and manage live
+// rooms: list rooms with their members and slots, broadcast a notice,
+// disconnect or ban a client, close a room and reset its slot list.
+// cmd/roomctl is its command-line client. Every action is written to the
+// audit log, if one is configured.
+
+// clientBan keeps a client out of every room until lifted. Bans live in
+// memory and end with the process.
+type clientBan struct {
+	ClientID string    `json:"clientID"`
+	Reason   string    `json:"reason,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+type adminMember struct {
+	ClientID string   `json:"clientID"`
+	Name     string   `json:"name,omitempty"`
+	Slot     int      `json:"slot"`
+	Breakout string   `json:"breakout,omitempty"`
+	Presence Presence `json:"presence"`
+	// Link is the member's connection health (see health.go).
+	Link *linkQuality `json:"link,omitempty"`
+}
+
+type adminRoom struct {
+	RoomID  string        `json:"roomID"`
+	Type    string        `json:"type,omitempty"`
+	Mode    string        `json:"mode"`
+	Variant string        `json:"variant,omitempty"`
+	Public  bool          `json:"public"`
+	Code    string        `json:"code,omitempty"`
+	Created *time.Time    `json:"created,omitempty"`
+	Host    string        `json:"host,omitempty"`
+	Members []adminMember `json:"members"`
+	Slots   []string      `json:"slots"`
+	Games   int           `json:"games"`
+	Tables  []gameTable   `json:"tables"`
+}
+
+// admissionError says why clientID may not join roomID, if it may not.
+func (tm *TopicManager) admissionError(roomID, clientID string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if _, banned := tm.bans[clientID]; banned {
+		return errBanned
+	}
+	if _, closed := tm.closedRooms[roomID]; closed {
+		return errRoomClosed
+	}
+	if info, ok := tm.roomInfo[roomID]; ok && !info.Schedule.opensAt(time.Now()).IsZero() {
+		return errRoomNotOpen
+	}
+	return nil
+}
+
+// adminRoomLocked describes one room.
+func (tm *TopicManager) adminRoomLocked(roomID string) adminRoom {
+	r := adminRoom{
+		RoomID:  roomID,
+		Mode:    roomModeMesh,
+		Members: []adminMember{},
+		Slots:   append([]string{}, tm.roomSlots[roomID]...),
+		Games:   len(tm.games[roomID]),
+		Tables:  []gameTable{},
+	}
+	for _, g := range tm.games[roomID] {
+		c := *g
+		c.Roster = append([]string{}, g.Roster...)
+		c.Kicked = append([]int{}, g.Kicked...)
+		r.Tables = append(r.Tables, c)
+	}
+	sort.Slice(r.Tables, func(i, j int) bool { return r.Tables[i].created.Before(r.Tables[j].created) })
+	if info, ok := tm.roomInfo[roomID]; ok {
+		created := info.Created
+		r.Type, r.Mode, r.Variant, r.Public, r.Code, r.Created =
+			info.Type, info.Mode, info.Variant, info.Public, info.Code, &created
+	}
+	members, now := tm.rooms[roomID], time.Now()
+	for slot, id := range r.Slots {
+		if _, ok := members[id]; !ok {
+			continue
+		}
+		if r.Host == "" {
+			r.Host = id
+		}
+		p := tm.presence[roomID][id]
+		m := adminMember{ClientID: id, Name: p.Name, Slot: slot, Presence: p}
+		if q, ok := tm.linkQualityLocked(roomID, id, now); ok {
+			m.Link = &q
+		}
+		if b := tm.breakoutOfLocked(roomID, id); b != mainRoom {
+			m.Breakout = b
+		}
+		r.Members = append(r.Members, m)
+	}
+	return r
+}
+
+// adminRooms lists occupied and registered rooms by ID.
+func (tm *TopicManager) adminRooms() []adminRoom {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	ids := map[string]bool{}
+	for id := range tm.rooms {
+		ids[id] = true
+	}
+	for id := range tm.roomInfo {
+		ids[id] = true
+	}
+	out := make([]adminRoom, 0, len(ids))
+	for id := range ids {
+		out = append(out, tm.adminRoomLocked(id))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RoomID < out[j].RoomID })
+	return out
+}
+
+// adminRoom describes one room; ok is false if it is neither occupied
+// nor registered.
+func (tm *TopicManager) adminRoom(roomID string) (adminRoom, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	_, active := tm.rooms[roomID]
+	_, registered := tm.roomInfo[roomID]
+	if !active && !registered {
+		return adminRoom{}, false
+	}
+	return tm.adminRoomLocked(roomID), true
+}
+
+// sendNotice sends an operator's notice to every member of roomID, or of
+// every room when roomID is empty. It returns how many clients got it.
+func (tm *TopicManager) sendNotice(roomID, text string) int {
+	tm.mu.Lock()
+	targets := map[string][]string{}
+	for id, members := range tm.rooms {
+		if roomID != "" && id != roomID {
+			continue
+		}
+		for clientID := range members {
+			targets[id] = append(targets[id], clientID)
+		}
+	}
+	tm.mu.Unlock()
+	sent := 0
+	for id, clientIDs := range targets {
+		data, err := json.Marshal(announcementMessage{
+			Type:   "announcement",
+			RoomID: id,
+			From:   "server",
+			Text:   text,
+			SentAt: time.Now().UTC(),
+		})
+		if err != nil {
+			continue
+		}
+		for _, clientID := range clientIDs {
+			tm.sendTo(id, clientID, data)
+			sent++
+		}
+	}
+	return sent
+}
+
+// disconnectClient removes clientID's session from roomID.
+func (tm *TopicManager) disconnectClient(roomID, clientID string) bool {
+	tm.mu.Lock()
+	s := tm.sessions[roomID][clientID]
+	tm.mu.Unlock()
+	if s == nil {
+		return false
+	}
+	s.end("disconnected")
+	return true
+}
+
+// banClient bans clientID and removes it from every room it is in.
+func (tm *TopicManager) banClient(clientID, reason string) clientBan {
+	ban := clientBan{ClientID: clientID, Reason: reason, Created: time.Now().UTC()}
+	var ended []*roomSession
+	tm.mu.Lock()
+	tm.bans[clientID] = ban
+	for _, sessions := range tm.sessions {
+		if s := sessions[clientID]; s != nil {
+			ended = append(ended, s)
+		}
+	}
+	tm.mu.Unlock()
+	for _, s := range ended {
+		s.end("banned")
+	}
+	return ban
+}
+
+// unbanClient lifts a ban, reporting whether there was one.
+func (tm *TopicManager) unbanClient(clientID string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	_, ok := tm.bans[clientID]
+	delete(tm.bans, clientID)
+	return ok
+}
+
+func (tm *TopicManager) banList() []clientBan {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	out := make([]clientBan, 0, len(tm.bans))
+	for _, b := range tm.bans {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out
+}
+
+// closeRoom disconnects everyone in roomID, drops its settings, code,
+// chat, breakouts and tables, and keeps it from being rejoined for
+// roomInfoTTL. It returns how many clients were disconnected.
+func (tm *TopicManager) closeRoom(roomID string) int {
+	var ended []*roomSession
+	tm.mu.Lock()
+	for _, s := range tm.sessions[roomID] {
+		ended = append(ended, s)
+	}
+	if info, ok := tm.roomInfo[roomID]; ok && info.Code != "" {
+		delete(tm.roomCodes, info.Code)
+	}
+	delete(tm.roomInfo, roomID)
+	delete(tm.chat, roomID)
+	delete(tm.breakouts, roomID)
+	delete(tm.games, roomID)
+	tm.closedRooms[roomID] = time.Now()
+	tm.mu.Unlock()
+	tm.cards.forget(roomID)
+	for _, s := range ended {
+		s.end("closed")
+	}
+	return len(ended)
+}
+
+// resetSlots drops the slots of clients no longer in roomID, closing up
+// the list, and sends the main room's members a fresh peers message with
+// their new slots.
+func (tm *TopicManager) resetSlots(roomID string) []string {
+	tm.mu.Lock()
+	members := tm.rooms[roomID]
+	slots := []string{}
+	for _, id := range tm.roomSlots[roomID] {
+		if _, ok := members[id]; ok {
+			slots = append(slots, id)
+		}
+	}
+	if len(slots) == 0 {
+		delete(tm.roomSlots, roomID)
+	} else {
+		tm.roomSlots[roomID] = slots
+	}
+	tm.mu.Unlock()
+	for _, id := range tm.scopeMembers(roomID, mainRoom, "") {
+		frames, _, _ := tm.joinFrames(roomID, id)
+		for _, data := range frames {
+			tm.sendTo(roomID, id, data)
+		}
+	}
+	return slots
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[Admin] encode: %v", err)
+	}
+}
+
+// readAdminJSON decodes a small JSON request body into v.
+func readAdminJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// auditAdminAction records an operator's action.
+func (tm *TopicManager) auditAdminAction(roomID, clientID, action string) {
+	tm.auditRecord(auditAdmin, roomID, clientID, map[string]string{"action": action})
+}
+
+// AdminAPI registers the /admin/api routes on r, behind the admin token.
+func AdminAPI(r *mux.Router, tm *TopicManager, token string) {
+	handle := func(path, method string, h http.HandlerFunc) {
+		r.HandleFunc("/admin/api"+path, requireAdmin(tm, token, h)).Methods(method)
+	}
+
+	// GET /admin/api/rooms – every live or registered room.
+	handle("/rooms", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, struct {
+			Rooms []adminRoom `json:"rooms"`
+		}{tm.adminRooms()})
+	})
+
+	// GET /admin/api/rooms/{roomID}
+	handle("/rooms/{roomID}", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		room, ok := tm.adminRoom(mux.Vars(r)["roomID"])
+		if !ok {
+			http.Error(w, "no such room", http.StatusNotFound)
+			return
+		}
+		writeAdminJSON(w, room)
+	})
+
+	// POST /admin/api/notice {"text": "...", "roomID": "..."} – a
+	// maintenance notice to one room, or every room without roomID.
+	handle("/notice", http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text   string `json:"text"`
+			RoomID string `json:"roomID"`
+		}
+		if !readAdminJSON(w, r, &body) {
+			return
+		}
+		text := cleanChatText(body.Text)
+		if text == "" {
+			http.Error(w, "empty notice", http.StatusBadRequest)
+			return
+		}
+		sent := tm.sendNotice(body.RoomID, text)
+		tm.auditAdminAction(body.RoomID, "", "notice")
+		writeAdminJSON(w, map[string]int{"recipients": sent})
+	})
+
+	// POST /admin/api/rooms/{roomID}/close – disconnect everyone and close
+	// the room.
+	handle("/rooms/{roomID}/close", http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		n := tm.closeRoom(roomID)
+		tm.auditAdminAction(roomID, "", "close")
+		writeAdminJSON(w, map[string]int{"disconnected": n})
+	})
+
+	// POST /admin/api/rooms/{roomID}/reset-slots
+	handle("/rooms/{roomID}/reset-slots", http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		slots := tm.resetSlots(roomID)
+		tm.auditAdminAction(roomID, "", "reset-slots")
+		writeAdminJSON(w, map[string][]string{"slots": slots})
+	})
+
+	// POST /admin/api/rooms/{roomID}/clients/{clientID}/disconnect
+	handle("/rooms/{roomID}/clients/{clientID}/disconnect", http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if !tm.disconnectClient(vars["roomID"], vars["clientID"]) {
+			http.Error(w, "client is not connected to that room", http.StatusNotFound)
+			return
+		}
+		tm.auditAdminAction(vars["roomID"], vars["clientID"], "disconnect")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// GET /admin/api/bans
+	handle("/bans", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, struct {
+			Bans []clientBan `json:"bans"`
+		}{tm.banList()})
+	})
+
+	// POST /admin/api/bans {"clientID": "...", "reason": "..."}
+	handle("/bans", http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ClientID string `json:"clientID"`
+			Reason   string `json:"reason"`
+		}
+		if !readAdminJSON(w, r, &body) {
+			return
+		}
+		if !validID(body.ClientID) {
+			http.Error(w, "invalid clientID", http.StatusBadRequest)
+			return
+		}
+		ban := tm.banClient(body.ClientID, body.Reason)
+		tm.auditAdminAction("", body.ClientID, "ban")
+		writeAdminJSON(w, ban)
+	})
+
+	// DELETE /admin/api/bans/{clientID}
+	handle("/bans/{clientID}", http.MethodDelete, func(w http.ResponseWriter, r *http.Request) {
+		clientID := mux.Vars(r)["clientID"]
+		if !tm.unbanClient(clientID) {
+			http.Error(w, "not banned", http.StatusNotFound)
+			return
+		}
+		tm.auditAdminAction("", clientID, "unban")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+// newAdminServer serves the full router with an admin token.
+func newAdminServer(t *testing.T) (*httptest.Server, *TopicManager) {
+	t.Helper()
+	tm := NewTopicManager()
+	cfg := DefaultConfig()
+	cfg.AdminToken = "letmein"
+	srv := httptest.NewServer(Router(tm, cfg))
+	t.Cleanup(func() {
+		srv.Close()
+		close(tm.shutdown)
+	})
+	return srv, tm
+}
+
+// adminCall makes an admin API request and decodes a JSON reply into out.
+func adminCall(t *testing.T, srv *httptest.Server, method, path, body string, out interface{}) int {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, _ := http.NewRequest(method, srv.URL+"/admin/api"+path, r)
+	req.Header.Set("Authorization", "Bearer letmein")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func dialErr(serverURL, roomID, clientID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := roomclient.Dial(ctx, serverURL, roomID, clientID, roomclient.WithReconnect(0, 0))
+	if err == nil {
+		c.Close()
+	}
+	return err
+}
+
+func TestAdminAPIListsRoomsAndSendsNotice(t *testing.T) {
+	srv, tm := newAdminServer(t)
+	tm.registerRoom("adminroom", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "pig", Created: time.Now()})
+	a := joinRoom(t, srv.URL, "adminroom", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoom(t, srv.URL, "adminroom", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+
+	var list struct {
+		Rooms []adminRoom `json:"rooms"`
+	}
+	if code := adminCall(t, srv, http.MethodGet, "/rooms", "", &list); code != http.StatusOK || len(list.Rooms) != 1 {
+		t.Fatalf("got %d with %+v", code, list.Rooms)
+	}
+	r := list.Rooms[0]
+	if r.RoomID != "adminroom" || r.Type != "dice" || r.Host != "playeraa" || len(r.Members) != 2 ||
+		r.Members[1].ClientID != "playerbb" || r.Members[1].Slot != 1 {
+		t.Fatalf("unexpected room %+v", r)
+	}
+	if code := adminCall(t, srv, http.MethodGet, "/rooms/nosuchroom", "", nil); code != http.StatusNotFound {
+		t.Fatalf("unknown room: got %d", code)
+	}
+
+	var sent struct {
+		Recipients int `json:"recipients"`
+	}
+	adminCall(t, srv, http.MethodPost, "/notice", `{"text":"Restarting in 5 minutes"}`, &sent)
+	if sent.Recipients != 2 {
+		t.Fatalf("notice reached %d clients", sent.Recipients)
+	}
+	if n := waitFor[roomclient.Announcement](t, b); n.From != "server" || n.Text != "Restarting in 5 minutes" {
+		t.Fatalf("unexpected notice %+v", n)
+	}
+}
+
+func TestAdminDisconnectBanAndClose(t *testing.T) {
+	srv, tm := newAdminServer(t)
+	a := joinRoom(t, srv.URL, "closeroom", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoom(t, srv.URL, "closeroom", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+	c := joinRoom(t, srv.URL, "closeroom", "playercc")
+	waitFor[roomclient.Peers](t, c)
+
+	if code := adminCall(t, srv, http.MethodPost, "/rooms/closeroom/clients/playerbb/disconnect", "", nil); code != http.StatusNoContent {
+		t.Fatalf("disconnect: got %d", code)
+	}
+	if ev := waitFor[roomclient.Removed](t, b); ev.Reason != "disconnected" {
+		t.Fatalf("unexpected %+v", ev)
+	}
+	if ev := waitFor[roomclient.PlayerLeft](t, a); ev.PeerID != "playerbb" {
+		t.Fatalf("expected playerbb to leave, got %+v", ev)
+	}
+
+	adminCall(t, srv, http.MethodPost, "/bans", `{"clientID":"playercc","reason":"spam"}`, nil)
+	if ev := waitFor[roomclient.Removed](t, c); ev.Reason != "banned" {
+		t.Fatalf("unexpected %+v", ev)
+	}
+	if err := dialErr(srv.URL, "otherroom", "playercc"); err != roomclient.ErrBanned {
+		t.Fatalf("banned client joined: %v", err)
+	}
+	var bans struct {
+		Bans []clientBan `json:"bans"`
+	}
+	if adminCall(t, srv, http.MethodGet, "/bans", "", &bans); len(bans.Bans) != 1 || bans.Bans[0].Reason != "spam" {
+		t.Fatalf("unexpected bans %+v", bans.Bans)
+	}
+	adminCall(t, srv, http.MethodDelete, "/bans/playercc", "", nil)
+	if err := dialErr(srv.URL, "otherroom", "playercc"); err != nil {
+		t.Fatalf("unbanned client refused: %v", err)
+	}
+
+	tm.registerRoom("closeroom", roomInfo{Type: "video", Mode: roomModeMesh, Created: time.Now()})
+	var closed struct {
+		Disconnected int `json:"disconnected"`
+	}
+	adminCall(t, srv, http.MethodPost, "/rooms/closeroom/close", "", &closed)
+	if closed.Disconnected != 1 {
+		t.Fatalf("close disconnected %d clients", closed.Disconnected)
+	}
+	if ev := waitFor[roomclient.Removed](t, a); ev.Reason != "closed" {
+		t.Fatalf("unexpected %+v", ev)
+	}
+	if err := dialErr(srv.URL, "closeroom", "playerdd"); err != roomclient.ErrRoomClosed {
+		t.Fatalf("joined a closed room: %v", err)
+	}
+	if _, ok := tm.adminRoom("closeroom"); ok {
+		t.Fatal("closed room still listed")
+	}
+}
+
+func TestAdminResetSlots(t *testing.T) {
+	srv, _ := newAdminServer(t)
+	a := joinRoom(t, srv.URL, "slotroom", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoom(t, srv.URL, "slotroom", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+	c := joinRoom(t, srv.URL, "slotroom", "playercc")
+	waitFor[roomclient.Peers](t, c)
+	b.Close()
+	waitFor[roomclient.PlayerLeft](t, c)
+
+	var out struct {
+		Slots []string `json:"slots"`
+	}
+	adminCall(t, srv, http.MethodPost, "/rooms/slotroom/reset-slots", "", &out)
+	if strings.Join(out.Slots, ",") != "playeraa,playercc" {
+		t.Fatalf("unexpected slots %v", out.Slots)
+	}
+	if p := waitFor[roomclient.Peers](t, c); p.MySlot != 1 || p.Slots["playercc"] != 1 {
+		t.Fatalf("expected playercc moved to slot 1, got %+v", p)
+	}
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Static assets (/css/, /js/, /wasm/) are fingerprinted at startup: every
+// file gets a content hash, and templates link to "/js/video.<hash>.js" via
+// the asset template func. A request for a hashed URL is served with an
+// immutable Cache-Control, so browsers — phones in particular — never
+// refetch or recompile pig.wasm until it actually changes. Plain URLs keep
+// working with an ETag + no-cache revalidation. Entries remember the size
+// and modification time they were hashed at, so a file rebuilt while the
+// server runs is re-hashed on its next request: its old hashed URL stops
+// being served as immutable, and templates link to the new one.
+
+const (
+	assetHashLen           = 10
+	immutableCacheControl  = "public, max-age=31536000, immutable"
+	revalidateCacheControl = "no-cache"
+)
+
+var (
+	wasmDir = "./app/wasm/"
+
+	staticAssets = newAssetManifest()
+
+	// assetDirs are the top-level directories of staticFS that get
+	// fingerprinted and served.
+	assetDirs = []string{"css", "js", "wasm"}
+
+	// precompressedEncodings lists the sibling suffixes we look for, in
+	// order of preference, when the client advertises support.
+	precompressedEncodings = []struct {
+		token  string
+		suffix string
+	}{
+		{"br", ".br"},
+		{"gzip", ".gz"},
+	}
+)
+
+// staticFS overlays the WASM build directory (read from disk; the builds are
+// too large to embed) onto ffs, so every static asset can be addressed as
+// "css/…", "js/…" or "wasm/…".
+type staticFS struct{}
+
+func (staticFS) Open(name string) (fs.File, error) {
+	if inDir(name, "wasm") {
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, "wasm"), "/")
+		if rel == "" {
+			rel = "."
+		}
+		return os.DirFS(wasmDir).Open(rel)
+	}
+	return ffs.Open(name)
+}
+
+type assetEntry struct {
+	hash string
+	url  string
+	// size and modTime are the file's when it was hashed.
+	size    int64
+	modTime time.Time
+}
+
+// matches reports whether fi is the file the entry was hashed from.
+func (e assetEntry) matches(fi fs.FileInfo) bool {
+	return e.hash != "" && e.size == fi.Size() && e.modTime.Equal(fi.ModTime())
+}
+
+type assetManifest struct {
+	mu     sync.RWMutex
+	byName map[string]assetEntry // "js/video.js" -> entry
+	// byHashed maps "js/video.<hash>.js" -> "js/video.js". Superseded
+	// hashes stay, so pages still linking to them get the current file.
+	byHashed map[string]string
+}
+
+func newAssetManifest() *assetManifest {
+	return &assetManifest{
+		byName:   make(map[string]assetEntry),
+		byHashed: make(map[string]string),
+	}
+}
+
+// load walks the asset directories of fsys and (re)computes every hash.
+// Missing directories are skipped — app/wasm is empty until the WASM build
+// has been run.
+func (m *assetManifest) load(fsys fs.FS) error {
+	byName := make(map[string]assetEntry)
+	byHashed := make(map[string]string)
+
+	for _, dir := range assetDirs {
+		err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if name == dir {
+					return fs.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() || isPrecompressedSibling(name) || strings.HasPrefix(path.Base(name), ".") {
+				return nil
+			}
+			entry, err := hashEntry(fsys, name)
+			if err != nil {
+				return err
+			}
+			byName[name] = entry
+			byHashed[strings.TrimPrefix(entry.url, "/")] = name
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.byName, m.byHashed = byName, byHashed
+	m.mu.Unlock()
+	log.Printf("[Assets] fingerprinted %d static assets", len(byName))
+	return nil
+}
+
+// url returns the fingerprinted URL for a logical asset name such as
+// "js/video.js", falling back to the plain path for unknown assets.
+func (m *assetManifest) url(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if e, ok := m.byName[name]; ok {
+		return e.url
+	}
+	return "/" + name
+}
+
+// resolve maps a requested path to its logical name.
+func (m *assetManifest) resolve(name string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if logical, ok := m.byHashed[name]; ok {
+		return logical
+	}
+	return name
+}
+
+// current returns name's entry, re-hashing the file if it changed since
+// it was hashed or isn't in the manifest yet, and recording the result.
+func (m *assetManifest) current(fsys fs.FS, name string) (assetEntry, error) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return assetEntry{}, err
+	}
+	if fi.IsDir() {
+		return assetEntry{}, fs.ErrNotExist
+	}
+	m.mu.RLock()
+	entry := m.byName[name]
+	m.mu.RUnlock()
+	if entry.matches(fi) {
+		return entry, nil
+	}
+	if entry, err = hashEntry(fsys, name); err != nil {
+		return assetEntry{}, err
+	}
+	m.mu.Lock()
+	m.byName[name] = entry
+	m.byHashed[strings.TrimPrefix(entry.url, "/")] = name
+	m.mu.Unlock()
+	return entry, nil
+}
+
+// hashEntry hashes name and records the size and time it was hashed at.
+func hashEntry(fsys fs.FS, name string) (assetEntry, error) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return assetEntry{}, err
+	}
+	hash, err := hashFile(fsys, name)
+	if err != nil {
+		return assetEntry{}, err
+	}
+	return assetEntry{hash: hash, url: "/" + hashedName(name, hash), size: fi.Size(), modTime: fi.ModTime()}, nil
+}
+
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:assetHashLen], nil
+}
+
+// hashedName inserts hash before the file extension: js/video.js -> js/video.<hash>.js.
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func isPrecompressedSibling(name string) bool {
+	for _, enc := range precompressedEncodings {
+		if strings.HasSuffix(name, enc.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header lists token
+// with a non-zero q value.
+func acceptsEncoding(header, token string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), token) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// assetHandler serves fingerprinted and plain static assets out of fsys,
+// negotiating precompressed .br/.gz siblings by Accept-Encoding.
+func assetHandler(fsys fs.FS, m *assetManifest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requested := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		name := m.resolve(requested)
+		// Files added or rebuilt after startup (e.g. a fresh WASM build) are
+		// hashed here, once, so revalidation still works.
+		entry, err := m.current(fsys, name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		hash := entry.hash
+		// Only the current hashed URL names these exact bytes forever.
+		hashed := entry.url == "/"+requested
+
+		servedName, encoding := name, ""
+		accept := r.Header.Get("Accept-Encoding")
+		for _, enc := range precompressedEncodings {
+			if !acceptsEncoding(accept, enc.token) {
+				continue
+			}
+			// A sibling older than the source was compressed from a
+			// previous build and does not match the hash.
+			if fi, err := fs.Stat(fsys, name+enc.suffix); err == nil && !fi.IsDir() && !fi.ModTime().Before(entry.modTime) {
+				servedName, encoding = name+enc.suffix, enc.token
+				break
+			}
+		}
+
+		f, err := fsys.Open(servedName)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		rs, ok := f.(io.ReadSeeker)
+		if !ok {
+			internalError(errors.New("asset "+servedName+" is not seekable"), w)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Accept-Encoding")
+		if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+			h.Set("Content-Type", ctype)
+		}
+		etag := hash
+		if encoding != "" {
+			h.Set("Content-Encoding", encoding)
+			etag += "-" + encoding
+		}
+		h.Set("ETag", `"`+etag+`"`)
+		if hashed {
+			h.Set("Cache-Control", immutableCacheControl)
+		} else {
+			h.Set("Cache-Control", revalidateCacheControl)
+		}
+
+		http.ServeContent(w, r, name, fi.ModTime(), rs)
+	}
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func newTestAssets(t *testing.T) (fstest.MapFS, *assetManifest) {
+	t.Helper()
+	fsys := fstest.MapFS{
+		"js/video.js":      {Data: []byte("console.log('video');")},
+		"css/app.css":      {Data: []byte("body {}")},
+		"wasm/pig.wasm":    {Data: []byte("\x00asm-raw")},
+		"wasm/pig.wasm.gz": {Data: []byte("gzipped")},
+		"wasm/pig.wasm.br": {Data: []byte("brotli")},
+	}
+	m := newAssetManifest()
+	if err := m.load(fsys); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return fsys, m
+}
+
+func TestAssetManifestHashesURLs(t *testing.T) {
+	_, m := newTestAssets(t)
+
+	url := m.url("js/video.js")
+	if !strings.HasPrefix(url, "/js/video.") || !strings.HasSuffix(url, ".js") || url == "/js/video.js" {
+		t.Fatalf("expected fingerprinted URL, got %s", url)
+	}
+	if got := m.url("js/missing.js"); got != "/js/missing.js" {
+		t.Fatalf("unknown asset should fall back to plain path, got %s", got)
+	}
+	if got := m.url("wasm/pig.wasm.gz"); got != "/wasm/pig.wasm.gz" {
+		t.Fatalf("precompressed siblings should not be fingerprinted, got %s", got)
+	}
+}
+
+func TestAssetHandlerImmutableForHashedURL(t *testing.T) {
+	fsys, m := newTestAssets(t)
+	h := assetHandler(fsys, m)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, m.url("js/video.js"), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != immutableCacheControl {
+		t.Fatalf("expected immutable Cache-Control, got %q", cc)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Fatal("expected ETag header")
+	}
+	if body := rec.Body.String(); body != "console.log('video');" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/js/video.js", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != revalidateCacheControl {
+		t.Fatalf("plain URL should revalidate, got %q", cc)
+	}
+}
+
+func TestAssetHandlerRevalidatesWithETag(t *testing.T) {
+	fsys, m := newTestAssets(t)
+	h := assetHandler(fsys, m)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/css/app.css", nil))
+	etag := rec.Header().Get("ETag")
+
+	req := httptest.NewRequest(http.MethodGet, "/css/app.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+}
+
+func TestAssetHandlerNegotiatesPrecompressed(t *testing.T) {
+	fsys, m := newTestAssets(t)
+	h := assetHandler(fsys, m)
+
+	cases := []struct {
+		accept, encoding, body string
+	}{
+		{"gzip, deflate, br", "br", "brotli"},
+		{"gzip", "gzip", "gzipped"},
+		{"br;q=0, gzip", "gzip", "gzipped"},
+		{"", "", "\x00asm-raw"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, m.url("wasm/pig.wasm"), nil)
+		if c.accept != "" {
+			req.Header.Set("Accept-Encoding", c.accept)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if got := rec.Header().Get("Content-Encoding"); got != c.encoding {
+			t.Errorf("Accept-Encoding %q: got Content-Encoding %q, want %q", c.accept, got, c.encoding)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/wasm" {
+			t.Errorf("Accept-Encoding %q: got Content-Type %q", c.accept, got)
+		}
+		if got := rec.Body.String(); got != c.body {
+			t.Errorf("Accept-Encoding %q: got body %q, want %q", c.accept, got, c.body)
+		}
+	}
+}
+
+func TestAssetHandlerNotFound(t *testing.T) {
+	fsys, m := newTestAssets(t)
+	rec := httptest.NewRecorder()
+	assetHandler(fsys, m)(rec, httptest.NewRequest(http.MethodGet, "/js/nope.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestAssetHandlerNoticesRebuilds(t *testing.T) {
+	fsys, m := newTestAssets(t)
+	h := assetHandler(fsys, m)
+	oldURL := m.url("wasm/pig.wasm")
+
+	fsys["wasm/pig.wasm"] = &fstest.MapFile{Data: []byte("\x00asm-rebuilt"), ModTime: time.Now()}
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, oldURL, nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != revalidateCacheControl {
+		t.Fatalf("stale hashed URL served with %q", cc)
+	}
+	if body := rec.Body.String(); body != "\x00asm-rebuilt" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	newURL := m.url("wasm/pig.wasm")
+	if newURL == oldURL {
+		t.Fatal("manifest still links to the old hash")
+	}
+	// The .br and .gz siblings predate the rebuild, so they are stale.
+	req := httptest.NewRequest(http.MethodGet, newURL, nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" || rec.Body.String() != "\x00asm-rebuilt" {
+		t.Fatalf("served a stale %q sibling: %q", enc, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, newURL, nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != immutableCacheControl {
+		t.Fatalf("new hashed URL served with %q", cc)
+	}
+
+	// Files added after startup are hashed once and then linked by hash.
+	fsys["js/late.js"] = &fstest.MapFile{Data: []byte("late")}
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/js/late.js", nil))
+	if m.url("js/late.js") == "/js/late.js" {
+		t.Fatal("on-demand hash was not cached")
+	}
+}
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/asyncpig"
+)
+
+// Pig by turns, for players who can't be online together: the server
+// keeps each game (see package asyncpig) and rolls the dice, and players
+// take their turn whenever they visit /games/{gameID}. Signed-in players
+// are their account; anyone else is a random key in a cookie, so they
+// keep their seat in that browser. Pages are plain forms and redirects,
+// and a sweeper enforces turn deadlines for games nobody is looking at.
+
+// AsyncGamesConfig configures play-by-turn games.
+type AsyncGamesConfig struct {
+	// File keeps games across restarts; empty keeps them in memory.
+	File string
+}
+
+// DefaultAsyncGamesConfig keeps games in memory.
+func DefaultAsyncGamesConfig() AsyncGamesConfig {
+	return AsyncGamesConfig{}
+}
+
+const (
+	asyncPlayerCookie = "pig_player"
+	asyncGameIDLen    = 10
+	asyncSweepEvery   = time.Minute
+	// Finished games, and games that never filled, are dropped after
+	// asyncGameRetention.
+	asyncGameRetention = 30 * 24 * time.Hour
+	asyncHistoryShown  = 50
+	maxAsyncNameLen    = 32
+	maxAsyncTurnLimit  = 14 * 24 * time.Hour
+)
+
+var (
+	asyncGamesTemplatePath = append([]string{templatePath + "async_games.gohtml"}, baseTemplatePaths...)
+	asyncGameTemplatePath  = append([]string{templatePath + "async_game.gohtml"}, baseTemplatePaths...)
+)
+
+// EnableAsyncGames keeps play-by-turn games in store.
+func (tm *TopicManager) EnableAsyncGames(store asyncpig.Store) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.asyncGames = store
+}
+
+func (tm *TopicManager) asyncStore() asyncpig.Store {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.asyncGames
+}
+
+// sweepAsyncGames times out overdue turns and drops old games until
+// shutdown.
+func (tm *TopicManager) sweepAsyncGames() {
+	ticker := time.NewTicker(asyncSweepEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tm.sweepAsyncGamesOnce(time.Now().UTC())
+		case <-tm.shutdown:
+			return
+		}
+	}
+}
+
+func (tm *TopicManager) sweepAsyncGamesOnce(now time.Time) {
+	store := tm.asyncStore()
+	games, err := store.All()
+	if err != nil {
+		log.Printf("[AsyncGames] sweep: %v", err)
+		return
+	}
+	for _, g := range games {
+		last := g.Ended
+		if last.IsZero() {
+			last = g.Created
+		}
+		switch {
+		case g.Status != asyncpig.StatusPlaying && now.Sub(last) > asyncGameRetention:
+			err = store.Delete(g.ID)
+		case g.Status == asyncpig.StatusPlaying:
+			_, err = tm.expireAsyncGame(g.ID, now)
+		}
+		if err != nil {
+			log.Printf("[AsyncGames] sweep %s: %v", g.ID, err)
+		}
+	}
+}
+
+// expireAsyncGame returns a game after timing out its turn if overdue.
+func (tm *TopicManager) expireAsyncGame(id string, now time.Time) (*asyncpig.Game, error) {
+	store := tm.asyncStore()
+	g, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := g.Deadline(); !ok || now.Before(deadline) {
+		return g, nil
+	}
+	return store.Update(id, func(g *asyncpig.Game) error {
+		g.Expire(now)
+		return nil
+	})
+}
+
+// asyncPlayer identifies the player behind r: their account if signed in,
+// else their browser's player key. With issue set, a browser without a
+// key is given one. ok is false if r has no identity.
+func (tm *TopicManager) asyncPlayer(w http.ResponseWriter, r *http.Request, issue bool, secure bool) (id, name string, ok bool) {
+	if u, signedIn := tm.currentUser(r); signedIn {
+		return u.ClientID(), u.Username, true
+	}
+	var key string
+	if c, err := r.Cookie(asyncPlayerCookie); err == nil && len(c.Value) == 32 {
+		key = c.Value
+	} else if issue {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", "", false
+		}
+		key = hex.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     asyncPlayerCookie,
+			Value:    key,
+			Path:     "/games",
+			MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+			HttpOnly: true,
+			Secure:   secure,
+			SameSite: http.SameSiteLaxMode,
+		})
+	} else {
+		return "", "", false
+	}
+	// Store a hash, so the games file holds nothing that signs anyone in.
+	sum := sha256.Sum256([]byte(key))
+	return "k-" + hex.EncodeToString(sum[:16]), "", true
+}
+
+// asyncName picks the name a player gave, their username, or a seat name.
+func asyncName(given, username string, seat int) string {
+	given = strings.TrimSpace(given)
+	if given == "" {
+		given = username
+	}
+	if given == "" {
+		return "Player " + strconv.Itoa(seat+1)
+	}
+	if r := []rune(given); len(r) > maxAsyncNameLen {
+		given = string(r[:maxAsyncNameLen])
+	}
+	return given
+}
+
+func rollDie() int {
+	return mathrand.IntN(6) + 1
+}
+
+type asyncGameSummary struct {
+	ID      string
+	Variant string
+	Status  string
+	Players []string
+	MyTurn  bool
+}
+
+type asyncGamesPage struct {
+	Nonce string
+	Games []asyncGameSummary
+	Error string
+}
+
+// GET /games – start a game, and the visitor's games.
+func AsyncGames(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page := asyncGamesPage{Nonce: cspNonce(r)}
+		if me, _, ok := tm.asyncPlayer(w, r, false, false); ok {
+			games, err := tm.asyncStore().All()
+			if err != nil {
+				internalError(err, w)
+				return
+			}
+			for i := len(games) - 1; i >= 0; i-- {
+				g := games[i]
+				seat := g.Seat(me)
+				if seat < 0 {
+					continue
+				}
+				s := asyncGameSummary{ID: g.ID, Variant: g.Variant, Status: g.Status,
+					MyTurn: g.Status == asyncpig.StatusPlaying && g.Current == seat}
+				for _, p := range g.Players {
+					s.Players = append(s.Players, p.Name)
+				}
+				page.Games = append(page.Games, s)
+			}
+		}
+		renderAsyncPage(w, asyncGamesTemplatePath, page, http.StatusOK)
+	}
+}
+
+// POST /games – create a game and take its first seat.
+func CreateAsyncGame(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fail := func(msg string) {
+			renderAsyncPage(w, asyncGamesTemplatePath, asyncGamesPage{Nonce: cspNonce(r), Error: msg}, http.StatusBadRequest)
+		}
+		seats, err := strconv.Atoi(r.FormValue("seats"))
+		if err != nil {
+			fail("Pick how many players.")
+			return
+		}
+		var limit time.Duration
+		if v := r.FormValue("turn_limit"); v != "" {
+			if limit, err = time.ParseDuration(v); err != nil || limit < time.Minute || limit > maxAsyncTurnLimit {
+				fail("Turn limits run from 1m to 336h.")
+				return
+			}
+		}
+		id, err := generateRoomID(asyncGameIDLen)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		now := time.Now().UTC()
+		g, err := asyncpig.New(id, r.FormValue("variant"), seats, limit, r.FormValue("on_timeout"), now)
+		if err != nil {
+			fail(strings.TrimPrefix(err.Error(), "asyncpig: "))
+			return
+		}
+		me, username, ok := tm.asyncPlayer(w, r, true, cfg.Security.TLS || r.TLS != nil)
+		if !ok {
+			internalError(errors.New("no player key"), w)
+			return
+		}
+		g.Join(me, asyncName(r.FormValue("name"), username, 0), now)
+		if err := tm.asyncStore().Add(g); err != nil {
+			internalError(err, w)
+			return
+		}
+		log.Printf("[AsyncGames] %s created (%s, %d seats)", id, g.Variant, seats)
+		http.Redirect(w, r, "/games/"+id, http.StatusSeeOther)
+	}
+}
+
+type asyncTurnView struct {
+	Player  string
+	Rolls   [][]int
+	Outcome string
+	Points  int
+	Ended   time.Time
+}
+
+type asyncGamePage struct {
+	Nonce    string
+	Game     *asyncpig.Game
+	MySeat   int
+	MyTurn   bool
+	Deadline time.Time
+	History  []asyncTurnView
+	Error    string
+}
+
+// CanJoin reports whether the visitor may take a seat.
+func (p asyncGamePage) CanJoin() bool {
+	return p.MySeat < 0 && p.Game.Status == asyncpig.StatusWaiting
+}
+
+// CurrentName is the name of the player whose turn it is.
+func (p asyncGamePage) CurrentName() string {
+	return p.Game.Players[p.Game.Current].Name
+}
+
+// WinnerName is the winner's name, or "" if nobody won.
+func (p asyncGamePage) WinnerName() string {
+	if p.Game.Winner < 0 {
+		return ""
+	}
+	return p.Game.Players[p.Game.Winner].Name
+}
+
+func renderAsyncPage(w http.ResponseWriter, paths []string, data any, status int) {
+	tmpl, err := parseTemplates(paths...)
+	if err != nil {
+		internalError(err, w)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("[AsyncGames] render: %v", err)
+	}
+}
+
+// renderAsyncGame shows g to the player me, newest turns first.
+func renderAsyncGame(w http.ResponseWriter, r *http.Request, g *asyncpig.Game, me, errMsg string, status int) {
+	page := asyncGamePage{Nonce: cspNonce(r), Game: g, MySeat: g.Seat(me), Error: errMsg}
+	page.MyTurn = g.Status == asyncpig.StatusPlaying && page.MySeat == g.Current
+	page.Deadline, _ = g.Deadline()
+	for i := len(g.History) - 1; i >= 0 && len(page.History) < asyncHistoryShown; i-- {
+		t := g.History[i]
+		page.History = append(page.History, asyncTurnView{
+			Player: g.Players[t.Player].Name, Rolls: t.Rolls, Outcome: t.Outcome, Points: t.Points, Ended: t.Ended,
+		})
+	}
+	renderAsyncPage(w, asyncGameTemplatePath, page, status)
+}
+
+// GET /games/{gameID} – the game, with the visitor's moves if it is their
+// turn. An overdue turn is timed out first.
+func AsyncGame(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, err := tm.expireAsyncGame(mux.Vars(r)["gameID"], time.Now().UTC())
+		if errors.Is(err, asyncpig.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			internalError(err, w)
+			return
+		}
+		me, _, _ := tm.asyncPlayer(w, r, false, false)
+		renderAsyncGame(w, r, g, me, "", http.StatusOK)
+	}
+}
+
+// POST /games/{gameID}/{action} – join, roll, hold or resign, then back to
+// the game. Moves that aren't allowed re-render the game with the reason.
+func AsyncGameAction(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, action := vars["gameID"], vars["action"]
+		me, username, ok := tm.asyncPlayer(w, r, action == "join", cfg.Security.TLS || r.TLS != nil)
+		now := time.Now().UTC()
+		// Time out an overdue turn first, so it stands even if the move
+		// is refused.
+		if _, err := tm.expireAsyncGame(id, now); errors.Is(err, asyncpig.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			internalError(err, w)
+			return
+		}
+		_, err := tm.asyncStore().Update(id, func(g *asyncpig.Game) error {
+			if !ok {
+				return asyncpig.ErrNotPlayer
+			}
+			switch action {
+			case "join":
+				return g.Join(me, asyncName(r.FormValue("name"), username, len(g.Players)), now)
+			case "roll":
+				return g.Roll(me, now, rollDie)
+			case "hold":
+				return g.Hold(me, now)
+			case "resign":
+				return g.Resign(me, now)
+			}
+			return asyncpig.ErrNotFound
+		})
+		switch {
+		case err == nil:
+			http.Redirect(w, r, "/games/"+id, http.StatusSeeOther)
+		case errors.Is(err, asyncpig.ErrNotFound):
+			http.NotFound(w, r)
+		case errors.Is(err, asyncpig.ErrNotPlayer), errors.Is(err, asyncpig.ErrNotYourTurn),
+			errors.Is(err, asyncpig.ErrNotStarted), errors.Is(err, asyncpig.ErrGameOver),
+			errors.Is(err, asyncpig.ErrGameFull), errors.Is(err, asyncpig.ErrAlreadyJoined),
+			errors.Is(err, asyncpig.ErrMustRoll):
+			msg := strings.TrimPrefix(err.Error(), "asyncpig: ")
+			g, err := tm.asyncStore().Get(id)
+			if err != nil {
+				internalError(err, w)
+				return
+			}
+			renderAsyncGame(w, r, g, me, strings.ToUpper(msg[:1])+msg[1:]+".", http.StatusConflict)
+		default:
+			internalError(err, w)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/asyncpig"
+)
+
+func TestAsyncGameTurns(t *testing.T) {
+	srv, tm := newAccountsServer(t)
+
+	alice, bob := browser(t), browser(t)
+	resp, err := alice.PostForm(srv.URL+"/games", url.Values{"name": {"Alice"}, "variant": {"pig"}, "seats": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameURL := resp.Request.URL.String()
+	code, page := pageBody(resp, nil)
+	if code != http.StatusOK || !strings.Contains(page, "Waiting for 2 players") {
+		t.Fatalf("create: got %d", code)
+	}
+	id := strings.TrimPrefix(resp.Request.URL.Path, "/games/")
+
+	if _, page := pageBody(bob.Get(gameURL)); !strings.Contains(page, "Take a seat") {
+		t.Fatal("no seat offered to a visitor")
+	}
+	pageBody(bob.PostForm(gameURL+"/join", url.Values{"name": {"Bob"}}))
+	if code, page := pageBody(bob.PostForm(gameURL+"/roll", nil)); code != http.StatusConflict || !strings.Contains(page, "Not your turn.") {
+		t.Fatalf("bob rolled on alice's turn: got %d", code)
+	}
+	if code, _ := pageBody(browser(t).PostForm(gameURL+"/roll", nil)); code != http.StatusConflict {
+		t.Fatalf("a stranger rolled: got %d", code)
+	}
+	// Rolls are random: alice either rolls on or busts to bob.
+	if code, page := pageBody(alice.PostForm(gameURL+"/roll", nil)); code != http.StatusOK || !strings.Contains(page, "Alice (you)") {
+		t.Fatalf("alice's roll: got %d", code)
+	}
+
+	g, err := tm.asyncStore().Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Status != asyncpig.StatusPlaying || g.Players[1].Name != "Bob" || len(g.Rolls)+len(g.History) != 1 {
+		t.Fatalf("unexpected game %+v", g)
+	}
+	if _, page := pageBody(alice.Get(srv.URL + "/games")); !strings.Contains(page, "/games/"+id) {
+		t.Fatal("game missing from alice's list")
+	}
+	if code, _ := pageBody(alice.Get(srv.URL + "/games/nosuchgame")); code != http.StatusNotFound {
+		t.Fatalf("unknown game: got %d", code)
+	}
+}
+
+func TestAsyncGameSweep(t *testing.T) {
+	_, tm := newAccountsServer(t)
+	store := tm.asyncStore()
+	start := time.Now().UTC()
+	add := func(id string, seats int) {
+		g, err := asyncpig.New(id, asyncpig.VariantPig, seats, time.Hour, asyncpig.TimeoutForfeit, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Join("k-alice", "Alice", start)
+		g.Join("k-bob", "Bob", start)
+		if err := store.Add(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("overdue001", 2)
+	add("waiting001", 3)
+
+	tm.sweepAsyncGamesOnce(start.Add(2 * time.Hour))
+	if g, _ := store.Get("overdue001"); g.Status != asyncpig.StatusOver || g.Winner != 1 {
+		t.Fatalf("overdue turn not forfeited: %+v", g)
+	}
+	if _, err := store.Get("waiting001"); err != nil {
+		t.Fatal("dropped a new game")
+	}
+
+	tm.sweepAsyncGamesOnce(start.Add(asyncGameRetention + 3*time.Hour))
+	if games, _ := store.All(); len(games) != 0 {
+		t.Fatalf("kept %d old games", len(games))
+	}
+}
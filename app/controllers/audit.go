@@ -0,0 +1,408 @@
+package controllers
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The audit log is an append-only JSONL record of who did what in which
+// room: joins and leaves, slot assignments, host changes, kicks, every
+// game_start and game_event the server relays, and operators' admin API
+// actions. It exists to settle "I was
+// kicked for no reason" and "that game was rigged" after the fact, so it
+// is written synchronously and never edited. Clients are identified by
+// clientID plus a keyed hash of their IP, which links one person's
+// sessions without storing addresses.
+//
+// The live file is audit.jsonl in the configured directory. When it would
+// grow past MaxBytes it becomes audit.jsonl.1, older files shift up, and
+// anything past MaxFiles is deleted.
+
+// AuditConfig configures the audit log.
+type AuditConfig struct {
+	// Dir holds the log files; empty disables auditing.
+	Dir string
+	// MaxBytes is the size at which the live file is rotated.
+	MaxBytes int
+	// MaxFiles is how many rotated files are kept.
+	MaxFiles int
+	// Salt keys the IP hashes. Empty picks a random one at startup, so
+	// hashes only match within one run of the server.
+	Salt string
+}
+
+// DefaultAuditConfig leaves auditing off.
+func DefaultAuditConfig() AuditConfig {
+	return AuditConfig{MaxBytes: 10 << 20, MaxFiles: 5}
+}
+
+const (
+	auditJoin      = "join"
+	auditLeave     = "leave"
+	auditSlot      = "slot"
+	auditRole      = "role"
+	auditKick      = "kick"
+	auditGameStart = "game_start"
+	auditGameEvent = "game_event"
+	auditAdmin     = "admin"
+
+	auditFileName   = "audit.jsonl"
+	maxAuditResults = 1000
+	// recentAuditEntries are kept in memory for the admin dashboard.
+	recentAuditEntries = 50
+)
+
+type auditEntry struct {
+	Time     time.Time       `json:"time"`
+	Type     string          `json:"type"`
+	RoomID   string          `json:"roomID"`
+	ClientID string          `json:"clientID"`
+	IPHash   string          `json:"ipHash,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+type auditLog struct {
+	cfg  AuditConfig
+	salt []byte
+
+	mu   sync.Mutex
+	file *os.File
+	size int
+	// ipHashes of connected clients, "roomID:clientID" -> hash, so entries
+	// about a client carry its hash whoever caused them.
+	ipHashes map[string]string
+	// hosts is the last recorded host of each occupied room.
+	hosts map[string]string
+	// recent holds the latest entries, oldest first, for the dashboard.
+	recent []auditEntry
+}
+
+// EnableAudit starts writing the audit log.
+func (tm *TopicManager) EnableAudit(cfg AuditConfig) error {
+	salt := []byte(cfg.Salt)
+	if len(salt) == 0 {
+		salt = make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return err
+	}
+	a := &auditLog{
+		cfg:      cfg,
+		salt:     salt,
+		ipHashes: make(map[string]string),
+		hosts:    make(map[string]string),
+	}
+	if err := a.open(); err != nil {
+		return err
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.audit = a
+	return nil
+}
+
+func (a *auditLog) path(n int) string {
+	p := filepath.Join(a.cfg.Dir, auditFileName)
+	if n > 0 {
+		p += "." + strconv.Itoa(n)
+	}
+	return p
+}
+
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.path(0), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file, a.size = f, int(info.Size())
+	return nil
+}
+
+// rotate shifts the files up by one and starts a new live file.
+func (a *auditLog) rotate() error {
+	a.file.Close()
+	os.Remove(a.path(a.cfg.MaxFiles))
+	for n := a.cfg.MaxFiles - 1; n >= 0; n-- {
+		if err := os.Rename(a.path(n), a.path(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return a.open()
+}
+
+func (a *auditLog) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// write appends one entry; data is marshalled into its Data field.
+func (a *auditLog) write(typ, roomID, clientID string, data interface{}) {
+	e := auditEntry{Time: time.Now().UTC(), Type: typ, RoomID: roomID, ClientID: clientID}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("[Audit] encode %s: %v", typ, err)
+			return
+		}
+		e.Data = raw
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e.IPHash = a.ipHashes[roomID+":"+clientID]
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if a.size > 0 && a.size+len(line) > a.cfg.MaxBytes {
+		if err := a.rotate(); err != nil {
+			log.Printf("[Audit] rotate: %v", err)
+			return
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += n
+	if err != nil {
+		log.Printf("[Audit] write: %v", err)
+	}
+	a.recent = append(a.recent, e)
+	if len(a.recent) > recentAuditEntries {
+		a.recent = append([]auditEntry{}, a.recent[len(a.recent)-recentAuditEntries:]...)
+	}
+}
+
+// latest returns up to n of the most recent entries, newest first.
+func (a *auditLog) latest(n int) []auditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]auditEntry, 0, n)
+	for i := len(a.recent) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, a.recent[i])
+	}
+	return out
+}
+
+// auditor returns the audit log, or nil when auditing is off.
+func (tm *TopicManager) auditor() *auditLog {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.audit
+}
+
+// auditRecord writes an entry about clientID, if auditing is on.
+func (tm *TopicManager) auditRecord(typ, roomID, clientID string, data interface{}) {
+	if a := tm.auditor(); a != nil {
+		a.write(typ, roomID, clientID, data)
+	}
+}
+
+// auditJoin records a client joining from ip. Its slot and any host
+// change are recorded once assigned.
+func (tm *TopicManager) auditJoin(roomID, clientID, ip string) {
+	a := tm.auditor()
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.ipHashes[roomID+":"+clientID] = a.hashIP(ip)
+	a.mu.Unlock()
+	a.write(auditJoin, roomID, clientID, nil)
+}
+
+// auditLeave records a client leaving.
+func (tm *TopicManager) auditLeave(roomID, clientID string) {
+	a := tm.auditor()
+	if a == nil {
+		return
+	}
+	a.write(auditLeave, roomID, clientID, nil)
+	a.mu.Lock()
+	delete(a.ipHashes, roomID+":"+clientID)
+	a.mu.Unlock()
+	tm.auditHost(roomID)
+}
+
+// auditHost records a change of the room's host after a join or leave.
+func (tm *TopicManager) auditHost(roomID string) {
+	a := tm.auditor()
+	if a == nil {
+		return
+	}
+	host := tm.roomHost(roomID)
+	a.mu.Lock()
+	prev := a.hosts[roomID]
+	if host == "" {
+		delete(a.hosts, roomID)
+	} else {
+		a.hosts[roomID] = host
+	}
+	a.mu.Unlock()
+	if host != "" && host != prev {
+		a.write(auditRole, roomID, host, map[string]string{"role": "host", "previous": prev})
+	}
+}
+
+// auditQuery selects entries.
+type auditQuery struct {
+	RoomID       string
+	Since, Until time.Time
+	Limit        int
+}
+
+func (q auditQuery) matches(e auditEntry) bool {
+	return (q.RoomID == "" || e.RoomID == q.RoomID) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until))
+}
+
+// query returns the latest q.Limit matching entries, oldest first. The
+// files are opened and measured under the lock, so a rotation cannot shift
+// them mid-query, and read without it, so writers are not held up.
+func (a *auditLog) query(q auditQuery) ([]auditEntry, error) {
+	files, err := a.snapshot()
+	defer func() {
+		for _, sf := range files {
+			sf.f.Close()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	out := []auditEntry{}
+	for _, sf := range files {
+		sc := bufio.NewScanner(io.LimitReader(sf.f, sf.size))
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			var e auditEntry
+			if json.Unmarshal(sc.Bytes(), &e) != nil || !q.matches(e) {
+				continue
+			}
+			out = append(out, e)
+			if len(out) > q.Limit {
+				out = out[1:]
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// snapshotFile is one audit file as it stood when a query began.
+type snapshotFile struct {
+	f    *os.File
+	size int64
+}
+
+// snapshot opens the audit files, oldest first, and notes their sizes.
+func (a *auditLog) snapshot() ([]snapshotFile, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var files []snapshotFile
+	for n := a.cfg.MaxFiles; n >= 0; n-- {
+		f, err := os.Open(a.path(n))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return files, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return files, err
+		}
+		files = append(files, snapshotFile{f: f, size: info.Size()})
+	}
+	return files, nil
+}
+
+// clientIP is the address a request came from, as worked out by
+// SecurityHeaders from the trusted proxies; without the middleware it is
+// the peer address.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// parseAuditQuery reads ?room=&since=&until=&limit=; times are RFC 3339.
+func parseAuditQuery(r *http.Request) (auditQuery, error) {
+	v := r.URL.Query()
+	q := auditQuery{RoomID: v.Get("room"), Limit: maxAuditResults}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if s := v.Get(p.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return q, fmt.Errorf("bad %s: %v", p.name, err)
+			}
+			*p.t = t
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("bad limit %q", s)
+		}
+		if n < q.Limit {
+			q.Limit = n
+		}
+	}
+	return q, nil
+}
+
+// GET /admin/audit?room=&since=&until=&limit= – audit entries, oldest
+// first, at most maxAuditResults.
+func AuditLog(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := tm.auditor()
+		if a == nil {
+			http.Error(w, "audit log is disabled", http.StatusNotFound)
+			return
+		}
+		q, err := parseAuditQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := a.query(q)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Entries []auditEntry `json:"entries"`
+		}{entries})
+	}
+}
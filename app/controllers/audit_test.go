@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+func TestAuditRecordsRoomActivity(t *testing.T) {
+	srv, tm := newTestServer(t)
+	if err := tm.EnableAudit(AuditConfig{Dir: t.TempDir(), MaxBytes: 1 << 20, MaxFiles: 2, Salt: "pepper"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := joinRoom(t, srv.URL, "auditroom", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoom(t, srv.URL, "auditroom", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+	a.StartGame("auditgame", "pig", []string{"playeraa", "playerbb"})
+	waitFor[roomclient.GameStart](t, b)
+	b.SendGameEvent("auditgame", map[string]int{"roll": 6})
+	waitFor[roomclient.GameEvent](t, a)
+	a.SendKick("auditgame", 1)
+	waitFor[roomclient.Kick](t, b)
+	a.Close()
+
+	want := []struct{ typ, clientID string }{
+		{auditJoin, "playeraa"}, {auditSlot, "playeraa"}, {auditRole, "playeraa"},
+		{auditJoin, "playerbb"}, {auditSlot, "playerbb"},
+		{auditGameStart, "playeraa"}, {auditGameEvent, "playerbb"}, {auditKick, "playeraa"},
+		{auditLeave, "playeraa"}, {auditRole, "playerbb"},
+	}
+	var entries []auditEntry
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if entries, err = tm.audit.query(auditQuery{RoomID: "auditroom", Limit: 100}); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) >= len(want) {
+			break
+		}
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), entries)
+	}
+	ipHash := tm.audit.hashIP("127.0.0.1")
+	for i, w := range want {
+		e := entries[i]
+		if e.Type != w.typ || e.ClientID != w.clientID || e.IPHash != ipHash {
+			t.Errorf("entry %d: got %s by %s (%s), want %s by %s", i, e.Type, e.ClientID, e.IPHash, w.typ, w.clientID)
+		}
+	}
+	var kick struct {
+		Slot   int    `json:"slot"`
+		Kicked string `json:"kicked"`
+	}
+	if json.Unmarshal(entries[7].Data, &kick); kick.Slot != 1 || kick.Kicked != "playerbb" {
+		t.Fatalf("unexpected kick data %s", entries[7].Data)
+	}
+}
+
+func TestAuditRotatesAndQueriesAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	if err := tm.EnableAudit(AuditConfig{Dir: dir, MaxBytes: 400, MaxFiles: 2}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 12; i++ {
+		room := "roomeven"
+		if i%2 == 1 {
+			room = "roomodd1"
+		}
+		tm.auditRecord(auditGameEvent, room, "playeraa", map[string]int{"n": i})
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit.jsonl.2")); err != nil {
+		t.Fatalf("expected two rotated files: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit.jsonl.3")); err == nil {
+		t.Fatal("kept more rotated files than MaxFiles")
+	}
+
+	cfg := DefaultConfig()
+	cfg.AdminToken = "letmein"
+	get := func(query string) (int, []auditEntry) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?"+query, nil)
+		req.Header.Set("Authorization", "Bearer letmein")
+		rec := httptest.NewRecorder()
+		Router(tm, cfg).ServeHTTP(rec, req)
+		var body struct {
+			Entries []auditEntry `json:"entries"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body.Entries
+	}
+	code, all := get("room=roomodd1")
+	if code != http.StatusOK || len(all) == 0 {
+		t.Fatalf("got %d with %d entries", code, len(all))
+	}
+	for i, e := range all {
+		if e.RoomID != "roomodd1" || (i > 0 && e.Time.Before(all[i-1].Time)) {
+			t.Fatalf("unexpected entries %+v", all)
+		}
+	}
+	if _, got := get("room=roomodd1&limit=2"); len(got) != 2 || got[1].Data == nil || string(got[1].Data) != string(all[len(all)-1].Data) {
+		t.Fatalf("limit should keep the latest entries, got %+v", got)
+	}
+	if _, got := get("until=" + start.Add(-time.Minute).Format(time.RFC3339)); len(got) != 0 {
+		t.Fatalf("expected nothing before the test started, got %d", len(got))
+	}
+	if code, _ := get("since=yesterday"); code != http.StatusBadRequest {
+		t.Fatalf("bad since: got %d", code)
+	}
+}
@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Breakouts split a room into named groups ("tables"). Each member is in
+// the main room or in one breakout; offers, candidates, "room" broadcasts,
+// player_joined/left and the peers message are all scoped to that group,
+// and each breakout keeps its own append-only slot list so it can run its
+// own dice game. The host moves people around; announcements, chat and
+// presence stay room-wide.
+//
+// Breakouts are for mesh rooms only: an SFU room forwards every track to
+// every member, so there is nothing to scope.
+
+const (
+	maxBreakouts     = 20
+	maxBreakoutRunes = 32
+	// mainRoom is the breakout ID of everyone not in a breakout.
+	mainRoom = ""
+)
+
+var (
+	errNotHost          = errors.New("only the host can manage breakouts")
+	errNoBreakouts      = errors.New("breakouts are not available in this room")
+	errTooManyBreakouts = errors.New("too many breakouts")
+	errUnknownBreakout  = errors.New("no such breakout")
+	errUnknownMember    = errors.New("no such member")
+)
+
+type breakout struct {
+	id    string
+	name  string
+	slots []string // index = slot within the breakout
+}
+
+// roomBreakouts is a room's groups plus who is in which. Assignments
+// outlive disconnects, like slots, so a refresh lands the client back at
+// its table.
+type roomBreakouts struct {
+	groups  map[string]*breakout
+	order   []string          // breakout IDs in creation order
+	of      map[string]string // clientID -> breakout ID; absent = main room
+	updated time.Time
+}
+
+// breakoutsMessage is broadcast room-wide whenever groups or their
+// membership change, and sent to joiners of rooms that have breakouts.
+// Members lists only connected clients.
+type breakoutsMessage struct {
+	Type      string          `json:"type"`
+	RoomID    string          `json:"roomID"`
+	Host      string          `json:"host"`
+	Main      []string        `json:"main"`
+	Breakouts []breakoutEntry `json:"breakouts"`
+}
+
+type breakoutEntry struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type breakoutErrorMessage struct {
+	Type   string `json:"type"`
+	RoomID string `json:"roomID"`
+	Error  string `json:"error"`
+}
+
+// announcementMessage is a host's message to the whole room, across
+// breakouts.
+type announcementMessage struct {
+	Type   string    `json:"type"`
+	RoomID string    `json:"roomID"`
+	From   string    `json:"from"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+// breakoutOf returns the breakout clientID is assigned to, or mainRoom.
+func (tm *TopicManager) breakoutOf(roomID, clientID string) string {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.breakoutOfLocked(roomID, clientID)
+}
+
+func (tm *TopicManager) breakoutOfLocked(roomID, clientID string) string {
+	if rb, ok := tm.breakouts[roomID]; ok {
+		// An assignment to a group that no longer exists means the main
+		// room.
+		if id := rb.of[clientID]; rb.groups[id] != nil {
+			return id
+		}
+	}
+	return mainRoom
+}
+
+// scopeMembers returns the connected members of one group in a room,
+// excluding excludeID.
+func (tm *TopicManager) scopeMembers(roomID, breakoutID, excludeID string) []string {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	members := tm.rooms[roomID]
+	result := make([]string, 0, len(members))
+	for id := range members {
+		if id != excludeID && tm.breakoutOfLocked(roomID, id) == breakoutID {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// peersOf returns the other connected members of clientID's group.
+func (tm *TopicManager) peersOf(roomID, clientID string) []string {
+	return tm.scopeMembers(roomID, tm.breakoutOf(roomID, clientID), clientID)
+}
+
+// sameScope reports whether two members are in the same group.
+func (tm *TopicManager) sameScope(roomID, a, b string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.breakoutOfLocked(roomID, a) == tm.breakoutOfLocked(roomID, b)
+}
+
+// assignScopeSlot is assignSlot for clientID's group: the room's slots in
+// the main room, the breakout's own slots otherwise.
+func (tm *TopicManager) assignScopeSlot(roomID, clientID string) (slot int, slots map[string]int) {
+	tm.mu.Lock()
+	var b *breakout
+	if rb, ok := tm.breakouts[roomID]; ok {
+		b = rb.groups[tm.breakoutOfLocked(roomID, clientID)]
+	}
+	if b == nil {
+		tm.mu.Unlock()
+		return tm.assignSlot(roomID, clientID)
+	}
+	defer tm.mu.Unlock()
+	slot = -1
+	for i, member := range b.slots {
+		if member == clientID {
+			slot = i
+			break
+		}
+	}
+	if slot == -1 {
+		slot = len(b.slots)
+		b.slots = append(b.slots, clientID)
+	}
+	slots = make(map[string]int, len(b.slots))
+	for i, member := range b.slots {
+		slots[member] = i
+	}
+	return slot, slots
+}
+
+// hasBreakouts reports whether the room has any breakout groups.
+func (tm *TopicManager) hasBreakouts(roomID string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	rb, ok := tm.breakouts[roomID]
+	return ok && len(rb.groups) > 0
+}
+
+func (tm *TopicManager) createBreakout(roomID, name string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	rb, ok := tm.breakouts[roomID]
+	if !ok {
+		rb = &roomBreakouts{groups: make(map[string]*breakout), of: make(map[string]string)}
+		tm.breakouts[roomID] = rb
+	}
+	if len(rb.groups) >= maxBreakouts {
+		return errTooManyBreakouts
+	}
+	id, err := newBreakoutID()
+	for err == nil && rb.groups[id] != nil {
+		id, err = newBreakoutID()
+	}
+	if err != nil {
+		return err
+	}
+	rb.groups[id] = &breakout{id: id, name: name}
+	rb.order = append(rb.order, id)
+	rb.updated = time.Now()
+	return nil
+}
+
+// newBreakoutID returns a random ID for a breakout.
+func newBreakoutID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// assignBreakout records clientID's new group and reports the old one.
+func (tm *TopicManager) assignBreakout(roomID, clientID, breakoutID string) (from string, err error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	rb, ok := tm.breakouts[roomID]
+	if !ok {
+		return "", errUnknownBreakout
+	}
+	if _, ok := rb.groups[breakoutID]; !ok && breakoutID != mainRoom {
+		return "", errUnknownBreakout
+	}
+	from = rb.of[clientID]
+	if breakoutID == mainRoom {
+		delete(rb.of, clientID)
+	} else {
+		rb.of[clientID] = breakoutID
+	}
+	rb.updated = time.Now()
+	return from, nil
+}
+
+// breakoutAssignees returns everyone assigned to a breakout, connected or
+// not.
+func (tm *TopicManager) breakoutAssignees(roomID, breakoutID string) ([]string, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	rb, ok := tm.breakouts[roomID]
+	if !ok || rb.groups[breakoutID] == nil {
+		return nil, errUnknownBreakout
+	}
+	var ids []string
+	for id, b := range rb.of {
+		if b == breakoutID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// removeBreakout deletes an (emptied) group.
+func (tm *TopicManager) removeBreakout(roomID, breakoutID string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	rb, ok := tm.breakouts[roomID]
+	if !ok {
+		return
+	}
+	delete(rb.groups, breakoutID)
+	for i, id := range rb.order {
+		if id == breakoutID {
+			rb.order = append(rb.order[:i], rb.order[i+1:]...)
+			break
+		}
+	}
+	rb.updated = time.Now()
+}
+
+func (tm *TopicManager) breakoutState(roomID string) breakoutsMessage {
+	host := tm.roomHost(roomID)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	msg := breakoutsMessage{Type: "breakouts", RoomID: roomID, Host: host, Main: []string{}, Breakouts: []breakoutEntry{}}
+	rb := tm.breakouts[roomID]
+	byGroup := make(map[string][]string)
+	for id := range tm.rooms[roomID] {
+		g := tm.breakoutOfLocked(roomID, id)
+		byGroup[g] = append(byGroup[g], id)
+	}
+	for _, ids := range byGroup {
+		sort.Strings(ids)
+	}
+	if byGroup[mainRoom] != nil {
+		msg.Main = byGroup[mainRoom]
+	}
+	if rb != nil {
+		for _, id := range rb.order {
+			members := byGroup[id]
+			if members == nil {
+				members = []string{}
+			}
+			msg.Breakouts = append(msg.Breakouts, breakoutEntry{ID: id, Name: rb.groups[id].name, Members: members})
+		}
+	}
+	return msg
+}
+
+// broadcastBreakouts sends the room's breakout state to every member, if
+// the room has breakouts (or force is set, e.g. after the last one closed).
+func (tm *TopicManager) broadcastBreakouts(roomID string, force bool) {
+	if !force && !tm.hasBreakouts(roomID) {
+		return
+	}
+	data, err := json.Marshal(tm.breakoutState(roomID))
+	if err != nil {
+		return
+	}
+	for _, id := range tm.getRoomMembers(roomID, "") {
+		tm.sendTo(roomID, id, data)
+	}
+}
+
+// moveMember puts a connected or absent member in a new group. The old
+// group sees player_left; if the member is connected it gets the new
+// breakout state followed by a fresh peers message for its new group, and
+// the new group sees player_joined — the same frames as a reconnect.
+func (tm *TopicManager) moveMember(roomID, clientID, breakoutID string) error {
+	from, err := tm.assignBreakout(roomID, clientID, breakoutID)
+	if err != nil || from == breakoutID {
+		return err
+	}
+	if left, err := json.Marshal(playerLeftMessage{Type: "player_left", RoomID: roomID, PeerID: clientID}); err == nil {
+		for _, id := range tm.scopeMembers(roomID, from, clientID) {
+			tm.sendTo(roomID, id, left)
+		}
+	}
+	tm.broadcastBreakouts(roomID, true)
+	if !tm.isMember(roomID, clientID) {
+		return nil
+	}
+	peers, existing := tm.scopedPeers(roomID, clientID)
+	if data, err := json.Marshal(peers); err == nil {
+		tm.sendTo(roomID, clientID, data)
+	}
+	tm.notifyJoined(roomID, clientID, peers.MySlot, peers.Presence[clientID], existing)
+	return nil
+}
+
+func (tm *TopicManager) isMember(roomID, clientID string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	_, ok := tm.rooms[roomID][clientID]
+	return ok
+}
+
+// handleBreakoutFrame applies a host's breakout_create, breakout_move or
+// breakout_close, replying with breakout_error on failure.
+func (s *roomSession) handleBreakoutFrame(typ string, message []byte) {
+	var frame struct {
+		Name       string `json:"name"`
+		ClientID   string `json:"clientID"`
+		BreakoutID string `json:"breakoutID"`
+	}
+	if json.Unmarshal(message, &frame) != nil {
+		return
+	}
+	tm, roomID := s.tm, s.roomID
+	var err error
+	switch {
+	case s.sfu != nil:
+		err = errNoBreakouts
+	case tm.roomHost(roomID) != s.clientID:
+		err = errNotHost
+	case typ == "breakout_create":
+		name := cleanText(frame.Name, maxBreakoutRunes)
+		if name == "" {
+			name = "Table"
+		}
+		if err = tm.createBreakout(roomID, name); err == nil {
+			tm.broadcastBreakouts(roomID, true)
+		}
+	case typ == "breakout_move":
+		if !validID(frame.ClientID) || tm.slotOf(roomID, frame.ClientID) < 0 {
+			err = errUnknownMember
+			break
+		}
+		err = tm.moveMember(roomID, frame.ClientID, frame.BreakoutID)
+	case typ == "breakout_close":
+		var members []string
+		if members, err = tm.breakoutAssignees(roomID, frame.BreakoutID); err == nil {
+			for _, id := range members {
+				tm.moveMember(roomID, id, mainRoom)
+			}
+			tm.removeBreakout(roomID, frame.BreakoutID)
+			tm.broadcastBreakouts(roomID, true)
+		}
+	}
+	if err == nil {
+		return
+	}
+	if data, mErr := json.Marshal(breakoutErrorMessage{Type: "breakout_error", RoomID: roomID, Error: err.Error()}); mErr == nil {
+		tm.sendTo(roomID, s.clientID, data)
+	}
+}
+
+// postAnnouncement broadcasts a host's announcement to the whole room.
+func (s *roomSession) postAnnouncement(message []byte) {
+	var frame struct {
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(message, &frame) != nil || s.tm.roomHost(s.roomID) != s.clientID {
+		return
+	}
+	text := cleanChatText(frame.Text)
+	if text == "" {
+		return
+	}
+	data, err := json.Marshal(announcementMessage{
+		Type:   "announcement",
+		RoomID: s.roomID,
+		From:   s.clientID,
+		Text:   text,
+		SentAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return
+	}
+	for _, id := range s.tm.getRoomMembers(s.roomID, "") {
+		s.tm.sendTo(s.roomID, id, data)
+	}
+}
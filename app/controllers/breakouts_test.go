@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+// waitFor returns c's next event of type T, skipping anything else.
+func waitFor[T roomclient.Event](t *testing.T, c *roomclient.Client) T {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				t.Fatalf("%s: event stream closed", c.ID())
+			}
+			if want, ok := ev.(T); ok {
+				return want
+			}
+		case <-deadline:
+			var zero T
+			t.Fatalf("%s: timed out waiting for %T", c.ID(), zero)
+		}
+	}
+}
+
+// expectNone fails if c receives an event of type T within a short window.
+func expectNone[T roomclient.Event](t *testing.T, c *roomclient.Client) {
+	t.Helper()
+	deadline := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case ev := <-c.Events():
+			if _, ok := ev.(T); ok {
+				t.Fatalf("%s: unexpected %#v", c.ID(), ev)
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
+
+func TestBreakoutsScopeSignalingAndSlots(t *testing.T) {
+	srv, _ := newTestServer(t)
+	host := joinRoom(t, srv.URL, "breakout1", "hostaaa1")
+	waitFor[roomclient.Peers](t, host)
+	b := joinRoom(t, srv.URL, "breakout1", "memberbb")
+	waitFor[roomclient.Peers](t, b)
+	c := joinRoom(t, srv.URL, "breakout1", "membercc")
+	waitFor[roomclient.Peers](t, c)
+
+	// Only the host manages breakouts.
+	c.CreateBreakout("Nope")
+	if other := waitFor[roomclient.Other](t, c); other.Type != "breakout_error" {
+		t.Fatalf("expected breakout_error, got %s", other.Type)
+	}
+
+	host.CreateBreakout("Table 1")
+	layout := waitFor[roomclient.Breakouts](t, host)
+	if len(layout.Groups) != 1 || layout.Groups[0].Name != "Table 1" || layout.Host != "hostaaa1" || len(layout.Main) != 3 {
+		t.Fatalf("unexpected layout %+v", layout)
+	}
+	table := layout.Groups[0].ID
+
+	host.MoveToBreakout("memberbb", table)
+	if left := waitFor[roomclient.PlayerLeft](t, host); left.PeerID != "memberbb" {
+		t.Fatalf("expected memberbb to leave the main room, got %+v", left)
+	}
+	if p := waitFor[roomclient.Peers](t, b); len(p.Peers) != 0 || p.MySlot != 0 {
+		t.Fatalf("unexpected peers for the first at the table: %+v", p)
+	}
+	host.MoveToBreakout("membercc", table)
+	p := waitFor[roomclient.Peers](t, c)
+	if len(p.Peers) != 1 || p.Peers[0] != "memberbb" || p.MySlot != 1 {
+		t.Fatalf("unexpected peers at the table: %+v", p)
+	}
+	waitFor[roomclient.PlayerJoined](t, b)
+
+	// Room broadcasts and direct signals stay inside the table.
+	b.StartGame("tablegame", "pig", nil)
+	waitFor[roomclient.GameStart](t, c)
+	b.SendGameEvent("tablegame", "roll")
+	if ev := waitFor[roomclient.GameEvent](t, c); ev.From != "memberbb" {
+		t.Fatalf("unexpected game event %+v", ev)
+	}
+	host.SendOffer("memberbb", "sdp")
+	expectNone[roomclient.GameEvent](t, host)
+	expectNone[roomclient.Signal](t, b)
+	// Claiming to be someone at the table doesn't get a frame in.
+	host.Send(map[string]string{"type": "offer", "from": "membercc", "to": "memberbb", "roomID": "breakout1", "sdp": `"sdp"`})
+	host.Send(map[string]string{"type": "candidate", "from": "membercc", "to": "room", "roomID": "breakout1"})
+	expectNone[roomclient.Signal](t, b)
+
+	// Announcements cross tables.
+	host.SendAnnouncement("five minutes left")
+	for _, m := range []*roomclient.Client{b, c} {
+		if a := waitFor[roomclient.Announcement](t, m); a.Text != "five minutes left" || a.From != "hostaaa1" {
+			t.Fatalf("unexpected announcement %+v", a)
+		}
+	}
+
+	// Closing the table brings everyone back with their original slots.
+	host.CloseBreakout(table)
+	if p := waitFor[roomclient.Peers](t, b); p.MySlot != 1 {
+		t.Fatalf("expected main-room slot 1 restored, got %+v", p)
+	}
+	if p := waitFor[roomclient.Peers](t, c); p.MySlot != 2 {
+		t.Fatalf("expected main-room slot 2 restored, got %+v", p)
+	}
+	for {
+		layout = waitFor[roomclient.Breakouts](t, host)
+		if len(layout.Groups) == 0 {
+			break
+		}
+	}
+	if len(layout.Main) != 3 {
+		t.Fatalf("unexpected final layout %+v", layout)
+	}
+}
+
+func TestMissingBreakoutMeansMainRoom(t *testing.T) {
+	tm := NewTopicManager()
+	const roomID = "staleBO1"
+	tm.addRoomMember(roomID, "member01")
+	if err := tm.createBreakout(roomID, "Table 1"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// An assignment outliving its group must not take anyone down with it.
+	tm.mu.Lock()
+	tm.breakouts[roomID].of["member01"] = "gone0001"
+	tm.mu.Unlock()
+
+	if id := tm.breakoutOf(roomID, "member01"); id != mainRoom {
+		t.Fatalf("expected the main room, got %q", id)
+	}
+	if slot, slots := tm.assignScopeSlot(roomID, "member01"); slot != 0 || slots["member01"] != 0 {
+		t.Fatalf("expected main-room slot 0, got %d %v", slot, slots)
+	}
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Invite cards are the Open Graph preview images shown when a room link is
+// shared. A card shows the room's type, dice variant, how many people are
+// in it and the host's display name; it is rendered once per distinct
+// state and served from memory until the state changes.
+
+const (
+	cardWidth  = 1200
+	cardHeight = 630
+)
+
+var (
+	cardBackground = color.RGBA{0x12, 0x12, 0x1f, 0xff}
+	cardAccent     = color.RGBA{0x6a, 0x40, 0xb0, 0xff}
+	cardTitle      = color.RGBA{0xe8, 0xd4, 0xff, 0xff}
+	cardText       = color.RGBA{0xa0, 0xa0, 0xcc, 0xff}
+)
+
+// cardState is what a card shows. Its key names the rendered image.
+type cardState struct {
+	Title   string
+	Players int
+	Host    string
+}
+
+func (c cardState) key() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s", c.Title, c.Players, c.Host)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// description is the card's second line, reused for og:description.
+func (c cardState) description() string {
+	s := "Nobody here yet"
+	switch {
+	case c.Players == 1:
+		s = "1 person here"
+	case c.Players > 1:
+		s = fmt.Sprintf("%d people here", c.Players)
+	}
+	if c.Host != "" {
+		s += " · hosted by " + c.Host
+	}
+	return s
+}
+
+// genericCardState is the card for a room that is neither registered nor
+// occupied.
+var genericCardState = cardState{Title: "Video room"}
+
+// roomCardState reads a room's current card contents, and reports whether
+// the room is registered or occupied.
+func (tm *TopicManager) roomCardState(roomID string) (cardState, bool) {
+	host := tm.roomHost(roomID)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	info, registered := tm.roomInfo[roomID]
+	_, occupied := tm.rooms[roomID]
+	if !registered && !occupied {
+		return genericCardState, false
+	}
+	c := cardState{Title: "Video room", Players: len(tm.rooms[roomID])}
+	if registered && info.Type == "dice" {
+		c.Title = "Pig Dice room"
+		if info.Variant == "bigpig" {
+			c.Title = "Big Pig dice room"
+		}
+	}
+	if host != "" {
+		c.Host = tm.presence[roomID][host].Name
+	}
+	return c, true
+}
+
+// cardCache keeps each room's latest rendered card.
+type cardCache struct {
+	mu    sync.Mutex
+	cards map[string]renderedCard // roomID -> card
+}
+
+type renderedCard struct {
+	key string
+	png []byte
+}
+
+// get returns the card for state, rendering it if the room's cached card
+// is for a different state.
+func (cc *cardCache) get(roomID string, state cardState) (renderedCard, error) {
+	key := state.key()
+	cc.mu.Lock()
+	c, ok := cc.cards[roomID]
+	cc.mu.Unlock()
+	if ok && c.key == key {
+		return c, nil
+	}
+	data, err := renderCard(state)
+	if err != nil {
+		return renderedCard{}, err
+	}
+	c = renderedCard{key: key, png: data}
+	cc.mu.Lock()
+	cc.cards[roomID] = c
+	cc.mu.Unlock()
+	return c, nil
+}
+
+var (
+	genericCardOnce sync.Once
+	genericCard     renderedCard
+	genericCardErr  error
+)
+
+// generic returns the one card served for every unknown room. It is
+// rendered once and never stored per room, so made-up room IDs cost
+// nothing.
+func (cc *cardCache) generic() (renderedCard, error) {
+	genericCardOnce.Do(func() {
+		var data []byte
+		data, genericCardErr = renderCard(genericCardState)
+		genericCard = renderedCard{key: genericCardState.key(), png: data}
+	})
+	return genericCard, genericCardErr
+}
+
+// forget drops a room's cached card.
+func (cc *cardCache) forget(roomID string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.cards, roomID)
+}
+
+// roomIDs lists the rooms with a cached card.
+func (cc *cardCache) roomIDs() []string {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	ids := make([]string, 0, len(cc.cards))
+	for roomID := range cc.cards {
+		ids = append(ids, roomID)
+	}
+	return ids
+}
+
+var (
+	cardFontsOnce sync.Once
+	cardFontsErr  error
+	cardBold      *opentype.Font
+	cardRegular   *opentype.Font
+)
+
+func loadCardFonts() error {
+	cardFontsOnce.Do(func() {
+		if cardBold, cardFontsErr = opentype.Parse(gobold.TTF); cardFontsErr != nil {
+			return
+		}
+		cardRegular, cardFontsErr = opentype.Parse(goregular.TTF)
+	})
+	return cardFontsErr
+}
+
+func cardFace(f *opentype.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// drawText writes s at (x, baseline y), shortening it with an ellipsis
+// if it would run past maxWidth.
+func drawText(dst draw.Image, face font.Face, c color.Color, x, y, maxWidth int, s string) {
+	d := &font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: face}
+	if d.MeasureString(s).Ceil() > maxWidth {
+		r := []rune(s)
+		for len(r) > 0 && d.MeasureString(string(r)+"…").Ceil() > maxWidth {
+			r = r[:len(r)-1]
+		}
+		s = string(r) + "…"
+	}
+	d.Dot = fixed.P(x, y)
+	d.DrawString(s)
+}
+
+func renderCard(state cardState) ([]byte, error) {
+	if err := loadCardFonts(); err != nil {
+		return nil, err
+	}
+	title, err := cardFace(cardBold, 84)
+	if err != nil {
+		return nil, err
+	}
+	defer title.Close()
+	body, err := cardFace(cardRegular, 48)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	small, err := cardFace(cardRegular, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer small.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(cardBackground), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 24, cardHeight), image.NewUniform(cardAccent), image.Point{}, draw.Src)
+
+	const left, width = 96, cardWidth - 96*2
+	drawText(img, small, cardText, left, 140, width, "You're invited to join")
+	drawText(img, title, cardTitle, left, 260, width, state.Title)
+	drawText(img, body, cardText, left, 360, width, state.description())
+	drawText(img, small, cardAccent, left, cardHeight-80, width, "josephhammerman.com/rooms")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GET /rooms/{roomID}/card.png – the room's invite preview image. The
+// ETag is the card's state key, so clients and crawlers revalidate cheaply.
+func RoomCard(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		if !validID(roomID) {
+			http.Error(w, "invalid room", http.StatusBadRequest)
+			return
+		}
+		var card renderedCard
+		var err error
+		if state, known := tm.roomCardState(roomID); known {
+			card, err = tm.cards.get(roomID, state)
+		} else {
+			card, err = tm.cards.generic()
+		}
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		etag := `"` + card.key + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(card.png)
+	}
+}
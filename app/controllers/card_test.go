@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomCardCachedPerState(t *testing.T) {
+	tm := NewTopicManager()
+	tm.registerRoom("cardroom1", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "bigpig", Created: time.Now()})
+	r := Router(tm, DefaultConfig())
+
+	fetch := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/rooms/cardroom1/card.png", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := fetch("")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != cardWidth || b.Dy() != cardHeight {
+		t.Fatalf("unexpected card size %v", b)
+	}
+	etag := rec.Header().Get("ETag")
+	if rec := fetch(etag); rec.Code != http.StatusNotModified {
+		t.Fatalf("unchanged card: got %d", rec.Code)
+	}
+
+	// Someone arriving changes the card.
+	tm.addRoomMember("cardroom1", "hostaaa1")
+	tm.assignSlot("cardroom1", "hostaaa1")
+	tm.setPresence("cardroom1", "hostaaa1", Presence{Name: "Ada"})
+	state, _ := tm.roomCardState("cardroom1")
+	if state.Title != "Big Pig dice room" || state.Players != 1 || state.Host != "Ada" {
+		t.Fatalf("unexpected card state %+v", state)
+	}
+	rec = fetch(etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Fatalf("changed card: got %d with ETag %s", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// Made-up rooms all get the same card, and none is cached for them.
+	for _, roomID := range []string{"nosuchroom1", "nosuchroom2"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rooms/"+roomID+"/card.png", nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"`+genericCardState.key()+`"` {
+			t.Fatalf("%s: got %d with ETag %s", roomID, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+	if ids := tm.cards.roomIDs(); len(ids) != 1 || ids[0] != "cardroom1" {
+		t.Fatalf("expected only cardroom1 cached, got %v", ids)
+	}
+}
+
+func TestVideoPageOpenGraphTags(t *testing.T) {
+	tm := NewTopicManager()
+	r := Router(tm, DefaultConfig())
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/rooms/ogroom01", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	state, _ := tm.roomCardState("ogroom01")
+	key := state.key()
+	for _, want := range []string{
+		`<meta property="og:title" content="Video room">`,
+		`<meta property="og:url" content="https://example.com/rooms/ogroom01">`,
+		`<meta property="og:image" content="https://example.com/rooms/ogroom01/card.png?v=` + key + `">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page is missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxChatHistory is how many messages a room keeps; older ones drop off.
+	maxChatHistory = 200
+	// chatHistoryOnJoin is how many recent messages a joining client is sent.
+	chatHistoryOnJoin = 50
+	maxChatRunes      = 2000
+)
+
+// chatMessage is one chat line as stored and broadcast. ID, From, Name and
+// SentAt are filled in by the server, never trusted from the client.
+type chatMessage struct {
+	Type   string    `json:"type"`
+	RoomID string    `json:"roomID"`
+	ID     string    `json:"id"`
+	From   string    `json:"from"`
+	Name   string    `json:"name,omitempty"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+// chatHistoryMessage follows the peers message when the room has history.
+type chatHistoryMessage struct {
+	Type     string        `json:"type"`
+	RoomID   string        `json:"roomID"`
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatDeletedMessage struct {
+	Type   string `json:"type"`
+	RoomID string `json:"roomID"`
+	ID     string `json:"id"`
+}
+
+// chatLog is a room's bounded history. updated drives expiry for rooms
+// without roomInfo.
+type chatLog struct {
+	messages []chatMessage
+	updated  time.Time
+}
+
+// cleanChatText strips control characters other than newlines, trims
+// surrounding space and caps the length.
+func cleanChatText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > maxChatRunes {
+		s = string([]rune(s)[:maxChatRunes])
+	}
+	return s
+}
+
+func newChatID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (tm *TopicManager) appendChat(msg chatMessage) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	l, ok := tm.chat[msg.RoomID]
+	if !ok {
+		l = &chatLog{}
+		tm.chat[msg.RoomID] = l
+	}
+	l.messages = append(l.messages, msg)
+	if n := len(l.messages); n > maxChatHistory {
+		l.messages = append([]chatMessage(nil), l.messages[n-maxChatHistory:]...)
+	}
+	l.updated = time.Now()
+}
+
+// deleteChat removes a message and reports whether it existed.
+func (tm *TopicManager) deleteChat(roomID, id string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	l, ok := tm.chat[roomID]
+	if !ok {
+		return false
+	}
+	for i, m := range l.messages {
+		if m.ID == id {
+			l.messages = append(l.messages[:i], l.messages[i+1:]...)
+			l.updated = time.Now()
+			return true
+		}
+	}
+	return false
+}
+
+// chatHistory returns up to the last n messages, oldest first; n <= 0
+// means all of them.
+func (tm *TopicManager) chatHistory(roomID string, n int) []chatMessage {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	l, ok := tm.chat[roomID]
+	if !ok {
+		return nil
+	}
+	msgs := l.messages
+	if n > 0 && len(msgs) > n {
+		msgs = msgs[len(msgs)-n:]
+	}
+	return append([]chatMessage(nil), msgs...)
+}
+
+// postChat stamps a chat frame from the session's client and broadcasts it
+// to the whole room, sender included, so everyone sees the same ID and time.
+func (s *roomSession) postChat(message []byte) {
+	var frame struct {
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(message, &frame) != nil {
+		return
+	}
+	text := cleanChatText(frame.Text)
+	if text == "" {
+		return
+	}
+	msg := chatMessage{
+		Type:   "chat",
+		RoomID: s.roomID,
+		ID:     newChatID(),
+		From:   s.clientID,
+		Name:   s.tm.roomPresence(s.roomID)[s.clientID].Name,
+		Text:   text,
+		SentAt: time.Now().UTC(),
+	}
+	s.tm.appendChat(msg)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.tm.sendTo(s.roomID, s.clientID, data)
+	for _, memberID := range s.tm.getRoomMembers(s.roomID, s.clientID) {
+		s.tm.sendTo(s.roomID, memberID, data)
+	}
+}
+
+// deleteChatMessage handles a chat_delete frame. Only the room's host may
+// delete; other requests are ignored.
+func (s *roomSession) deleteChatMessage(message []byte) {
+	var frame struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(message, &frame) != nil || frame.ID == "" {
+		return
+	}
+	if s.tm.roomHost(s.roomID) != s.clientID || !s.tm.deleteChat(s.roomID, frame.ID) {
+		return
+	}
+	data, err := json.Marshal(chatDeletedMessage{Type: "chat_deleted", RoomID: s.roomID, ID: frame.ID})
+	if err != nil {
+		return
+	}
+	s.tm.sendTo(s.roomID, s.clientID, data)
+	for _, memberID := range s.tm.getRoomMembers(s.roomID, s.clientID) {
+		s.tm.sendTo(s.roomID, memberID, data)
+	}
+}
+
+// ChatExport serves a room's full chat history as a JSON download.
+func ChatExport(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		if !validID(roomID) {
+			http.Error(w, "invalid room", http.StatusBadRequest)
+			return
+		}
+		messages := tm.chatHistory(roomID, 0)
+		if messages == nil {
+			messages = []chatMessage{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="chat-`+roomID+`.json"`)
+		json.NewEncoder(w).Encode(struct {
+			RoomID     string        `json:"roomID"`
+			ExportedAt time.Time     `json:"exportedAt"`
+			Messages   []chatMessage `json:"messages"`
+		}{roomID, time.Now().UTC(), messages})
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+func TestChatHistoryAndHostDelete(t *testing.T) {
+	srv, tm := newTestServer(t)
+
+	host := joinRoom(t, srv.URL, "chatroom1", "hostaaa1")
+	nextEvent(t, host)
+	guest := joinRoom(t, srv.URL, "chatroom1", "guestbb1")
+	nextEvent(t, guest)
+	nextEvent(t, host) // player_joined
+
+	if err := guest.SendChat("  hello\x07 room  "); err != nil {
+		t.Fatal(err)
+	}
+	var sent roomclient.Chat
+	for _, c := range []*roomclient.Client{guest, host} {
+		msg, ok := nextEvent(t, c).(roomclient.Chat)
+		if !ok || msg.Text != "hello room" || msg.From != "guestbb1" || msg.ID == "" || msg.SentAt.IsZero() {
+			t.Fatalf("%s: unexpected chat %+v", c.ID(), msg)
+		}
+		sent = msg
+	}
+
+	late := joinRoom(t, srv.URL, "chatroom1", "lateccc1")
+	history, ok := nextEvent(t, late, "Peers").(roomclient.ChatHistory)
+	if !ok || len(history.Messages) != 1 || history.Messages[0].ID != sent.ID {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	// A guest can't delete; the host can.
+	guest.DeleteChat(sent.ID)
+	host.DeleteChat(sent.ID)
+	del, ok := nextEvent(t, late, "PlayerJoined").(roomclient.ChatDeleted)
+	if !ok || del.ID != sent.ID {
+		t.Fatalf("expected chat_deleted, got %+v", del)
+	}
+	if got := tm.chatHistory("chatroom1", 0); len(got) != 0 {
+		t.Fatalf("history not emptied: %+v", got)
+	}
+}
+
+func TestChatHistoryBoundedAndExported(t *testing.T) {
+	tm := NewTopicManager()
+	defer close(tm.shutdown)
+	for i := 0; i < maxChatHistory+5; i++ {
+		tm.appendChat(chatMessage{Type: "chat", RoomID: "export01", ID: fmt.Sprint(i), Text: "hi", SentAt: time.Now()})
+	}
+	if got := tm.chatHistory("export01", 0); len(got) != maxChatHistory || got[0].ID != "5" {
+		t.Fatalf("history not bounded: %d messages, first %s", len(got), got[0].ID)
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/rooms/export01/chat.json", nil), map[string]string{"roomID": "export01"})
+	rec := httptest.NewRecorder()
+	ChatExport(tm)(rec, req)
+	var body struct {
+		RoomID   string        `json:"roomID"`
+		Messages []chatMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RoomID != "export01" || len(body.Messages) != maxChatHistory {
+		t.Fatalf("unexpected export %s with %d messages", body.RoomID, len(body.Messages))
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), "chat-export01.json") {
+		t.Fatalf("missing attachment header: %q", rec.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestChatExpiresWithRoom(t *testing.T) {
+	tm := NewTopicManager()
+	defer close(tm.shutdown)
+	tm.appendChat(chatMessage{RoomID: "expire01", ID: "a"})
+	tm.registerRoom("expire01", roomInfo{Created: time.Now().Add(-2 * roomInfoTTL)})
+	tm.chat["expire01"].updated = time.Now().Add(-2 * roomInfoTTL)
+
+	tm.cleanupTopics()
+	if _, ok := tm.chat["expire01"]; ok {
+		t.Fatal("chat outlived its room")
+	}
+}
@@ -0,0 +1,33 @@
+package controllers
+
+// Config holds the server's tunable settings. Start from DefaultConfig and
+// override what the deployment needs.
+type Config struct {
+	Security   SecurityConfig
+	ICE        ICEConfig
+	SFU        SFUConfig
+	Webhooks   WebhookConfig
+	Audit      AuditConfig
+	Accounts   AccountsConfig
+	Stats      StatsConfig
+	AsyncGames AsyncGamesConfig
+	Schedule   ScheduleConfig
+	// AdminToken guards the /admin endpoints; empty disables them.
+	AdminToken string
+}
+
+// DefaultConfig returns the settings the site runs with when nothing is
+// overridden.
+func DefaultConfig() Config {
+	return Config{
+		Security:   DefaultSecurityConfig(),
+		ICE:        DefaultICEConfig(),
+		SFU:        DefaultSFUConfig(),
+		Webhooks:   DefaultWebhookConfig(),
+		Audit:      DefaultAuditConfig(),
+		Accounts:   DefaultAccountsConfig(),
+		Stats:      DefaultStatsConfig(),
+		AsyncGames: DefaultAsyncGamesConfig(),
+		Schedule:   DefaultScheduleConfig(),
+	}
+}
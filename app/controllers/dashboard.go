@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// The admin dashboard (/admin) is a page over the admin API: live server
+// and room counts, a drill-down into each room's members, slots, presence
+// and game tables, recent audit entries, and buttons to close rooms, kick
+// members and broadcast notices. It logs in with the admin token, which
+// it trades for a session cookie, and refreshes from an SSE stream of
+// snapshots (/admin/events).
+
+var adminTemplatePath = append([]string{templatePath + "admin.gohtml"}, baseTemplatePaths...)
+
+const (
+	dashboardInterval   = 2 * time.Second
+	dashboardAuditCount = 20
+	adminSessionTTL     = 12 * time.Hour
+)
+
+// serverStarted is when the process started, for the dashboard's uptime.
+var serverStarted = time.Now()
+
+type adminPage struct {
+	Nonce    string
+	LoggedIn bool
+	Error    string
+}
+
+// serverHealth is the dashboard's summary line.
+type serverHealth struct {
+	Uptime         string `json:"uptime"`
+	Goroutines     int    `json:"goroutines"`
+	HeapMB         uint64 `json:"heapMB"`
+	Rooms          int    `json:"rooms"`
+	Connections    int    `json:"connections"`
+	SSEConnections int    `json:"sseConnections"`
+	GameTables     int    `json:"gameTables"`
+	Bans           int    `json:"bans"`
+	WebhookQueue   int    `json:"webhookQueue"`
+	Audit          bool   `json:"audit"`
+}
+
+// dashboardSnapshot is one frame of /admin/events.
+type dashboardSnapshot struct {
+	Time   time.Time    `json:"time"`
+	Health serverHealth `json:"health"`
+	Rooms  []adminRoom  `json:"rooms"`
+	Audit  []auditEntry `json:"audit"`
+}
+
+func (tm *TopicManager) health() serverHealth {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	h := serverHealth{
+		Uptime:     time.Since(serverStarted).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		HeapMB:     mem.HeapAlloc >> 20,
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	h.Rooms = len(tm.rooms)
+	for _, members := range tm.rooms {
+		h.Connections += len(members)
+	}
+	h.SSEConnections = len(tm.httpSessions)
+	for _, games := range tm.games {
+		h.GameTables += len(games)
+	}
+	h.Bans = len(tm.bans)
+	if tm.webhooks != nil {
+		h.WebhookQueue = len(tm.webhooks.queue)
+	}
+	h.Audit = tm.audit != nil
+	return h
+}
+
+func (tm *TopicManager) dashboardSnapshot() dashboardSnapshot {
+	s := dashboardSnapshot{
+		Time:   time.Now().UTC(),
+		Health: tm.health(),
+		Rooms:  tm.adminRooms(),
+		Audit:  []auditEntry{},
+	}
+	if a := tm.auditor(); a != nil {
+		s.Audit = a.latest(dashboardAuditCount)
+	}
+	return s
+}
+
+func renderAdminPage(w http.ResponseWriter, data adminPage, status int) {
+	tmpl, err := parseTemplates(adminTemplatePath...)
+	if err != nil {
+		internalError(err, w)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("[Admin] render: %v", err)
+	}
+}
+
+// GET /admin – the dashboard, or its login form.
+func AdminDashboard(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		renderAdminPage(w, adminPage{Nonce: cspNonce(r), LoggedIn: tm.adminAuthorized(r, cfg.AdminToken)}, http.StatusOK)
+	}
+}
+
+// POST /admin/login – trade the admin token for a session cookie.
+func AdminLogin(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.FormValue("token")), []byte(cfg.AdminToken)) != 1 {
+			renderAdminPage(w, adminPage{Nonce: cspNonce(r), Error: "Wrong token."}, http.StatusUnauthorized)
+			return
+		}
+		value, err := tm.startAdminSession(cfg.AdminToken, time.Now())
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     adminCookie,
+			Value:    value,
+			Path:     "/admin",
+			MaxAge:   int(adminSessionTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   cfg.Security.TLS || r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+}
+
+// POST /admin/logout – end the session and drop its cookie.
+func AdminLogout(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(adminCookie); err == nil && cfg.AdminToken != "" {
+			tm.endAdminSession(cfg.AdminToken, c.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: adminCookie, Path: "/admin", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+}
+
+// GET /admin/events – SSE stream of dashboard snapshots, one straight away
+// and then every dashboardInterval.
+func AdminEvents(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			internalError(fmt.Errorf("streaming unsupported by %T", w), w)
+			return
+		}
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		ticker := time.NewTicker(dashboardInterval)
+		defer ticker.Stop()
+		for {
+			data, err := json.Marshal(tm.dashboardSnapshot())
+			if err != nil {
+				log.Printf("[Admin] encode snapshot: %v", err)
+				return
+			}
+			if err := writeSSE(w, "snapshot", data); err != nil {
+				return
+			}
+			flusher.Flush()
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
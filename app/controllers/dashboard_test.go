@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+func TestAdminDashboardLogin(t *testing.T) {
+	srv, _ := newAdminServer(t)
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := http.Get(srv.URL + "/admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), `action="/admin/login"`) || strings.Contains(string(page), "js/admin.") {
+		t.Fatalf("expected the login form, got %d", resp.StatusCode)
+	}
+
+	resp, err = noRedirect.PostForm(srv.URL+"/admin/login", url.Values{"token": {"wrong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || len(resp.Cookies()) != 0 {
+		t.Fatalf("wrong token: got %d with cookies %v", resp.StatusCode, resp.Cookies())
+	}
+
+	resp, err = noRedirect.PostForm(srv.URL+"/admin/login", url.Values{"token": {"letmein"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || len(resp.Cookies()) != 1 {
+		t.Fatalf("login: got %d with cookies %v", resp.StatusCode, resp.Cookies())
+	}
+	cookie := resp.Cookies()[0]
+	if cookie.Name != adminCookie || !cookie.HttpOnly || cookie.Value == "letmein" {
+		t.Fatalf("unexpected cookie %+v", cookie)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin", nil)
+	req.AddCookie(cookie)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `id="admin-rooms"`) || !strings.Contains(string(page), "js/admin.") {
+		t.Fatal("expected the dashboard after logging in")
+	}
+
+	// The cookie works for the API from our own pages only.
+	post := func(origin string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/api/notice", strings.NewReader(`{"text":"hi"}`))
+		req.AddCookie(cookie)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(srv.URL); code != http.StatusOK {
+		t.Fatalf("same-origin notice: got %d", code)
+	}
+	if code := post("https://evil.example"); code != http.StatusUnauthorized {
+		t.Fatalf("cross-origin notice: got %d", code)
+	}
+	if code := post(""); code != http.StatusUnauthorized {
+		t.Fatalf("notice without Origin or Referer: got %d", code)
+	}
+
+	// Logging out ends the session, not just the browser's copy of it.
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/admin/logout", nil)
+	req.AddCookie(cookie)
+	if resp, err = noRedirect.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if code := post(srv.URL); code != http.StatusUnauthorized {
+		t.Fatalf("notice after logout: got %d", code)
+	}
+}
+
+func TestAdminDashboardDisabledWithoutToken(t *testing.T) {
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	h := Router(tm, DefaultConfig())
+	for _, path := range []string{"/admin", "/admin/events"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestAdminEventsStreamsSnapshots(t *testing.T) {
+	srv, tm := newAdminServer(t)
+	tm.registerRoom("dashroom", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "pig", Created: time.Now()})
+	a := joinRoom(t, srv.URL, "dashroom", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoom(t, srv.URL, "dashroom", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+	a.StartGame("dashgame", "pig", []string{"playeraa", "playerbb"})
+	waitFor[roomclient.GameStart](t, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/admin/events", nil)
+	req.Header.Set("Authorization", "Bearer letmein")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	var snap dashboardSnapshot
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		if e, ok := strings.CutPrefix(line, "event: "); ok {
+			event = e
+		} else if data, ok := strings.CutPrefix(line, "data: "); ok && event == "snapshot" {
+			if err := json.Unmarshal([]byte(data), &snap); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	h := snap.Health
+	if h.Rooms != 1 || h.Connections != 2 || h.GameTables != 1 || h.Goroutines == 0 || h.Uptime == "" {
+		t.Fatalf("unexpected health %+v", h)
+	}
+	if len(snap.Rooms) != 1 || len(snap.Rooms[0].Members) != 2 || len(snap.Rooms[0].Tables) != 1 ||
+		snap.Rooms[0].Tables[0].Variant != "pig" {
+		t.Fatalf("unexpected rooms %+v", snap.Rooms)
+	}
+
+	resp, err = http.Get(srv.URL + "/admin/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated stream: got %d", resp.StatusCode)
+	}
+}
+
+func TestAuditLatestIsNewestFirst(t *testing.T) {
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	if err := tm.EnableAudit(AuditConfig{Dir: t.TempDir(), MaxBytes: 1 << 20, MaxFiles: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < recentAuditEntries+5; i++ {
+		tm.auditRecord(auditGameEvent, "someroom", "playeraa", map[string]int{"n": i})
+	}
+	got := tm.dashboardSnapshot().Audit
+	if len(got) != dashboardAuditCount {
+		t.Fatalf("expected %d entries, got %d", dashboardAuditCount, len(got))
+	}
+	var first struct{ N int }
+	json.Unmarshal(got[0].Data, &first)
+	if first.N != recentAuditEntries+4 {
+		t.Fatalf("expected the newest entry first, got %s", got[0].Data)
+	}
+}
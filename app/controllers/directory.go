@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The room directory lists rooms created as public. Rooms are private
+// unless their creator ticked "public"; private rooms are never listed and
+// are only reachable by their link.
+
+const (
+	// quickplayHoldTTL is how long quick play keeps a seat for a player it
+	// sent to a room, so players matched at the same moment don't overfill it.
+	quickplayHoldTTL = 30 * time.Second
+	// maxQuickplayHoldsPerIP caps the seats held at once for one address,
+	// however many client IDs it presents.
+	maxQuickplayHoldsPerIP = 3
+	// maxQuickplayRooms is how many rooms quick play creates per
+	// quickplayRoomWindow; past it players wait for a seat to free up.
+	maxQuickplayRooms   = 20
+	quickplayRoomWindow = time.Minute
+)
+
+var (
+	errTooManyHolds  = errors.New("too many quick-play seats held from this address")
+	errQuickplayBusy = errors.New("quick play is creating too many rooms")
+)
+
+// quickplayHolder identifies who a quick-play seat is held for: the
+// pig_client cookie, which the room is joined with, and the address the
+// request came from.
+type quickplayHolder struct {
+	clientID string
+	ip       string
+}
+
+var browseTemplatePath = append([]string{templatePath + "rooms_browse.gohtml"}, baseTemplatePaths...)
+
+// publicRoom is one directory entry.
+type publicRoom struct {
+	RoomID     string    `json:"roomID"`
+	Type       string    `json:"type"`
+	Mode       string    `json:"mode"`
+	Variant    string    `json:"variant,omitempty"`
+	Players    int       `json:"players"`
+	Capacity   int       `json:"capacity"`
+	SeatsFree  int       `json:"seatsFree"`
+	InProgress bool      `json:"inProgress"`
+	Created    time.Time `json:"created"`
+}
+
+// seatsFreeLocked is the room's capacity less its members and any
+// unexpired quick-play holds for players who have not arrived yet.
+func (tm *TopicManager) seatsFreeLocked(roomID string, info *roomInfo) int {
+	members := tm.rooms[roomID]
+	free := tm.capacityLocked(roomID) - len(members)
+	for holder, until := range info.holds {
+		if _, joined := members[holder.clientID]; joined || time.Now().After(until) {
+			delete(info.holds, holder)
+			continue
+		}
+		free--
+	}
+	if free < 0 {
+		free = 0
+	}
+	return free
+}
+
+// gameInProgressLocked reports whether any table in the room is being played.
+func (tm *TopicManager) gameInProgressLocked(roomID string) bool {
+	for _, g := range tm.games[roomID] {
+		if g.Status == gameStatusPlaying {
+			return true
+		}
+	}
+	return false
+}
+
+// publicRooms lists public rooms, fullest first so browsing players find
+// company, then newest first.
+func (tm *TopicManager) publicRooms() []publicRoom {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	out := []publicRoom{}
+	for roomID, info := range tm.roomInfo {
+		if !info.Public {
+			continue
+		}
+		out = append(out, publicRoom{
+			RoomID:     roomID,
+			Type:       info.Type,
+			Mode:       info.Mode,
+			Variant:    info.Variant,
+			Players:    len(tm.rooms[roomID]),
+			Capacity:   tm.capacityLocked(roomID),
+			SeatsFree:  tm.seatsFreeLocked(roomID, info),
+			InProgress: tm.gameInProgressLocked(roomID),
+			Created:    info.Created,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Players != out[j].Players {
+			return out[i].Players > out[j].Players
+		}
+		return out[i].Created.After(out[j].Created)
+	})
+	return out
+}
+
+// quickplay picks a public dice room for holder: the fullest one with a
+// free seat, preferring rooms without a game in progress and, when variant
+// is set, rooms of that variant. With no match it creates a public dice
+// room, at most maxQuickplayRooms per quickplayRoomWindow. Either way a
+// seat is held for holder for quickplayHoldTTL, replacing any earlier
+// hold; an address holding maxQuickplayHoldsPerIP seats gets
+// errTooManyHolds. It returns the room and its variant.
+func (tm *TopicManager) quickplay(holder quickplayHolder, variant string) (string, string, error) {
+	// A created room is announced after the deferred unlock below.
+	var createdID string
+	var created roomInfo
+	defer func() {
+		if createdID != "" {
+			tm.emit(EventRoomCreated, createdID, roomEventData(created))
+		}
+	}()
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	now, held := time.Now(), 0
+	for _, info := range tm.roomInfo {
+		for h, until := range info.holds {
+			if h == holder || now.After(until) {
+				delete(info.holds, h)
+			} else if h.ip == holder.ip {
+				held++
+			}
+		}
+	}
+	if held >= maxQuickplayHoldsPerIP {
+		return "", "", errTooManyHolds
+	}
+
+	best, bestScore := "", -1
+	for roomID, info := range tm.roomInfo {
+		if !info.Public || info.Type != "dice" || info.Mode != roomModeMesh || !info.Schedule.opensAt(time.Now()).IsZero() {
+			continue
+		}
+		if variant != "" && info.Variant != variant {
+			continue
+		}
+		if tm.seatsFreeLocked(roomID, info) == 0 {
+			continue
+		}
+		// Waiting rooms beat rooms mid-game; then the more players the
+		// better, so matched players end up together.
+		score := len(tm.rooms[roomID]) + len(info.holds)
+		if !tm.gameInProgressLocked(roomID) {
+			score += maxRoomParticipants + 1
+		}
+		if score > bestScore {
+			best, bestScore = roomID, score
+		}
+	}
+
+	if best == "" {
+		if now.Sub(tm.quickplayWindow) > quickplayRoomWindow {
+			tm.quickplayRooms, tm.quickplayWindow = 0, now
+		}
+		if tm.quickplayRooms >= maxQuickplayRooms {
+			return "", "", errQuickplayBusy
+		}
+		tm.quickplayRooms++
+		roomID, err := generateRoomID(12)
+		if err != nil {
+			return "", "", err
+		}
+		if variant == "" {
+			variant = "pig"
+		}
+		created = roomInfo{Type: "dice", Mode: roomModeMesh, Variant: variant, Public: true, Created: now}
+		info := created
+		tm.roomInfo[roomID] = &info
+		best, createdID = roomID, roomID
+	}
+	info := tm.roomInfo[best]
+	if info.holds == nil {
+		info.holds = make(map[quickplayHolder]time.Time)
+	}
+	info.holds[holder] = now.Add(quickplayHoldTTL)
+	return best, info.Variant, nil
+}
+
+// PublicRooms serves GET /api/rooms?public=1. Only public rooms can be
+// listed, so the parameter is required.
+func PublicRooms(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("public") != "1" {
+			http.Error(w, "only public rooms can be listed; add public=1", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Rooms []publicRoom `json:"rooms"`
+		}{tm.publicRooms()})
+	}
+}
+
+type browsePage struct {
+	Rooms []publicRoom
+}
+
+// GET /rooms/browse – the public room directory.
+func BrowseRooms(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := parseTemplates(browseTemplatePath...)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		if err := tmpl.Execute(w, browsePage{Rooms: tm.publicRooms()}); err != nil {
+			internalError(err, w)
+			return
+		}
+	}
+}
+
+// POST /rooms/quickplay – send the player to an open public dice room,
+// creating one if none has a free seat. The optional "variant" form value
+// restricts the match to that variant. The seat is held for the player's
+// pig_client cookie from their address; a clientID query parameter is
+// ignored.
+func QuickPlay(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		variant := ""
+		if v := r.FormValue("variant"); v != "" {
+			variant = normalizeVariant(v)
+		}
+		holder := quickplayHolder{ip: clientIP(r)}
+		if c, err := r.Cookie(clientIDCookie); err == nil && validID(c.Value) {
+			holder.clientID = c.Value
+		} else if holder.clientID, err = anonymousID(); err != nil {
+			internalError(err, w)
+			return
+		}
+		roomID, variant, err := tm.quickplay(holder, variant)
+		switch {
+		case errors.Is(err, errTooManyHolds), errors.Is(err, errQuickplayBusy):
+			http.Error(w, "Too many quick-play requests. Try again in a minute.", http.StatusTooManyRequests)
+			return
+		case err != nil:
+			internalError(err, w)
+			return
+		}
+		http.Redirect(w, r, diceRoomURL(roomID, variant), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicRoomsListsOnlyPublicRooms(t *testing.T) {
+	tm := NewTopicManager()
+	tm.registerRoom("public01", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "bigpig", Public: true, Created: time.Now()})
+	tm.registerRoom("private1", roomInfo{Type: "video", Mode: roomModeMesh, Created: time.Now()})
+	tm.addRoomMember("public01", "playeraa")
+	tm.games["public01"] = map[string]*gameTable{"tableone": {ID: "tableone", Status: gameStatusPlaying}}
+
+	rec := httptest.NewRecorder()
+	PublicRooms(tm).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rooms", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("listing without public=1: got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	PublicRooms(tm).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rooms?public=1", nil))
+	var body struct {
+		Rooms []publicRoom `json:"rooms"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Rooms) != 1 {
+		t.Fatalf("expected only the public room, got %+v", body.Rooms)
+	}
+	r := body.Rooms[0]
+	if r.RoomID != "public01" || r.Variant != "bigpig" || r.Players != 1 ||
+		r.SeatsFree != maxRoomParticipants-1 || !r.InProgress {
+		t.Fatalf("unexpected entry %+v", r)
+	}
+}
+
+// quickplayFrom posts to /rooms/quickplay with clientID's cookie from ip.
+func quickplayFrom(tm *TopicManager, clientID, ip, variant string) *httptest.ResponseRecorder {
+	form := url.Values{"variant": {variant}}
+	req := httptest.NewRequest(http.MethodPost, "/rooms/quickplay", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: clientIDCookie, Value: clientID})
+	req.RemoteAddr = ip + ":4321"
+	rec := httptest.NewRecorder()
+	QuickPlay(tm).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestQuickPlayFillsRoomsThenCreates(t *testing.T) {
+	tm := NewTopicManager()
+	tm.registerRoom("waiting1", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "pig", Public: true, Created: time.Now()})
+	tm.registerRoom("playing1", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "pig", Public: true, Created: time.Now()})
+	tm.registerRoom("hidden01", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "pig", Created: time.Now()})
+	for i := 0; i < 3; i++ {
+		tm.addRoomMember("playing1", "member0"+string(rune('a'+i)))
+	}
+	tm.games["playing1"] = map[string]*gameTable{"tableone": {ID: "tableone", Status: gameStatusPlaying}}
+	tm.addRoomMember("waiting1", "membera1")
+
+	quickplay := func(clientID, ip, variant string) string {
+		t.Helper()
+		rec := quickplayFrom(tm, clientID, ip, variant)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("quickplay: got %d", rec.Code)
+		}
+		loc, _ := url.Parse(rec.Header().Get("Location"))
+		return strings.TrimPrefix(loc.Path, "/rooms/")
+	}
+
+	// A room waiting for players beats a fuller one mid-game.
+	if got := quickplay("seekeraa", "192.0.2.1", ""); got != "waiting1" {
+		t.Fatalf("expected waiting1, got %s", got)
+	}
+	// Held seats count against free seats until they expire or are taken.
+	tm.mu.Lock()
+	free := tm.seatsFreeLocked("waiting1", tm.roomInfo["waiting1"])
+	tm.mu.Unlock()
+	if free != maxRoomParticipants-2 {
+		t.Fatalf("expected the seat held, %d free", free)
+	}
+	// Asking again moves the hold rather than adding one.
+	quickplay("seekeraa", "192.0.2.1", "")
+	tm.mu.Lock()
+	free = tm.seatsFreeLocked("waiting1", tm.roomInfo["waiting1"])
+	tm.mu.Unlock()
+	if free != maxRoomParticipants-2 {
+		t.Fatalf("expected one seat held, %d free", free)
+	}
+	// No public bigpig room exists, so one is made and listed.
+	created := quickplay("seekerbb", "192.0.2.2", "bigpig")
+	if created == "waiting1" || created == "playing1" || created == "hidden01" {
+		t.Fatalf("expected a new room, got %s", created)
+	}
+	found := false
+	for _, r := range tm.publicRooms() {
+		if r.RoomID == created && r.Type == "dice" && r.Variant == "bigpig" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("created room %s not in the directory", created)
+	}
+	// Once the room is full, players go elsewhere.
+	for i := 2; i < maxRoomParticipants; i++ {
+		tm.addRoomMember("waiting1", "filler"+strings.Repeat("x", i))
+	}
+	if got := quickplay("seekercc", "192.0.2.3", "pig"); got != "playing1" {
+		t.Fatalf("expected playing1 once waiting1 is full, got %s", got)
+	}
+}
+
+func TestQuickPlayLimitsHoldsAndRooms(t *testing.T) {
+	tm := NewTopicManager()
+	tm.registerRoom("waiting1", roomInfo{Type: "dice", Mode: roomModeMesh, Variant: "pig", Public: true, Created: time.Now()})
+
+	// Fresh client IDs from one address only hold so many seats.
+	for i := 0; i < maxQuickplayHoldsPerIP; i++ {
+		if rec := quickplayFrom(tm, "seeker0"+string(rune('a'+i)), "192.0.2.1", "pig"); rec.Code != http.StatusSeeOther {
+			t.Fatalf("hold %d: got %d", i, rec.Code)
+		}
+	}
+	if rec := quickplayFrom(tm, "seekerzz", "192.0.2.1", "pig"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the address to be capped, got %d", rec.Code)
+	}
+	if rec := quickplayFrom(tm, "seekerzz", "192.0.2.2", "pig"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("another address: got %d", rec.Code)
+	}
+
+	// Misses create rooms only up to the window's limit.
+	if rec := quickplayFrom(tm, "seekeryy", "198.51.100.1", "bigpig"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("first bigpig room: got %d", rec.Code)
+	}
+	tm.mu.Lock()
+	tm.quickplayRooms = maxQuickplayRooms
+	for roomID, info := range tm.roomInfo {
+		if info.Variant == "bigpig" {
+			delete(tm.roomInfo, roomID)
+		}
+	}
+	tm.mu.Unlock()
+	if rec := quickplayFrom(tm, "seekeryy", "198.51.100.1", "bigpig"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected room creation to be limited, got %d", rec.Code)
+	}
+	tm.mu.Lock()
+	tm.quickplayWindow = time.Now().Add(-2 * quickplayRoomWindow)
+	tm.mu.Unlock()
+	if rec := quickplayFrom(tm, "seekeryy", "198.51.100.1", "bigpig"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("next window: got %d", rec.Code)
+	}
+}
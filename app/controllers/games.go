@@ -0,0 +1,431 @@
+package controllers
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Game tables let several dice games run side by side in one room. The
+// server tracks each table — its ID, host, variant, roster, kicked slots
+// and status — so late joiners and spectators can see every table and
+// rejoining players are put back into theirs. Tables belong to the group
+// (main room or breakout) their host was in when opening them, and only
+// that group sees them.
+//
+// A table's life: the host opens it (game_open), players join or leave
+// while it is open, the host starts it (game_start; the server fills in
+// the roster and echoes it to the whole group), players exchange
+// game_events, the host may kick (player_kick) and reports the end
+// (game_over), every player reports the result (game_result, see
+// stats.go), and the host either starts a new round or closes the table.
+
+const (
+	gameStatusOpen     = "open"
+	gameStatusPlaying  = "playing"
+	gameStatusFinished = "finished"
+
+	maxGamesPerRoom = 10
+)
+
+type gameTable struct {
+	ID      string   `json:"id"`
+	Host    string   `json:"host"`
+	Variant string   `json:"variant"`
+	Status  string   `json:"status"`
+	Roster  []string `json:"roster"`
+	Kicked  []int    `json:"kicked"`
+
+	scope   string
+	created time.Time
+	// started is when the current round began; reports holds each
+	// player's game_result for it until one is recorded.
+	started  time.Time
+	reports  map[string]resultReport
+	recorded bool
+}
+
+// gamesMessage lists a group's tables. It is sent after the peers message
+// and to the whole group whenever a table changes.
+type gamesMessage struct {
+	Type   string      `json:"type"`
+	RoomID string      `json:"roomID"`
+	Games  []gameTable `json:"games"`
+}
+
+// gameStartMessage is the server's normalized game_start, carrying the
+// table's authoritative roster.
+type gameStartMessage struct {
+	Type    string   `json:"type"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	RoomID  string   `json:"roomID"`
+	GameID  string   `json:"gameID"`
+	Roster  []string `json:"roster"`
+	Variant string   `json:"variant"`
+	Kicked  []int    `json:"kicked"`
+}
+
+// gameFrame is the part of a client's game frame the server reads.
+type gameFrame struct {
+	GameID  string   `json:"gameID"`
+	Variant string   `json:"variant"`
+	Roster  []string `json:"roster"`
+	Slot    *int     `json:"slot"`
+	// Winner is the roster index game_over reports as the winner.
+	Winner *int `json:"winner"`
+	// Result is a player's game_result report.
+	Result *gameResult `json:"result"`
+}
+
+func normalizeVariant(v string) string {
+	if v == "bigpig" {
+		return v
+	}
+	return "pig"
+}
+
+func (g *gameTable) inRoster(clientID string) bool {
+	for _, id := range g.Roster {
+		if id == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *gameTable) isKicked(slot int) bool {
+	for _, k := range g.Kicked {
+		if k == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// gamesFor returns copies of the tables visible to a group, oldest first.
+func (tm *TopicManager) gamesFor(roomID, scope string) []gameTable {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	out := []gameTable{}
+	for _, g := range tm.games[roomID] {
+		if g.scope != scope {
+			continue
+		}
+		c := *g
+		c.Roster = append([]string{}, g.Roster...)
+		c.Kicked = append([]int{}, g.Kicked...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].created.Before(out[j].created) })
+	return out
+}
+
+func (tm *TopicManager) gamesMessageFor(roomID, scope string) ([]byte, error) {
+	return json.Marshal(gamesMessage{Type: "games", RoomID: roomID, Games: tm.gamesFor(roomID, scope)})
+}
+
+// broadcastGames sends a group its current tables.
+func (tm *TopicManager) broadcastGames(roomID, scope string) {
+	data, err := tm.gamesMessageFor(roomID, scope)
+	if err != nil {
+		return
+	}
+	for _, id := range tm.scopeMembers(roomID, scope, "") {
+		tm.sendTo(roomID, id, data)
+	}
+}
+
+// updateGame runs fn on a table under the lock. fn reports whether it
+// changed anything; a nil table means the ID is unknown.
+func (tm *TopicManager) updateGame(roomID, gameID string, fn func(g *gameTable) bool) (scope string, changed bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	g := tm.games[roomID][gameID]
+	if g == nil {
+		return "", fn(nil)
+	}
+	return g.scope, fn(g)
+}
+
+// handleGameFrame applies one game frame from the session's client. Frames
+// for unknown tables, from non-players or (for host actions) non-hosts are
+// dropped.
+func (s *roomSession) handleGameFrame(sig signalMessage, message []byte) {
+	var f gameFrame
+	if json.Unmarshal(message, &f) != nil || !validID(f.GameID) {
+		return
+	}
+	tm, roomID, me := s.tm, s.roomID, s.clientID
+	scope := tm.breakoutOf(roomID, me)
+
+	switch sig.Type {
+	case "game_open":
+		tm.mu.Lock()
+		games := tm.games[roomID]
+		if games == nil {
+			games = make(map[string]*gameTable)
+			tm.games[roomID] = games
+		}
+		ok := games[f.GameID] == nil && len(games) < maxGamesPerRoom
+		if ok {
+			games[f.GameID] = &gameTable{
+				ID:      f.GameID,
+				Host:    me,
+				Variant: normalizeVariant(f.Variant),
+				Status:  gameStatusOpen,
+				Roster:  []string{me},
+				Kicked:  []int{},
+				scope:   scope,
+				created: time.Now(),
+			}
+		}
+		tm.mu.Unlock()
+		if ok {
+			tm.broadcastGames(roomID, scope)
+		}
+
+	case "game_join", "game_leave":
+		gScope, changed := tm.updateGame(roomID, f.GameID, func(g *gameTable) bool {
+			if g == nil || g.Status != gameStatusOpen || g.scope != scope || g.Host == me {
+				return false
+			}
+			if sig.Type == "game_join" {
+				if g.inRoster(me) {
+					return false
+				}
+				g.Roster = append(g.Roster, me)
+				return true
+			}
+			for i, id := range g.Roster {
+				if id == me {
+					g.Roster = append(g.Roster[:i], g.Roster[i+1:]...)
+					return true
+				}
+			}
+			return false
+		})
+		if changed {
+			tm.broadcastGames(roomID, gScope)
+		}
+
+	case "game_start":
+		s.startGame(f, scope)
+
+	case "game_event":
+		_, ok := tm.updateGame(roomID, f.GameID, func(g *gameTable) bool {
+			return g != nil && g.Status == gameStatusPlaying && g.inRoster(me)
+		})
+		if !ok {
+			return
+		}
+		tm.auditRecord(auditGameEvent, roomID, me, map[string]interface{}{
+			"gameID": f.GameID,
+			"event":  sig.Event,
+		})
+		s.observeGame(sig, message)
+		s.relay(sig, message)
+
+	case "player_kick":
+		if f.Slot == nil {
+			return
+		}
+		slot := *f.Slot
+		var kicked string
+		gScope, changed := tm.updateGame(roomID, f.GameID, func(g *gameTable) bool {
+			if g == nil || g.Host != me || g.Status != gameStatusPlaying ||
+				slot < 0 || slot >= len(g.Roster) || g.Roster[slot] == me || g.isKicked(slot) {
+				return false
+			}
+			g.Kicked = append(g.Kicked, slot)
+			kicked = g.Roster[slot]
+			return true
+		})
+		if !changed {
+			return
+		}
+		tm.auditRecord(auditKick, roomID, me, map[string]interface{}{
+			"gameID": f.GameID,
+			"slot":   slot,
+			"kicked": kicked,
+		})
+		s.observeGame(sig, message)
+		s.relay(sig, message)
+		tm.broadcastGames(roomID, gScope)
+
+	case "game_result":
+		s.reportGameResult(f)
+
+	case "game_over", "game_close":
+		var gScope string
+		var finished *gameTable
+		closed := false
+		tm.mu.Lock()
+		if g := tm.games[roomID][f.GameID]; g != nil && g.Host == me {
+			gScope = g.scope
+			if sig.Type == "game_close" {
+				delete(tm.games[roomID], f.GameID)
+				closed = true
+			} else if g.Status == gameStatusPlaying {
+				g.Status = gameStatusFinished
+				closed = true
+				c := *g
+				c.Roster = append([]string{}, g.Roster...)
+				finished = &c
+			}
+		}
+		tm.mu.Unlock()
+		if closed {
+			tm.broadcastGames(roomID, gScope)
+		}
+		if finished != nil {
+			data := tm.gameEventData(roomID, *finished)
+			if w := f.Winner; w != nil && *w >= 0 && *w < len(finished.Roster) {
+				data["winner"] = tm.eventPlayers(roomID, finished.Roster[*w:*w+1])[0]
+			}
+			tm.emit(EventGameOver, roomID, data)
+		}
+	}
+}
+
+// startGame handles game_start. The host of a table starts (or restarts)
+// it; a game_start for an unknown ID opens and starts a table in one step
+// with the sender as host. A roster in the frame replaces the table's,
+// limited to members of the host's group; kicked players are left out of
+// a restart.
+func (s *roomSession) startGame(f gameFrame, scope string) {
+	tm, roomID, me := s.tm, s.roomID, s.clientID
+	members := map[string]bool{me: true}
+	for _, id := range tm.scopeMembers(roomID, scope, me) {
+		members[id] = true
+	}
+
+	var start gameStartMessage
+	tm.mu.Lock()
+	games := tm.games[roomID]
+	if games == nil {
+		games = make(map[string]*gameTable)
+		tm.games[roomID] = games
+	}
+	g := games[f.GameID]
+	switch {
+	case g == nil && len(games) < maxGamesPerRoom:
+		g = &gameTable{ID: f.GameID, Host: me, Variant: normalizeVariant(f.Variant), Roster: []string{me}, scope: scope, created: time.Now()}
+		games[f.GameID] = g
+	case g == nil || g.Host != me:
+		tm.mu.Unlock()
+		return
+	}
+	if f.Variant != "" {
+		g.Variant = normalizeVariant(f.Variant)
+	}
+	if f.Roster != nil {
+		roster := []string{}
+		for _, id := range f.Roster {
+			if members[id] {
+				roster = append(roster, id)
+			}
+		}
+		g.Roster = roster
+	} else if g.Status != gameStatusOpen {
+		roster := []string{}
+		for i, id := range g.Roster {
+			if !g.isKicked(i) {
+				roster = append(roster, id)
+			}
+		}
+		g.Roster = roster
+	}
+	g.Status = gameStatusPlaying
+	g.Kicked = []int{}
+	g.started, g.reports, g.recorded = time.Now(), nil, false
+	start = gameStartMessage{
+		Type:    "game_start",
+		From:    me,
+		To:      "room",
+		RoomID:  roomID,
+		GameID:  g.ID,
+		Roster:  append([]string{}, g.Roster...),
+		Variant: g.Variant,
+		Kicked:  []int{},
+	}
+	tm.mu.Unlock()
+
+	data, err := json.Marshal(start)
+	if err != nil {
+		return
+	}
+	tm.auditRecord(auditGameStart, roomID, me, map[string]interface{}{
+		"gameID":  start.GameID,
+		"variant": start.Variant,
+		"roster":  start.Roster,
+	})
+	s.observeGame(signalMessage{Type: start.Type, From: me, To: "room", RoomID: roomID}, data)
+	for _, id := range tm.scopeMembers(roomID, scope, "") {
+		tm.sendTo(roomID, id, data)
+	}
+	tm.broadcastGames(roomID, scope)
+	tm.emit(EventGameStarted, roomID, tm.gameEventData(roomID, gameTable{
+		ID: start.GameID, Host: me, Variant: start.Variant, Roster: start.Roster,
+	}))
+}
+
+// gameEventData describes a table for game events.
+func (tm *TopicManager) gameEventData(roomID string, g gameTable) map[string]interface{} {
+	return map[string]interface{}{
+		"gameID":  g.ID,
+		"host":    g.Host,
+		"variant": g.Variant,
+		"players": tm.eventPlayers(roomID, g.Roster),
+	}
+}
+
+// observeGame feeds a game frame to the room's recording, if any.
+func (s *roomSession) observeGame(sig signalMessage, message []byte) {
+	if s.sfu != nil {
+		s.sfu.observe(s.roomID, sig, message)
+	}
+}
+
+// leaveGames drops a departing member from open tables and removes tables
+// it hosted that are not being played, or that nobody left in the roster
+// is still connected to.
+func (tm *TopicManager) leaveGames(roomID, clientID string) {
+	tm.mu.Lock()
+	members := tm.rooms[roomID]
+	scopes := map[string]bool{}
+	for id, g := range tm.games[roomID] {
+		switch {
+		case g.Host == clientID && g.Status != gameStatusPlaying:
+			delete(tm.games[roomID], id)
+			scopes[g.scope] = true
+		case g.Status == gameStatusOpen && g.inRoster(clientID):
+			for i, r := range g.Roster {
+				if r == clientID {
+					g.Roster = append(g.Roster[:i], g.Roster[i+1:]...)
+					break
+				}
+			}
+			scopes[g.scope] = true
+		case g.Status != gameStatusOpen:
+			connected := false
+			for _, r := range g.Roster {
+				if _, ok := members[r]; ok {
+					connected = true
+					break
+				}
+			}
+			if !connected {
+				delete(tm.games[roomID], id)
+				scopes[g.scope] = true
+			}
+		}
+	}
+	if len(tm.games[roomID]) == 0 {
+		delete(tm.games, roomID)
+	}
+	tm.mu.Unlock()
+	for scope := range scopes {
+		tm.broadcastGames(roomID, scope)
+	}
+}
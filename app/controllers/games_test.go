@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+// waitGames returns c's next table list that satisfies ok.
+func waitGames(t *testing.T, c *roomclient.Client, ok func([]roomclient.Game) bool) []roomclient.Game {
+	t.Helper()
+	for {
+		if g := waitFor[roomclient.Games](t, c); ok(g.Games) {
+			return g.Games
+		}
+	}
+}
+
+func TestGameTablesLobbyAndIsolation(t *testing.T) {
+	srv, _ := newTestServer(t)
+	a := joinRoom(t, srv.URL, "tables01", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoom(t, srv.URL, "tables01", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+	c := joinRoom(t, srv.URL, "tables01", "playercc")
+	waitFor[roomclient.Peers](t, c)
+
+	// Two tables: a hosts one that b joins, c hosts another alone.
+	a.OpenGame("tableone", "bigpig")
+	waitGames(t, c, func(g []roomclient.Game) bool { return len(g) == 1 })
+	c.OpenGame("tabletwo", "pig")
+	b.JoinGame("tableone")
+	waitGames(t, a, func(g []roomclient.Game) bool {
+		return len(g) == 2 && len(g[0].Roster) == 2
+	})
+
+	// Only the table's host can start it.
+	b.StartGame("tableone", "", nil)
+	a.StartGame("tableone", "", nil)
+	start := waitFor[roomclient.GameStart](t, c)
+	if start.GameID != "tableone" || start.From != "playeraa" || start.Variant != "bigpig" ||
+		len(start.Roster) != 2 || start.Roster[1] != "playerbb" {
+		t.Fatalf("unexpected game_start %+v", start)
+	}
+	if echo := waitFor[roomclient.GameStart](t, a); echo.GameID != "tableone" {
+		t.Fatalf("host did not get its game_start echoed: %+v", echo)
+	}
+
+	// Events from players reach the room; a non-player's are dropped, as
+	// are events for a table that is still open.
+	c.SendGameEvent("tableone", "cheat")
+	c.SendGameEvent("tabletwo", "early")
+	b.SendGameEvent("tableone", "roll")
+	if ev := waitFor[roomclient.GameEvent](t, a); ev.From != "playerbb" || ev.GameID != "tableone" {
+		t.Fatalf("expected playerbb's roll first, got %+v", ev)
+	}
+
+	// A kick from a non-host is ignored; the host's is recorded.
+	b.SendKick("tableone", 0)
+	a.SendKick("tableone", 1)
+	if k := waitFor[roomclient.Kick](t, c); k.From != "playeraa" || k.Slot != 1 {
+		t.Fatalf("unexpected kick %+v", k)
+	}
+
+	// A late joiner is told about both tables and their state.
+	d := joinRoom(t, srv.URL, "tables01", "playerdd")
+	games := waitFor[roomclient.Games](t, d).Games
+	if len(games) != 2 || games[0].ID != "tableone" || games[0].Status != "playing" ||
+		len(games[0].Kicked) != 1 || games[1].ID != "tabletwo" || games[1].Status != "open" {
+		t.Fatalf("unexpected tables for late joiner %+v", games)
+	}
+
+	// Restarting drops the kicked player from the roster.
+	a.SendGameEvent("tableone", "over")
+	a.EndGame("tableone", -1)
+	a.StartGame("tableone", "", nil)
+	if start := waitFor[roomclient.GameStart](t, d); len(start.Roster) != 1 || start.Roster[0] != "playeraa" {
+		t.Fatalf("unexpected restart roster %+v", start.Roster)
+	}
+
+	a.CloseGame("tableone")
+	waitGames(t, d, func(g []roomclient.Game) bool {
+		return len(g) == 1 && g[0].ID == "tabletwo"
+	})
+}
+
+func TestGameTablesCleanedUpWhenHostLeaves(t *testing.T) {
+	srv, tm := newTestServer(t)
+	a := joinRoom(t, srv.URL, "tables02", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoom(t, srv.URL, "tables02", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+
+	a.OpenGame("lobbyone", "pig")
+	b.JoinGame("lobbyone")
+	b.StartGame("soloplay", "pig", []string{"playerbb", "outsider"})
+	if start := waitFor[roomclient.GameStart](t, a); len(start.Roster) != 1 {
+		t.Fatalf("roster should be limited to room members, got %+v", start.Roster)
+	}
+
+	// a's open table goes with it; b's table in play stays.
+	a.Close()
+	games := waitGames(t, b, func(g []roomclient.Game) bool { return len(g) == 1 })
+	if games[0].ID != "soloplay" {
+		t.Fatalf("unexpected tables %+v", games)
+	}
+
+	// Once nobody on a table is connected, it is gone.
+	b.Close()
+	for i := 0; ; i++ {
+		tm.mu.Lock()
+		n := len(tm.games["tables02"])
+		tm.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("%d tables left after everyone left", n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
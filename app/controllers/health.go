@@ -0,0 +1,416 @@
+package controllers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Connection health: the server measures every session's round-trip time
+// and counts its recent reconnects, so a laggy game can be pinned on the
+// connection causing it. WebSocket sessions are probed with ping control
+// frames carrying a random probe ID, which browsers answer with pongs on
+// their own; SSE sessions get an application-level "ping" frame and POST
+// back a "pong" echoing its id. The server keeps each probe's send time,
+// so a client can only make its link look slower, never faster. Every
+// healthInterval each room's members are sent a room_health message with
+// everyone's link quality, if it changed since the last one, which the
+// page shows as signal bars on video tiles and game chips. The admin room
+// API reports the same values per member, and /admin/metrics exports
+// them for Prometheus.
+
+const (
+	healthInterval = 5 * time.Second
+	// reconnectWindow is how far back rejoins count as recent reconnects.
+	reconnectWindow = 10 * time.Minute
+	// A session that hasn't answered a probe for staleAfter shows one bar
+	// whatever its last RTT was.
+	staleAfter = 3 * healthInterval
+	// maxRTT bounds a plausible sample; anything longer is discarded.
+	maxRTT = time.Minute
+
+	transportWebSocket = "websocket"
+	transportSSE       = "sse"
+)
+
+// linkStats is a session's smoothed RTT and jitter, updated TCP-style
+// (RFC 6298) from each ping/pong sample. It has its own lock because
+// WebSocket pongs are handled on the read pump.
+type linkStats struct {
+	mu      sync.Mutex
+	srtt    time.Duration
+	rttvar  time.Duration
+	samples int
+	last    time.Time
+	// probes are the send times of unanswered pings, by probe ID.
+	probes map[uint64]time.Time
+}
+
+// observe records one round trip.
+func (l *linkStats) observe(rtt time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.samples == 0 {
+		l.srtt, l.rttvar = rtt, rtt/2
+	} else {
+		diff := l.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		l.rttvar += (diff - l.rttvar) / 4
+		l.srtt += (rtt - l.srtt) / 8
+	}
+	l.samples++
+	l.last = now
+}
+
+// probe records a ping sent at now and returns its ID. IDs fit in 53 bits
+// so they survive a round trip through JavaScript numbers.
+func (l *linkStats) probe(now time.Time) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.probes == nil {
+		l.probes = make(map[uint64]time.Time)
+	}
+	for id, sent := range l.probes {
+		if now.Sub(sent) > maxRTT {
+			delete(l.probes, id)
+		}
+	}
+	id := rand.Uint64() >> 11
+	l.probes[id] = now
+	return id
+}
+
+// answered records the round trip of probe id, if it is outstanding.
+func (l *linkStats) answered(id uint64, now time.Time) bool {
+	l.mu.Lock()
+	sent, ok := l.probes[id]
+	delete(l.probes, id)
+	l.mu.Unlock()
+	rtt := now.Sub(sent)
+	if !ok || rtt < 0 || rtt > maxRTT {
+		return false
+	}
+	l.observe(rtt, now)
+	return true
+}
+
+// linkQuality is one member's connection health, as sent in room_health
+// and reported by the admin API.
+type linkQuality struct {
+	Transport  string `json:"transport"`
+	RTTMs      int    `json:"rttMs"`
+	JitterMs   int    `json:"jitterMs"`
+	Reconnects int    `json:"reconnects"` // rejoins in the last reconnectWindow
+	// Bars is 1 (poor) to 4 (good), or 0 before the first measurement.
+	Bars int `json:"bars"`
+}
+
+// quality summarises the stats with reconnects recent rejoins.
+func (l *linkStats) quality(transport string, reconnects int, now time.Time) linkQuality {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q := linkQuality{
+		Transport:  transport,
+		RTTMs:      int(l.srtt.Milliseconds()),
+		JitterMs:   int(l.rttvar.Milliseconds()),
+		Reconnects: reconnects,
+	}
+	if l.samples > 0 {
+		q.Bars = signalBars(l.srtt, l.rttvar, reconnects, now.Sub(l.last) > staleAfter)
+	}
+	return q
+}
+
+// signalBars grades a connection: by smoothed RTT, one bar fewer for
+// jitter or flapping, and a single bar once probes go unanswered.
+func signalBars(srtt, jitter time.Duration, reconnects int, stale bool) int {
+	if stale {
+		return 1
+	}
+	bars := 1
+	switch {
+	case srtt < 100*time.Millisecond:
+		bars = 4
+	case srtt < 250*time.Millisecond:
+		bars = 3
+	case srtt < 500*time.Millisecond:
+		bars = 2
+	}
+	if jitter > 100*time.Millisecond || reconnects >= 3 {
+		bars--
+	}
+	return max(bars, 1)
+}
+
+// pingPayload is a WebSocket ping carrying a probe ID; the pong echoes it
+// back.
+func pingPayload(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+// parsePingPayload reads a pong's echoed probe ID.
+func parsePingPayload(data []byte) (uint64, bool) {
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// probeMessage is the SSE transport's application-level ping, and the
+// client's pong answering it.
+type probeMessage struct {
+	Type   string `json:"type"`
+	RoomID string `json:"roomID"`
+	From   string `json:"from,omitempty"`
+	ID     uint64 `json:"id"`
+}
+
+// pingFrame is the SSE transport's ping, sent at now.
+func (s *roomSession) pingFrame(now time.Time) []byte {
+	data, _ := json.Marshal(probeMessage{Type: "ping", RoomID: s.roomID, ID: s.link.probe(now)})
+	return data
+}
+
+// handlePong records the round trip of a ping the client echoed back.
+func (s *roomSession) handlePong(message []byte) {
+	var pong probeMessage
+	if err := json.Unmarshal(message, &pong); err != nil {
+		return
+	}
+	s.link.answered(pong.ID, time.Now())
+}
+
+// clientReconnects tracks one client's comings and goings in a room.
+type clientReconnects struct {
+	// left is when its last session ended; zero while connected.
+	left time.Time
+	// rejoins are joins within reconnectWindow of leaving.
+	rejoins []time.Time
+}
+
+// recent drops rejoins older than reconnectWindow and counts the rest.
+func (c *clientReconnects) recent(now time.Time) int {
+	i := 0
+	for i < len(c.rejoins) && now.Sub(c.rejoins[i]) > reconnectWindow {
+		i++
+	}
+	c.rejoins = c.rejoins[i:]
+	return len(c.rejoins)
+}
+
+// noteJoin counts a join as a reconnect if the client left the room
+// within reconnectWindow.
+func (tm *TopicManager) noteJoin(roomID, clientID string, now time.Time) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	key := roomID + ":" + clientID
+	c := tm.reconnects[key]
+	if c == nil {
+		c = &clientReconnects{}
+		tm.reconnects[key] = c
+	}
+	if !c.left.IsZero() && now.Sub(c.left) <= reconnectWindow {
+		c.rejoins = append(c.rejoins, now)
+		tm.reconnectsTotal++
+	}
+	c.left = time.Time{}
+}
+
+// noteLeaveLocked records when a client's session ended.
+func (tm *TopicManager) noteLeaveLocked(roomID, clientID string, now time.Time) {
+	if c := tm.reconnects[roomID+":"+clientID]; c != nil {
+		c.left = now
+	}
+}
+
+// pruneReconnectsLocked forgets clients gone longer than reconnectWindow.
+func (tm *TopicManager) pruneReconnectsLocked(now time.Time) {
+	for key, c := range tm.reconnects {
+		if !c.left.IsZero() && now.Sub(c.left) > reconnectWindow {
+			delete(tm.reconnects, key)
+		}
+	}
+}
+
+// linkQualityLocked reports clientID's connection, if it has a session in
+// roomID that has been announced to the room.
+func (tm *TopicManager) linkQualityLocked(roomID, clientID string, now time.Time) (linkQuality, bool) {
+	s := tm.sessions[roomID][clientID]
+	if _, announced := tm.presence[roomID][clientID]; s == nil || !announced {
+		return linkQuality{}, false
+	}
+	reconnects := 0
+	if c := tm.reconnects[roomID+":"+clientID]; c != nil {
+		reconnects = c.recent(now)
+	}
+	return s.link.quality(s.transport, reconnects, now), true
+}
+
+// roomHealthMessage is the periodic report of every member's connection.
+type roomHealthMessage struct {
+	Type    string                 `json:"type"`
+	RoomID  string                 `json:"roomID"`
+	Members map[string]linkQuality `json:"members"`
+}
+
+// roomHealth reports the connection of each of roomID's members.
+func (tm *TopicManager) roomHealth(roomID string, now time.Time) map[string]linkQuality {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	out := make(map[string]linkQuality, len(tm.sessions[roomID]))
+	for clientID := range tm.sessions[roomID] {
+		if q, ok := tm.linkQualityLocked(roomID, clientID, now); ok {
+			out[clientID] = q
+		}
+	}
+	return out
+}
+
+// reportHealth sends occupied rooms their room_health message each
+// healthInterval until shutdown.
+func (tm *TopicManager) reportHealth() {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tm.shutdown:
+			return
+		case now := <-ticker.C:
+			tm.broadcastHealth(now)
+		}
+	}
+}
+
+// broadcastHealth sends room_health to the announced members of each room
+// whose numbers changed since it was last sent.
+func (tm *TopicManager) broadcastHealth(now time.Time) {
+	tm.mu.Lock()
+	roomIDs := make([]string, 0, len(tm.sessions))
+	for roomID := range tm.sessions {
+		roomIDs = append(roomIDs, roomID)
+	}
+	for roomID := range tm.healthSent {
+		if _, ok := tm.sessions[roomID]; !ok {
+			delete(tm.healthSent, roomID)
+		}
+	}
+	tm.mu.Unlock()
+	for _, roomID := range roomIDs {
+		members := tm.roomHealth(roomID, now)
+		if len(members) == 0 {
+			continue
+		}
+		data, err := json.Marshal(roomHealthMessage{Type: "room_health", RoomID: roomID, Members: members})
+		if err != nil {
+			log.Printf("[Health] encode: %v", err)
+			continue
+		}
+		tm.mu.Lock()
+		unchanged := tm.healthSent[roomID] == string(data)
+		tm.healthSent[roomID] = string(data)
+		tm.mu.Unlock()
+		if unchanged {
+			continue
+		}
+		for clientID := range members {
+			tm.sendTo(roomID, clientID, data)
+		}
+	}
+}
+
+// clientLink is one member's connection, for /admin/metrics.
+type clientLink struct {
+	RoomID, ClientID string
+	linkQuality
+}
+
+// clientLinks lists every announced member's connection, by room then
+// client.
+func (tm *TopicManager) clientLinks(now time.Time) []clientLink {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	var out []clientLink
+	for roomID, sessions := range tm.sessions {
+		for clientID := range sessions {
+			if q, ok := tm.linkQualityLocked(roomID, clientID, now); ok {
+				out = append(out, clientLink{roomID, clientID, q})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RoomID != out[j].RoomID {
+			return out[i].RoomID < out[j].RoomID
+		}
+		return out[i].ClientID < out[j].ClientID
+	})
+	return out
+}
+
+// GET /admin/metrics – server and per-client connection metrics in the
+// Prometheus text format. Labels need no escaping: room and client IDs
+// are validID.
+func Metrics(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		h := tm.health()
+		tm.mu.Lock()
+		reconnects := tm.reconnectsTotal
+		tm.mu.Unlock()
+		links := tm.clientLinks(now)
+
+		var b strings.Builder
+		metric := func(name, kind, help string) {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		}
+		metric("rooms_uptime_seconds", "gauge", "Seconds since the server started.")
+		fmt.Fprintf(&b, "rooms_uptime_seconds %d\n", int64(now.Sub(serverStarted).Seconds()))
+		metric("rooms_goroutines", "gauge", "Running goroutines.")
+		fmt.Fprintf(&b, "rooms_goroutines %d\n", h.Goroutines)
+		metric("rooms_active", "gauge", "Rooms with connected members.")
+		fmt.Fprintf(&b, "rooms_active %d\n", h.Rooms)
+		metric("rooms_connections", "gauge", "Connected room members by transport.")
+		fmt.Fprintf(&b, "rooms_connections{transport=%q} %d\n", transportWebSocket, h.Connections-h.SSEConnections)
+		fmt.Fprintf(&b, "rooms_connections{transport=%q} %d\n", transportSSE, h.SSEConnections)
+		metric("rooms_game_tables", "gauge", "Open dice-game tables.")
+		fmt.Fprintf(&b, "rooms_game_tables %d\n", h.GameTables)
+		metric("rooms_webhook_queue", "gauge", "Webhook deliveries waiting to be sent.")
+		fmt.Fprintf(&b, "rooms_webhook_queue %d\n", h.WebhookQueue)
+		metric("rooms_reconnects_total", "counter", "Clients rejoining a room shortly after leaving it.")
+		fmt.Fprintf(&b, "rooms_reconnects_total %d\n", reconnects)
+
+		perClient := []struct {
+			name, help string
+			value      func(linkQuality) string
+		}{
+			{"rooms_client_rtt_seconds", "Smoothed round-trip time to the client.",
+				func(q linkQuality) string { return strconv.FormatFloat(float64(q.RTTMs)/1000, 'f', -1, 64) }},
+			{"rooms_client_jitter_seconds", "Round-trip time variation to the client.",
+				func(q linkQuality) string { return strconv.FormatFloat(float64(q.JitterMs)/1000, 'f', -1, 64) }},
+			{"rooms_client_reconnects", "The client's reconnects in the last 10 minutes.",
+				func(q linkQuality) string { return strconv.Itoa(q.Reconnects) }},
+			{"rooms_client_signal_bars", "The client's connection quality, 1 (poor) to 4 (good); 0 if not yet measured.",
+				func(q linkQuality) string { return strconv.Itoa(q.Bars) }},
+		}
+		for _, m := range perClient {
+			metric(m.name, "gauge", m.help)
+			for _, l := range links {
+				fmt.Fprintf(&b, "%s{room=%q,client=%q,transport=%q} %s\n", m.name, l.RoomID, l.ClientID, l.Transport, m.value(l.linkQuality))
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		io.WriteString(w, b.String())
+	}
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+func TestRoomHealthReportsRTTAndReconnects(t *testing.T) {
+	srv, tm := newAdminServer(t)
+	const roomID = "healthrm1"
+
+	a := joinRoom(t, srv.URL, roomID, "wsplayer1")
+	waitFor[roomclient.Peers](t, a)
+
+	events, _ := dialSSE(t, srv.URL, roomID, "sseplay1")
+	token := readSSE(t, events).data
+	waitFor[roomclient.PlayerJoined](t, a)
+	tm.mu.Lock()
+	session := tm.sessions[roomID]["sseplay1"]
+	tm.mu.Unlock()
+	var ping probeMessage
+	if err := json.Unmarshal(session.pingFrame(time.Now()), &ping); err != nil {
+		t.Fatal(err)
+	}
+	// Pongs for probes the server never sent don't count.
+	forged := map[string]interface{}{"type": "pong", "from": "sseplay1", "roomID": roomID, "id": ping.ID + 1}
+	postSignal(t, srv.URL, roomID, token, forged)
+	time.Sleep(80 * time.Millisecond)
+	pong := map[string]interface{}{"type": "pong", "from": "sseplay1", "roomID": roomID, "id": ping.ID}
+	if code := postSignal(t, srv.URL, roomID, token, pong); code != http.StatusNoContent {
+		t.Fatalf("pong: got %d", code)
+	}
+	// Pongs only count for the session's own client.
+	pong["from"] = "wsplayer1"
+	postSignal(t, srv.URL, roomID, token, pong)
+
+	b := joinRoom(t, srv.URL, roomID, "wsplayer2")
+	waitFor[roomclient.PlayerJoined](t, a)
+	b.Close()
+	waitFor[roomclient.PlayerLeft](t, a)
+	joinRoom(t, srv.URL, roomID, "wsplayer2")
+	waitFor[roomclient.PlayerJoined](t, a)
+
+	now := time.Now()
+	tm.broadcastHealth(now)
+	health := waitFor[roomclient.RoomHealth](t, a)
+	if len(health.Members) != 3 {
+		t.Fatalf("expected 3 members, got %+v", health.Members)
+	}
+	sse := health.Members["sseplay1"]
+	if sse.Transport != "sse" || sse.RTTMs < 80 || sse.RTTMs > 500 || sse.Bars < 2 {
+		t.Fatalf("SSE member: %+v", sse)
+	}
+	if ws := health.Members["wsplayer1"]; ws.Transport != "websocket" || ws.Bars != 0 || ws.Reconnects != 0 {
+		t.Fatalf("unmeasured member: %+v", ws)
+	}
+	if rejoined := health.Members["wsplayer2"]; rejoined.Reconnects != 1 {
+		t.Fatalf("rejoined member: %+v", rejoined)
+	}
+	// Nothing changed, so nothing is sent.
+	tm.broadcastHealth(now)
+	expectNone[roomclient.RoomHealth](t, a)
+
+	var room adminRoom
+	adminCall(t, srv, http.MethodGet, "/rooms/"+roomID, "", &room)
+	for _, m := range room.Members {
+		if m.Link == nil || m.Link.Transport == "" {
+			t.Fatalf("admin member without link: %+v", m)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin/metrics", nil)
+	req.Header.Set("Authorization", "Bearer letmein")
+	code, metrics := pageBody(http.DefaultClient.Do(req))
+	if code != http.StatusOK {
+		t.Fatalf("metrics: got %d", code)
+	}
+	for _, want := range []string{
+		"rooms_reconnects_total 1\n",
+		`rooms_connections{transport="sse"} 1` + "\n",
+		`rooms_client_reconnects{room="healthrm1",client="wsplayer2",transport="websocket"} 1` + "\n",
+		`rooms_client_rtt_seconds{room="healthrm1",client="sseplay1",transport="sse"} 0.`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics lack %q:\n%s", want, metrics)
+		}
+	}
+	if code, _ := pageBody(http.Get(srv.URL + "/admin/metrics")); code != http.StatusUnauthorized {
+		t.Fatalf("metrics without a token: got %d", code)
+	}
+}
+
+func TestLinkStatsAndSignalBars(t *testing.T) {
+	now := time.Now()
+	var l linkStats
+	if q := l.quality(transportWebSocket, 0, now); q.Bars != 0 {
+		t.Fatalf("unmeasured link has %d bars", q.Bars)
+	}
+	var probed linkStats
+	id := probed.probe(now.Add(-30 * time.Millisecond))
+	if got, ok := parsePingPayload(pingPayload(id)); !ok || got != id || id >= 1<<53 {
+		t.Fatalf("ping payload round trip: %d, %d", got, id)
+	}
+	if probed.answered(id+1, now) || !probed.answered(id, now) || probed.answered(id, now) {
+		t.Fatal("only an outstanding probe may be answered, once")
+	}
+	if stale := probed.probe(now.Add(-2 * maxRTT)); probed.answered(stale, now) {
+		t.Fatal("accepted an implausible sample")
+	}
+	l.observe(40*time.Millisecond, now)
+	if q := l.quality(transportWebSocket, 0, now); q.RTTMs != 40 || q.Bars != 4 {
+		t.Fatalf("after one sample: %+v", q)
+	}
+	// One slow sample moves the smoothed RTT an eighth of the way.
+	l.observe(440*time.Millisecond, now)
+	if q := l.quality(transportWebSocket, 0, now); q.RTTMs != 90 || q.JitterMs != 115 || q.Bars != 3 {
+		t.Fatalf("after a spike: %+v", q)
+	}
+	if q := l.quality(transportWebSocket, 0, now.Add(staleAfter+time.Second)); q.Bars != 1 {
+		t.Fatalf("stale link has %d bars", q.Bars)
+	}
+
+	for _, c := range []struct {
+		srtt, jitter time.Duration
+		reconnects   int
+		want         int
+	}{
+		{50 * time.Millisecond, 0, 0, 4},
+		{50 * time.Millisecond, 0, 3, 3},
+		{200 * time.Millisecond, 0, 0, 3},
+		{300 * time.Millisecond, 150 * time.Millisecond, 0, 1},
+		{time.Second, 0, 5, 1},
+	} {
+		if got := signalBars(c.srtt, c.jitter, c.reconnects, false); got != c.want {
+			t.Errorf("signalBars(%v, %v, %d) = %d, want %d", c.srtt, c.jitter, c.reconnects, got, c.want)
+		}
+	}
+}
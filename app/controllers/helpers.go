@@ -4,10 +4,12 @@ import (
 	"embed"
 	"encoding/base64"
 	"errors"
+	"html/template"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 )
 
@@ -31,24 +33,42 @@ var (
 	}
 )
 
+// templateFuncs are available to every page template.
+var templateFuncs = template.FuncMap{
+	// asset returns the fingerprinted URL for a static asset,
+	// e.g. {{ asset "js/video.js" }}.
+	"asset": staticAssets.url,
+}
+
+// parseTemplates parses the given template files with templateFuncs
+// installed. The first path names the template that Execute runs.
+func parseTemplates(paths ...string) (*template.Template, error) {
+	return template.New(path.Base(paths[0])).Funcs(templateFuncs).ParseFS(ffs, paths...)
+}
+
 type flexFS struct{}
 
 func (f *flexFS) Open(name string) (fs.File, error) {
 	if os.Getenv("USE_LOCAL_FS") != "" {
 		return os.Open("./app/controllers/" + name)
 	}
-	if strings.HasPrefix(name, "js/") {
+	if inDir(name, "js") {
 		return jsEmbedFS.Open(name)
 	}
-	if strings.HasPrefix(name, "css/") {
+	if inDir(name, "css") {
 		return cssEmbedFS.Open(name)
 	}
-	if strings.HasPrefix(name, "templates/") {
+	if inDir(name, "templates") {
 		return templatesEmbedFS.Open(name)
 	}
 	return nil, errors.New("could not find file")
 }
 
+// inDir reports whether name is dir itself or a path beneath it.
+func inDir(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
 func makeImagePath(imageID string) string {
 	return imageBaseURL + encodeImageID(imageID)
 }
@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"html/template"
 	"net/http"
 	"time"
 
@@ -40,7 +39,7 @@ func Home(w http.ResponseWriter, r *http.Request) {
 		internalError(err, w)
 		return
 	}
-	tmpl, err := template.ParseFS(ffs, homeTemplatePath...)
+	tmpl, err := parseTemplates(homeTemplatePath...)
 	if err != nil {
 		internalError(err, w)
 		return
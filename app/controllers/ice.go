@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/turnserver"
+)
+
+// clientIDCookie mirrors the clientID video.js keeps in localStorage, so
+// page handlers know who is asking.
+const clientIDCookie = "pig_client"
+
+// turnIDCookie carries the ID TURN credentials are minted for when nobody
+// is signed in. The server picks and signs it, so the relay's per-user
+// quota cannot be dodged by inventing clientIDs.
+const turnIDCookie = "pig_turn"
+
+// ICEServer mirrors the browser's RTCIceServer dictionary.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEConfig describes the ICE servers handed to WebRTC clients.
+type ICEConfig struct {
+	// Servers are external STUN/TURN servers, listed after the embedded one.
+	Servers []ICEServer
+	// STUNPort enables the embedded STUN responder on this UDP port; 0
+	// disables it.
+	STUNPort int
+	// STUNHost is the host clients should use to reach the embedded STUN
+	// server. Empty means the host the page was requested on.
+	STUNHost string
+
+	TURN TURNConfig
+}
+
+// TURNConfig configures the embedded TURN relay. It runs when both Port and
+// Secret are set.
+type TURNConfig struct {
+	Port   int
+	Secret string
+	Realm  string
+	// Host is the host clients use to reach the relay. Empty means the host
+	// the page was requested on.
+	Host string
+	// RelayIP is the public address advertised for relayed candidates.
+	RelayIP string
+	// MinPort and MaxPort bound the relay sockets; 0 lets the OS choose.
+	MinPort, MaxPort      int
+	MaxAllocationsPerUser int
+	MaxAllocations        int
+	// CredentialTTL is how long minted credentials stay valid.
+	CredentialTTL time.Duration
+}
+
+// Enabled reports whether the relay should run.
+func (cfg TURNConfig) Enabled() bool {
+	return cfg.Port > 0 && cfg.Secret != ""
+}
+
+// DefaultICEConfig keeps the public Google STUN server so rooms work out of
+// the box; deployments running the embedded server can drop it.
+func DefaultICEConfig() ICEConfig {
+	return ICEConfig{
+		Servers: []ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}},
+		TURN: TURNConfig{
+			Realm:                 "josephhammerman.com",
+			MaxAllocationsPerUser: 10,
+			CredentialTTL:         12 * time.Hour,
+		},
+	}
+}
+
+// iceServers returns the list for clientID, which loaded the page from r.
+// TURN credentials, when the relay is enabled, are minted for clientID.
+func (cfg ICEConfig) iceServers(r *http.Request, clientID string) []ICEServer {
+	servers := make([]ICEServer, 0, len(cfg.Servers)+2)
+	if cfg.STUNPort > 0 {
+		host := orRequestHost(cfg.STUNHost, r)
+		servers = append(servers, ICEServer{
+			URLs: []string{"stun:" + net.JoinHostPort(host, strconv.Itoa(cfg.STUNPort))},
+		})
+	}
+	if cfg.TURN.Enabled() {
+		addr := net.JoinHostPort(orRequestHost(cfg.TURN.Host, r), strconv.Itoa(cfg.TURN.Port))
+		username, password := turnserver.Credentials(cfg.TURN.Secret, clientID, cfg.TURN.CredentialTTL, time.Now())
+		servers = append(servers, ICEServer{
+			URLs:       []string{"turn:" + addr + "?transport=udp", "turn:" + addr + "?transport=tcp"},
+			Username:   username,
+			Credential: password,
+		})
+	}
+	return append(servers, cfg.Servers...)
+}
+
+// turnIdentity returns the ID to mint TURN credentials for: the signed-in
+// account's, else the one in r's pig_turn cookie, else a fresh one that is
+// set on w. Without a relay there is nothing to mint and it returns "".
+func turnIdentity(tm *TopicManager, cfg Config, w http.ResponseWriter, r *http.Request) (string, error) {
+	if !cfg.ICE.TURN.Enabled() {
+		return "", nil
+	}
+	if u, ok := tm.currentUser(r); ok {
+		return u.ClientID(), nil
+	}
+	if c, err := r.Cookie(turnIDCookie); err == nil {
+		if id, ok := cfg.ICE.TURN.verifyID(c.Value); ok {
+			return id, nil
+		}
+	}
+	id, err := anonymousID()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     turnIDCookie,
+		Value:    id + "." + cfg.ICE.TURN.signID(id),
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.Security.TLS || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id, nil
+}
+
+func (cfg TURNConfig) signID(id string) string {
+	mac := hmac.New(sha256.New, []byte("turn-id:"+cfg.Secret))
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (cfg TURNConfig) verifyID(value string) (string, bool) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || !validID(id) || !hmac.Equal([]byte(sig), []byte(cfg.signID(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+func anonymousID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "anon-" + hex.EncodeToString(b), nil
+}
+
+func orRequestHost(host string, r *http.Request) string {
+	if host != "" {
+		return host
+	}
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		return h
+	}
+	return r.Host
+}
+
+// requestClientID identifies the client: the clientID query parameter,
+// then the pig_client cookie, then a one-off anonymous ID for first-time
+// visitors. It is self-asserted, so nothing is rationed by it.
+func requestClientID(r *http.Request) (string, error) {
+	if id := r.URL.Query().Get("clientID"); validID(id) {
+		return id, nil
+	}
+	if c, err := r.Cookie(clientIDCookie); err == nil && validID(c.Value) {
+		return c.Value, nil
+	}
+	return anonymousID()
+}
+
+type iceServersResponse struct {
+	ICEServers []ICEServer `json:"iceServers"`
+}
+
+// GET /api/ice-servers – the RTCConfiguration.iceServers list for this
+// site, with TURN credentials minted for the caller's server-issued ID.
+func ICEServers(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, err := turnIdentity(tm, cfg, w, r)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(iceServersResponse{ICEServers: cfg.ICE.iceServers(r, clientID)}); err != nil {
+			internalError(err, w)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICEServersIncludesEmbeddedSTUN(t *testing.T) {
+	cfg := ICEConfig{
+		Servers:  []ICEServer{{URLs: []string{"stun:stun.example.com:3478"}}},
+		STUNPort: 3478,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://games.example.com:8000/api/ice-servers", nil)
+	rec := httptest.NewRecorder()
+	ICEServers(NewTopicManager(), Config{ICE: cfg})(rec, req)
+
+	var resp iceServersResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.ICEServers) != 2 {
+		t.Fatalf("expected 2 servers, got %+v", resp.ICEServers)
+	}
+	if got := resp.ICEServers[0].URLs[0]; got != "stun:games.example.com:3478" {
+		t.Fatalf("embedded STUN URL should use the request host, got %s", got)
+	}
+	if got := resp.ICEServers[1].URLs[0]; got != "stun:stun.example.com:3478" {
+		t.Fatalf("unexpected external server %s", got)
+	}
+}
+
+func TestICEServersWithoutEmbeddedSTUN(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/ice-servers", nil)
+	servers := ICEConfig{STUNHost: "stun.example.com"}.iceServers(req, "client01")
+	if len(servers) != 0 {
+		t.Fatalf("expected no servers when nothing is configured, got %+v", servers)
+	}
+}
+
+func TestICEServersMintsTURNCredentials(t *testing.T) {
+	cfg := Config{ICE: ICEConfig{TURN: TURNConfig{Port: 3478, Secret: "s3cret", CredentialTTL: time.Hour}}}
+	h := ICEServers(NewTopicManager(), cfg)
+
+	fetch := func(cookies ...*http.Cookie) (ICEServer, *httptest.ResponseRecorder) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "http://games.example.com/api/ice-servers?clientID=client01", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		var resp iceServersResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if len(resp.ICEServers) != 1 {
+			t.Fatalf("expected only the TURN server, got %+v", resp.ICEServers)
+		}
+		return resp.ICEServers[0], rec
+	}
+
+	turn, rec := fetch()
+	if turn.URLs[0] != "turn:games.example.com:3478?transport=udp" {
+		t.Fatalf("unexpected TURN URL %s", turn.URLs[0])
+	}
+	if strings.HasSuffix(turn.Username, ":client01") || turn.Credential == "" {
+		t.Fatalf("credentials minted for a caller-chosen ID: %+v", turn)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != turnIDCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly %s cookie, got %+v", turnIDCookie, cookies)
+	}
+
+	// The issued ID sticks; a forged one is replaced.
+	again, rec := fetch(cookies[0])
+	if again.Username != turn.Username || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("issued ID not reused: %s vs %s", again.Username, turn.Username)
+	}
+	forged, _ := fetch(&http.Cookie{Name: turnIDCookie, Value: "client01.bogus"})
+	if strings.HasSuffix(forged.Username, ":client01") {
+		t.Fatalf("forged ID accepted: %s", forged.Username)
+	}
+}
@@ -0,0 +1,229 @@
+// admin.js
+// The admin dashboard. The server pushes a snapshot of its health, every
+// open room and the latest audit entries over /admin/events every couple
+// of seconds; this renders it and drives the admin API for closing rooms,
+// disconnecting members and sending notices. The page is authenticated by
+// the admin session cookie, which the API accepts for same-origin requests.
+
+const healthBox = document.getElementById("admin-health");
+const statusText = document.getElementById("admin-status");
+const roomsBody = document.querySelector("#admin-rooms tbody");
+const roomsEmpty = document.getElementById("admin-rooms-empty");
+const roomPanel = document.getElementById("admin-room");
+const membersBody = document.querySelector("#admin-members tbody");
+const tablesBody = document.querySelector("#admin-tables tbody");
+const auditBody = document.querySelector("#admin-audit tbody");
+const auditEmpty = document.getElementById("admin-audit-empty");
+const noticeForm = document.getElementById("admin-notice");
+const noticeText = document.getElementById("admin-notice-text");
+const noticeRoom = document.getElementById("admin-notice-room");
+
+let snapshot = null;
+let selectedRoom = "";
+
+// Rendering goes through textContent; room IDs, names and audit data
+// all come from users.
+function _cell(row, text) {
+  const td = document.createElement("td");
+  td.textContent = text === undefined || text === "" ? "–" : String(text);
+  row.appendChild(td);
+  return td;
+}
+
+function _time(iso) {
+  const d = new Date(iso);
+  return isNaN(d) ? "" : d.toLocaleTimeString();
+}
+
+async function _adminPost(path, body) {
+  const opts = { method: "POST", credentials: "same-origin" };
+  if (body !== undefined) {
+    opts.headers = { "Content-Type": "application/json" };
+    opts.body = JSON.stringify(body);
+  }
+  const res = await fetch("/admin/api" + path, opts);
+  if (!res.ok) {
+    throw new Error(res.status + " " + (await res.text()).trim());
+  }
+  return res.status === 204 ? null : res.json();
+}
+
+function _renderHealth(h) {
+  healthBox.textContent = "";
+  [
+    [h.rooms, "rooms"],
+    [h.connections, "connections"],
+    [h.sseConnections, "SSE sessions"],
+    [h.gameTables, "game tables"],
+    [h.bans, "bans"],
+    [h.webhookQueue, "queued webhooks"],
+    [h.goroutines, "goroutines"],
+    [h.heapMB + " MB", "heap"],
+    [h.uptime, "uptime"],
+    [h.audit ? "on" : "off", "audit log"],
+  ].forEach(([value, label]) => {
+    const span = document.createElement("span");
+    const b = document.createElement("b");
+    b.textContent = String(value);
+    span.appendChild(b);
+    span.appendChild(document.createTextNode(label));
+    healthBox.appendChild(span);
+  });
+}
+
+function _renderRooms(rooms) {
+  roomsBody.textContent = "";
+  roomsEmpty.hidden = rooms.length > 0;
+  rooms.forEach((r) => {
+    const tr = document.createElement("tr");
+    tr.className = "room-row" + (r.roomID === selectedRoom ? " selected" : "");
+    _cell(tr, r.roomID);
+    _cell(tr, r.type ? r.type + (r.mode === "sfu" ? " (sfu)" : "") : "");
+    _cell(tr, r.variant);
+    _cell(tr, r.members.length);
+    _cell(tr, r.host);
+    _cell(tr, r.code);
+    tr.addEventListener("click", () => {
+      selectedRoom = r.roomID;
+      _render();
+    });
+    roomsBody.appendChild(tr);
+  });
+
+  // Keep the notice target list in step, preserving the choice.
+  const chosen = noticeRoom.value;
+  while (noticeRoom.options.length > 1) noticeRoom.remove(1);
+  rooms.forEach((r) => {
+    const opt = document.createElement("option");
+    opt.value = r.roomID;
+    opt.textContent = "Only " + r.roomID;
+    noticeRoom.appendChild(opt);
+  });
+  noticeRoom.value = rooms.some((r) => r.roomID === chosen) ? chosen : "";
+}
+
+function _presence(p) {
+  const bits = [];
+  if (p.micMuted) bits.push("muted");
+  if (p.cameraOff) bits.push("camera off");
+  if (p.screenSharing) bits.push("sharing");
+  if (p.handRaised) bits.push("hand up");
+  return bits.join(", ");
+}
+
+function _link(l) {
+  if (!l) return "";
+  const bits = [l.transport];
+  if (l.bars) bits.push(`${l.rttMs} ms ±${l.jitterMs}`, `${l.bars}/4`);
+  if (l.reconnects) bits.push(`${l.reconnects} reconnects`);
+  return bits.join(", ");
+}
+
+function _renderRoom(room) {
+  roomPanel.hidden = !room;
+  if (!room) return;
+  document.getElementById("admin-room-title").textContent = "Room " + room.roomID;
+  const meta = [room.type || "untyped", room.mode];
+  if (room.variant) meta.push(room.variant);
+  if (room.public) meta.push("public");
+  if (room.created) meta.push("created " + _time(room.created));
+  meta.push("slots: " + (room.slots.join(" ") || "none"));
+  document.getElementById("admin-room-meta").textContent = meta.join(" · ");
+
+  membersBody.textContent = "";
+  room.members.forEach((m) => {
+    const tr = document.createElement("tr");
+    _cell(tr, m.slot);
+    _cell(tr, m.clientID + (m.clientID === room.host ? " (host)" : ""));
+    _cell(tr, m.name);
+    _cell(tr, _presence(m.presence || {}));
+    _cell(tr, _link(m.link));
+    _cell(tr, m.breakout);
+    const td = document.createElement("td");
+    const kick = document.createElement("button");
+    kick.type = "button";
+    kick.className = "admin-danger";
+    kick.textContent = "Kick";
+    kick.addEventListener("click", () => _kick(room.roomID, m.clientID));
+    td.appendChild(kick);
+    tr.appendChild(td);
+    membersBody.appendChild(tr);
+  });
+
+  tablesBody.textContent = "";
+  (room.tables || []).forEach((t) => {
+    const tr = document.createElement("tr");
+    _cell(tr, t.id);
+    _cell(tr, t.variant);
+    _cell(tr, t.roster.join(", "));
+    _cell(tr, t.status);
+    tablesBody.appendChild(tr);
+  });
+}
+
+function _renderAudit(entries) {
+  auditBody.textContent = "";
+  auditEmpty.hidden = entries.length > 0;
+  entries.forEach((e) => {
+    const tr = document.createElement("tr");
+    _cell(tr, _time(e.time));
+    _cell(tr, e.type);
+    _cell(tr, e.roomID);
+    _cell(tr, e.clientID);
+    _cell(tr, e.data ? JSON.stringify(e.data) : "");
+    auditBody.appendChild(tr);
+  });
+}
+
+function _render() {
+  if (!snapshot) return;
+  _renderHealth(snapshot.health);
+  _renderRooms(snapshot.rooms);
+  _renderRoom(snapshot.rooms.find((r) => r.roomID === selectedRoom));
+  _renderAudit(snapshot.audit);
+}
+
+async function _kick(roomID, clientID) {
+  if (!confirm("Disconnect " + clientID + " from " + roomID + "?")) return;
+  try {
+    await _adminPost("/rooms/" + encodeURIComponent(roomID) + "/clients/" + encodeURIComponent(clientID) + "/disconnect");
+  } catch (err) {
+    alert("Kick failed: " + err.message);
+  }
+}
+
+document.getElementById("admin-room-close").addEventListener("click", async () => {
+  const roomID = selectedRoom;
+  if (!roomID || !confirm("Close " + roomID + " and disconnect everyone in it?")) return;
+  try {
+    await _adminPost("/rooms/" + encodeURIComponent(roomID) + "/close");
+    selectedRoom = "";
+    _render();
+  } catch (err) {
+    alert("Close failed: " + err.message);
+  }
+});
+
+noticeForm.addEventListener("submit", async (ev) => {
+  ev.preventDefault();
+  const text = noticeText.value.trim();
+  if (!text) return;
+  try {
+    const out = await _adminPost("/notice", { text, roomID: noticeRoom.value });
+    noticeText.value = "";
+    statusText.textContent = "Notice sent to " + out.recipients + " client(s)";
+  } catch (err) {
+    alert("Notice failed: " + err.message);
+  }
+});
+
+// EventSource reconnects by itself; the status line says when it is down.
+const events = new EventSource("/admin/events");
+events.addEventListener("snapshot", (ev) => {
+  snapshot = JSON.parse(ev.data);
+  statusText.textContent = "live · updated " + _time(snapshot.time);
+  _render();
+});
+events.onerror = () => {
+  statusText.textContent = "disconnected, retrying…";
+};
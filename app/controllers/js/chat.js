@@ -0,0 +1,99 @@
+// chat.js
+// In-room text chat. The server stamps each message with an ID, sender and
+// time, keeps a bounded history, and sends recent history to new joiners
+// right after the "peers" message. The room's host (the connected member
+// with the lowest slot) can delete messages.
+//
+// Depends on globals set by video.js:  myID, roomID, sendSignal,
+//                                      displayName, currentHostID
+
+const chatLog = document.getElementById("chat-log");
+const chatForm = document.getElementById("chat-form");
+const chatInput = document.getElementById("chat-input");
+const chatMessages = [];  // oldest first, as the server holds them
+const CHAT_HISTORY_MAX = 200;  // matches the server's maxChatHistory
+
+function _amChatHost() {
+  return currentHostID() === myID;
+}
+
+function _chatTime(iso) {
+  const d = new Date(iso);
+  return isNaN(d) ? "" : d.toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" });
+}
+
+// Rendering goes through textContent; chat text is user input.
+function _renderChat() {
+  const atBottom = chatLog.scrollTop + chatLog.clientHeight >= chatLog.scrollHeight - 4;
+  const canDelete = _amChatHost();
+  chatLog.textContent = "";
+  chatMessages.forEach((m) => {
+    const li = document.createElement("li");
+    if (m.from === myID) li.className = "mine";
+    const who = document.createElement("span");
+    who.className = "chat-from";
+    who.textContent = m.from === myID ? "You" : (displayName(m.from) || m.name || "Guest");
+    const when = document.createElement("time");
+    when.dateTime = m.sentAt;
+    when.textContent = _chatTime(m.sentAt);
+    const text = document.createElement("span");
+    text.className = "chat-text";
+    text.textContent = m.text;
+    li.append(who, when, text);
+    if (canDelete) {
+      const del = document.createElement("button");
+      del.type = "button";
+      del.className = "chat-delete";
+      del.title = "Delete message";
+      del.textContent = "×";
+      del.addEventListener("click", () => {
+        sendSignal({ type: "chat_delete", from: myID, to: "room", roomID, id: m.id });
+      });
+      li.appendChild(del);
+    }
+    chatLog.appendChild(li);
+  });
+  if (atBottom) chatLog.scrollTop = chatLog.scrollHeight;
+}
+
+// Called by video.js for chat, chat_history and chat_deleted frames.
+function handleChatMessage(msg) {
+  switch (msg.type) {
+    case "chat_history":
+      chatMessages.length = 0;
+      (msg.messages || []).forEach((m) => chatMessages.push(m));
+      break;
+    case "chat":
+      if (!chatMessages.some((m) => m.id === msg.id)) chatMessages.push(msg);
+      if (chatMessages.length > CHAT_HISTORY_MAX) chatMessages.shift();
+      break;
+    case "chat_deleted": {
+      const i = chatMessages.findIndex((m) => m.id === msg.id);
+      if (i >= 0) chatMessages.splice(i, 1);
+      break;
+    }
+  }
+  _renderChat();
+}
+
+// Called by video.js on every "peers" message. The server only sends
+// chat_history when there is some, and after a reconnect its copy is the
+// truth (messages may have been deleted while we were away).
+function resetChat() {
+  chatMessages.length = 0;
+  _renderChat();
+}
+
+// Called by video.js whenever membership changes, since that can move the
+// host role (and with it the delete buttons).
+function onChatMembersChanged() {
+  _renderChat();
+}
+
+chatForm.addEventListener("submit", (evt) => {
+  evt.preventDefault();
+  const text = chatInput.value.trim();
+  if (!text) return;
+  sendSignal({ type: "chat", from: myID, to: "room", roomID, text });
+  chatInput.value = "";
+});
@@ -2,6 +2,11 @@
 // Handles WASM loading, player coordination, and game-event routing for
 // the Pig Dice multiplayer mini-game embedded in a WebRTC room.
 //
+// A room can run several games at once. The server tracks each "table" —
+// its gameID, host, variant, roster and status — and sends the list in
+// "games" messages; this tab plays or watches at most one table at a time
+// (currentGameID) and ignores game traffic for the others.
+//
 // Depends on globals set by video.js:  myID, roomID, peers, sendSignal,
 //                                      mySlot, playerSlots
 
@@ -14,34 +19,28 @@ let diceGameRunning = false;
 let diceGameSpectating = false;
 let gameEnded = false;
 
-// The roster is captured at game_start time and frozen for the life of that
-// game. The host's broadcast carries the authoritative list. New peers
-// joining after that point do not get a slot in this game; they become
-// spectators and wait for the next game_start.
+// The roster is fixed by the server when the table's host starts it and
+// frozen for the life of that game. Players who join the table later, or
+// who watch it, are spectators until the next game_start.
+let currentGameID = null; // table we're playing or watching, or null
 let gameRoster = [];     // ordered list of clientIDs participating in the current game
-let gameHostID = null;   // clientID of the host (first to send game_start)
+let gameHostID = null;   // clientID of the table's host
 let myGameSlot = -1;     // our index within gameRoster, or -1 if spectator
 let currentVariant = "pig";    // active game's rules variant ("pig" | "bigpig")
 const kickedSlots = new Set(); // game-roster indices that have been kicked
 
-// kickedClientIDs persists ACROSS rounds for the lifetime of the page —
-// once a player is booted for AFK, they stay out of subsequent automatic
-// rosters even though their server slot is still active. (A page reload
-// clears it, by design: it's session-scoped, not durable punishment.)
-const kickedClientIDs = new Set();
+// The tables in our group, as last sent by the server. Kicked players are
+// left off a table's roster by the server when its host starts a new round.
+let gameTables = [];
 
-// Build a clientID list ordered by server-assigned slot index. Used to
-// snapshot the roster at game_start time and to render the chip list before
-// a game has started.  Excludes clientIDs in kickedClientIDs so that
-// next-round auto-rosters skip players the host already kicked.
+// Build a clientID list ordered by server-assigned slot index, for the chip
+// list shown while we're not at a table.
 function _playerListBySlot() {
   const out = [];
   Object.keys(playerSlots).forEach((id) => {
     out[playerSlots[id]] = id;
   });
-  return out
-    .filter((id) => typeof id === "string")
-    .filter((id) => !kickedClientIDs.has(id));
+  return out.filter((id) => typeof id === "string");
 }
 
 // Read the variant picker; default to "pig" if the element is missing or
@@ -54,45 +53,35 @@ function _selectedVariant() {
 
 // ── Entry point ──────────────────────────────────────────────────────────────
 
+// _sendGameSignal sends a table-scoped frame; the server routes it to the
+// table's group.
+function _sendGameSignal(type, gameID, extra) {
+  sendSignal(Object.assign({ type, from: myID, to: "room", roomID, gameID }, extra));
+}
+
 /**
- * Start a new game session.  Called when the local user clicks the Start button.
- * The caller becomes the host: their snapshot of the current playerSlots is
- * frozen as the game roster, and only they can kick AFK players.  Players
- * already kicked for AFK in a prior round are excluded automatically.
+ * Open a new table with the picked variant.  Called when the local user
+ * clicks New Table.  The opener is the table's host: others join from the
+ * table list, the host starts the game, and only the host can kick AFK
+ * players.
  */
-function startDiceGame() {
-  if (diceGameRunning || diceGameSpectating) return;
-  if (gameEnded) _resetGameState();
-
-  const roster  = _playerListBySlot();   // already filters kickedClientIDs
-  const variant = _selectedVariant();
-  if (roster.length === 0) return;
-
-  // Broadcast roster + variant + host identity so every peer agrees on who
-  // is playing and which ruleset is in effect.
-  sendSignal({
-    type:    "game_start",
-    from:    myID,
-    to:      "room",
-    roomID:  roomID,
-    roster:  roster,
-    variant: variant,
-  });
-
-  _initDiceGame(roster, myID, variant);
+function openGameTable() {
+  if (diceGameRunning && !gameEnded) return;
+  _sendGameSignal("game_open", randomID(), { variant: _selectedVariant() });
 }
 
 /**
- * Initialise the game for a specific roster + variant, with a specific host.
- * If our clientID isn't in the roster (we joined after the host clicked
- * Start), we drop into spectator mode — chips render, no WASM, no buttons.
- * Safe to call multiple times — re-entrant calls are silently ignored while
- * the game is running.
+ * Initialise the game for a specific table.  If our clientID isn't in the
+ * roster (we joined the table after its host clicked Start, or are only
+ * watching), we drop into spectator mode — chips render, no WASM, no
+ * buttons.  Safe to call multiple times — re-entrant calls are silently
+ * ignored while the game is running.
  */
-function _initDiceGame(roster, hostID, variant) {
+function _initDiceGame(gameID, roster, hostID, variant) {
   if (diceGameRunning || diceGameSpectating) return;
   if (!Array.isArray(roster) || roster.length === 0) return;
 
+  currentGameID   = gameID;
   gameRoster      = roster.slice();
   gameHostID      = hostID;
   myGameSlot      = roster.indexOf(myID);
@@ -109,19 +98,20 @@ function _initDiceGame(roster, hostID, variant) {
     const startBtn = document.getElementById("start-game-btn");
     const statusEl = document.getElementById("game-status");
     if (startBtn) startBtn.style.display = "none";
-    if (statusEl) statusEl.textContent = "Game in progress — waiting for next round.";
+    if (statusEl) statusEl.textContent = "Watching — waiting for the next round to play.";
     _updateGamePlayerList(roster, -1);
     _ensureChipTick();
     _syncVariantPicker();
+    _renderGameTables();
     _refreshFullscreen();
     return;
   }
 
   diceGameRunning = true;
 
-  // Show the canvas panel + state panel + action buttons. Hide Start, but
-  // surface the New Game button so the user has an obvious way to restart
-  // mid-round (otherwise auto-start rooms had no findable restart control).
+  // Show the canvas panel + state panel + action buttons. Hide New Table,
+  // and surface New Game for the table's host so there is an obvious way to
+  // restart mid-round (only the host's game_start is accepted).
   const container = document.getElementById("game-container");
   const statePanel = document.getElementById("game-state-panel");
   const startBtn  = document.getElementById("start-game-btn");
@@ -130,9 +120,10 @@ function _initDiceGame(roster, hostID, variant) {
   if (container)  container.style.display  = "block";
   if (statePanel) statePanel.style.display = "flex";
   if (startBtn)   startBtn.style.display   = "none";
-  if (newGameBtn) newGameBtn.style.display = "inline-block";
+  if (newGameBtn) newGameBtn.style.display = hostID === myID ? "inline-block" : "none";
   if (actionRow)  actionRow.classList.add("active");
   _renderStatePanelFromRoster();
+  _renderGameTables();
 
   _updateGamePlayerList(roster, myGameSlot);
   _setupActionButtons();
@@ -149,16 +140,9 @@ function _initDiceGame(roster, hostID, variant) {
   // Called by the Go game whenever the local player takes an action.
   window.diceGameSendEvent = function(jsonStr) {
     const event = JSON.parse(jsonStr);
-    // Fan-out: send to every peer individually (server routes by To).
-    Object.keys(peers).forEach(peerID => {
-      sendSignal({
-        type:   "game_event",
-        from:   myID,
-        to:     peerID,
-        roomID: roomID,
-        event:  event,
-      });
-    });
+    // Room broadcast rather than a per-peer fan-out: in SFU rooms there
+    // are no peer connections to enumerate.
+    _sendGameSignal("game_event", gameID, { event });
   };
 
   // If a previous game already loaded the WASM module, reset it in-place
@@ -187,11 +171,11 @@ function _syncVariantPicker() {
   sel.disabled = diceGameRunning || diceGameSpectating;
 }
 
-// Clear all per-game state in preparation for a fresh round.  Does not
-// touch the WASM (a subsequent _initDiceGame will call diceGameReset).
-// kickedClientIDs is deliberately NOT cleared — kicks for AFK persist across
-// rounds for the page lifetime.
+// Clear all per-game state in preparation for a fresh round or another
+// table.  Does not touch the WASM (a subsequent _initDiceGame will call
+// diceGameReset).
 function _resetGameState() {
+  currentGameID           = null;
   diceGameRunning         = false;
   diceGameSpectating      = false;
   gameEnded               = false;
@@ -214,32 +198,42 @@ function _resetGameState() {
   if (actionRow)  actionRow.classList.remove("active");
   if (statePanel) statePanel.style.display = "none";
   if (enterFsBtn) enterFsBtn.style.display = "none";
+  const startBtn = document.getElementById("start-game-btn");
+  if (startBtn)   startBtn.style.display = "";
   _syncVariantPicker();
+  _updateGamePlayerList(_playerListBySlot(), mySlot);
+  _renderGameTables();
   _refreshFullscreen();
 }
 
-// Click handler for the New Game button. Works whether a game is in
-// progress (treated as an immediate restart), already ended, or never
-// started — clears local state and broadcasts a fresh game_start so peers
-// reset too. The button is always visible after the first game starts so
-// the user can find it; mid-game clicks abandon the current round.
+// Click handler for the New Game button, shown to the table's host. Works
+// whether a game is in progress (treated as an immediate restart) or
+// already ended — asks the server to restart the table, which drops kicked
+// players and echoes a fresh game_start to everyone, us included.
+// Mid-game clicks abandon the current round.
 function startNewGame() {
+  if (!currentGameID || gameHostID !== myID) return;
   if (diceGameRunning && !gameEnded) {
     if (!confirm("Restart the game now? This ends the current round for everyone.")) {
       return;
     }
   }
-  _resetGameState();
-  startDiceGame();
+  const variant = _selectedVariant();
+  _sendGameSignal("game_start", currentGameID, { variant });
 }
 
-// Wire the Start / New Game buttons once on script load.  Start is the
-// initial entry point; New Game is what appears after a finished round.
+// Wire the New Table / New Game buttons once on script load.  New Table is
+// the initial entry point; New Game is what the host sees at a table.
 (function setupGameButtons() {
   const startBtn = document.getElementById("start-game-btn");
-  if (startBtn) startBtn.addEventListener("click", startDiceGame);
+  if (startBtn) startBtn.addEventListener("click", openGameTable);
   const newGameBtn = document.getElementById("new-game-btn");
   if (newGameBtn) newGameBtn.addEventListener("click", startNewGame);
+  // Dice rooms are linked with the variant they were created (or matched)
+  // for; start the picker there.
+  const sel = document.getElementById("game-variant");
+  const variant = new URLSearchParams(window.location.search).get("variant");
+  if (sel && (variant === "pig" || variant === "bigpig")) sel.value = variant;
 })();
 
 // ── On-screen Roll / Hold buttons ────────────────────────────────────────────
@@ -277,10 +271,16 @@ function _refreshActionButtons() {
 // Called by the WASM when the game ends — either a winning hold or a Kick
 // that left only one un-kicked player.  Surfaces the New Game button so the
 // round can be replayed without reloading the page.
-window.diceGameOnGameOver = function(_winnerIdx) {
+window.diceGameOnGameOver = function(winnerIdx) {
   gameEnded = true;
+  // The host reports the end, and who won, so the table list shows it
+  // finished.
+  if (currentGameID && gameHostID === myID) {
+    _sendGameSignal("game_over", currentGameID, { winner: winnerIdx });
+  }
+  _reportGameResult(winnerIdx);
   const newGameBtn = document.getElementById("new-game-btn");
-  if (newGameBtn) newGameBtn.style.display = "inline-block";
+  if (newGameBtn && gameHostID === myID) newGameBtn.style.display = "inline-block";
   // Let the picker re-enable so the user can choose a different variant for
   // the next round.  The new game won't start until they click New Game.
   const sel = document.getElementById("game-variant");
@@ -288,6 +288,22 @@ window.diceGameOnGameOver = function(_winnerIdx) {
   _refreshFullscreen();
 };
 
+// Every player reports the final state their WASM computed; the server
+// records the game for the leaderboard once two reports agree.
+function _reportGameResult(winnerIdx) {
+  if (!currentGameID || myGameSlot < 0 || typeof window.diceGameGetState !== "function") return;
+  let state;
+  try { state = JSON.parse(window.diceGameGetState()); } catch (_) { return; }
+  const players = (Array.isArray(state.players) ? state.players : []).map((p) => ({
+    score:         p.totalScore,
+    turns:         p.turns,
+    biggestTurn:   p.biggestTurn,
+    longestStreak: p.longestStreak,
+    kicked:        p.kicked,
+  }));
+  _sendGameSignal("game_result", currentGameID, { result: { winner: winnerIdx, players } });
+}
+
 // Called by the WASM whenever any scoring / turn / message state changes.
 // Paints the DOM state panel — which is the source of truth for mobile
 // fullscreen mode (where the canvas is hidden) and a redundancy on desktop
@@ -353,7 +369,7 @@ function _renderStatePanel(state) {
     if (isMe)      classes.push("me");
     if (isCurrent) classes.push("current");
     if (p.kicked)  classes.push("kicked");
-    const label = isMe ? `You (P${p.id})` : `Player ${p.id}`;
+    const label = isMe ? `You (P${p.id})` : _escapeHTML(_playerName(gameRoster[idx], p.id));
     const kickedMark = p.kicked ? " (kicked)" : "";
     const turn = (!p.kicked && p.turnScore > 0)
       ? `<span class="player-turn">turn +${p.turnScore}</span>`
@@ -495,9 +511,13 @@ async function _loadWasm() {
     _captureEbitenCanvas();
 
     // The Go constructor comes from /js/wasm_exec.js (loaded in <head>).
+    // The page supplies the fingerprinted pig.wasm URL so the browser can
+    // cache the compiled module until the build actually changes.
+    const panel = document.getElementById("game-panel");
+    const wasmURL = (panel && panel.dataset.wasmUrl) || "/wasm/pig.wasm";
     const go = new Go();
     const result = await WebAssembly.instantiateStreaming(
-      fetch("/wasm/pig.wasm"),
+      fetch(wasmURL),
       go.importObject
     );
     if (statusEl) statusEl.textContent = "";
@@ -592,27 +612,30 @@ function _restoreBodyStyles() {
  */
 function handleDiceGameMessage(msg) {
   switch (msg.type) {
-    case "game_start":
-      if (!Array.isArray(msg.roster)) break;
-      // Accept any game_start broadcast — it's a unilateral restart. If we
-      // were already running we treat it as a peer-initiated restart and
-      // drop our local state first. (Restart was previously ignored mid-
-      // round, which made the New Game button useless for everyone except
-      // the clicker.)
-      if (diceGameRunning || diceGameSpectating || gameEnded) {
-        _resetGameState();
-      }
-      _initDiceGame(msg.roster, msg.from, msg.variant);
-      // Replay any kicks the host already applied so a refreshed-mid-game
-      // rejoin comes back to the same logical state.
+    case "games":
+      _handleGamesMessage(msg);
+      break;
+
+    case "game_start": {
+      if (!Array.isArray(msg.roster) || !msg.gameID) break;
+      // The server echoes a table's game_start to its whole group, host
+      // included. We pick it up for the table we're at (a restart), or for
+      // a table that has us on its roster as long as we're not mid-round
+      // somewhere else.
+      const ours = msg.gameID === currentGameID;
+      const busy = diceGameRunning && !gameEnded;
+      if (!ours && (busy || !msg.roster.includes(myID))) break;
+      _resetGameState();
+      _initDiceGame(msg.gameID, msg.roster, msg.from, msg.variant);
       if (Array.isArray(msg.kicked)) {
         msg.kicked.forEach((slot) => _applyKick(slot, msg.from));
       }
       _ensureChipTick();
       break;
+    }
 
     case "game_event":
-      if (diceGameRunning && msg.event) {
+      if (diceGameRunning && msg.gameID === currentGameID && msg.event) {
         // Pass the event payload to the running Go WASM instance.
         const fn = window.diceGameReceiveEvent;
         if (typeof fn === "function") {
@@ -622,7 +645,7 @@ function handleDiceGameMessage(msg) {
       break;
 
     case "player_kick":
-      if (typeof msg.slot === "number") {
+      if (msg.gameID === currentGameID && typeof msg.slot === "number") {
         _applyKick(msg.slot, msg.from);
       }
       break;
@@ -643,25 +666,89 @@ function onSlotsUpdated() {
   }
 }
 
-// Called by video.js when a brand-new peer arrives (player_joined). If we
-// are the host of an active game, send them a unicast game_start carrying
-// both the frozen roster and the set of already-kicked slots, so a
-// returning player rebuilds their WASM with the correct state and a fresh
-// joiner drops into spectator mode. Without this catch-up, late joiners
-// would think no game was running and could trigger a competing game_start.
-function onPlayerJoined(peerID) {
-  if (!peerID) return;
-  if ((diceGameRunning || diceGameSpectating) && gameHostID === myID && gameRoster.length) {
-    sendSignal({
-      type:    "game_start",
-      from:    myID,
-      to:      peerID,
-      roomID:  roomID,
-      roster:  gameRoster,
-      kicked:  Array.from(kickedSlots),
-      variant: currentVariant,
-    });
+// The server's "games" message lists every table in our group; it follows
+// the "peers" message and is re-sent whenever a table changes. It replaces
+// the old host-to-joiner catch-up: a refreshed player finds their table
+// here and rejoins it, with the kicks applied so far.
+function _handleGamesMessage(msg) {
+  gameTables = Array.isArray(msg.games) ? msg.games : [];
+  const mine = gameTables.find((t) => t.id === currentGameID);
+  if (currentGameID && !mine) {
+    _resetGameState();  // our table was closed
+    return;
   }
+  if (!currentGameID) {
+    const rejoin = gameTables.find((t) => t.status === "playing" && _myRosterSlot(t) >= 0);
+    if (rejoin) {
+      _joinTableGame(rejoin);
+      return;
+    }
+  }
+  _renderGameTables();
+}
+
+// _myRosterSlot is our un-kicked index on a table's roster, or -1.
+function _myRosterSlot(table) {
+  const slot = (table.roster || []).indexOf(myID);
+  return slot >= 0 && !(table.kicked || []).includes(slot) ? slot : -1;
+}
+
+// _joinTableGame plays (or, off the roster, watches) a table already in
+// progress, from its entry in the games list.
+function _joinTableGame(table) {
+  _resetGameState();
+  _initDiceGame(table.id, table.roster, table.host, table.variant);
+  (table.kicked || []).forEach((slot) => _applyKick(slot, table.host));
+  _ensureChipTick();
+}
+
+// Called by video.js on every "peers" message. The server only sends a
+// games list when the group has tables, so start from an empty one.
+function resetGameTables() {
+  gameTables = [];
+  _renderGameTables();
+}
+
+// Render the table list with the actions open to us on each table.
+function _renderGameTables() {
+  const listEl = document.getElementById("game-tables");
+  if (!listEl) return;
+  listEl.textContent = "";
+  const busy = diceGameRunning && !gameEnded;
+  gameTables.forEach((t) => {
+    const li = document.createElement("li");
+    li.className = "game-table" + (t.id === currentGameID ? " current" : "");
+    const label = document.createElement("span");
+    const host = t.host === myID ? "Your" : `${_playerName(t.host, "?")}'s`;
+    const variant = t.variant === "bigpig" ? "Big Pig" : "Pig";
+    const players = (t.roster || []).length;
+    label.textContent = `${host} ${variant} table · ${players} player${players === 1 ? "" : "s"} · ${t.status}`;
+    li.appendChild(label);
+
+    const button = (text, onClick) => {
+      const b = document.createElement("button");
+      b.type = "button";
+      b.textContent = text;
+      b.addEventListener("click", onClick);
+      li.appendChild(b);
+    };
+    const inRoster = (t.roster || []).includes(myID);
+    if (t.status === "open") {
+      if (t.host === myID) {
+        button("Start", () => _sendGameSignal("game_start", t.id));
+      } else if (!busy) {
+        button(inRoster ? "Leave" : "Join", () => _sendGameSignal(inRoster ? "game_leave" : "game_join", t.id));
+      }
+    } else if (t.id === currentGameID && diceGameSpectating) {
+      button("Stop watching", () => _resetGameState());
+    } else if (t.id !== currentGameID && !busy) {
+      button(_myRosterSlot(t) >= 0 && t.status === "playing" ? "Rejoin" : "Watch", () => _joinTableGame(t));
+    }
+    if (t.host === myID) {
+      button("Close", () => _sendGameSignal("game_close", t.id));
+    }
+    listEl.appendChild(li);
+  });
 }
 
 // Called by video.js when a peer disconnects. The server preserves their
@@ -671,10 +758,34 @@ function onPlayerLeft(peerID) {
   const statusEl = document.getElementById("game-status");
   if (!statusEl) return;
   const slot = playerSlots[peerID];
-  const label = typeof slot === "number" ? `Player ${slot + 1}` : "A player";
+  const label = typeof slot === "number" ? _playerName(peerID, slot + 1) : (displayName(peerID) || "A player");
   statusEl.textContent = `${label} disconnected — waiting for rejoin…`;
 }
 
+// Called by video.js when a member changes their name or avatar, so chips
+// show the new name without waiting for the next turn.
+function onPresenceUpdated(peerID) {
+  if (gameRoster.includes(peerID)) _updateGamePlayerList(gameRoster, myGameSlot);
+}
+
+// Called by video.js on each room_health report, so the chips' signal bars
+// stay current between turns.
+function onRoomHealth() {
+  if (diceGameRunning || diceGameSpectating) {
+    if (gameRoster.length) _updateGamePlayerList(gameRoster, myGameSlot);
+  } else {
+    _updateGamePlayerList(_playerListBySlot(), mySlot);
+  }
+}
+
+// Called by video.js when the host moves us to another breakout table.
+// Each table runs its own game, so whatever we were in is over for us; the
+// "peers" message that follows repopulates the chips for the new table.
+function onBreakoutChanged() {
+  gameTables = [];
+  _resetGameState();
+}
+
 // Called by video.js when the local WebSocket drops (network blip, server
 // restart, etc.). The reconnect runs automatically in the background.
 function onWSDisconnected() {
@@ -695,6 +806,16 @@ let turnStartedAt = 0;
 // active (so the turn timer + kick enable update visually).
 let chipTickHandle = null;
 
+// _playerName prefers a member's display name over "Player N".
+function _playerName(id, n) {
+  return (id && displayName(id)) || `Player ${n}`;
+}
+
+function _escapeHTML(s) {
+  return String(s).replace(/[&<>"']/g, (c) =>
+    ({ "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" })[c]);
+}
+
 function _formatElapsed(secs) {
   const m = Math.floor(secs / 60);
   const s = secs % 60;
@@ -719,7 +840,7 @@ function _updateGamePlayerList(players, myPlayerIdx) {
     if (isKicked)  classes.push("kicked");
     if (isCurrent) classes.push("current");
 
-    let label = isMe ? `<strong>You (P${idx + 1})</strong>` : `Player ${idx + 1}`;
+    let label = isMe ? `<strong>You (P${idx + 1})</strong>` : _escapeHTML(_playerName(id, idx + 1));
     if (isKicked) label += " <em>(kicked)</em>";
 
     let extras = "";
@@ -737,7 +858,7 @@ function _updateGamePlayerList(players, myPlayerIdx) {
               + `${canKick ? "" : " disabled"} title="${title}">&times;</button>`;
     }
 
-    return `<span class="${classes.join(" ")}">${label}${extras}</span>`;
+    return `<span class="${classes.join(" ")}">${label}${signalBarsHTML(id)}${extras}</span>`;
   }).join("");
 
   // Re-wire kick buttons after each render.
@@ -766,13 +887,7 @@ function _ensureChipTick() {
 function _broadcastKick(slot) {
   if (gameHostID !== myID) return;     // only host can kick
   if (slot === myGameSlot) return;     // can't self-kick
-  sendSignal({
-    type:   "player_kick",
-    from:   myID,
-    to:     "room",
-    roomID: roomID,
-    slot:   slot,
-  });
+  _sendGameSignal("player_kick", currentGameID, { slot });
   _applyKick(slot, myID);
 }
 
@@ -782,10 +897,6 @@ function _applyKick(slot, fromID) {
   if (slot < 0 || slot >= gameRoster.length) return;
   if (kickedSlots.has(slot)) return;          // already applied
   kickedSlots.add(slot);
-  // Persist the kick across rounds — the auto-roster builder consults
-  // kickedClientIDs so an AFK player stays out of the next New Game.
-  const clientID = gameRoster[slot];
-  if (clientID && clientID !== myID) kickedClientIDs.add(clientID);
   if (typeof window.diceGameKick === "function") {
     window.diceGameKick(slot);
   }
@@ -0,0 +1,41 @@
+// schedule.js
+// Scheduled rooms. On the rooms page it fills the create form's hidden
+// time zone with the browser's, so a start typed as local time means what
+// the creator expects. On a scheduled room's lobby it counts down to the
+// room opening and reloads into the room when it does.
+
+const tzInput = document.getElementById("schedule-tz");
+if (tzInput) {
+  try {
+    tzInput.value = Intl.DateTimeFormat().resolvedOptions().timeZone || "UTC";
+  } catch (e) {
+    tzInput.value = "UTC";
+  }
+}
+
+const countdown = document.getElementById("lobby-countdown");
+if (countdown) {
+  const opens = new Date(countdown.dataset.opens).getTime();
+  const next = document.getElementById("lobby-next");
+  if (next) {
+    next.textContent = new Date(next.dataset.start).toLocaleString(undefined, {
+      weekday: "long", month: "long", day: "numeric", hour: "numeric", minute: "2-digit",
+    });
+  }
+
+  const pad = (n) => String(n).padStart(2, "0");
+  const tick = () => {
+    const left = Math.max(0, Math.round((opens - Date.now()) / 1000));
+    const days = Math.floor(left / 86400);
+    const h = Math.floor((left % 86400) / 3600);
+    const m = Math.floor((left % 3600) / 60);
+    countdown.textContent = (days ? days + "d " : "") + pad(h) + ":" + pad(m) + ":" + pad(left % 60);
+    if (left === 0) {
+      // A second's grace so the server agrees the room is open.
+      setTimeout(() => location.reload(), 1000);
+      return;
+    }
+    setTimeout(tick, 1000);
+  };
+  if (!isNaN(opens)) tick();
+}
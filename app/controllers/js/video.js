@@ -3,6 +3,11 @@
 const videoRoot = document.getElementById("video-root");
 const roomID = videoRoot.dataset.roomId;
 
+// ICE servers come from the server's config (embedded STUN and/or external
+// servers) so nothing is hardcoded here. /api/ice-servers serves the same list.
+let iceServers = [];
+try { iceServers = JSON.parse(videoRoot.dataset.iceServers || "[]"); } catch (_) {}
+
 function randomID() {
   const bytes = new Uint8Array(8);
   crypto.getRandomValues(bytes);
@@ -10,9 +15,11 @@ function randomID() {
 }
 
 // Stable client ID, persisted across reloads so the server can restore the
-// player's slot on refresh/rejoin.
+// player's slot on refresh/rejoin. Signed-in players use their account's
+// ID, which the page carries, so the slot follows them between devices.
 const CLIENT_ID_STORAGE_KEY = "pig.clientID";
 function getOrCreateClientID() {
+  if (videoRoot.dataset.clientId) return videoRoot.dataset.clientId;
   let id = null;
   try { id = window.localStorage.getItem(CLIENT_ID_STORAGE_KEY); } catch (_) {}
   if (!id || !/^[a-f0-9]{16}$/.test(id)) {
@@ -22,9 +29,20 @@ function getOrCreateClientID() {
   return id;
 }
 const myID = getOrCreateClientID();
+// Mirror the clientID into a cookie so page handlers know who is asking.
+// TURN credentials are minted for a server-issued ID instead.
+document.cookie = "pig_client=" + myID + "; path=/; max-age=31536000; SameSite=Lax";
 const peers = Object.create(null);
 const pendingPeers = new Set();
 
+// Room media mode from the "peers" message. In "sfu" rooms we hold a single
+// connection to the server's virtual peer instead of one per participant;
+// the server always offers and we only answer.
+let roomMode = "mesh";
+let sfuPeerID = null;
+let sfuPC = null;
+let sfuQueue = Promise.resolve();  // serializes SFU offers and candidates
+
 // Server-assigned slot info, populated from the "peers" and "player_joined"
 // messages. Read by dice_game.js to determine player ordering.
 let mySlot = -1;
@@ -32,8 +50,42 @@ const playerSlots = Object.create(null);  // clientID -> slot index
 const wsScheme = window.location.protocol === "https:" ? "wss://" : "ws://";
 const wsURL = wsScheme + window.location.host + "/rooms/" + encodeURIComponent(roomID) + "/ws?userID=" + encodeURIComponent(myID);
 
+// Presence: our display name, avatar colour and media state, announced on
+// every (re)connect via the URL and updated with presence_update frames.
+// Name and avatar persist across visits; media state starts fresh.
+const PRESENCE_STORAGE_KEY = "pig.presence";
+const myPresence = { name: "", avatar: "", micMuted: false, cameraOff: false, screenSharing: false, handRaised: false };
+try {
+  const saved = JSON.parse(window.localStorage.getItem(PRESENCE_STORAGE_KEY) || "{}");
+  if (typeof saved.name === "string") myPresence.name = saved.name;
+  if (typeof saved.avatar === "string") myPresence.avatar = saved.avatar;
+} catch (_) {}
+if (!myPresence.name && videoRoot.dataset.username) myPresence.name = videoRoot.dataset.username.slice(0, 32);
+const peerPresence = Object.create(null);  // clientID -> presence
+// Everyone's connection as the server measures it, from its periodic
+// room_health message: clientID -> { rttMs, jitterMs, reconnects, bars }.
+const roomHealth = Object.create(null);
+
+// Fallback transport for networks whose proxies break WebSocket upgrades:
+// frames arrive over Server-Sent Events and are sent with POST. We switch
+// after WS_FAILURES_BEFORE_SSE attempts in a row that never opened.
+const eventsURL = "/rooms/" + encodeURIComponent(roomID) + "/events?userID=" + encodeURIComponent(myID);
+
+function presenceParam() {
+  return "&presence=" + encodeURIComponent(JSON.stringify(myPresence));
+}
+const signalURL = "/rooms/" + encodeURIComponent(roomID) + "/signal";
+const WS_FAILURES_BEFORE_SSE = 2;
+let wsFailures = 0;
+let wsOpened = false;
+let useSSE = false;
+let eventSource = null;
+let sseToken = null;
+
 let ws = null;
 let localStream = null;
+let resolveMediaReady;
+const mediaReady = new Promise((resolve) => { resolveMediaReady = resolve; });
 
 // Auto-reconnect state. The server preserves slot assignments across
 // disconnect, so a reconnect restores the same player number.
@@ -53,6 +105,14 @@ document.getElementById("copy-link-btn").addEventListener("click", () => {
   });
 });
 
+// QR invite: toggles the server-rendered QR code of the room link, for
+// phones across the table.
+document.getElementById("qr-btn").addEventListener("click", (evt) => {
+  const panel = document.getElementById("qr-invite");
+  panel.hidden = !panel.hidden;
+  evt.currentTarget.setAttribute("aria-expanded", String(!panel.hidden));
+});
+
 // SMS invite. On mobile we prefer the native share sheet (Web Share API)
 // which lets the user pick Messages, WhatsApp, etc. without us hard-coding
 // the sms: protocol — that one has been flaky across iOS Safari versions
@@ -104,14 +164,352 @@ function updateLayout() {
   grid.style.gridTemplateColumns = `repeat(${cols}, 1fr)`;
 }
 
+// displayName returns a member's chosen name, or "" if they haven't set one.
+function displayName(id) {
+  const p = id === myID ? myPresence : peerPresence[id];
+  return p && p.name ? p.name : "";
+}
+
+// videoTile returns the tile (video + label) for a peer, creating it.
+function videoTile(peerID) {
+  let tile = document.querySelector(`.video-tile[data-peer-id="${peerID}"]`);
+  if (tile) return tile;
+  tile = document.createElement("div");
+  tile.className = "video-tile";
+  tile.dataset.peerId = peerID;
+  const video = document.createElement("video");
+  video.autoplay = true;
+  video.playsInline = true;
+  video.dataset.peerId = peerID;
+  const label = document.createElement("div");
+  label.className = "video-label";
+  tile.append(video, label);
+  document.getElementById("video-grid").appendChild(tile);
+  renderPresence(peerID);
+  updateLayout();
+  return tile;
+}
+
+// renderPresence refreshes a tile's label from the member's presence.
+// Everything goes in via textContent; names are user input.
+function renderPresence(peerID) {
+  const tile = document.querySelector(`.video-tile[data-peer-id="${peerID}"]`);
+  if (!tile) return;
+  const p = (peerID === myID ? myPresence : peerPresence[peerID]) || {};
+  const label = tile.querySelector(".video-label");
+  label.textContent = "";
+  const avatar = document.createElement("span");
+  avatar.className = "video-avatar";
+  if (/^#[0-9a-f]{3,8}$/i.test(p.avatar || "")) {
+    avatar.style.background = p.avatar;
+  } else if (p.avatar) {
+    avatar.textContent = p.avatar;
+  }
+  const name = document.createElement("span");
+  name.textContent = peerID === myID ? (p.name || "You") + " (you)" : p.name || "Guest";
+  label.append(avatar, name);
+  const flags = [];
+  if (p.handRaised) flags.push("\u270B");
+  if (p.micMuted) flags.push("\u{1F507}");
+  if (p.cameraOff) flags.push("\u{1F6AB}\u{1F4F7}");
+  if (p.screenSharing) flags.push("\u{1F5A5}");
+  if (flags.length) {
+    const icons = document.createElement("span");
+    icons.className = "video-flags";
+    icons.textContent = flags.join(" ");
+    label.appendChild(icons);
+  }
+  label.insertAdjacentHTML("beforeend", signalBarsHTML(peerID));
+  tile.classList.toggle("hand-raised", !!p.handRaised);
+}
+
+// signalBarsHTML renders a member's connection quality as up to four
+// bars, or "" before the server has measured it. Everything in it is a
+// number, so it is safe to put in innerHTML.
+function signalBarsHTML(peerID) {
+  const q = roomHealth[peerID];
+  const bars = q ? Math.max(0, Math.min(4, q.bars | 0)) : 0;
+  if (!bars) return "";
+  let title = `${q.rttMs | 0} ms round trip, \u00B1${q.jitterMs | 0} ms`;
+  if (q.reconnects) title += `, ${q.reconnects | 0} reconnect${q.reconnects === 1 ? "" : "s"} lately`;
+  let html = `<span class="signal-bars bars-${bars}" title="${title}" aria-label="Connection ${bars} of 4">`;
+  for (let i = 1; i <= 4; i++) html += i <= bars ? `<i class="on"></i>` : "<i></i>";
+  return html + "</span>";
+}
+
+// setPresence merges changes into our presence, saves the name and avatar,
+// and tells the room.
+function setPresence(changes) {
+  Object.assign(myPresence, changes);
+  try {
+    window.localStorage.setItem(PRESENCE_STORAGE_KEY,
+      JSON.stringify({ name: myPresence.name, avatar: myPresence.avatar }));
+  } catch (_) {}
+  renderPresence(myID);
+  renderPresenceControls();
+  sendSignal({ type: "presence_update", from: myID, to: "room", roomID, presence: myPresence });
+  if (typeof onPresenceUpdated === "function") onPresenceUpdated(myID);
+}
+
+const nameInput = document.getElementById("presence-name");
+const avatarInput = document.getElementById("presence-avatar");
+const micBtn = document.getElementById("mic-btn");
+const cameraBtn = document.getElementById("camera-btn");
+const handBtn = document.getElementById("hand-btn");
+
+function renderPresenceControls() {
+  micBtn.textContent = myPresence.micMuted ? "\u{1F507} Unmute" : "\u{1F3A4} Mute";
+  cameraBtn.textContent = myPresence.cameraOff ? "\u{1F4F7} Start Video" : "\u{1F4F7} Stop Video";
+  handBtn.classList.toggle("active", myPresence.handRaised);
+}
+
+// applyMediaState enables or disables our outgoing tracks to match the
+// mute/camera toggles.
+function applyMediaState() {
+  if (!localStream) return;
+  localStream.getAudioTracks().forEach((t) => { t.enabled = !myPresence.micMuted; });
+  localStream.getVideoTracks().forEach((t) => { t.enabled = !myPresence.cameraOff; });
+}
+
+nameInput.value = myPresence.name;
+if (/^#[0-9a-f]{6}$/i.test(myPresence.avatar)) avatarInput.value = myPresence.avatar;
+nameInput.addEventListener("change", () => setPresence({ name: nameInput.value.trim().slice(0, 32) }));
+avatarInput.addEventListener("change", () => setPresence({ avatar: avatarInput.value }));
+micBtn.addEventListener("click", () => { setPresence({ micMuted: !myPresence.micMuted }); applyMediaState(); });
+cameraBtn.addEventListener("click", () => { setPresence({ cameraOff: !myPresence.cameraOff }); applyMediaState(); });
+handBtn.addEventListener("click", () => setPresence({ handRaised: !myPresence.handRaised }));
+document.getElementById("local-tile").dataset.peerId = myID;
+renderPresenceControls();
+renderPresence(myID);
+
+// Recording (SFU rooms only). Anyone sees whether the room is being
+// recorded; only the host's start/stop requests are honoured by the server,
+// and only the host is sent the download link.
+const recordBtn = document.getElementById("record-btn");
+const recordingStatus = document.getElementById("recording-status");
+let roomRecording = false;
+
+function setRecording(on) {
+  roomRecording = on;
+  recordBtn.classList.toggle("recording", on);
+  recordBtn.textContent = on ? "\u23F9 Stop Recording" : "\u23FA Record";
+}
+
+recordBtn.addEventListener("click", () => {
+  if (!sfuPeerID) return;
+  sendSignal({ type: roomRecording ? "recording_stop" : "recording_start", from: myID, to: sfuPeerID, roomID });
+});
+
+function handleRecordingMessage(msg) {
+  recordingStatus.textContent = "";
+  switch (msg.type) {
+    case "recording_started":
+      setRecording(true);
+      recordingStatus.textContent = "\u25CF Recording";
+      break;
+    case "recording_stopped":
+      setRecording(false);
+      if (msg.url) {
+        const link = document.createElement("a");
+        link.href = msg.url;
+        link.textContent = "Download recording";
+        recordingStatus.appendChild(link);
+      }
+      break;
+    case "recording_error":
+      recordingStatus.textContent = msg.error || "Recording failed";
+      break;
+  }
+}
+
+// Breakouts: the host can split the room into tables. Peers, slots and
+// "room" broadcasts are scoped to our table by the server; when we are
+// moved we drop every connection and rebuild from the fresh "peers"
+// message that follows. Announcements reach every table.
+const breakoutPanel = document.getElementById("breakout-panel");
+const breakoutList = document.getElementById("breakout-list");
+const breakoutHostControls = document.getElementById("breakout-host-controls");
+const announcementEl = document.getElementById("announcement");
+let breakoutLayout = null;  // last "breakouts" message, null if none
+let myBreakoutID = "";
+// After a (re)connect the "peers" message already reflects our table, so
+// the first layout only records where we are.
+let breakoutSynced = false;
+let announcementTimer = null;
+
+// currentHostID mirrors the server's roomHost: the connected member with
+// the lowest room slot. Inside a breakout our slot map is the table's, so
+// we rely on the host the server reports with the layout.
+function currentHostID() {
+  if (breakoutLayout) return breakoutLayout.host;
+  let host = null;
+  [myID, ...Object.keys(peerPresence)].forEach((id) => {
+    const slot = playerSlots[id];
+    if (typeof slot === "number" && (host === null || slot < playerSlots[host])) host = id;
+  });
+  return host;
+}
+
+// dropAllPeers tears down every media connection and remote video.
+function dropAllPeers() {
+  Object.keys(peers).forEach((peerID) => {
+    peers[peerID].close();
+    delete peers[peerID];
+    removePeerVideo(peerID);
+  });
+  pendingPeers.clear();
+}
+
+function handleBreakoutsMessage(msg) {
+  breakoutLayout = msg.breakouts.length ? msg : null;
+  const known = new Set(msg.main);
+  msg.breakouts.forEach((b) => b.members.forEach((id) => known.add(id)));
+  Object.keys(peerPresence).forEach((id) => { if (!known.has(id)) delete peerPresence[id]; });
+
+  const mine = msg.breakouts.find((b) => b.members.includes(myID));
+  const nowIn = mine ? mine.id : "";
+  if (breakoutSynced && nowIn !== myBreakoutID) {
+    dropAllPeers();
+    Object.keys(playerSlots).forEach((id) => { delete playerSlots[id]; });
+    if (typeof onBreakoutChanged === "function") onBreakoutChanged();
+  }
+  myBreakoutID = nowIn;
+  breakoutSynced = true;
+  renderBreakouts();
+  if (typeof onChatMembersChanged === "function") onChatMembersChanged();
+}
+
+// renderBreakouts lists the tables; the host also gets move and close
+// controls. Names go in via textContent.
+function renderBreakouts() {
+  const amHost = roomMode === "mesh" && currentHostID() === myID;
+  breakoutPanel.style.display = breakoutLayout || amHost || !announcementEl.hidden ? "" : "none";
+  breakoutHostControls.style.display = amHost ? "" : "none";
+  breakoutList.textContent = "";
+  if (!breakoutLayout) return;
+
+  const groups = [{ id: "", name: "Main room", members: breakoutLayout.main }, ...breakoutLayout.breakouts];
+  groups.forEach((g) => {
+    const li = document.createElement("li");
+    if (g.id === myBreakoutID) li.className = "mine";
+    const title = document.createElement("strong");
+    title.textContent = g.name;
+    li.appendChild(title);
+    if (amHost && g.id) {
+      const close = document.createElement("button");
+      close.type = "button";
+      close.className = "breakout-close";
+      close.title = "Close table";
+      close.textContent = "\u00D7";
+      close.addEventListener("click", () => {
+        sendSignal({ type: "breakout_close", from: myID, to: "room", roomID, breakoutID: g.id });
+      });
+      li.appendChild(close);
+    }
+    g.members.forEach((id) => {
+      const member = document.createElement("span");
+      member.className = "breakout-member";
+      member.textContent = id === myID ? "You" : displayName(id) || "Guest";
+      if (amHost) {
+        const move = document.createElement("select");
+        move.setAttribute("aria-label", "Move to");
+        groups.forEach((target) => {
+          const opt = document.createElement("option");
+          opt.value = target.id;
+          opt.textContent = target.name;
+          opt.selected = target.id === g.id;
+          move.appendChild(opt);
+        });
+        move.addEventListener("change", () => {
+          sendSignal({ type: "breakout_move", from: myID, to: "room", roomID, clientID: id, breakoutID: move.value });
+        });
+        member.appendChild(move);
+      }
+      li.appendChild(member);
+    });
+    breakoutList.appendChild(li);
+  });
+}
+
+function showAnnouncement(msg) {
+  announcementEl.textContent = "\u{1F4E3} " + msg.text;
+  announcementEl.hidden = false;
+  renderBreakouts();
+  clearTimeout(announcementTimer);
+  announcementTimer = setTimeout(() => {
+    announcementEl.hidden = true;
+    renderBreakouts();
+  }, 20000);
+}
+
+const REMOVED_TEXT = {
+  closed: "This room was closed by the site operator.",
+  banned: "You have been banned from rooms on this site.",
+  disconnected: "You were disconnected by the site operator. Reload the page to rejoin.",
+};
+
+// The server removed us; the notice stays up since we won't reconnect.
+function showRemoved(reason) {
+  clearTimeout(announcementTimer);
+  announcementEl.textContent = "\u26A0\uFE0F " + (REMOVED_TEXT[reason] || REMOVED_TEXT.disconnected);
+  announcementEl.hidden = false;
+  renderBreakouts();
+}
+
+document.getElementById("breakout-create-form").addEventListener("submit", (evt) => {
+  evt.preventDefault();
+  const input = document.getElementById("breakout-name");
+  sendSignal({ type: "breakout_create", from: myID, to: "room", roomID, name: input.value.trim() });
+  input.value = "";
+});
+
+document.getElementById("announce-form").addEventListener("submit", (evt) => {
+  evt.preventDefault();
+  const input = document.getElementById("announce-text");
+  const text = input.value.trim();
+  if (!text) return;
+  sendSignal({ type: "announcement", from: myID, to: "room", roomID, text });
+  input.value = "";
+});
+
 function connectWS() {
-  ws = new WebSocket(wsURL);
-  ws.onopen = onWSOpen;
+  if (useSSE) {
+    connectSSE();
+    return;
+  }
+  wsOpened = false;
+  ws = new WebSocket(wsURL + presenceParam());
+  ws.onopen = () => { wsOpened = true; wsFailures = 0; onWSOpen(); };
   ws.onmessage = onWSMessage;
-  ws.onclose = onWSClose;
+  ws.onclose = () => {
+    if (!wsOpened && ++wsFailures >= WS_FAILURES_BEFORE_SSE) {
+      console.warn("[WS] upgrade keeps failing; falling back to SSE");
+      useSSE = true;
+    }
+    onWSClose();
+  };
   ws.onerror = (err) => console.error("[WS] error:", err);
 }
 
+function connectSSE() {
+  sseToken = null;
+  eventSource = new EventSource(eventsURL + presenceParam());
+  eventSource.addEventListener("session", (evt) => {
+    sseToken = evt.data;
+    onWSOpen();
+  });
+  eventSource.onmessage = onWSMessage;
+  // EventSource would retry on its own, but every retry is a new server
+  // session; go through the normal reconnect path so peer state is reset.
+  eventSource.onerror = () => {
+    if (!eventSource) return;
+    eventSource.close();
+    eventSource = null;
+    sseToken = null;
+    onWSClose();
+  };
+}
+
 function scheduleReconnect() {
   if (manualClose || reconnectTimer) return;
   const delay = Math.min(RECONNECT_MAX_MS, RECONNECT_MIN_MS * Math.pow(2, reconnectAttempts));
@@ -138,7 +536,20 @@ function onWSMessage(evt) {
     if (msg.slots && typeof msg.slots === "object") {
       Object.keys(msg.slots).forEach((id) => { playerSlots[id] = msg.slots[id]; });
     }
+    roomMode = msg.mode === "sfu" ? "sfu" : "mesh";
+    sfuPeerID = roomMode === "sfu" ? msg.sfuPeer : null;
+    recordBtn.style.display = msg.canRecord ? "" : "none";
+    if (msg.presence && typeof msg.presence === "object") {
+      Object.keys(msg.presence).forEach((id) => {
+        if (id === myID) return;
+        peerPresence[id] = msg.presence[id];
+        renderPresence(id);
+      });
+    }
+    setRecording(!!msg.recording);
+    if (msg.recording) recordingStatus.textContent = "\u25CF Recording";
     msg.peers.forEach((peerID) => {
+      if (roomMode === "sfu") return;
       if (peerID === myID || peers[peerID]) return;
       if (localStream) {
         const pc = createPeerConnection(peerID);
@@ -148,6 +559,9 @@ function onWSMessage(evt) {
       }
     });
     if (typeof onSlotsUpdated === "function") onSlotsUpdated();
+    if (typeof resetChat === "function") resetChat();
+    if (typeof resetGameTables === "function") resetGameTables();
+    renderBreakouts();
     return;
   }
 
@@ -157,6 +571,8 @@ function onWSMessage(evt) {
   if (msg.type === "player_joined") {
     if (msg.peerID && typeof msg.slot === "number") {
       playerSlots[msg.peerID] = msg.slot;
+      peerPresence[msg.peerID] = msg.presence || {};
+      if (roomMode === "sfu") removePeerVideo(msg.peerID);
       if (peers[msg.peerID]) {
         peers[msg.peerID].close();
         delete peers[msg.peerID];
@@ -164,6 +580,8 @@ function onWSMessage(evt) {
       }
       if (typeof onSlotsUpdated === "function") onSlotsUpdated();
       if (typeof onPlayerJoined === "function") onPlayerJoined(msg.peerID);
+      if (typeof onChatMembersChanged === "function") onChatMembersChanged();
+      renderBreakouts();
     }
     return;
   }
@@ -178,12 +596,71 @@ function onWSMessage(evt) {
       }
       removePeerVideo(msg.peerID);
       if (typeof onPlayerLeft === "function") onPlayerLeft(msg.peerID);
+      delete peerPresence[msg.peerID];
+      if (typeof onChatMembersChanged === "function") onChatMembersChanged();
+      renderBreakouts();
     }
     return;
   }
 
-  // Dice game coordination messages (broadcast or direct).
-  if (msg.type === "game_start" || msg.type === "game_event" || msg.type === "player_kick") {
+  if (msg.type === "presence_updated") {
+    if (msg.peerID && msg.peerID !== myID && msg.presence) {
+      peerPresence[msg.peerID] = msg.presence;
+      renderPresence(msg.peerID);
+      if (typeof onPresenceUpdated === "function") onPresenceUpdated(msg.peerID);
+      if (typeof onChatMembersChanged === "function") onChatMembersChanged();
+    }
+    return;
+  }
+
+  // The server's report of everyone's connection, every few seconds.
+  if (msg.type === "room_health") {
+    Object.keys(roomHealth).forEach((id) => { delete roomHealth[id]; });
+    if (msg.members && typeof msg.members === "object") Object.assign(roomHealth, msg.members);
+    document.querySelectorAll(".video-tile[data-peer-id]").forEach((tile) => renderPresence(tile.dataset.peerId));
+    if (typeof onRoomHealth === "function") onRoomHealth();
+    return;
+  }
+  // The SSE transport's round-trip probe; over WebSocket the server pings
+  // with control frames, which the browser answers itself.
+  if (msg.type === "ping") {
+    sendSignal({ type: "pong", from: myID, roomID, id: msg.id });
+    return;
+  }
+
+  if (msg.type === "breakouts") {
+    handleBreakoutsMessage(msg);
+    return;
+  }
+  if (msg.type === "announcement") {
+    showAnnouncement(msg);
+    return;
+  }
+  // An operator disconnected or banned us, or closed the room. The server
+  // hangs up next; stay disconnected rather than reconnecting.
+  if (msg.type === "removed") {
+    manualClose = true;
+    showRemoved(msg.reason);
+    return;
+  }
+  if (msg.type === "breakout_error") {
+    console.warn("[Breakouts]", msg.error);
+    return;
+  }
+
+  if (msg.type === "chat" || msg.type === "chat_history" || msg.type === "chat_deleted") {
+    if (typeof handleChatMessage === "function") handleChatMessage(msg);
+    return;
+  }
+
+  if (msg.type === "recording_started" || msg.type === "recording_stopped" || msg.type === "recording_error") {
+    handleRecordingMessage(msg);
+    return;
+  }
+
+  // Dice game coordination messages (broadcast or direct) and the server's
+  // table list.
+  if (msg.type === "games" || msg.type === "game_start" || msg.type === "game_event" || msg.type === "player_kick") {
     if (typeof handleDiceGameMessage === "function") {
       handleDiceGameMessage(msg);
     }
@@ -194,6 +671,11 @@ function onWSMessage(evt) {
   const from = msg.from;
   if (!from || from === myID) return;
 
+  if (roomMode === "sfu") {
+    if (from === sfuPeerID) handleSFUSignal(msg);
+    return;
+  }
+
   let pc = peers[from];
   if (!pc) {
     pc = createPeerConnection(from);
@@ -227,14 +709,13 @@ function onWSClose() {
   console.log("WS closed");
   // Drop all peer state — a fresh "peers" message on reconnect will rebuild
   // the WebRTC mesh from scratch.
-  Object.keys(peers).forEach((peerID) => {
-    peers[peerID].close();
-    delete peers[peerID];
-    removePeerVideo(peerID);
-  });
-  pendingPeers.clear();
+  dropAllPeers();
+  breakoutSynced = false;
+  closeSFU();
   mySlot = -1;
   Object.keys(playerSlots).forEach((id) => { delete playerSlots[id]; });
+  Object.keys(peerPresence).forEach((id) => { delete peerPresence[id]; });
+  Object.keys(roomHealth).forEach((id) => { delete roomHealth[id]; });
   if (typeof onWSDisconnected === "function") onWSDisconnected();
   scheduleReconnect();
 }
@@ -242,27 +723,44 @@ function onWSClose() {
 window.addEventListener("beforeunload", () => {
   manualClose = true;
   if (ws) ws.close();
+  if (eventSource) eventSource.close();
 });
 
+// POSTs on the SSE transport are chained so frames arrive in order, as
+// they would over a socket.
+let signalQueue = Promise.resolve();
+
 function sendSignal(payload) {
+  if (useSSE) {
+    if (!sseToken) return;
+    const token = sseToken;
+    const body = JSON.stringify(payload);
+    signalQueue = signalQueue
+      .then(() => fetch(signalURL, {
+        method: "POST",
+        headers: { "Content-Type": "application/json", "X-Session-Token": token },
+        body,
+      }))
+      .then((res) => { if (!res.ok) console.warn("[SSE] signal rejected:", res.status); })
+      .catch((err) => console.error("[SSE] signal failed:", err));
+    return;
+  }
   if (ws && ws.readyState === WebSocket.OPEN) {
     ws.send(JSON.stringify(payload));
   }
 }
 
 function removePeerVideo(peerID) {
-  const video = document.querySelector(`video[data-peer-id="${peerID}"]`);
-  if (video) {
-    video.srcObject = null;
-    video.remove();
+  const tile = document.querySelector(`.video-tile[data-peer-id="${peerID}"]`);
+  if (tile) {
+    tile.querySelector("video").srcObject = null;
+    tile.remove();
     updateLayout();
   }
 }
 
 function createPeerConnection(peerID) {
-  const pc = new RTCPeerConnection({
-    iceServers: [{ urls: "stun:stun.l.google.com:19302" }],
-  });
+  const pc = new RTCPeerConnection({ iceServers });
 
   if (localStream) {
     localStream.getTracks().forEach((track) => pc.addTrack(track, localStream));
@@ -277,15 +775,7 @@ function createPeerConnection(peerID) {
   pc.ontrack = (evt) => {
     const stream = evt.streams[0];
     if (!stream) return;
-    let video = document.querySelector(`video[data-peer-id="${peerID}"]`);
-    if (!video) {
-      video = document.createElement("video");
-      video.autoplay = true;
-      video.playsInline = true;
-      video.dataset.peerId = peerID;
-      document.getElementById("video-grid").appendChild(video);
-      updateLayout();
-    }
+    const video = videoTile(peerID).querySelector("video");
     if (video.srcObject !== stream) {
       video.srcObject = stream;
     }
@@ -311,12 +801,97 @@ function createPeerConnection(peerID) {
   return pc;
 }
 
+// handleSFUSignal applies one signaling frame from the server's virtual
+// peer. Frames are chained so an offer is fully answered before the next
+// one (or a trickled candidate) is applied, and nothing is answered until
+// the camera is ready so our tracks are in the first answer.
+function handleSFUSignal(msg) {
+  sfuQueue = sfuQueue
+    .then(() => mediaReady)
+    .then(() => {
+      if (!sfuPC) sfuPC = createSFUConnection();
+      const pc = sfuPC;
+      switch (msg.type) {
+        case "offer":
+          return pc.setRemoteDescription({ type: "offer", sdp: msg.sdp })
+            .then(() => attachLocalTracks(pc))
+            .then(() => pc.createAnswer())
+            .then((answer) => pc.setLocalDescription(answer))
+            .then(() => {
+              sendSignal({ type: "answer", from: myID, to: sfuPeerID, roomID, sdp: pc.localDescription.sdp });
+            });
+        case "candidate":
+          if (msg.ice) return pc.addIceCandidate(msg.ice);
+      }
+    })
+    .catch((err) => console.error("[SFU] signaling error", err));
+}
+
+// attachLocalTracks publishes our camera and microphone on the transceivers
+// the server offered to receive on (one per kind).
+function attachLocalTracks(pc) {
+  if (!localStream) return Promise.resolve();
+  const pending = [];
+  localStream.getTracks().forEach((track) => {
+    const t = pc.getTransceivers().find((tr) =>
+      tr.receiver.track && tr.receiver.track.kind === track.kind &&
+      !tr.sender.track && tr.currentDirection !== "stopped" &&
+      (tr.direction === "recvonly" || tr.direction === "sendrecv") &&
+      !pc.getSenders().some((s) => s.track === track));
+    if (!t) return;
+    t.direction = "sendrecv";
+    pending.push(t.sender.replaceTrack(track));
+  });
+  return Promise.all(pending);
+}
+
+function createSFUConnection() {
+  const pc = new RTCPeerConnection({ iceServers });
+
+  pc.onicecandidate = (evt) => {
+    if (evt.candidate) {
+      sendSignal({ type: "candidate", from: myID, to: sfuPeerID, roomID, ice: evt.candidate });
+    }
+  };
+
+  // Every forwarded stream's ID is its publisher's clientID, so videos are
+  // keyed the same way as in mesh rooms.
+  pc.ontrack = (evt) => {
+    const stream = evt.streams[0];
+    if (!stream || stream.id === myID) return;
+    const video = videoTile(stream.id).querySelector("video");
+    if (video.srcObject !== stream) {
+      video.srcObject = stream;
+    }
+  };
+
+  pc.onconnectionstatechange = () => {
+    if (pc.connectionState === "failed" && sfuPC === pc) {
+      console.warn("[SFU] connection failed; reconnecting");
+      if (ws) ws.close();  // the reconnect path rebuilds everything
+    }
+  };
+
+  return pc;
+}
+
+function closeSFU() {
+  if (!sfuPC) return;
+  sfuPC.close();
+  sfuPC = null;
+  sfuQueue = Promise.resolve();
+  document.querySelectorAll("#video-grid .video-tile[data-peer-id]").forEach((tile) => {
+    if (tile.dataset.peerId !== myID) removePeerVideo(tile.dataset.peerId);
+  });
+}
+
 connectWS();
 
 navigator.mediaDevices
   .getUserMedia({ video: true, audio: true })
   .then((stream) => {
     localStream = stream;
+    applyMediaState();
     const localVideo = document.getElementById("local_video");
     localVideo.srcObject = stream;
     updateLayout();
@@ -327,11 +902,16 @@ navigator.mediaDevices
       }
     });
     pendingPeers.clear();
+    resolveMediaReady();
     return localVideo.play();
   })
-  .catch((err) => console.error("Error getting user media", err));
+  .catch((err) => {
+    console.error("Error getting user media", err);
+    // Still join SFU rooms receive-only.
+    resolveMediaReady();
+  });
 // Note: Dice rooms used to auto-start the game on entry (when the URL had
 // ?game=dice) but that fired before any peers had joined, leaving the
 // first player rolling against no one. The game now starts only when the
-// user explicitly clicks Start Game, by which time they've had a chance
-// to share the invite link and wait for peers.
+// host of a table explicitly clicks Start, by which time they've had a
+// chance to share the invite link and let peers join the table.
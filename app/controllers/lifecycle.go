@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"time"
+)
+
+// Lifecycle events describe what happens to rooms and games: a room is
+// created or expires, members come and go, tables start and finish. The
+// TopicManager hands each one to every registered hook (webhooks, for
+// one); hooks run on the emitting goroutine and must not block.
+
+const (
+	EventRoomCreated  = "room.created"
+	EventRoomExpired  = "room.expired"
+	EventMemberJoined = "member.joined"
+	EventMemberLeft   = "member.left"
+	EventGameStarted  = "game.started"
+	EventGameOver     = "game.over"
+)
+
+// EventTypes lists every lifecycle event type.
+var EventTypes = []string{
+	EventRoomCreated, EventRoomExpired, EventMemberJoined,
+	EventMemberLeft, EventGameStarted, EventGameOver,
+}
+
+// LifecycleEvent is one room or game lifecycle event. It is also the body
+// of a webhook delivery.
+type LifecycleEvent struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	RoomID string                 `json:"roomID"`
+	Time   time.Time              `json:"time"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// OnEvent registers fn to be called with every lifecycle event.
+func (tm *TopicManager) OnEvent(fn func(LifecycleEvent)) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.eventHooks = append(tm.eventHooks, fn)
+}
+
+// emit hands an event to the registered hooks. Callers must not hold tm.mu.
+func (tm *TopicManager) emit(eventType, roomID string, data map[string]interface{}) {
+	tm.mu.Lock()
+	hooks := tm.eventHooks
+	tm.mu.Unlock()
+	if len(hooks) == 0 {
+		return
+	}
+	id, err := generateRoomID(16)
+	if err != nil {
+		return
+	}
+	ev := LifecycleEvent{ID: id, Type: eventType, RoomID: roomID, Time: time.Now().UTC(), Data: data}
+	for _, fn := range hooks {
+		fn(ev)
+	}
+}
+
+// roomEventData describes a room's settings for room events.
+func roomEventData(info roomInfo) map[string]interface{} {
+	data := map[string]interface{}{
+		"roomType": info.Type,
+		"mode":     info.Mode,
+		"public":   info.Public,
+	}
+	if info.Variant != "" {
+		data["variant"] = info.Variant
+	}
+	if info.Code != "" {
+		data["code"] = info.Code
+	}
+	if info.Schedule != nil {
+		data["start"] = info.Schedule.Start.UTC()
+	}
+	return data
+}
+
+// eventPlayer is a game participant as events report it.
+type eventPlayer struct {
+	ClientID string `json:"clientID"`
+	Name     string `json:"name,omitempty"`
+}
+
+// eventPlayers names the clients in ids from the room's presence.
+func (tm *TopicManager) eventPlayers(roomID string, ids []string) []eventPlayer {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	out := make([]eventPlayer, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, eventPlayer{ClientID: id, Name: tm.presence[roomID][id].Name})
+	}
+	return out
+}
+
+// memberCount is how many clients are in a room.
+func (tm *TopicManager) memberCount(roomID string) int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return len(tm.rooms[roomID])
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Presence is what a client tells the room about itself: who it is and the
+// state of its media. Clients send it on join (the "presence" query
+// parameter, JSON-encoded) and change it with presence_update frames. It is
+// kept only while the client is connected.
+type Presence struct {
+	Name string `json:"name,omitempty"`
+	// Avatar is a CSS colour ("#3a7bd5") or a short emoji.
+	Avatar        string `json:"avatar,omitempty"`
+	MicMuted      bool   `json:"micMuted"`
+	CameraOff     bool   `json:"cameraOff"`
+	ScreenSharing bool   `json:"screenSharing"`
+	HandRaised    bool   `json:"handRaised"`
+}
+
+const (
+	maxNameRunes   = 32
+	maxAvatarBytes = 32
+)
+
+// presenceUpdatedMessage is broadcast when a member's presence changes.
+type presenceUpdatedMessage struct {
+	Type     string   `json:"type"`
+	RoomID   string   `json:"roomID"`
+	PeerID   string   `json:"peerID"`
+	Presence Presence `json:"presence"`
+}
+
+// parsePresence decodes and sanitizes client-supplied presence; anything
+// malformed yields the zero Presence.
+func parsePresence(raw []byte) Presence {
+	var p Presence
+	if len(raw) == 0 || json.Unmarshal(raw, &p) != nil {
+		return Presence{}
+	}
+	p.Name = cleanText(p.Name, maxNameRunes)
+	p.Avatar = cleanText(p.Avatar, maxAvatarBytes)
+	if len(p.Avatar) > maxAvatarBytes {
+		p.Avatar = ""
+	}
+	return p
+}
+
+// cleanText drops control characters, collapses whitespace and truncates
+// to max runes.
+func cleanText(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) > max {
+		s = string([]rune(s)[:max])
+	}
+	return s
+}
+
+func (tm *TopicManager) setPresence(roomID, clientID string, p Presence) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	room, ok := tm.presence[roomID]
+	if !ok {
+		room = make(map[string]Presence)
+		tm.presence[roomID] = room
+	}
+	room[clientID] = p
+}
+
+func (tm *TopicManager) clearPresence(roomID, clientID string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if room, ok := tm.presence[roomID]; ok {
+		delete(room, clientID)
+		if len(room) == 0 {
+			delete(tm.presence, roomID)
+		}
+	}
+}
+
+// roomPresence returns a snapshot of every connected member's presence.
+func (tm *TopicManager) roomPresence(roomID string) map[string]Presence {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	room := tm.presence[roomID]
+	out := make(map[string]Presence, len(room))
+	for id, p := range room {
+		out[id] = p
+	}
+	return out
+}
+
+// updatePresence applies a presence_update frame from the session's own
+// client and tells the rest of the room.
+func (s *roomSession) updatePresence(message []byte) {
+	var frame struct {
+		Presence json.RawMessage `json:"presence"`
+	}
+	if json.Unmarshal(message, &frame) != nil {
+		return
+	}
+	p := parsePresence(frame.Presence)
+	s.tm.setPresence(s.roomID, s.clientID, p)
+
+	data, err := json.Marshal(presenceUpdatedMessage{
+		Type:     "presence_updated",
+		RoomID:   s.roomID,
+		PeerID:   s.clientID,
+		Presence: p,
+	})
+	if err != nil {
+		return
+	}
+	for _, memberID := range s.tm.getRoomMembers(s.roomID, s.clientID) {
+		s.tm.sendTo(s.roomID, memberID, data)
+	}
+}
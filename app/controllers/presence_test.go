@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+func TestParsePresenceSanitizes(t *testing.T) {
+	p := parsePresence([]byte(`{"name":"  Ada\n\tLovelace` + strings.Repeat("x", 40) + `","avatar":"` + strings.Repeat("#", 40) + `","micMuted":true}`))
+	if strings.ContainsAny(p.Name, "\n\t") || len([]rune(p.Name)) != maxNameRunes || !strings.HasPrefix(p.Name, "Ada Lovelace") {
+		t.Fatalf("name not sanitized: %q", p.Name)
+	}
+	if len(p.Avatar) > maxAvatarBytes || !p.MicMuted {
+		t.Fatalf("unexpected %+v", p)
+	}
+	if parsePresence([]byte(`not json`)) != (Presence{}) {
+		t.Fatal("malformed presence should be zero")
+	}
+}
+
+func TestPresenceOnJoinAndUpdate(t *testing.T) {
+	srv, tm := newTestServer(t)
+
+	a := joinRoom(t, srv.URL, "presence1", "useraaa1")
+	nextEvent(t, a)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	b, err := roomclient.Dial(ctx, srv.URL, "presence1", "userbbb1",
+		roomclient.WithReconnect(0, 0), roomclient.WithPresence(roomclient.Presence{Name: "Bea", Avatar: "🎲"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	peers, ok := nextEvent(t, b).(roomclient.Peers)
+	if !ok || peers.Presence["userbbb1"].Name != "Bea" {
+		t.Fatalf("peers should carry our own presence: %+v", peers)
+	}
+	if _, ok := peers.Presence["useraaa1"]; !ok {
+		t.Fatalf("peers should carry existing members' presence: %+v", peers.Presence)
+	}
+	joined, ok := nextEvent(t, a).(roomclient.PlayerJoined)
+	if !ok || joined.Presence.Name != "Bea" || joined.Presence.Avatar != "🎲" {
+		t.Fatalf("unexpected player_joined %+v", joined)
+	}
+
+	if err := b.SendPresence(roomclient.Presence{Name: "Bea", MicMuted: true, HandRaised: true}); err != nil {
+		t.Fatal(err)
+	}
+	upd, ok := nextEvent(t, a).(roomclient.PresenceUpdated)
+	if !ok || upd.PeerID != "userbbb1" || !upd.Presence.MicMuted || !upd.Presence.HandRaised {
+		t.Fatalf("unexpected update %+v", upd)
+	}
+	if p, _ := a.Presence("userbbb1"); !p.HandRaised {
+		t.Fatalf("client did not track presence: %+v", p)
+	}
+
+	// Frames claiming to be from someone else are dropped.
+	a.Send(map[string]interface{}{
+		"type": "presence_update", "from": "userbbb1", "to": "room", "roomID": "presence1",
+		"presence": map[string]string{"name": "spoofed"},
+	})
+	b.Close()
+	if _, ok := nextEvent(t, a).(roomclient.PlayerLeft); !ok {
+		t.Fatal("expected player_left, not a spoofed presence update")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := tm.roomPresence("presence1"); len(got) != 1 {
+		t.Fatalf("presence not cleared on leave: %+v", got)
+	}
+}
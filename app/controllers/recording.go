@@ -0,0 +1,459 @@
+package controllers
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// Recording is available in SFU rooms only, since that is the one place the
+// server sees everyone's media. The room's host (the member holding the
+// lowest slot) sends "recording_start" / "recording_stop" to the virtual
+// peer. While recording, every published track is written to its own file
+// under <RecordingDir>/<roomID>/<recordingID>/ and game messages relayed
+// through the room are logged, so manifest.json can line the two up. When
+// recording stops, the host alone is sent a tokenized download URL for a zip
+// of the directory.
+
+const (
+	manifestFile = "manifest.json"
+	// accessFile holds the SHA-256 of the download token. It is never
+	// served, and keeps links working across restarts.
+	accessFile = ".access"
+)
+
+// recordingManifest describes one recording. Offsets are milliseconds
+// from StartedAt.
+type recordingManifest struct {
+	ID        string           `json:"id"`
+	RoomID    string           `json:"roomID"`
+	StartedAt time.Time        `json:"startedAt"`
+	StoppedAt time.Time        `json:"stoppedAt"`
+	StartedBy string           `json:"startedBy"`
+	Tracks    []recordedTrack  `json:"tracks"`
+	Events    []recordingEvent `json:"events"`
+}
+
+type recordedTrack struct {
+	File        string `json:"file"`
+	ClientID    string `json:"clientID"`
+	Slot        int    `json:"slot"`
+	Kind        string `json:"kind"`
+	Codec       string `json:"codec"`
+	StartOffset int64  `json:"startOffsetMs"`
+	EndOffset   int64  `json:"endOffsetMs"`
+}
+
+// recordingEvent is one relayed game message; Message is the frame as
+// sent, so game_start keeps its roster and variant.
+type recordingEvent struct {
+	Offset  int64           `json:"offsetMs"`
+	Type    string          `json:"type"`
+	From    string          `json:"from"`
+	Message json.RawMessage `json:"message"`
+}
+
+// recordingMessage tells the room that recording started or stopped. URL is
+// only set on the copy sent to the host.
+type recordingMessage struct {
+	Type        string `json:"type"` // "recording_started", "recording_stopped", "recording_error"
+	From        string `json:"from"`
+	RoomID      string `json:"roomID"`
+	RecordingID string `json:"recordingID,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// roomRecording is an in-progress recording.
+type roomRecording struct {
+	dir   string
+	token string
+
+	mu       sync.Mutex
+	manifest recordingManifest
+	writers  map[*sfuTrack]*trackRecorder
+}
+
+// trackRecorder is a trackSink writing one track to disk. Writes come from
+// the track's forwarding goroutine while Close may come from signaling, so
+// both are serialized.
+type trackRecorder struct {
+	mu     sync.Mutex
+	w      mediaWriter
+	closed bool
+	entry  int // index in manifest.Tracks
+}
+
+type mediaWriter interface {
+	WriteRTP(*rtp.Packet) error
+	Close() error
+}
+
+func (tr *trackRecorder) WriteRTP(pkt *rtp.Packet) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.closed {
+		return nil
+	}
+	return tr.w.WriteRTP(pkt)
+}
+
+func (tr *trackRecorder) Close() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.closed {
+		return nil
+	}
+	tr.closed = true
+	return tr.w.Close()
+}
+
+var errUnsupportedCodec = errors.New("codec not recordable")
+
+// newMediaWriter opens the container for a codec, returning the file
+// extension it chose.
+func newMediaWriter(path string, codec webrtc.RTPCodecParameters) (mediaWriter, string, error) {
+	switch mime := strings.ToLower(codec.MimeType); mime {
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		channels := codec.Channels
+		if channels == 0 {
+			channels = 2
+		}
+		w, err := oggwriter.New(path+".ogg", codec.ClockRate, channels)
+		return w, ".ogg", err
+	case strings.ToLower(webrtc.MimeTypeVP8), strings.ToLower(webrtc.MimeTypeVP9), strings.ToLower(webrtc.MimeTypeAV1):
+		w, err := ivfwriter.New(path+".ivf", ivfwriter.WithCodec(codec.MimeType))
+		return w, ".ivf", err
+	case strings.ToLower(webrtc.MimeTypeH264):
+		w, err := h264writer.New(path + ".h264")
+		return w, ".h264", err
+	}
+	return nil, "", errUnsupportedCodec
+}
+
+func newRecordingID() (string, string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	tok := make([]byte, 24)
+	if _, err := rand.Read(tok); err != nil {
+		return "", "", err
+	}
+	id := time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+	return id, hex.EncodeToString(tok), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (rec *roomRecording) offset(t time.Time) int64 {
+	return t.Sub(rec.manifest.StartedAt).Milliseconds()
+}
+
+// addTrack starts writing t. Callers hold the room lock.
+func (rec *roomRecording) addTrack(t *sfuTrack, slot int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if _, ok := rec.writers[t]; ok {
+		return
+	}
+	codec := t.remote.Codec()
+	name := fmt.Sprintf("%s-%s-%d", t.owner, t.remote.Kind(), len(rec.manifest.Tracks))
+	w, ext, err := newMediaWriter(filepath.Join(rec.dir, name), codec)
+	if err != nil {
+		log.Printf("[Recording] %s %s track (%s): %v", t.owner, t.remote.Kind(), codec.MimeType, err)
+		return
+	}
+	tr := &trackRecorder{w: w, entry: len(rec.manifest.Tracks)}
+	rec.manifest.Tracks = append(rec.manifest.Tracks, recordedTrack{
+		File:        name + ext,
+		ClientID:    t.owner,
+		Slot:        slot,
+		Kind:        t.remote.Kind().String(),
+		Codec:       codec.MimeType,
+		StartOffset: rec.offset(time.Now()),
+		EndOffset:   -1,
+	})
+	rec.writers[t] = tr
+	t.addSink(tr)
+}
+
+// removeTrack finishes t's file when its publisher stops sending.
+func (rec *roomRecording) removeTrack(t *sfuTrack) {
+	rec.mu.Lock()
+	tr, ok := rec.writers[t]
+	var file string
+	if ok {
+		delete(rec.writers, t)
+		rec.manifest.Tracks[tr.entry].EndOffset = rec.offset(time.Now())
+		file = rec.manifest.Tracks[tr.entry].File
+	}
+	rec.mu.Unlock()
+	if ok {
+		t.removeSink(tr)
+		if err := tr.Close(); err != nil {
+			log.Printf("[Recording] close %s: %v", file, err)
+		}
+	}
+}
+
+func (rec *roomRecording) logEvent(sig signalMessage, raw []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.manifest.Events = append(rec.manifest.Events, recordingEvent{
+		Offset:  rec.offset(time.Now()),
+		Type:    sig.Type,
+		From:    sig.From,
+		Message: json.RawMessage(raw),
+	})
+}
+
+// finish closes every open file and writes the manifest.
+func (rec *roomRecording) finish() error {
+	rec.mu.Lock()
+	writers := rec.writers
+	rec.writers = nil
+	now := time.Now()
+	rec.manifest.StoppedAt = now
+	for _, tr := range writers {
+		rec.manifest.Tracks[tr.entry].EndOffset = rec.offset(now)
+	}
+	manifest := rec.manifest
+	rec.mu.Unlock()
+
+	for t, tr := range writers {
+		t.removeSink(tr)
+		if err := tr.Close(); err != nil {
+			log.Printf("[Recording] close %s: %v", manifest.Tracks[tr.entry].File, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(rec.dir, manifestFile), data, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(rec.dir, accessFile), []byte(hashToken(rec.token)), 0o600)
+}
+
+func (m *sfuManager) isRecording(roomID string) bool {
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recording != nil
+}
+
+// startRecording begins recording the room on behalf of clientID.
+func (r *sfuRoom) startRecording(clientID string) (string, error) {
+	dir := r.mgr.cfg.RecordingDir
+	if dir == "" {
+		return "", errors.New("recording is not enabled on this server")
+	}
+	id, token, err := newRecordingID()
+	if err != nil {
+		return "", err
+	}
+	recDir := filepath.Join(dir, r.id, id)
+	if err := os.MkdirAll(recDir, 0o755); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recording != nil {
+		os.Remove(recDir)
+		return "", errors.New("already recording")
+	}
+	rec := &roomRecording{
+		dir:   recDir,
+		token: token,
+		manifest: recordingManifest{
+			ID:        id,
+			RoomID:    r.id,
+			StartedAt: time.Now(),
+			StartedBy: clientID,
+			Tracks:    []recordedTrack{},
+			Events:    []recordingEvent{},
+		},
+		writers: make(map[*sfuTrack]*trackRecorder),
+	}
+	r.recording = rec
+	for _, t := range r.tracks {
+		rec.addTrack(t, r.mgr.tm.slotOf(r.id, t.owner))
+	}
+	// Video files should open on a keyframe.
+	go r.requestKeyframes()
+	log.Printf("[Recording] %s started recording room %s (%s)", clientID, r.id, id)
+	return id, nil
+}
+
+// stopRecording finishes the room's recording, returning its ID and
+// download token.
+func (r *sfuRoom) stopRecording() (id, token string, err error) {
+	r.mu.Lock()
+	rec := r.recording
+	r.recording = nil
+	r.mu.Unlock()
+	if rec == nil {
+		return "", "", errors.New("not recording")
+	}
+	if err := rec.finish(); err != nil {
+		return "", "", err
+	}
+	log.Printf("[Recording] stopped recording room %s (%s)", r.id, rec.manifest.ID)
+	return rec.manifest.ID, rec.token, nil
+}
+
+// handleRecording processes a recording_start or recording_stop request
+// from clientID, the sending session's own client.
+func (m *sfuManager) handleRecording(roomID, clientID, msgType string) {
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if ok {
+		r.handleRecording(clientID, msgType)
+	}
+}
+
+func (r *sfuRoom) handleRecording(clientID, msgType string) {
+	if host := r.mgr.tm.roomHost(r.id); host != clientID {
+		r.sendRecording(clientID, recordingMessage{Type: "recording_error", Error: "only the host can record"})
+		return
+	}
+
+	switch msgType {
+	case "recording_start":
+		id, err := r.startRecording(clientID)
+		if err != nil {
+			r.sendRecording(clientID, recordingMessage{Type: "recording_error", Error: err.Error()})
+			return
+		}
+		r.broadcastRecording(recordingMessage{Type: "recording_started", RecordingID: id}, "")
+	case "recording_stop":
+		id, token, err := r.stopRecording()
+		if err != nil {
+			r.sendRecording(clientID, recordingMessage{Type: "recording_error", Error: err.Error()})
+			return
+		}
+		r.broadcastRecording(recordingMessage{Type: "recording_stopped", RecordingID: id}, clientID)
+		r.sendRecording(clientID, recordingMessage{
+			Type:        "recording_stopped",
+			RecordingID: id,
+			URL:         "/rooms/" + r.id + "/recordings/" + id + "?token=" + token,
+		})
+	}
+}
+
+func (r *sfuRoom) sendRecording(clientID string, msg recordingMessage) {
+	msg.From = sfuPeerID
+	msg.RoomID = r.id
+	if data, err := json.Marshal(msg); err == nil {
+		r.mgr.tm.sendTo(r.id, clientID, data)
+	}
+}
+
+// broadcastRecording sends msg to every member except excludeID.
+func (r *sfuRoom) broadcastRecording(msg recordingMessage, excludeID string) {
+	for _, id := range r.mgr.tm.getRoomMembers(r.id, excludeID) {
+		r.sendRecording(id, msg)
+	}
+}
+
+// RecordingDownload serves a finished recording as a zip. The URL's token
+// is handed only to the host who stopped the recording.
+//
+// GET /rooms/{roomID}/recordings/{recordingID}?token=…
+func RecordingDownload(cfg SFUConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID, recID := vars["roomID"], vars["recordingID"]
+		if cfg.RecordingDir == "" || !validID(roomID) || !validID(recID) {
+			http.NotFound(w, r)
+			return
+		}
+		dir := filepath.Join(cfg.RecordingDir, roomID, recID)
+		want, err := os.ReadFile(filepath.Join(dir, accessFile))
+		if err != nil {
+			// Missing until the recording has been stopped.
+			http.NotFound(w, r)
+			return
+		}
+		got := hashToken(r.URL.Query().Get("token"))
+		if subtle.ConstantTimeCompare(want, []byte(got)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.zip"`, roomID, recID))
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		zw := zip.NewWriter(w)
+		for _, e := range entries {
+			if e.IsDir() || e.Name() == accessFile {
+				continue
+			}
+			if err := addZipFile(zw, filepath.Join(dir, e.Name()), e.Name()); err != nil {
+				log.Printf("[Recording] zip %s: %v", e.Name(), err)
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			log.Printf("[Recording] zip %s: %v", recID, err)
+		}
+	}
+}
+
+func addZipFile(zw *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Media is already compressed.
+	method := zip.Store
+	if strings.HasSuffix(name, ".json") {
+		method = zip.Deflate
+	}
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
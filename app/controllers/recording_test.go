@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+func awaitNotice(t *testing.T, c *sfuClient, msgType string) map[string]interface{} {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-c.notices:
+			if msg["type"] == msgType {
+				return msg
+			}
+		case <-deadline:
+			t.Fatalf("%s: no %s", c.id, msgType)
+		}
+	}
+}
+
+func TestRecordingHostOnlyAndDownload(t *testing.T) {
+	dir := t.TempDir()
+	cfg := SFUConfig{Enabled: true, MaxParticipants: 20, RecordingDir: dir}
+	srv, tm := newSFUTestServer(t, cfg)
+	const roomID = "recroom1"
+	tm.registerRoom(roomID, roomInfo{Type: "dice", Mode: roomModeSFU, Created: time.Now()})
+
+	host := newSFUClient(t, srv.URL, roomID, "hostaaa1")
+	if msg := <-host.peers; msg["canRecord"] != true {
+		t.Fatalf("expected canRecord in peers message: %v", msg)
+	}
+	guest := newSFUClient(t, srv.URL, roomID, "guestbb1")
+	<-guest.peers
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go host.publish(stop)
+	go guest.publish(stop)
+	// Wait until media flows so both tracks are published.
+	for _, c := range []*sfuClient{host, guest} {
+		select {
+		case <-c.tracks:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s never received a track", c.id)
+		}
+	}
+
+	guest.send(roomID, signalMessage{Type: "recording_start"})
+	if msg := awaitNotice(t, guest, "recording_error"); msg["error"] == "" {
+		t.Fatalf("expected an error for a non-host start: %v", msg)
+	}
+	// Claiming to be the host doesn't help.
+	forged, _ := json.Marshal(signalMessage{Type: "recording_start", From: host.id, To: sfuPeerID, RoomID: roomID})
+	guest.connMu.Lock()
+	guest.conn.WriteMessage(websocket.TextMessage, forged)
+	guest.connMu.Unlock()
+	select {
+	case msg := <-host.notices:
+		if msg["type"] == "recording_started" {
+			t.Fatal("a forged host frame started the recording")
+		}
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	host.send(roomID, signalMessage{Type: "recording_start"})
+	awaitNotice(t, host, "recording_started")
+	awaitNotice(t, guest, "recording_started")
+
+	host.connMu.Lock()
+	for _, frame := range []map[string]interface{}{
+		{"type": "game_start", "from": host.id, "to": "room", "roomID": roomID, "gameID": "recgame1"},
+		{"type": "game_event", "from": host.id, "to": "room", "roomID": roomID, "gameID": "recgame1",
+			"event": json.RawMessage(`{"action":"roll"}`)},
+	} {
+		data, _ := json.Marshal(frame)
+		host.conn.WriteMessage(websocket.TextMessage, data)
+	}
+	host.connMu.Unlock()
+	time.Sleep(300 * time.Millisecond)
+
+	host.send(roomID, signalMessage{Type: "recording_stop"})
+	stopped := awaitNotice(t, host, "recording_stopped")
+	if msg := awaitNotice(t, guest, "recording_stopped"); msg["url"] != nil {
+		t.Fatalf("guest must not receive the download URL: %v", msg)
+	}
+	link, _ := stopped["url"].(string)
+	u, err := url.Parse(link)
+	if err != nil || u.Query().Get("token") == "" {
+		t.Fatalf("bad download url %q", link)
+	}
+
+	download := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.RawQuery = url.Values{"token": {token}}.Encode()
+		req = mux.SetURLVars(req, map[string]string{
+			"roomID":      roomID,
+			"recordingID": stopped["recordingID"].(string),
+		})
+		rec := httptest.NewRecorder()
+		RecordingDownload(cfg).ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := download("wrong"); rec.Code != http.StatusForbidden {
+		t.Fatalf("wrong token: got %d", rec.Code)
+	}
+	rec := download(u.Query().Get("token"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download: got %d", rec.Code)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	var manifest recordingManifest
+	ivfFiles := 0
+	for _, f := range zr.File {
+		if f.Name == accessFile {
+			t.Fatal("access file must not be served")
+		}
+		if strings.HasSuffix(f.Name, ".ivf") {
+			ivfFiles++
+		}
+		if f.Name == manifestFile {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("manifest: %v", err)
+			}
+		}
+	}
+	if ivfFiles != 2 || len(manifest.Tracks) != 2 {
+		t.Fatalf("expected 2 video tracks, got %d files and manifest %+v", ivfFiles, manifest.Tracks)
+	}
+	if manifest.StartedBy != host.id || manifest.StoppedAt.IsZero() {
+		t.Fatalf("unexpected manifest header %+v", manifest)
+	}
+	if len(manifest.Events) != 2 || manifest.Events[0].Type != "game_start" ||
+		manifest.Events[1].Type != "game_event" || manifest.Events[1].From != host.id {
+		t.Fatalf("expected the game start and event on the timeline, got %+v", manifest.Events)
+	}
+}
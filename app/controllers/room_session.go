@@ -0,0 +1,373 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// roomSession is one client's membership of a room, independent of the
+// transport carrying its frames. VideoConnections (WebSocket) and
+// RoomEvents/RoomSignal (SSE + POST) both drive the same lifecycle:
+// openSession reserves a place, start announces the client, handleFrame
+// routes what it sends, and close tears everything down.
+type roomSession struct {
+	tm       *TopicManager
+	roomID   string
+	clientID string
+	topic    string
+	// out carries frames for the client; it is closed when the session is
+	// unsubscribed.
+	out     chan []byte
+	sfu     *sfuManager
+	started bool
+	// transport is transportWebSocket or transportSSE; link measures its
+	// round trips (see health.go).
+	transport string
+	link      linkStats
+	// presence is announced by start; set it before then.
+	presence Presence
+	// ip is the client's address, for the audit log.
+	ip string
+
+	// ended is closed when the server removes the client (see end); the
+	// transport then sends a removed frame and hangs up.
+	ended     chan struct{}
+	endOnce   sync.Once
+	endReason string
+}
+
+var (
+	errRoomFull   = errors.New("room full")
+	errBanned     = errors.New("banned")
+	errRoomClosed = errors.New("room closed")
+)
+
+// sessionErrorStatus is the HTTP status for an openSession error.
+func sessionErrorStatus(err error) int {
+	switch err {
+	case errBanned:
+		return http.StatusForbidden
+	case errRoomClosed:
+		return http.StatusGone
+	case errRoomNotOpen:
+		return http.StatusTooEarly
+	}
+	return http.StatusConflict
+}
+
+// openSession admits clientID to roomID over transport, or returns
+// errRoomFull, errBanned, errRoomClosed or errRoomNotOpen.
+func (tm *TopicManager) openSession(roomID, clientID, transport string) (*roomSession, error) {
+	if err := tm.admissionError(roomID, clientID); err != nil {
+		log.Printf("[Connection] %s refused from room %s: %v", clientID, roomID, err)
+		return nil, err
+	}
+	if ok, count := tm.addRoomMember(roomID, clientID); !ok {
+		log.Printf("[Connection] room %s full (%d users)", roomID, count)
+		return nil, errRoomFull
+	}
+	s := &roomSession{
+		tm:        tm,
+		roomID:    roomID,
+		clientID:  clientID,
+		topic:     roomID + ":" + clientID,
+		out:       make(chan []byte, messageBufferSize),
+		ended:     make(chan struct{}),
+		transport: transport,
+	}
+	tm.mu.Lock()
+	if tm.sessions[roomID] == nil {
+		tm.sessions[roomID] = make(map[string]*roomSession)
+	}
+	tm.sessions[roomID][clientID] = s
+	tm.mu.Unlock()
+	return s, nil
+}
+
+// removedMessage tells a client the server disconnected it and it should
+// not reconnect on its own.
+type removedMessage struct {
+	Type   string `json:"type"`
+	RoomID string `json:"roomID"`
+	Reason string `json:"reason"`
+}
+
+// end asks the session's transport to disconnect the client, telling it
+// why: "disconnected", "banned" or "closed".
+func (s *roomSession) end(reason string) {
+	s.endOnce.Do(func() {
+		s.endReason = reason
+		close(s.ended)
+	})
+}
+
+// removedFrame is the frame sent to an ended session's client.
+func (s *roomSession) removedFrame() []byte {
+	data, _ := json.Marshal(removedMessage{Type: "removed", RoomID: s.roomID, Reason: s.endReason})
+	return data
+}
+
+// start subscribes the session, sends the client its "peers" message and
+// tells the rest of the room it joined.
+func (s *roomSession) start() {
+	tm, roomID, userID := s.tm, s.roomID, s.clientID
+	s.started = true
+	log.Printf("[Connection] %s joined room %s", userID, roomID)
+
+	tm.control <- topicOperation{opType: "sub", topic: s.topic, ch: s.out}
+	tm.setPresence(roomID, userID, s.presence)
+	tm.auditJoin(roomID, userID, s.ip)
+	tm.noteJoin(roomID, userID, time.Now())
+
+	s.sfu = tm.sfuFor(roomID)
+	frames, peers, existing := tm.joinFrames(roomID, userID)
+	log.Printf("[Connection] %s in room %s assigned slot %d", userID, roomID, peers.MySlot)
+	for _, data := range frames {
+		s.out <- data
+	}
+
+	// In SFU rooms the server offers the new client its media connection
+	// right after the peers message.
+	if s.sfu != nil {
+		if err := s.sfu.join(roomID, userID); err != nil {
+			log.Printf("[SFU] join %s in room %s: %v", userID, roomID, err)
+		}
+	}
+
+	tm.notifyJoined(roomID, userID, peers.MySlot, s.presence, existing)
+	tm.broadcastBreakouts(roomID, false)
+	tm.auditHost(roomID)
+	tm.emit(EventMemberJoined, roomID, map[string]interface{}{
+		"clientID": userID,
+		"name":     s.presence.Name,
+		"members":  tm.memberCount(roomID),
+	})
+}
+
+// joinFrames builds what a client is sent on joining: the peers message
+// for its group — the peers already there (for WebRTC offers) and the
+// group's slot map (for dice-game player ordering) — then recent chat and
+// the group's game tables, so it can spectate or rejoin one. It also
+// returns the peers message and the group's other members.
+func (tm *TopicManager) joinFrames(roomID, clientID string) ([][]byte, peersMessage, []string) {
+	var frames [][]byte
+	peers, existing := tm.scopedPeers(roomID, clientID)
+	if sfu := tm.sfuFor(roomID); sfu != nil {
+		peers.Mode = roomModeSFU
+		peers.SFUPeer = sfuPeerID
+		peers.CanRecord = sfu.cfg.RecordingDir != ""
+		peers.Recording = sfu.isRecording(roomID)
+	}
+	if data, err := json.Marshal(peers); err == nil {
+		frames = append(frames, data)
+	}
+	if history := tm.chatHistory(roomID, chatHistoryOnJoin); len(history) > 0 {
+		if data, err := json.Marshal(chatHistoryMessage{
+			Type:     "chat_history",
+			RoomID:   roomID,
+			Messages: history,
+		}); err == nil {
+			frames = append(frames, data)
+		}
+	}
+	if scope := tm.breakoutOf(roomID, clientID); len(tm.gamesFor(roomID, scope)) > 0 {
+		if data, err := tm.gamesMessageFor(roomID, scope); err == nil {
+			frames = append(frames, data)
+		}
+	}
+	return frames, peers, existing
+}
+
+// scopedPeers builds clientID's peers message for its group, assigning (or
+// restoring) its slot there, and returns the group's other members.
+func (tm *TopicManager) scopedPeers(roomID, clientID string) (peersMessage, []string) {
+	mySlot, slots := tm.assignScopeSlot(roomID, clientID)
+	tm.auditRecord(auditSlot, roomID, clientID, map[string]interface{}{
+		"slot":     mySlot,
+		"breakout": tm.breakoutOf(roomID, clientID),
+	})
+	existing := tm.peersOf(roomID, clientID)
+	return peersMessage{
+		Type:   "peers",
+		RoomID: roomID,
+		Peers:  existing,
+		Slots:  slots,
+		MySlot: mySlot,
+		Mode:   roomModeMesh,
+
+		Presence: tm.roomPresence(roomID),
+	}, existing
+}
+
+// notifyJoined tells a group's existing members that clientID joined it
+// and what slot it got.
+func (tm *TopicManager) notifyJoined(roomID, clientID string, slot int, p Presence, existing []string) {
+	joined, err := json.Marshal(playerJoinedMessage{
+		Type:     "player_joined",
+		RoomID:   roomID,
+		PeerID:   clientID,
+		Slot:     slot,
+		Presence: p,
+	})
+	if err != nil {
+		return
+	}
+	for _, memberID := range existing {
+		tm.sendTo(roomID, memberID, joined)
+	}
+}
+
+// handleFrame validates one frame from the client and routes it.
+func (s *roomSession) handleFrame(message []byte) {
+	roomID := s.roomID
+
+	var sig signalMessage
+	if err := json.Unmarshal(message, &sig); err != nil {
+		log.Printf("[Read] invalid JSON: %v", err)
+		return
+	}
+
+	// Basic validation: enforce room + sender ID.
+	// sig.To may be a specific userID or "room" (broadcast to all members).
+	if sig.RoomID != roomID || !validID(sig.From) {
+		return
+	}
+	// Frames the server answers itself, from the session's own client only.
+	switch sig.Type {
+	case "presence_update", "chat", "chat_delete", "announcement",
+		"breakout_create", "breakout_move", "breakout_close", "pong",
+		"recording_start", "recording_stop":
+		if sig.From != s.clientID {
+			return
+		}
+		switch sig.Type {
+		case "pong":
+			s.handlePong(message)
+		case "presence_update":
+			s.updatePresence(message)
+		case "chat":
+			s.postChat(message)
+		case "chat_delete":
+			s.deleteChatMessage(message)
+		case "announcement":
+			s.postAnnouncement(message)
+		case "recording_start", "recording_stop":
+			if s.sfu != nil {
+				s.sfu.handleRecording(roomID, s.clientID, sig.Type)
+			}
+		default:
+			s.handleBreakoutFrame(sig.Type, message)
+		}
+		return
+	}
+	if sig.To != "room" && !validID(sig.To) {
+		return
+	}
+
+	switch sig.Type {
+	case "game_open", "game_join", "game_leave", "game_start",
+		"game_event", "player_kick", "game_over", "game_result", "game_close":
+		if sig.From == s.clientID {
+			s.handleGameFrame(sig, message)
+		}
+		return
+	}
+
+	// Frames for the virtual peer drive the sender's own server-side
+	// connection, so they must come from the session's client.
+	if sig.To == sfuPeerID {
+		if s.sfu != nil && sig.From == s.clientID {
+			s.sfu.handleSignal(roomID, s.clientID, sig)
+		}
+		return
+	}
+	s.relay(sig, message)
+}
+
+// relay forwards a client's frame unchanged: to the rest of its group for
+// "room", otherwise to one peer in the same group. Frames claiming another
+// sender are dropped, and the group is always the session's own.
+func (s *roomSession) relay(sig signalMessage, message []byte) {
+	tm, roomID := s.tm, s.roomID
+	if sig.From != s.clientID {
+		return
+	}
+	if sig.To == "room" {
+		// Broadcast to every other member of the sender's group.
+		for _, memberID := range tm.peersOf(roomID, s.clientID) {
+			tm.sendTo(roomID, memberID, message)
+		}
+	} else if tm.sameScope(roomID, s.clientID, sig.To) {
+		// Forward to a specific peer in the same group.
+		tm.sendTo(roomID, sig.To, message)
+	}
+}
+
+// close releases the session's place in the room and notifies the
+// remaining members.
+func (s *roomSession) close() {
+	tm, roomID, userID := s.tm, s.roomID, s.clientID
+	tm.mu.Lock()
+	current := tm.sessions[roomID][userID] == s
+	if current {
+		if s.started {
+			tm.noteLeaveLocked(roomID, userID, time.Now())
+		}
+		delete(tm.sessions[roomID], userID)
+		if len(tm.sessions[roomID]) == 0 {
+			delete(tm.sessions, roomID)
+		}
+	}
+	tm.mu.Unlock()
+	if s.started {
+		tm.control <- topicOperation{opType: "unsub", topic: s.topic, ch: s.out}
+	}
+	// A session replaced by the client's next one leaves nothing else
+	// behind: the membership, presence, media and games are the new
+	// session's now.
+	if !current {
+		log.Printf("[Connection] superseded session for %s in room %s closed", userID, roomID)
+		return
+	}
+
+	var member eventPlayer
+	if s.started {
+		member = tm.eventPlayers(roomID, []string{userID})[0]
+		if s.sfu != nil {
+			s.sfu.leave(roomID, userID)
+		}
+		tm.clearPresence(roomID, userID)
+	}
+	tm.removeRoomMember(roomID, userID)
+	tm.leaveGames(roomID, userID)
+	if s.started {
+		tm.auditLeave(roomID, userID)
+		tm.emit(EventMemberLeft, roomID, map[string]interface{}{
+			"clientID": userID,
+			"name":     member.Name,
+			"members":  tm.memberCount(roomID),
+		})
+	}
+	// Notify remaining peers so they can tear down stale WebRTC
+	// connections and dice-game state without waiting for an ICE timeout.
+	remaining := tm.peersOf(roomID, userID)
+	tm.broadcastBreakouts(roomID, false)
+	if len(remaining) == 0 {
+		return
+	}
+	data, err := json.Marshal(playerLeftMessage{
+		Type:   "player_left",
+		RoomID: roomID,
+		PeerID: userID,
+	})
+	if err != nil {
+		return
+	}
+	for _, memberID := range remaining {
+		tm.sendTo(roomID, memberID, data)
+	}
+}
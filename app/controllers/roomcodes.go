@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"rsc.io/qr"
+)
+
+// Room codes are optional easy-to-say aliases for room IDs, such as
+// "brave-otter-42". A room keeps its random ID for links and signaling;
+// the code only resolves to it through /rooms/join, and expires with the
+// room's settings.
+
+var codeAdjectives = []string{
+	"amber", "bold", "brave", "breezy", "bright", "calm", "clever", "cosmic",
+	"crisp", "curly", "dapper", "eager", "fancy", "fluffy", "gentle", "giddy",
+	"golden", "happy", "hidden", "jolly", "kind", "lively", "lucky", "mellow",
+	"merry", "misty", "nimble", "noble", "plucky", "polite", "proud", "quick",
+	"quiet", "rapid", "rosy", "rusty", "shiny", "silly", "silver", "sleepy",
+	"snowy", "sparkly", "speedy", "spicy", "sunny", "swift", "tidy", "tiny",
+	"vivid", "wacky", "warm", "witty", "zany", "zesty", "dusty", "fuzzy",
+	"grand", "hasty", "icy", "jazzy", "lofty", "mighty", "peppy", "royal",
+}
+
+var codeAnimals = []string{
+	"badger", "bat", "bear", "beaver", "bison", "camel", "cat", "cobra",
+	"crab", "crane", "crow", "deer", "dingo", "dog", "dolphin", "dove",
+	"duck", "eagle", "eel", "elk", "falcon", "ferret", "finch", "fox",
+	"frog", "gecko", "goat", "goose", "hare", "hawk", "heron", "horse",
+	"ibis", "koala", "lemur", "lion", "llama", "lynx", "mole", "moose",
+	"newt", "orca", "otter", "owl", "panda", "parrot", "pig", "puffin",
+	"quail", "rabbit", "raven", "seal", "shark", "sloth", "snail", "swan",
+	"tiger", "toad", "trout", "turtle", "walrus", "whale", "wolf", "yak",
+}
+
+// codeShape matches a normalized word code.
+var codeShape = regexp.MustCompile(`^[a-z]+-[a-z]+-[0-9]+$`)
+
+const (
+	// maxCodeTries bounds the search for an unused code.
+	maxCodeTries = 20
+	// maxCodeMisses is how many unknown codes one IP may try per
+	// codeMissWindow before /rooms/join stops answering it, so the code
+	// space cannot be walked to find private rooms.
+	maxCodeMisses  = 10
+	codeMissWindow = 10 * time.Minute
+)
+
+var errNoFreeCode = errors.New("no unused room code found")
+
+// codeMisses counts an IP's failed lookups since the window started.
+type codeMisses struct {
+	count int
+	since time.Time
+}
+
+func randomIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
+
+// newRoomCode makes an adjective-animal-number code, number 2–999: about
+// four million codes.
+func newRoomCode() (string, error) {
+	a, err := randomIndex(len(codeAdjectives))
+	if err != nil {
+		return "", err
+	}
+	b, err := randomIndex(len(codeAnimals))
+	if err != nil {
+		return "", err
+	}
+	n, err := randomIndex(998)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-%d", codeAdjectives[a], codeAnimals[b], n+2), nil
+}
+
+// normalizeCode forgives how people type codes they were read aloud:
+// case, surrounding space, and spaces or underscores between words.
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.Join(strings.FieldsFunc(code, func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-'
+	}), "-")
+}
+
+// assignRoomCode gives a registered room a code that is not in use, or
+// returns errNoFreeCode if maxCodeTries random codes were all taken.
+func (tm *TopicManager) assignRoomCode(roomID string) (string, error) {
+	for i := 0; i < maxCodeTries; i++ {
+		code, err := newRoomCode()
+		if err != nil {
+			return "", err
+		}
+		tm.mu.Lock()
+		info, ok := tm.roomInfo[roomID]
+		_, taken := tm.roomCodes[code]
+		if ok && !taken {
+			info.Code = code
+			tm.roomCodes[code] = roomID
+		}
+		tm.mu.Unlock()
+		if !ok {
+			return "", fmt.Errorf("room %s is not registered", roomID)
+		}
+		if !taken {
+			return code, nil
+		}
+	}
+	return "", errNoFreeCode
+}
+
+// resolveRoomCode returns the room a code belongs to.
+func (tm *TopicManager) resolveRoomCode(code string) (string, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	roomID, ok := tm.roomCodes[normalizeCode(code)]
+	return roomID, ok
+}
+
+// codeLookupAllowed reports whether ip may look up another code.
+func (tm *TopicManager) codeLookupAllowed(ip string, now time.Time) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	m, ok := tm.codeMisses[ip]
+	return !ok || now.Sub(m.since) > codeMissWindow || m.count < maxCodeMisses
+}
+
+// noteCodeMiss records a failed lookup from ip.
+func (tm *TopicManager) noteCodeMiss(ip string, now time.Time) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	m, ok := tm.codeMisses[ip]
+	if !ok || now.Sub(m.since) > codeMissWindow {
+		m = &codeMisses{since: now}
+		tm.codeMisses[ip] = m
+	}
+	m.count++
+}
+
+// pruneCodeMissesLocked forgets windows that have ended.
+func (tm *TopicManager) pruneCodeMissesLocked(now time.Time) {
+	for ip, m := range tm.codeMisses {
+		if now.Sub(m.since) > codeMissWindow {
+			delete(tm.codeMisses, ip)
+		}
+	}
+}
+
+// roomCode returns the room's word code, or "".
+func (tm *TopicManager) roomCode(roomID string) string {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if info, ok := tm.roomInfo[roomID]; ok {
+		return info.Code
+	}
+	return ""
+}
+
+// roomLink is the path that opens a room, with the dice game preselected
+// for dice rooms.
+func (tm *TopicManager) roomLink(roomID string) string {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if info, ok := tm.roomInfo[roomID]; ok && info.Type == "dice" {
+		return diceRoomURL(roomID, info.Variant)
+	}
+	return "/rooms/" + roomID
+}
+
+// GET /rooms/join?code= – resolve a word code, or accept a plain room ID,
+// and redirect to the room. Unknown codes go back to the landing page with
+// an error; an IP that keeps guessing is turned away for a while.
+func JoinRoom(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimSpace(r.URL.Query().Get("code"))
+		ip, now := clientIP(r), time.Now()
+		if !tm.codeLookupAllowed(ip, now) {
+			renderRoomsLanding(tm, w, r, roomsPage{Error: "Too many unknown codes. Try again in a few minutes."}, http.StatusTooManyRequests)
+			return
+		}
+		if roomID, ok := tm.resolveRoomCode(code); ok {
+			http.Redirect(w, r, tm.roomLink(roomID), http.StatusSeeOther)
+			return
+		}
+		// Anything else that is a valid room ID is taken as one, unless it
+		// looks like a mistyped or expired word code.
+		if validID(code) && !codeShape.MatchString(normalizeCode(code)) {
+			http.Redirect(w, r, tm.roomLink(code), http.StatusSeeOther)
+			return
+		}
+		tm.noteCodeMiss(ip, now)
+		renderRoomsLanding(tm, w, r, roomsPage{Error: "No room found for code " + code + "."}, http.StatusNotFound)
+	}
+}
+
+// inviteURL is the absolute link a QR code or invite carries.
+func inviteURL(r *http.Request, cfg SecurityConfig, path string) string {
+	scheme := "http"
+	if cfg.requestSecure(r) {
+		scheme = "https"
+	}
+	return (&url.URL{Scheme: scheme, Host: r.Host}).String() + path
+}
+
+// GET /rooms/{roomID}/qr.png – a QR code of the room's invite URL.
+func RoomQR(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		if !validID(roomID) {
+			http.Error(w, "invalid room", http.StatusBadRequest)
+			return
+		}
+		code, err := qr.Encode(inviteURL(r, cfg.Security, tm.roomLink(roomID)), qr.M)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		code.Scale = 6
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		w.Write(code.PNG())
+	}
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewRoomCodeShape(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := newRoomCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !codeShape.MatchString(code) || !validID(code) {
+			t.Fatalf("bad code %q", code)
+		}
+	}
+	if got := normalizeCode("  Brave Otter_42 "); got != "brave-otter-42" {
+		t.Fatalf("normalizeCode: got %q", got)
+	}
+}
+
+func TestCreateWithCodeAndJoin(t *testing.T) {
+	tm := NewTopicManager()
+	r := Router(tm, DefaultConfig())
+
+	form := url.Values{"type": {"dice"}, "variant": {"bigpig"}, "words": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/rooms", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	created := rec.Header().Get("Location")
+	roomID := strings.TrimPrefix(strings.SplitN(created, "?", 2)[0], "/rooms/")
+	code := tm.roomCode(roomID)
+	if code == "" {
+		t.Fatalf("room %s was not given a code", roomID)
+	}
+
+	join := func(code string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rooms/join?code="+url.QueryEscape(code), nil))
+		return rec
+	}
+	// Codes resolve however they were typed, to the same link as creation.
+	if rec := join(strings.ToUpper(strings.ReplaceAll(code, "-", " "))); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != created {
+		t.Fatalf("join by code: got %d %q, want %q", rec.Code, rec.Header().Get("Location"), created)
+	}
+	// Plain room IDs still work.
+	if rec := join("plainroom1"); rec.Header().Get("Location") != "/rooms/plainroom1" {
+		t.Fatalf("join by ID: got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	// An unknown code is an error, not a fresh empty room.
+	if rec := join("sleepy-walrus-7"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "No room found") {
+		t.Fatalf("unknown code: got %d", rec.Code)
+	}
+
+	// The video page shows the code.
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rooms/"+roomID, nil))
+	if !strings.Contains(rec.Body.String(), code) {
+		t.Fatal("video page does not show the room code")
+	}
+}
+
+func TestJoinByCodeLimitsGuessing(t *testing.T) {
+	tm := NewTopicManager()
+	r := Router(tm, DefaultConfig())
+	join := func(code, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/rooms/join?code="+url.QueryEscape(code), nil)
+		req.RemoteAddr = ip + ":5000"
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for i := 0; i < maxCodeMisses; i++ {
+		if code := join("sleepy-walrus-7", "192.0.2.1"); code != http.StatusNotFound {
+			t.Fatalf("miss %d: got %d", i, code)
+		}
+	}
+	if code := join("plainroom1", "192.0.2.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("after %d misses: got %d", maxCodeMisses, code)
+	}
+	if code := join("plainroom1", "192.0.2.2"); code != http.StatusSeeOther {
+		t.Fatalf("another IP: got %d", code)
+	}
+}
+
+func TestAssignRoomCodeGivesUp(t *testing.T) {
+	tm := NewTopicManager()
+	if _, err := tm.assignRoomCode("nosuchroom"); err == nil {
+		t.Fatal("expected an error for an unregistered room")
+	}
+}
+
+func TestRoomQRIsPNG(t *testing.T) {
+	tm := NewTopicManager()
+	r := Router(tm, DefaultConfig())
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rooms/abcdef123456/qr.png", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != b.Dy() || b.Dx() < 100 {
+		t.Fatalf("unexpected QR size %v", b)
+	}
+	if u := inviteURL(httptest.NewRequest(http.MethodGet, "https://example.com/", nil), SecurityConfig{}, "/rooms/x"); u != "https://example.com/rooms/x" {
+		t.Fatalf("inviteURL: got %q", u)
+	}
+}
+
+func TestInviteURLTrustsForwardedProtoOnlyFromProxies(t *testing.T) {
+	cfg := SecurityConfig{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	for _, tc := range []struct {
+		peer, want string
+	}{
+		{"10.1.2.3:1234", "https://example.com/rooms/x"},
+		{"192.0.2.1:1234", "http://example.com/rooms/x"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.RemoteAddr = tc.peer
+		r.Header.Set("X-Forwarded-Proto", "https")
+		if u := inviteURL(r, cfg, "/rooms/x"); u != tc.want {
+			t.Errorf("from %s: got %q, want %q", tc.peer, u, tc.want)
+		}
+	}
+}
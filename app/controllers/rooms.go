@@ -4,30 +4,46 @@ package controllers
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"html/template"
 	"io"
+	"log"
 	"net/http"
+	"time"
 )
 
 var roomsTemplatePath = append([]string{templatePath + "rooms.gohtml"}, baseTemplatePaths...)
 
 type roomsPage struct {
-	RoomID string
-	Error  string
+	Nonce      string
+	RoomID     string
+	Error      string
+	SFUEnabled bool
+	// Accounts is set when sign-in is on; Username when signed in.
+	Accounts bool
+	Username string
 }
 
 // GET /rooms – landing page with create/join form.
-func RoomsLanding(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFS(ffs, roomsTemplatePath...)
+func RoomsLanding(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderRoomsLanding(tm, w, r, roomsPage{}, http.StatusOK)
+	}
+}
+
+func renderRoomsLanding(tm *TopicManager, w http.ResponseWriter, r *http.Request, data roomsPage, status int) {
+	tmpl, err := parseTemplates(roomsTemplatePath...)
 	if err != nil {
 		internalError(err, w)
 		return
 	}
-
-	data := roomsPage{}
+	data.Nonce = cspNonce(r)
+	data.SFUEnabled = tm.sfuEnabled()
+	data.Accounts = tm.userAccounts() != nil
+	if u, ok := tm.currentUser(r); ok {
+		data.Username = u.Username
+	}
+	w.WriteHeader(status)
 	if err := tmpl.Execute(w, data); err != nil {
-		internalError(err, w)
-		return
+		log.Println(err)
 	}
 }
 
@@ -36,23 +52,61 @@ func RoomsLanding(w http.ResponseWriter, r *http.Request) {
 // The "type" form value selects the room flavour:
 //   - "video" (default) – plain WebRTC room.
 //   - "dice"            – WebRTC room that auto-starts the dice game on entry.
-func CreateRoom(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+//
+// "mode=sfu" routes the room's media through the server instead of a
+// full mesh, for calls too large for every client to send to every other.
+// It is only honoured when the SFU is enabled.
+//
+// "public=1" lists the room in the directory (/rooms/browse),
+// "variant" picks the dice game dice rooms start with, and "words=1" gives
+// the room an easy-to-say code (see roomcodes.go). A "start" schedules the
+// room (see schedule.go).
+func CreateRoom(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-	roomID, err := generateRoomID(12)
-	if err != nil {
-		internalError(err, w)
-		return
-	}
+		roomID, err := generateRoomID(12)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+
+		info := roomInfo{Type: "video", Mode: roomModeMesh, Created: time.Now()}
+		if info.Schedule, err = parseSchedule(r, cfg.Schedule, info.Created); err != nil {
+			renderRoomsLanding(tm, w, r, roomsPage{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("type") == "dice" {
+			info.Type = "dice"
+			info.Variant = normalizeVariant(r.FormValue("variant"))
+		}
+		info.Public = r.FormValue("public") == "1"
+		if r.FormValue("mode") == roomModeSFU && tm.sfuEnabled() {
+			info.Mode = roomModeSFU
+		}
+		tm.registerRoom(roomID, info)
+		if r.FormValue("words") == "1" {
+			if info.Code, err = tm.assignRoomCode(roomID); err != nil {
+				internalError(err, w)
+				return
+			}
+		}
+		tm.emit(EventRoomCreated, roomID, roomEventData(info))
 
-	dest := "/rooms/" + roomID
-	if r.FormValue("type") == "dice" {
-		dest += "?game=dice"
+		dest := "/rooms/" + roomID
+		if info.Type == "dice" {
+			dest = diceRoomURL(roomID, info.Variant)
+		}
+		http.Redirect(w, r, dest, http.StatusSeeOther)
 	}
-	http.Redirect(w, r, dest, http.StatusSeeOther)
+}
+
+// diceRoomURL links to a dice room with its variant preselected.
+func diceRoomURL(roomID, variant string) string {
+	return "/rooms/" + roomID + "?game=dice&variant=" + variant
 }
 
 func generateRoomID(n int) (string, error) {
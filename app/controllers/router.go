@@ -1,28 +1,91 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-func Router(tm *TopicManager) *mux.Router {
+func Router(tm *TopicManager, cfg Config) *mux.Router {
 	r := mux.NewRouter()
-	r.PathPrefix("/css/").Handler(http.FileServer(http.FS(ffs)))
-	r.PathPrefix("/js/").Handler(http.FileServer(http.FS(ffs)))
-	// WASM builds are large — serve from the filesystem, not embedded in the binary.
-	r.PathPrefix("/wasm/").Handler(http.StripPrefix("/wasm/", http.FileServer(http.Dir("./app/wasm/"))))
+	r.Use(SecurityHeaders(cfg.Security))
+
+	// Fingerprint static assets once at startup; templates link to the
+	// hashed URLs through the asset template func.
+	if err := staticAssets.load(staticFS{}); err != nil {
+		log.Printf("[Assets] fingerprinting failed: %v", err)
+	}
+	assets := assetHandler(staticFS{}, staticAssets)
+	r.PathPrefix("/css/").Handler(assets)
+	r.PathPrefix("/js/").Handler(assets)
+	// WASM builds are large — served from the filesystem, not embedded in the binary.
+	r.PathPrefix("/wasm/").Handler(assets)
 
 	r.HandleFunc("/home/", Home).Methods(http.MethodGet)
 	r.HandleFunc("/", Index).Methods(http.MethodGet)
 
+	// Public room directory and matchmaking; registered before the
+	// {roomID} route below, which would otherwise match "browse".
+	r.HandleFunc("/rooms/browse", BrowseRooms(tm)).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/quickplay", QuickPlay(tm)).Methods(http.MethodPost)
+	// Join by word code or room ID, likewise ahead of {roomID}.
+	r.HandleFunc("/rooms/join", JoinRoom(tm)).Methods(http.MethodGet)
+	r.HandleFunc("/api/rooms", PublicRooms(tm)).Methods(http.MethodGet)
+
 	// New room routes (you'll add handlers/templates later)
-	r.HandleFunc("/rooms", RoomsLanding).Methods(http.MethodGet)   // create/join page
-	r.HandleFunc("/rooms", CreateRoom).Methods(http.MethodPost)    // generate room code
-	r.HandleFunc("/rooms/{roomID}", Video).Methods(http.MethodGet) // video page for a room
+	r.HandleFunc("/rooms", RoomsLanding(tm)).Methods(http.MethodGet)        // create/join page
+	r.HandleFunc("/rooms", CreateRoom(tm, cfg)).Methods(http.MethodPost)    // generate room code
+	r.HandleFunc("/rooms/{roomID}", Video(tm, cfg)).Methods(http.MethodGet) // video page for a room
 
 	// WebSocket for signaling, scoped to a room
 	r.HandleFunc("/rooms/{roomID}/ws", VideoConnections(tm)).Methods(http.MethodGet)
+	// Fallback for proxies that break WebSocket upgrades: SSE down, POST up.
+	r.HandleFunc("/rooms/{roomID}/events", RoomEvents(tm)).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{roomID}/signal", RoomSignal(tm)).Methods(http.MethodPost)
+
+	// QR code of the room's invite link, and its link-preview card.
+	r.HandleFunc("/rooms/{roomID}/qr.png", RoomQR(tm, cfg)).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{roomID}/card.png", RoomCard(tm)).Methods(http.MethodGet)
+
+	// Calendar invite for scheduled rooms.
+	r.HandleFunc("/rooms/{roomID}/invite.ics", RoomInvite(tm, cfg)).Methods(http.MethodGet)
+
+	// Chat history export.
+	r.HandleFunc("/rooms/{roomID}/chat.json", ChatExport(tm)).Methods(http.MethodGet)
+
+	// Finished SFU-room recordings, behind the host's download token.
+	r.HandleFunc("/rooms/{roomID}/recordings/{recordingID}", RecordingDownload(cfg.SFU)).Methods(http.MethodGet)
+
+	// Dice-game leaderboard.
+	r.HandleFunc("/leaderboard", Leaderboard(tm)).Methods(http.MethodGet)
+	r.HandleFunc("/api/leaderboard", LeaderboardAPI(tm)).Methods(http.MethodGet)
+
+	// Play-by-turn Pig.
+	r.HandleFunc("/games", AsyncGames(tm)).Methods(http.MethodGet)
+	r.HandleFunc("/games", CreateAsyncGame(tm, cfg)).Methods(http.MethodPost)
+	r.HandleFunc("/games/{gameID}", AsyncGame(tm)).Methods(http.MethodGet)
+	r.HandleFunc("/games/{gameID}/{action:join|roll|hold|resign}", AsyncGameAction(tm, cfg)).Methods(http.MethodPost)
+
+	// Optional user accounts.
+	r.HandleFunc("/login", AccountForm(tm, false)).Methods(http.MethodGet)
+	r.HandleFunc("/login", AccountSubmit(tm, cfg, false)).Methods(http.MethodPost)
+	r.HandleFunc("/register", AccountForm(tm, true)).Methods(http.MethodGet)
+	r.HandleFunc("/register", AccountSubmit(tm, cfg, true)).Methods(http.MethodPost)
+	r.HandleFunc("/logout", AccountLogout).Methods(http.MethodPost)
+
+	// Admin endpoints, behind the admin token.
+	r.HandleFunc("/admin/webhooks", requireAdmin(tm, cfg.AdminToken, WebhookLog(tm))).Methods(http.MethodGet)
+	r.HandleFunc("/admin/audit", requireAdmin(tm, cfg.AdminToken, AuditLog(tm))).Methods(http.MethodGet)
+	AdminAPI(r, tm, cfg.AdminToken)
+	r.HandleFunc("/admin", AdminDashboard(tm, cfg)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/login", AdminLogin(tm, cfg)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/logout", AdminLogout(tm, cfg)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/events", requireAdmin(tm, cfg.AdminToken, AdminEvents(tm))).Methods(http.MethodGet)
+	r.HandleFunc("/admin/metrics", requireAdmin(tm, cfg.AdminToken, Metrics(tm))).Methods(http.MethodGet)
+
+	// ICE servers for WebRTC clients, built from config.
+	r.HandleFunc("/api/ice-servers", ICEServers(tm, cfg)).Methods(http.MethodGet)
 
 	fileServer := http.FileServer(http.Dir("./app/data/imgdata/"))
 	r.Handle("/static/{reqFile}", http.StripPrefix("/static", fileServer))
@@ -0,0 +1,407 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	// Time zone names must resolve even in containers without tzdata.
+	_ "time/tzdata"
+
+	"github.com/gorilla/mux"
+)
+
+// A room can be scheduled: created ahead of time with a start, a length,
+// an optional daily or weekly repeat, and a title and description. Joins
+// are refused until ScheduleConfig.EarlyOpen before a session starts;
+// until then the room page is a lobby counting down to it. Each session
+// also refuses joins once it has ended, until the next one opens, and
+// people already in the room are left alone. After the last session the
+// room is ordinary, expiring roomInfoTTL after it ended.
+// /rooms/{roomID}/invite.ics hands out the schedule as a calendar event.
+
+// ScheduleConfig configures scheduled rooms.
+type ScheduleConfig struct {
+	// EarlyOpen is how long before a session its room opens.
+	EarlyOpen time.Duration
+}
+
+// DefaultScheduleConfig opens scheduled rooms 15 minutes early.
+func DefaultScheduleConfig() ScheduleConfig {
+	return ScheduleConfig{EarlyOpen: 15 * time.Minute}
+}
+
+const (
+	repeatDaily  = "daily"
+	repeatWeekly = "weekly"
+
+	defaultSessionLen   = 2 * time.Hour
+	maxSessionLen       = 12 * time.Hour
+	maxScheduleAhead    = 365 * 24 * time.Hour
+	maxSessions         = 52
+	maxScheduleTitleLen = 80
+	maxScheduleDescLen  = 1000
+	// startLayout is what <input type="datetime-local"> submits.
+	startLayout = "2006-01-02T15:04"
+)
+
+var lobbyTemplatePath = append([]string{templatePath + "room_lobby.gohtml"}, baseTemplatePaths...)
+
+var errRoomNotOpen = errors.New("room not open yet")
+
+// roomSchedule is when a scheduled room's sessions run.
+type roomSchedule struct {
+	Title       string
+	Description string
+	// Start is the first session, in the creator's time zone, so repeats
+	// keep its wall-clock time across daylight-saving changes.
+	Start     time.Time
+	Duration  time.Duration
+	Repeat    string // "", repeatDaily or repeatWeekly
+	Sessions  int
+	EarlyOpen time.Duration
+}
+
+// session returns the start of session i.
+func (s *roomSchedule) session(i int) time.Time {
+	switch s.Repeat {
+	case repeatDaily:
+		return s.Start.AddDate(0, 0, i)
+	case repeatWeekly:
+		return s.Start.AddDate(0, 0, 7*i)
+	}
+	return s.Start
+}
+
+// next returns the first session that hasn't ended by now; ok is false
+// once they all have.
+func (s *roomSchedule) next(now time.Time) (start time.Time, ok bool) {
+	for i := range s.Sessions {
+		if start = s.session(i); now.Before(start.Add(s.Duration)) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// opensAt returns when the room next opens, or the zero time if it is
+// open now. A nil schedule is always open.
+func (s *roomSchedule) opensAt(now time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	start, ok := s.next(now)
+	if !ok {
+		return time.Time{}
+	}
+	if opens := start.Add(-s.EarlyOpen); now.Before(opens) {
+		return opens
+	}
+	return time.Time{}
+}
+
+// end is when the last session ends.
+func (s *roomSchedule) end() time.Time {
+	return s.session(s.Sessions - 1).Add(s.Duration)
+}
+
+// idleSince is when a room's settings start counting towards roomInfoTTL:
+// its creation, or for scheduled rooms the end of the last session.
+func (info *roomInfo) idleSince() time.Time {
+	if info.Schedule != nil {
+		return info.Schedule.end()
+	}
+	return info.Created
+}
+
+// roomOpensAt returns when roomID next opens, or the zero time if it is
+// open now.
+func (tm *TopicManager) roomOpensAt(roomID string, now time.Time) time.Time {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if info, ok := tm.roomInfo[roomID]; ok {
+		return info.Schedule.opensAt(now)
+	}
+	return time.Time{}
+}
+
+// roomSchedule returns a copy of roomID's schedule, if it has one.
+func (tm *TopicManager) roomSchedule(roomID string) (roomSchedule, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if info, ok := tm.roomInfo[roomID]; ok && info.Schedule != nil {
+		return *info.Schedule, true
+	}
+	return roomSchedule{}, false
+}
+
+// parseSchedule reads a schedule from the create-room form, or returns nil
+// if the form has no start. "start" is RFC 3339, or a datetime-local value
+// in the IANA zone "tz" (UTC if empty).
+func parseSchedule(r *http.Request, cfg ScheduleConfig, now time.Time) (*roomSchedule, error) {
+	v := strings.TrimSpace(r.FormValue("start"))
+	if v == "" {
+		return nil, nil
+	}
+	loc := time.UTC
+	if tz := r.FormValue("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("Unknown time zone %q.", tz)
+		}
+	}
+	start, err := time.ParseInLocation(startLayout, v, loc)
+	if err != nil {
+		if start, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, errors.New("Give the start as a date and time.")
+		}
+	}
+	s := &roomSchedule{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Start:       start,
+		Duration:    defaultSessionLen,
+		Sessions:    1,
+		EarlyOpen:   cfg.EarlyOpen,
+	}
+	if d := r.FormValue("duration"); d != "" {
+		if s.Duration, err = time.ParseDuration(d); err != nil || s.Duration < 15*time.Minute || s.Duration > maxSessionLen {
+			return nil, errors.New("Sessions last from 15 minutes to 12 hours.")
+		}
+	}
+	switch repeat := r.FormValue("repeat"); repeat {
+	case "", "none":
+	case repeatDaily, repeatWeekly:
+		s.Repeat = repeat
+		if s.Sessions, err = strconv.Atoi(r.FormValue("sessions")); err != nil || s.Sessions < 2 || s.Sessions > maxSessions {
+			return nil, fmt.Errorf("Repeat from 2 to %d times.", maxSessions)
+		}
+	default:
+		return nil, errors.New("Repeat daily, weekly or not at all.")
+	}
+	if len([]rune(s.Title)) > maxScheduleTitleLen || len([]rune(s.Description)) > maxScheduleDescLen {
+		return nil, fmt.Errorf("Titles are up to %d characters, descriptions up to %d.", maxScheduleTitleLen, maxScheduleDescLen)
+	}
+	if !now.Before(start.Add(s.Duration)) || start.Sub(now) > maxScheduleAhead {
+		return nil, errors.New("Pick a start within the next year.")
+	}
+	return s, nil
+}
+
+type lobbyPage struct {
+	Nonce    string
+	RoomID   string
+	Code     string
+	PageURL  string
+	Schedule roomSchedule
+	// Next is the coming session and Opens when the room opens for it.
+	Next  time.Time
+	Opens time.Time
+}
+
+// renderLobby shows the countdown page of a scheduled room that isn't
+// open yet.
+func renderLobby(w http.ResponseWriter, r *http.Request, data lobbyPage) {
+	tmpl, err := parseTemplates(lobbyTemplatePath...)
+	if err != nil {
+		internalError(err, w)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("[Schedule] render: %v", err)
+	}
+}
+
+// GET /rooms/{roomID}/invite.ics – the room's schedule as a calendar event.
+func RoomInvite(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		s, ok := tm.roomSchedule(roomID)
+		if !validID(roomID) || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		link := inviteURL(r, cfg.Security, tm.roomLink(roomID))
+		summary := s.Title
+		if summary == "" {
+			summary = "Game night"
+		}
+		desc := "Join: " + link
+		if s.Description != "" {
+			desc = s.Description + "\n\n" + desc
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="invite.ics"`)
+		writeICS(w, icsEvent{
+			UID:         roomID + "@" + r.Host,
+			Stamp:       time.Now(),
+			Start:       s.Start,
+			End:         s.Start.Add(s.Duration),
+			Repeat:      s.Repeat,
+			Count:       s.Sessions,
+			Summary:     summary,
+			Description: desc,
+			URL:         link,
+		})
+	}
+}
+
+// icsEvent is one VEVENT, possibly repeating.
+type icsEvent struct {
+	UID                  string
+	Stamp, Start, End    time.Time
+	Repeat               string // "", repeatDaily or repeatWeekly
+	Count                int
+	Summary, Description string
+	URL                  string
+}
+
+// writeICS writes ev as an RFC 5545 calendar. Times in an IANA zone are
+// written with its TZID and a VTIMEZONE covering the event's sessions, so
+// repeats follow local time; any other time is written in UTC.
+func writeICS(w io.Writer, ev icsEvent) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//josephhammerman.com//rooms//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+	if tzid, ok := icsZone(ev.Start); ok {
+		last := ev.End
+		if ev.Count > 1 {
+			switch ev.Repeat {
+			case repeatDaily:
+				last = last.AddDate(0, 0, ev.Count-1)
+			case repeatWeekly:
+				last = last.AddDate(0, 0, 7*(ev.Count-1))
+			}
+		}
+		lines = append(lines, icsTimezone(tzid, ev.Start, last)...)
+	}
+	lines = append(lines,
+		"BEGIN:VEVENT",
+		"UID:"+icsText(ev.UID),
+		"DTSTAMP:"+ev.Stamp.UTC().Format("20060102T150405Z"),
+		icsTime("DTSTART", ev.Start),
+		icsTime("DTEND", ev.End),
+	)
+	if ev.Repeat != "" && ev.Count > 1 {
+		lines = append(lines, fmt.Sprintf("RRULE:FREQ=%s;COUNT=%d", strings.ToUpper(ev.Repeat), ev.Count))
+	}
+	lines = append(lines,
+		"SUMMARY:"+icsText(ev.Summary),
+		"DESCRIPTION:"+icsText(ev.Description),
+		"URL:"+ev.URL,
+		"LOCATION:"+icsText(ev.URL),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	)
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(icsFold(l))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// icsZone returns the TZID for t's location if it is an IANA zone. Fixed
+// offsets, such as an RFC 3339 start's, have no usable name.
+func icsZone(t time.Time) (string, bool) {
+	name := t.Location().String()
+	if name == "" || name == "UTC" || name == "Local" {
+		return "", false
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// icsTime formats a DTSTART or DTEND property.
+func icsTime(name string, t time.Time) string {
+	if tzid, ok := icsZone(t); ok {
+		return name + ";TZID=" + tzid + ":" + t.Format("20060102T150405")
+	}
+	return name + ":" + t.UTC().Format("20060102T150405Z")
+}
+
+// icsTimezone builds a VTIMEZONE for tzid with one STANDARD or DAYLIGHT
+// observance per offset period from the one holding from to the one
+// holding until.
+func icsTimezone(tzid string, from, until time.Time) []string {
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + tzid}
+	onset, end := from.ZoneBounds()
+	if onset.IsZero() {
+		onset = from
+	}
+	for {
+		lines = append(lines, icsObservance(onset.In(from.Location()))...)
+		if end.IsZero() || end.After(until) {
+			break
+		}
+		onset = end
+		_, end = onset.ZoneBounds()
+	}
+	return append(lines, "END:VTIMEZONE")
+}
+
+// icsObservance describes the offset period starting at onset.
+func icsObservance(onset time.Time) []string {
+	abbr, to := onset.Zone()
+	_, from := onset.Add(-time.Second).Zone()
+	kind := "STANDARD"
+	if onset.IsDST() {
+		kind = "DAYLIGHT"
+	}
+	return []string{
+		"BEGIN:" + kind,
+		// The onset is given in the local time it replaces.
+		"DTSTART:" + onset.In(time.FixedZone("", from)).Format("20060102T150405"),
+		"TZOFFSETFROM:" + icsOffset(from),
+		"TZOFFSETTO:" + icsOffset(to),
+		"TZNAME:" + icsText(abbr),
+		"END:" + kind,
+	}
+}
+
+// icsOffset formats a UTC offset in seconds as ±hhmm.
+func icsOffset(sec int) string {
+	sign := "+"
+	if sec < 0 {
+		sign, sec = "-", -sec
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, sec/3600, sec/60%60)
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// icsText escapes a TEXT value.
+func icsText(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// icsFold ends a content line with CRLF, folding it so no line is longer
+// than 75 octets, without splitting a UTF-8 sequence.
+func icsFold(line string) string {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+func TestScheduledRoomOpensEarly(t *testing.T) {
+	tm := NewTopicManager()
+	srv := httptest.NewServer(Router(tm, DefaultConfig()))
+	t.Cleanup(func() {
+		srv.Close()
+		close(tm.shutdown)
+	})
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	start := time.Now().Add(3 * time.Hour).UTC().Truncate(time.Second)
+	resp, err := noRedirect.PostForm(srv.URL+"/rooms", url.Values{
+		"type": {"video"}, "start": {start.Format(time.RFC3339)}, "repeat": {"weekly"}, "sessions": {"3"},
+		"title": {"Thursday, game night"}, "description": {"Bring snacks; dice provided."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	roomID := strings.TrimPrefix(resp.Header.Get("Location"), "/rooms/")
+	if resp.StatusCode != http.StatusSeeOther || !validID(roomID) {
+		t.Fatalf("create: got %d to %q", resp.StatusCode, roomID)
+	}
+
+	if err := dialErr(srv.URL, roomID, "playeraa"); !errors.Is(err, roomclient.ErrNotOpen) {
+		t.Fatalf("joined before opening: got %v", err)
+	}
+	if _, page := pageBody(http.Get(srv.URL + "/rooms/" + roomID)); !strings.Contains(page, "lobby-countdown") || !strings.Contains(page, "Thursday, game night") {
+		t.Fatal("room page is not the lobby")
+	}
+
+	resp, err = http.Get(srv.URL + "/rooms/" + roomID + "/invite.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctype := resp.Header.Get("Content-Type")
+	_, ics := pageBody(resp, nil)
+	if !strings.HasPrefix(ctype, "text/calendar") {
+		t.Fatalf("content type %q", ctype)
+	}
+	for _, want := range []string{
+		"BEGIN:VEVENT\r\n",
+		"DTSTART:" + start.Format("20060102T150405Z") + "\r\n",
+		"DTEND:" + start.Add(defaultSessionLen).Format("20060102T150405Z") + "\r\n",
+		"RRULE:FREQ=WEEKLY;COUNT=3\r\n",
+		`SUMMARY:Thursday\, game night`,
+		`DESCRIPTION:Bring snacks\; dice provided.\n\nJoin: http`,
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("invite lacks %q:\n%s", want, ics)
+		}
+	}
+	if code, _ := pageBody(http.Get(srv.URL + "/rooms/unscheduled1/invite.ics")); code != http.StatusNotFound {
+		t.Fatalf("invite for an unscheduled room: got %d", code)
+	}
+
+	// Inside the early-open window, joins are let in.
+	tm.mu.Lock()
+	tm.roomInfo[roomID].Schedule.Start = time.Now().Add(5 * time.Minute)
+	tm.mu.Unlock()
+	if err := dialErr(srv.URL, roomID, "playeraa"); err != nil {
+		t.Fatalf("join after opening: %v", err)
+	}
+
+	if code, _ := pageBody(noRedirect.PostForm(srv.URL+"/rooms", url.Values{"start": {time.Now().Add(-24 * time.Hour).Format(time.RFC3339)}})); code != http.StatusBadRequest {
+		t.Fatalf("start in the past: got %d", code)
+	}
+}
+
+func TestScheduleSessionsAndExpiry(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Daylight saving ends between the first and second sessions.
+	s := &roomSchedule{
+		Start:     time.Date(2026, 10, 29, 19, 0, 0, 0, ny),
+		Duration:  2 * time.Hour,
+		Repeat:    repeatWeekly,
+		Sessions:  3,
+		EarlyOpen: 15 * time.Minute,
+	}
+	second := s.session(1)
+	if second.Hour() != 19 || second.Day() != 5 {
+		t.Fatalf("second session at %v, want 19:00 on Nov 5", second)
+	}
+	if opens := s.opensAt(s.Start.Add(3 * time.Hour)); !opens.Equal(second.Add(-15 * time.Minute)) {
+		t.Fatalf("between sessions: opens %v", opens)
+	}
+	if opens := s.opensAt(second.Add(-10 * time.Minute)); !opens.IsZero() {
+		t.Fatalf("closed inside the early-open window until %v", opens)
+	}
+	if opens := s.opensAt(s.end()); !opens.IsZero() {
+		t.Fatalf("closed after the last session until %v", opens)
+	}
+
+	var b strings.Builder
+	writeICS(&b, icsEvent{Start: s.Start, End: s.Start.Add(s.Duration), Repeat: s.Repeat, Count: s.Sessions,
+		Description: strings.Repeat("Würfel ", 40)})
+	for _, want := range []string{
+		"DTSTART;TZID=America/New_York:20261029T190000\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:America/New_York\r\n",
+		// The session's own period, then the switch back on Nov 1.
+		"BEGIN:DAYLIGHT\r\nDTSTART:20260308T020000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20261101T020000\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("zoned invite lacks %q:\n%s", want, b.String())
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 || strings.ContainsRune(line, '\uFFFD') {
+			t.Fatalf("badly folded line %q", line)
+		}
+	}
+
+	// A start with only an offset is written in UTC.
+	offset, err := time.Parse(time.RFC3339, "2026-10-29T19:00:00+02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	writeICS(&b, icsEvent{Start: offset, End: offset.Add(time.Hour)})
+	if !strings.Contains(b.String(), "DTSTART:20261029T170000Z\r\n") || strings.Contains(b.String(), "TZID") {
+		t.Fatalf("offset start not in UTC:\n%s", b.String())
+	}
+
+	// Scheduled rooms expire roomInfoTTL after their last session, however
+	// long ago they were created.
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	upcoming := &roomSchedule{Start: time.Now().Add(-time.Hour), Duration: time.Hour, Repeat: repeatDaily, Sessions: 2}
+	finished := &roomSchedule{Start: old, Duration: time.Hour, Sessions: 1}
+	tm.registerRoom("upcoming01", roomInfo{Type: "video", Created: old, Schedule: upcoming})
+	tm.registerRoom("finished01", roomInfo{Type: "video", Created: old, Schedule: finished})
+	tm.cleanupTopics()
+	if _, ok := tm.roomSchedule("upcoming01"); !ok {
+		t.Fatal("dropped a room with a session to come")
+	}
+	if _, ok := tm.roomSchedule("finished01"); ok {
+		t.Fatal("kept a room whose sessions ended long ago")
+	}
+}
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SecurityConfig controls the headers set by SecurityHeaders.
+type SecurityConfig struct {
+	// TLS marks the site as served over HTTPS (typically behind a
+	// TLS-terminating proxy). HSTS is sent when this is set or when the
+	// request itself arrived over TLS.
+	TLS        bool
+	HSTSMaxAge time.Duration
+
+	ReferrerPolicy string
+	// FrameAncestors is the CSP frame-ancestors source list, e.g. "'none'".
+	FrameAncestors string
+
+	// GamePaths are mux path templates whose pages instantiate the dice
+	// game's WASM module and therefore need 'wasm-unsafe-eval'.
+	GamePaths []string
+	// MediaPaths are mux path templates allowed to use the camera and
+	// microphone.
+	MediaPaths []string
+
+	// TrustedProxies are the proxies whose X-Forwarded-For is believed;
+	// requests from anywhere else are identified by their peer address.
+	TrustedProxies []netip.Prefix
+}
+
+// ParseTrustedProxies reads a comma-separated list of IPs and CIDR
+// prefixes, as given in the TRUSTED_PROXIES environment variable.
+func ParseTrustedProxies(v string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if strings.Contains(f, "/") {
+			p, err := netip.ParsePrefix(f)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(f)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+func (cfg SecurityConfig) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range cfg.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIP is the client address of r: the peer address, or, when the
+// peer is a trusted proxy, the nearest X-Forwarded-For hop that is not.
+func (cfg SecurityConfig) requestIP(r *http.Request) string {
+	ip := peerIP(r)
+	if !cfg.trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !cfg.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// requestSecure reports whether r reached the site over HTTPS: the site
+// is configured for TLS, the connection is TLS, or a trusted proxy says so
+// in X-Forwarded-Proto.
+func (cfg SecurityConfig) requestSecure(r *http.Request) bool {
+	if cfg.TLS || r.TLS != nil {
+		return true
+	}
+	return cfg.trusted(peerIP(r)) && r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// DefaultSecurityConfig returns the policy the site ships with.
+func DefaultSecurityConfig() SecurityConfig {
+	return SecurityConfig{
+		HSTSMaxAge:     365 * 24 * time.Hour,
+		ReferrerPolicy: "strict-origin-when-cross-origin",
+		FrameAncestors: "'none'",
+		GamePaths:      []string{"/rooms/{roomID}"},
+		MediaPaths:     []string{"/rooms/{roomID}"},
+	}
+}
+
+type cspNonceKey struct{}
+
+type clientIPKey struct{}
+
+// cspNonce returns the per-request script nonce set by SecurityHeaders, or
+// "" if the middleware is not installed.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+func newCSPNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// SecurityHeaders sets CSP, HSTS, Permissions-Policy and Referrer-Policy on
+// every routed response. Page templates must put the request's cspNonce on
+// their <script> tags.
+func SecurityHeaders(cfg SecurityConfig) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce, err := newCSPNonce()
+			if err != nil {
+				internalError(err, w)
+				return
+			}
+
+			route := routeTemplate(r)
+			h := w.Header()
+			h.Set("Content-Security-Policy", cfg.contentSecurityPolicy(r, nonce, matchesRoute(route, cfg.GamePaths)))
+			h.Set("Permissions-Policy", permissionsPolicy(matchesRoute(route, cfg.MediaPaths)))
+			if cfg.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+			}
+			h.Set("X-Content-Type-Options", "nosniff")
+			if (cfg.TLS || r.TLS != nil) && cfg.HSTSMaxAge > 0 {
+				h.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int(cfg.HSTSMaxAge.Seconds())))
+			}
+
+			ctx := context.WithValue(r.Context(), cspNonceKey{}, nonce)
+			ctx = context.WithValue(ctx, clientIPKey{}, cfg.requestIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (cfg SecurityConfig) contentSecurityPolicy(r *http.Request, nonce string, game bool) string {
+	scriptSrc := "'self' 'nonce-" + nonce + "'"
+	if game {
+		scriptSrc += " 'wasm-unsafe-eval'"
+	}
+	// Older Safari does not treat 'self' as covering ws(s):, so name the
+	// signaling socket explicitly.
+	connectSrc := "'self' wss://" + r.Host
+	if !cfg.TLS && r.TLS == nil {
+		connectSrc += " ws://" + r.Host
+	}
+	directives := []string{
+		"default-src 'self'",
+		"script-src " + scriptSrc,
+		// Inline style attributes are used throughout the templates.
+		"style-src 'self' 'unsafe-inline'",
+		"img-src 'self' data: blob:",
+		"media-src 'self' blob: mediastream:",
+		"connect-src " + connectSrc,
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+	}
+	if cfg.FrameAncestors != "" {
+		directives = append(directives, "frame-ancestors "+cfg.FrameAncestors)
+	}
+	return strings.Join(directives, "; ")
+}
+
+// permissionsPolicy allows camera, microphone and screen capture only on
+// media pages. Motion sensors stay enabled there for shake-to-roll.
+func permissionsPolicy(media bool) string {
+	allow := "()"
+	if media {
+		allow = "(self)"
+	}
+	return strings.Join([]string{
+		"camera=" + allow,
+		"microphone=" + allow,
+		"display-capture=" + allow,
+		"accelerometer=" + allow,
+		"gyroscope=" + allow,
+		"geolocation=()",
+		"payment=()",
+		"usb=()",
+	}, ", ")
+}
+
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return tmpl
+}
+
+func matchesRoute(route string, templates []string) bool {
+	for _, t := range templates {
+		if route == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newSecurityTestRouter(cfg SecurityConfig) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(SecurityHeaders(cfg))
+	echoNonce := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(cspNonce(r)))
+	}
+	r.HandleFunc("/rooms/{roomID}", echoNonce)
+	r.HandleFunc("/home/", echoNonce)
+	return r
+}
+
+func TestSecurityHeadersNoncePerRequest(t *testing.T) {
+	r := newSecurityTestRouter(DefaultSecurityConfig())
+
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/home/", nil))
+		nonce := rec.Body.String()
+		if nonce == "" || seen[nonce] {
+			t.Fatalf("expected a fresh nonce, got %q", nonce)
+		}
+		seen[nonce] = true
+		csp := rec.Header().Get("Content-Security-Policy")
+		if !strings.Contains(csp, "'nonce-"+nonce+"'") {
+			t.Fatalf("CSP %q does not carry nonce %q", csp, nonce)
+		}
+	}
+}
+
+func TestSecurityHeadersGameAndMediaPages(t *testing.T) {
+	r := newSecurityTestRouter(DefaultSecurityConfig())
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rooms/abcdefgh", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "'wasm-unsafe-eval'") {
+		t.Fatalf("room page CSP should allow wasm: %q", csp)
+	}
+	if pp := rec.Header().Get("Permissions-Policy"); !strings.Contains(pp, "camera=(self)") || !strings.Contains(pp, "microphone=(self)") {
+		t.Fatalf("room page should allow camera/microphone: %q", pp)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/home/", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); strings.Contains(csp, "wasm-unsafe-eval") {
+		t.Fatalf("home page CSP should not allow wasm: %q", csp)
+	}
+	if pp := rec.Header().Get("Permissions-Policy"); !strings.Contains(pp, "camera=()") || !strings.Contains(pp, "microphone=()") {
+		t.Fatalf("home page should deny camera/microphone: %q", pp)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Fatalf("expected frame-ancestors in CSP: %q", csp)
+	}
+	if rp := rec.Header().Get("Referrer-Policy"); rp != "strict-origin-when-cross-origin" {
+		t.Fatalf("unexpected Referrer-Policy %q", rp)
+	}
+}
+
+func TestSecurityHeadersHSTSOnlyWithTLS(t *testing.T) {
+	cfg := DefaultSecurityConfig()
+
+	rec := httptest.NewRecorder()
+	newSecurityTestRouter(cfg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/home/", nil))
+	if hsts := rec.Header().Get("Strict-Transport-Security"); hsts != "" {
+		t.Fatalf("HSTS should not be sent without TLS, got %q", hsts)
+	}
+
+	cfg.TLS = true
+	rec = httptest.NewRecorder()
+	newSecurityTestRouter(cfg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/home/", nil))
+	if hsts := rec.Header().Get("Strict-Transport-Security"); !strings.HasPrefix(hsts, "max-age=31536000") {
+		t.Fatalf("expected HSTS with TLS enabled, got %q", hsts)
+	}
+}
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := SecurityConfig{TrustedProxies: proxies}
+	var got string
+	h := SecurityHeaders(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = clientIP(r)
+	}))
+	for _, c := range []struct {
+		remote, fwd, want string
+	}{
+		{"203.0.113.5:4000", "198.51.100.1", "203.0.113.5"},
+		{"192.0.2.7:4000", "198.51.100.1", "198.51.100.1"},
+		{"10.1.2.3:4000", "6.6.6.6, 198.51.100.1, 10.9.9.9", "198.51.100.1"},
+		{"10.1.2.3:4000", "", "10.1.2.3"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+		if c.fwd != "" {
+			req.Header.Set("X-Forwarded-For", c.fwd)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got != c.want {
+			t.Errorf("from %s with %q: got %s, want %s", c.remote, c.fwd, got, c.want)
+		}
+	}
+	if _, err := ParseTrustedProxies("not-an-ip"); err == nil {
+		t.Fatal("expected an error for a bad proxy")
+	}
+}
@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// In SFU rooms every client holds a single RTCPeerConnection to the server,
+// which takes part in signaling as the virtual peer sfuPeerID over the same
+// /rooms/{roomID}/ws protocol. Each client publishes one upstream; the
+// server forwards every published track to all other participants. The
+// server is always the offerer, so clients only ever answer.
+
+const (
+	sfuPeerID = "sfu-server"
+
+	roomModeMesh = "mesh"
+	roomModeSFU  = "sfu"
+
+	// keyframeInterval bounds how long a new subscriber waits for a
+	// decodable video frame.
+	keyframeInterval = 3 * time.Second
+)
+
+// SFUConfig configures the server-side media path.
+type SFUConfig struct {
+	Enabled bool
+	// MaxParticipants is the capacity of SFU rooms.
+	MaxParticipants int
+	// PublicIPs replace the host candidates the server advertises, for
+	// deployments behind 1:1 NAT.
+	PublicIPs []string
+	// MinPort and MaxPort bound the server's ICE UDP ports; 0 means any.
+	MinPort, MaxPort int
+	// RecordingDir is where room recordings are written; empty disables
+	// recording.
+	RecordingDir string
+}
+
+// DefaultSFUConfig leaves the SFU off.
+func DefaultSFUConfig() SFUConfig {
+	return SFUConfig{MaxParticipants: 50}
+}
+
+// trackSink receives a copy of every RTP packet of a published track.
+type trackSink interface {
+	WriteRTP(*rtp.Packet) error
+}
+
+type sfuManager struct {
+	api   *webrtc.API
+	cfg   SFUConfig
+	tm    *TopicManager
+	mu    sync.Mutex
+	rooms map[string]*sfuRoom
+}
+
+type sfuRoom struct {
+	id     string
+	mgr    *sfuManager
+	mu     sync.Mutex
+	peers  map[string]*sfuPeer  // clientID -> peer
+	tracks map[string]*sfuTrack // local track ID -> forwarded track
+	done   chan struct{}
+
+	recording *roomRecording // nil unless the host is recording
+}
+
+type sfuPeer struct {
+	clientID   string
+	pc         *webrtc.PeerConnection
+	needsOffer bool // renegotiation requested while an offer was outstanding
+}
+
+// sfuTrack is one published upstream track and its fan-out.
+type sfuTrack struct {
+	owner  string
+	remote *webrtc.TrackRemote
+	pc     *webrtc.PeerConnection // publisher's connection, for PLI
+	local  *webrtc.TrackLocalStaticRTP
+
+	mu    sync.Mutex
+	sinks []trackSink
+}
+
+func newSFUManager(tm *TopicManager, cfg SFUConfig) (*sfuManager, error) {
+	se := webrtc.SettingEngine{}
+	if cfg.MinPort > 0 && cfg.MaxPort > 0 {
+		if err := se.SetEphemeralUDPPortRange(uint16(cfg.MinPort), uint16(cfg.MaxPort)); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.PublicIPs) > 0 {
+		if err := se.SetICEAddressRewriteRules(webrtc.ICEAddressRewriteRule{
+			External:        cfg.PublicIPs,
+			AsCandidateType: webrtc.ICECandidateTypeHost,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return &sfuManager{
+		api:   webrtc.NewAPI(webrtc.WithSettingEngine(se)),
+		cfg:   cfg,
+		tm:    tm,
+		rooms: make(map[string]*sfuRoom),
+	}, nil
+}
+
+func (m *sfuManager) room(roomID string) *sfuRoom {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rooms[roomID]
+	if !ok {
+		r = &sfuRoom{
+			id:     roomID,
+			mgr:    m,
+			peers:  make(map[string]*sfuPeer),
+			tracks: make(map[string]*sfuTrack),
+			done:   make(chan struct{}),
+		}
+		m.rooms[roomID] = r
+		go r.keyframeLoop()
+	}
+	return r
+}
+
+// send delivers a signaling frame from the virtual peer to clientID.
+func (r *sfuRoom) send(clientID string, sig signalMessage) {
+	sig.From = sfuPeerID
+	sig.To = clientID
+	sig.RoomID = r.id
+	data, err := json.Marshal(sig)
+	if err != nil {
+		return
+	}
+	r.mgr.tm.sendTo(r.id, clientID, data)
+}
+
+// join creates the server side of clientID's connection and offers it every
+// track already published in the room.
+func (m *sfuManager) join(roomID, clientID string) error {
+	r := m.room(roomID)
+
+	pc, err := m.api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return err
+	}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			pc.Close()
+			return err
+		}
+	}
+
+	peer := &sfuPeer{clientID: clientID, pc: pc}
+
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		ice, err := json.Marshal(c.ToJSON())
+		if err != nil {
+			return
+		}
+		r.send(clientID, signalMessage{Type: "candidate", ICE: ice})
+	})
+	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		if s == webrtc.PeerConnectionStateFailed {
+			log.Printf("[SFU] %s in room %s: connection failed", clientID, roomID)
+			pc.Close()
+		}
+	})
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		r.publish(clientID, pc, remote)
+	})
+
+	r.mu.Lock()
+	if old, ok := r.peers[clientID]; ok {
+		// Reconnect with the same clientID: drop the stale connection.
+		r.removePeerLocked(old)
+	}
+	r.peers[clientID] = peer
+	r.mu.Unlock()
+
+	log.Printf("[SFU] %s joined room %s", clientID, roomID)
+	r.signal()
+	return nil
+}
+
+// leave tears down clientID's connection and unpublishes its tracks.
+func (m *sfuManager) leave(roomID, clientID string) {
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	if peer, ok := r.peers[clientID]; ok {
+		r.removePeerLocked(peer)
+	}
+	empty := len(r.peers) == 0
+	r.mu.Unlock()
+
+	if empty {
+		if _, _, err := r.stopRecording(); err == nil {
+			log.Printf("[Recording] room %s emptied; recording stopped", roomID)
+		}
+		m.mu.Lock()
+		if m.rooms[roomID] == r {
+			delete(m.rooms, roomID)
+			close(r.done)
+		}
+		m.mu.Unlock()
+		return
+	}
+	r.signal()
+}
+
+func (r *sfuRoom) removePeerLocked(peer *sfuPeer) {
+	delete(r.peers, peer.clientID)
+	for id, t := range r.tracks {
+		if t.owner == peer.clientID {
+			delete(r.tracks, id)
+		}
+	}
+	peer.pc.Close()
+}
+
+// handleSignal processes a frame a client addressed to the virtual peer.
+func (m *sfuManager) handleSignal(roomID, clientID string, sig signalMessage) {
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	peer, ok := r.peers[clientID]
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	switch sig.Type {
+	case "answer":
+		var sdp string
+		if err := json.Unmarshal(sig.SDP, &sdp); err != nil {
+			log.Printf("[SFU] bad answer from %s: %v", clientID, err)
+			return
+		}
+		// Serialize with signal() so an answer can't land between its
+		// signaling-state check and the next offer.
+		r.mu.Lock()
+		err := peer.pc.SetRemoteDescription(webrtc.SessionDescription{
+			Type: webrtc.SDPTypeAnswer,
+			SDP:  sdp,
+		})
+		again := peer.needsOffer
+		peer.needsOffer = false
+		r.mu.Unlock()
+		if err != nil {
+			log.Printf("[SFU] set answer from %s: %v", clientID, err)
+			return
+		}
+		if again {
+			r.signal()
+		}
+	case "candidate":
+		var c webrtc.ICECandidateInit
+		if err := json.Unmarshal(sig.ICE, &c); err != nil {
+			return
+		}
+		if err := peer.pc.AddICECandidate(c); err != nil {
+			log.Printf("[SFU] add candidate from %s: %v", clientID, err)
+		}
+	}
+}
+
+// publish starts forwarding a newly received upstream track.
+func (r *sfuRoom) publish(owner string, pc *webrtc.PeerConnection, remote *webrtc.TrackRemote) {
+	// The stream ID is the publisher's clientID so subscribers can label
+	// the video with the right player; track IDs are prefixed with it so
+	// two publishers can never collide inside one subscriber's connection.
+	id := owner + "-" + remote.ID()
+	local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, id, owner)
+	if err != nil {
+		log.Printf("[SFU] local track for %s: %v", owner, err)
+		return
+	}
+	t := &sfuTrack{owner: owner, remote: remote, pc: pc, local: local}
+	t.sinks = []trackSink{local}
+
+	r.mu.Lock()
+	r.tracks[id] = t
+	if r.recording != nil {
+		r.recording.addTrack(t, r.mgr.tm.slotOf(r.id, owner))
+	}
+	r.mu.Unlock()
+	log.Printf("[SFU] %s published %s track in room %s", owner, remote.Kind(), r.id)
+	r.signal()
+
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			if r.tracks[id] == t {
+				delete(r.tracks, id)
+			}
+			rec := r.recording
+			r.mu.Unlock()
+			if rec != nil {
+				rec.removeTrack(t)
+			}
+			r.signal()
+		}()
+		for {
+			pkt, _, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			t.forward(pkt)
+		}
+	}()
+}
+
+func (t *sfuTrack) addSink(s trackSink) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Copy so forward can range over its snapshot without the lock.
+	t.sinks = append(t.sinks[:len(t.sinks):len(t.sinks)], s)
+}
+
+func (t *sfuTrack) removeSink(s trackSink) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sinks := make([]trackSink, 0, len(t.sinks))
+	for _, existing := range t.sinks {
+		if existing != s {
+			sinks = append(sinks, existing)
+		}
+	}
+	t.sinks = sinks
+}
+
+// observe logs a relayed game message on the room's recording timeline.
+func (m *sfuManager) observe(roomID string, sig signalMessage, raw []byte) {
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	rec := r.recording
+	r.mu.Unlock()
+	if rec != nil {
+		rec.logEvent(sig, raw)
+	}
+}
+
+func (t *sfuTrack) forward(pkt *rtp.Packet) {
+	t.mu.Lock()
+	sinks := t.sinks
+	t.mu.Unlock()
+	for _, s := range sinks {
+		if err := s.WriteRTP(pkt); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			log.Printf("[SFU] forward %s: %v", t.owner, err)
+		}
+	}
+}
+
+// signal brings every peer's senders in line with the published tracks and
+// sends a fresh offer to each peer whose connection is ready for one.
+func (r *sfuRoom) signal() {
+	type pendingOffer struct {
+		clientID string
+		sdp      string
+	}
+	var offers []pendingOffer
+
+	r.mu.Lock()
+	for _, peer := range r.peers {
+		if peer.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			continue
+		}
+		if peer.pc.SignalingState() != webrtc.SignalingStateStable {
+			peer.needsOffer = true
+			continue
+		}
+
+		sending := make(map[string]bool)
+		for _, sender := range peer.pc.GetSenders() {
+			track := sender.Track()
+			if track == nil {
+				continue
+			}
+			if _, ok := r.tracks[track.ID()]; !ok {
+				if err := peer.pc.RemoveTrack(sender); err != nil {
+					log.Printf("[SFU] remove track from %s: %v", peer.clientID, err)
+				}
+				continue
+			}
+			sending[track.ID()] = true
+		}
+		for id, t := range r.tracks {
+			if t.owner == peer.clientID || sending[id] {
+				continue
+			}
+			if _, err := peer.pc.AddTrack(t.local); err != nil {
+				log.Printf("[SFU] add track to %s: %v", peer.clientID, err)
+			}
+		}
+
+		offer, err := peer.pc.CreateOffer(nil)
+		if err != nil {
+			log.Printf("[SFU] offer for %s: %v", peer.clientID, err)
+			continue
+		}
+		if err := peer.pc.SetLocalDescription(offer); err != nil {
+			log.Printf("[SFU] set offer for %s: %v", peer.clientID, err)
+			continue
+		}
+		offers = append(offers, pendingOffer{peer.clientID, offer.SDP})
+	}
+	r.mu.Unlock()
+
+	for _, o := range offers {
+		sdp, _ := json.Marshal(o.sdp)
+		r.send(o.clientID, signalMessage{Type: "offer", SDP: sdp})
+	}
+	r.requestKeyframes()
+}
+
+// requestKeyframes asks every video publisher for a keyframe so new
+// subscribers can start decoding.
+func (r *sfuRoom) requestKeyframes() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tracks {
+		if t.remote.Kind() != webrtc.RTPCodecTypeVideo {
+			continue
+		}
+		t.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(t.remote.SSRC())}})
+	}
+}
+
+func (r *sfuRoom) keyframeLoop() {
+	ticker := time.NewTicker(keyframeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.requestKeyframes()
+		case <-r.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+func newSFUTestServer(t *testing.T, cfg SFUConfig) (*httptest.Server, *TopicManager) {
+	t.Helper()
+	tm := NewTopicManager()
+	if err := tm.EnableSFU(cfg); err != nil {
+		t.Fatalf("enable sfu: %v", err)
+	}
+	r := mux.NewRouter()
+	r.Handle("/rooms/{roomID}/ws", VideoConnections(tm))
+	srv := httptest.NewServer(r)
+	t.Cleanup(func() {
+		srv.Close()
+		close(tm.shutdown)
+	})
+	return srv, tm
+}
+
+func TestSFURoomCapacity(t *testing.T) {
+	tm := NewTopicManager()
+	defer close(tm.shutdown)
+	if err := tm.EnableSFU(SFUConfig{Enabled: true, MaxParticipants: 25}); err != nil {
+		t.Fatal(err)
+	}
+	tm.registerRoom("bigroom", roomInfo{Mode: roomModeSFU, Created: time.Now()})
+
+	for i := 0; i < 25; i++ {
+		if ok, _ := tm.addRoomMember("bigroom", string(rune('A'+i))); !ok {
+			t.Fatalf("unexpected failure at member %d", i)
+		}
+	}
+	if ok, _ := tm.addRoomMember("bigroom", "overflow"); ok {
+		t.Fatal("expected SFU room to be full at 25")
+	}
+	if got := tm.capacityLocked("meshroom"); got != maxRoomParticipants {
+		t.Fatalf("mesh room capacity = %d, want %d", got, maxRoomParticipants)
+	}
+}
+
+func TestMeshRoomPeersMessageMode(t *testing.T) {
+	srv, _ := newSFUTestServer(t, DefaultSFUConfig())
+
+	conn := dialWS(t, srv.URL, "meshroom1", "meshuser1")
+	defer conn.Close()
+
+	msg := readJSON(t, conn, time.Second)
+	if msg["type"] != "peers" || msg["mode"] != roomModeMesh {
+		t.Fatalf("expected mesh peers message, got %v", msg)
+	}
+	if _, ok := msg["sfuPeer"]; ok {
+		t.Fatalf("mesh room should not name an SFU peer: %v", msg)
+	}
+}
+
+// sfuClient is a minimal participant: it answers the server's offers and
+// publishes one video track.
+type sfuClient struct {
+	id     string
+	conn   *websocket.Conn
+	connMu sync.Mutex
+	pc     *webrtc.PeerConnection
+	track  *webrtc.TrackLocalStaticRTP
+	tracks chan *webrtc.TrackRemote
+	peers  chan map[string]interface{}
+	// notices receives the virtual peer's other frames, e.g. recording
+	// status.
+	notices chan map[string]interface{}
+}
+
+func newSFUClient(t *testing.T, serverURL, roomID, clientID string) *sfuClient {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &sfuClient{
+		id:     clientID,
+		conn:   dialWS(t, serverURL, roomID, clientID),
+		pc:     pc,
+		track:  track,
+		tracks: make(chan *webrtc.TrackRemote, 4),
+		peers:  make(chan map[string]interface{}, 1),
+
+		notices: make(chan map[string]interface{}, 16),
+	}
+	t.Cleanup(func() {
+		c.conn.Close()
+		pc.Close()
+	})
+
+	pc.OnICECandidate(func(cand *webrtc.ICECandidate) {
+		if cand == nil {
+			return
+		}
+		ice, _ := json.Marshal(cand.ToJSON())
+		c.send(roomID, signalMessage{Type: "candidate", ICE: ice})
+	})
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		c.tracks <- remote
+	})
+
+	go func() {
+		for {
+			_, raw, err := c.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg map[string]interface{}
+			if json.Unmarshal(raw, &msg) == nil && msg["type"] == "peers" {
+				c.peers <- msg
+				continue
+			}
+			if msg["from"] == sfuPeerID && msg["type"] != "offer" && msg["type"] != "candidate" {
+				c.notices <- msg
+				continue
+			}
+			var sig signalMessage
+			if err := json.Unmarshal(raw, &sig); err != nil || sig.From != sfuPeerID {
+				continue
+			}
+			switch sig.Type {
+			case "offer":
+				var sdp string
+				json.Unmarshal(sig.SDP, &sdp)
+				// Errors here surface as missing tracks; they are also
+				// expected once cleanup has closed the connection.
+				if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}); err != nil {
+					return
+				}
+				answer, err := pc.CreateAnswer(nil)
+				if err != nil {
+					return
+				}
+				pc.SetLocalDescription(answer)
+				sdpJSON, _ := json.Marshal(answer.SDP)
+				c.send(roomID, signalMessage{Type: "answer", SDP: sdpJSON})
+			case "candidate":
+				var cand webrtc.ICECandidateInit
+				if json.Unmarshal(sig.ICE, &cand) == nil {
+					pc.AddICECandidate(cand)
+				}
+			}
+		}
+	}()
+	return c
+}
+
+func (c *sfuClient) send(roomID string, sig signalMessage) {
+	sig.From = c.id
+	sig.To = sfuPeerID
+	sig.RoomID = roomID
+	data, _ := json.Marshal(sig)
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// publish writes fake VP8 packets on c's track until stop is closed.
+func (c *sfuClient) publish(stop chan struct{}) {
+	seq := uint16(0)
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			seq++
+			c.track.WriteRTP(&rtp.Packet{
+				Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 3000, Marker: true},
+				Payload: []byte{0x10, 0x00, 0x00, 0x9d, 0x01, 0x2a},
+			})
+		case <-stop:
+			return
+		}
+	}
+}
+
+func TestSFUForwardsPublishedTracks(t *testing.T) {
+	srv, tm := newSFUTestServer(t, SFUConfig{Enabled: true, MaxParticipants: 20})
+	const roomID = "sfuroom1"
+	tm.registerRoom(roomID, roomInfo{Type: "video", Mode: roomModeSFU, Created: time.Now()})
+
+	alice := newSFUClient(t, srv.URL, roomID, "alice01")
+	select {
+	case msg := <-alice.peers:
+		if msg["mode"] != roomModeSFU || msg["sfuPeer"] != sfuPeerID {
+			t.Fatalf("expected sfu peers message, got %v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no peers message")
+	}
+	bob := newSFUClient(t, srv.URL, roomID, "bob0001")
+
+	// Publish on both sides until each sees the other's track.
+	stop := make(chan struct{})
+	defer close(stop)
+	go alice.publish(stop)
+	go bob.publish(stop)
+
+	for _, tc := range []struct {
+		receiver  *sfuClient
+		publisher string
+	}{{bob, alice.id}, {alice, bob.id}} {
+		select {
+		case remote := <-tc.receiver.tracks:
+			if remote.StreamID() != tc.publisher {
+				t.Fatalf("%s got stream %q, want publisher %q", tc.receiver.id, remote.StreamID(), tc.publisher)
+			}
+			if !strings.HasPrefix(remote.ID(), tc.publisher+"-") {
+				t.Fatalf("track ID %q not namespaced by publisher", remote.ID())
+			}
+			remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, _, err := remote.ReadRTP(); err != nil {
+				t.Fatalf("%s: read forwarded RTP: %v", tc.receiver.id, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s never received %s's track", tc.receiver.id, tc.publisher)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Fallback signaling transport for clients whose proxies break WebSocket
+// upgrades. GET /rooms/{roomID}/events streams server→client frames as
+// Server-Sent Events; POST /rooms/{roomID}/signal carries client→server
+// frames. Both drive the same roomSession as /ws, so peers, player_joined,
+// player_left and relayed frames behave identically.
+//
+// The first event on the stream is "session", whose data is a token the
+// client sends back in the X-Session-Token header with every POST. The
+// token lives as long as the stream.
+
+const (
+	sessionTokenHeader = "X-Session-Token"
+	// sseKeepAliveInterval keeps idle proxies from closing the stream.
+	sseKeepAliveInterval = 25 * time.Second
+	maxSignalBodyBytes   = 64 << 10
+)
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (tm *TopicManager) registerHTTPSession(token string, s *roomSession) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.httpSessions[token] = s
+}
+
+func (tm *TopicManager) dropHTTPSession(token string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	delete(tm.httpSessions, token)
+}
+
+func (tm *TopicManager) httpSession(token string) *roomSession {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.httpSessions[token]
+}
+
+// writeSSE writes one event. Multi-line data is split across data: lines
+// as the spec requires.
+func writeSSE(w io.Writer, event string, data []byte) error {
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// RoomEvents streams a room's frames to one client.
+//
+// GET /rooms/{roomID}/events?userID=…
+func RoomEvents(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		userID := r.URL.Query().Get("userID")
+		if !validID(roomID) || !validID(userID) {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		if !tm.clientIDAllowed(r, userID) {
+			http.Error(w, "sign in to use this clientID", http.StatusForbidden)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			internalError(fmt.Errorf("streaming unsupported by %T", w), w)
+			return
+		}
+		token, err := newSessionToken()
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+
+		session, err := tm.openSession(roomID, userID, transportSSE)
+		if err != nil {
+			http.Error(w, err.Error(), sessionErrorStatus(err))
+			return
+		}
+		defer session.close()
+		session.presence = parsePresence([]byte(r.URL.Query().Get("presence")))
+		session.ip = clientIP(r)
+		tm.registerHTTPSession(token, session)
+		defer tm.dropHTTPSession(token)
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		// Stop nginx-style proxies from buffering the stream.
+		h.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		// Start before handing out the token, so the first POSTed frame
+		// finds the session subscribed and attached to its SFU.
+		session.start()
+		if err := writeSSE(w, "session", []byte(token)); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		ctx, cancel := context.WithTimeout(r.Context(), keepAliveInterval)
+		defer cancel()
+
+		ping := time.NewTicker(sseKeepAliveInterval)
+		defer ping.Stop()
+		probe := time.NewTicker(healthInterval)
+		defer probe.Stop()
+		for {
+			select {
+			case msg, ok := <-session.out:
+				if !ok {
+					return
+				}
+				if err := writeSSE(w, "", msg); err != nil {
+					log.Printf("[SSE] write to %s: %v", userID, err)
+					return
+				}
+				flusher.Flush()
+			case <-session.ended:
+				writeSSE(w, "", session.removedFrame())
+				flusher.Flush()
+				return
+			case <-ping.C:
+				if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case now := <-probe.C:
+				// The client POSTs back a pong; see handlePong.
+				if err := writeSSE(w, "", session.pingFrame(now)); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// RoomSignal accepts one frame from a client connected through RoomEvents.
+//
+// POST /rooms/{roomID}/signal with X-Session-Token
+func RoomSignal(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["roomID"]
+		session := tm.httpSession(r.Header.Get(sessionTokenHeader))
+		if session == nil || session.roomID != roomID {
+			http.Error(w, "unknown session", http.StatusForbidden)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignalBodyBytes))
+		if err != nil {
+			http.Error(w, "frame too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		session.handleFrame(body)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+func newTransportTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	tm := NewTopicManager()
+	r := mux.NewRouter()
+	r.Handle("/rooms/{roomID}/ws", VideoConnections(tm))
+	r.Handle("/rooms/{roomID}/events", RoomEvents(tm)).Methods(http.MethodGet)
+	r.Handle("/rooms/{roomID}/signal", RoomSignal(tm)).Methods(http.MethodPost)
+	srv := httptest.NewServer(r)
+	t.Cleanup(func() {
+		srv.Close()
+		close(tm.shutdown)
+	})
+	return srv
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// dialSSE opens an event stream and delivers parsed events on a channel.
+func dialSSE(t *testing.T, serverURL, roomID, userID string) (<-chan sseEvent, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/rooms/"+roomID+"/events?userID="+userID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("dial sse: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		cancel()
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var ev sseEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.data != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data += strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	t.Cleanup(cancel)
+	return events, cancel
+}
+
+func readSSE(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return sseEvent{}
+}
+
+func postSignal(t *testing.T, serverURL, roomID, token string, frame interface{}) int {
+	t.Helper()
+	body, _ := json.Marshal(frame)
+	req, _ := http.NewRequest(http.MethodPost, serverURL+"/rooms/"+roomID+"/signal", strings.NewReader(string(body)))
+	req.Header.Set(sessionTokenHeader, token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post signal: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSSEClientInteroperatesWithWebSocketClient(t *testing.T) {
+	srv := newTransportTestServer(t)
+	const roomID = "sseroom1"
+
+	wsConn := dialWS(t, srv.URL, roomID, "wsuser01")
+	defer wsConn.Close()
+	if msg := readJSON(t, wsConn, time.Second); msg["type"] != "peers" {
+		t.Fatalf("expected peers, got %v", msg)
+	}
+
+	events, hangUp := dialSSE(t, srv.URL, roomID, "sseuser1")
+	session := readSSE(t, events)
+	if session.name != "session" || session.data == "" {
+		t.Fatalf("expected session event first, got %+v", session)
+	}
+
+	var peers map[string]interface{}
+	json.Unmarshal([]byte(readSSE(t, events).data), &peers)
+	if peers["type"] != "peers" || peers["mySlot"] != float64(1) {
+		t.Fatalf("expected peers with slot 1, got %v", peers)
+	}
+	if list, _ := peers["peers"].([]interface{}); len(list) != 1 || list[0] != "wsuser01" {
+		t.Fatalf("expected the WebSocket peer, got %v", peers["peers"])
+	}
+	if msg := readJSON(t, wsConn, time.Second); msg["type"] != "player_joined" || msg["peerID"] != "sseuser1" {
+		t.Fatalf("expected player_joined for the SSE client, got %v", msg)
+	}
+
+	// SSE → WebSocket via POST.
+	offer := map[string]interface{}{"type": "offer", "from": "sseuser1", "to": "wsuser01", "roomID": roomID, "sdp": "v=0"}
+	if code := postSignal(t, srv.URL, roomID, session.data, offer); code != http.StatusNoContent {
+		t.Fatalf("post: got %d", code)
+	}
+	if msg := readJSON(t, wsConn, time.Second); msg["type"] != "offer" || msg["from"] != "sseuser1" {
+		t.Fatalf("expected relayed offer, got %v", msg)
+	}
+
+	// WebSocket → SSE.
+	answer, _ := json.Marshal(map[string]interface{}{"type": "answer", "from": "wsuser01", "to": "sseuser1", "roomID": roomID, "sdp": "v=0"})
+	wsConn.WriteMessage(websocket.TextMessage, answer)
+	var got map[string]interface{}
+	json.Unmarshal([]byte(readSSE(t, events).data), &got)
+	if got["type"] != "answer" || got["from"] != "wsuser01" {
+		t.Fatalf("expected relayed answer, got %v", got)
+	}
+
+	if code := postSignal(t, srv.URL, roomID, "bogus", offer); code != http.StatusForbidden {
+		t.Fatalf("unknown token: got %d", code)
+	}
+	if code := postSignal(t, srv.URL, "otherroom1", session.data, offer); code != http.StatusForbidden {
+		t.Fatalf("token for another room: got %d", code)
+	}
+
+	hangUp()
+	if msg := readJSON(t, wsConn, time.Second); msg["type"] != "player_left" || msg["peerID"] != "sseuser1" {
+		t.Fatalf("expected player_left for the SSE client, got %v", msg)
+	}
+	if code := postSignal(t, srv.URL, roomID, session.data, offer); code != http.StatusForbidden {
+		t.Fatalf("token after disconnect: got %d", code)
+	}
+}
+
+func TestSSERejectsInvalidIDs(t *testing.T) {
+	srv := newTransportTestServer(t)
+	resp, err := http.Get(srv.URL + "/rooms/sseroom2/events?userID=ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestWriteSSESplitsLines(t *testing.T) {
+	var b strings.Builder
+	writeSSE(&b, "x", []byte("a\nb"))
+	if got, want := b.String(), "event: x\ndata: a\ndata: b\n\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,398 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/accounts"
+)
+
+// Finished dice games feed a leaderboard. When a game ends every player's
+// page reports the result it computed — winner, and each player's score,
+// turns, biggest banked turn and longest run of scoring rolls — with a
+// game_result frame. Every peer applies the same rolls, so honest reports
+// agree; the server records a game once resultConfirmations distinct
+// reporters have sent identical ones, which keeps one tampered page from
+// writing history. A reporter is a signed-in account, or for anonymous
+// players their IP address, so one person with several tabs or clientIDs
+// counts once; anonymous players sharing a network need accounts for
+// their games to count. An anonymous report from an address an agreeing
+// account also reported from adds nothing, so a signed-in seat and an
+// anonymous one cannot confirm a game alone.
+// Duration comes from the server's own start time. One-player games are
+// never confirmed and so never recorded.
+//
+// Records are kept in memory and, with StatsConfig.File set, appended to a
+// JSONL file that is replayed at startup. The leaderboard aggregates them
+// per player, optionally for one variant or one room.
+
+// StatsConfig configures game statistics.
+type StatsConfig struct {
+	// File keeps results across restarts; empty keeps them in memory.
+	File string
+}
+
+// DefaultStatsConfig keeps results in memory.
+func DefaultStatsConfig() StatsConfig {
+	return StatsConfig{}
+}
+
+const (
+	resultConfirmations   = 2
+	defaultLeaderboardLen = 50
+	maxLeaderboardLen     = 500
+)
+
+var leaderboardTemplatePath = append([]string{templatePath + "leaderboard.gohtml"}, baseTemplatePaths...)
+
+// gameResult is a game_result frame's report; Players is in roster order.
+type gameResult struct {
+	Winner  int            `json:"winner"`
+	Players []playerResult `json:"players"`
+}
+
+type playerResult struct {
+	Score         int  `json:"score"`
+	Turns         int  `json:"turns"`
+	BiggestTurn   int  `json:"biggestTurn"`
+	LongestStreak int  `json:"longestStreak"`
+	Kicked        bool `json:"kicked"`
+}
+
+// valid reports whether r could describe a game with players players.
+func (r gameResult) valid(players int) bool {
+	if len(r.Players) != players || r.Winner < -1 || r.Winner >= players {
+		return false
+	}
+	for _, p := range r.Players {
+		if p.Score < 0 || p.Turns < 0 || p.BiggestTurn < 0 || p.LongestStreak < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// gameRecord is one confirmed game.
+type gameRecord struct {
+	GameID      string         `json:"gameID"`
+	RoomID      string         `json:"roomID"`
+	Variant     string         `json:"variant"`
+	Ended       time.Time      `json:"ended"`
+	DurationSec int            `json:"durationSec"`
+	Turns       int            `json:"turns"`
+	Winner      string         `json:"winner,omitempty"`
+	Players     []recordPlayer `json:"players"`
+}
+
+type recordPlayer struct {
+	ClientID string `json:"clientID"`
+	Name     string `json:"name,omitempty"`
+	playerResult
+}
+
+// gameStats holds the recorded games.
+type gameStats struct {
+	mu      sync.Mutex
+	records []gameRecord
+	file    *os.File
+}
+
+// EnableStats keeps results in cfg.File, loading those already there.
+func (tm *TopicManager) EnableStats(cfg StatsConfig) error {
+	if err := os.MkdirAll(filepath.Dir(cfg.File), 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	var records []gameRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var r gameRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			log.Printf("[Stats] skipping bad line in %s: %v", cfg.File, err)
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return err
+	}
+	s := tm.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(records, s.records...)
+	s.file = f
+	return nil
+}
+
+func (s *gameStats) add(r gameRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	if s.file == nil {
+		return
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		log.Printf("[Stats] write: %v", err)
+	}
+}
+
+// resultReport is one player's game_result for a round and who sent it:
+// the account for verified account clientIDs, and the client's address.
+type resultReport struct {
+	result  string
+	account string
+	ip      string
+}
+
+// report builds s's resultReport for result.
+func (s *roomSession) report(result string) resultReport {
+	r := resultReport{result: result, ip: s.ip}
+	if strings.HasPrefix(s.clientID, accounts.ClientIDPrefix) {
+		r.account = s.clientID
+	}
+	return r
+}
+
+// confirmations counts the distinct reporters of result: each account
+// once, and each address without an agreeing account on it once.
+func confirmations(reports map[string]resultReport, result string) int {
+	accounts, addrs := map[string]bool{}, map[string]bool{}
+	for _, r := range reports {
+		if r.result != result {
+			continue
+		}
+		if r.account != "" {
+			accounts[r.account] = true
+		} else {
+			addrs[r.ip] = true
+		}
+	}
+	for _, r := range reports {
+		if r.result == result && r.account != "" {
+			delete(addrs, r.ip)
+		}
+	}
+	return len(accounts) + len(addrs)
+}
+
+// reportGameResult handles game_result from a player of the table.
+func (s *roomSession) reportGameResult(f gameFrame) {
+	tm, roomID, me := s.tm, s.roomID, s.clientID
+	if f.Result == nil {
+		return
+	}
+	report, err := json.Marshal(f.Result)
+	if err != nil {
+		return
+	}
+
+	var finished gameTable
+	tm.mu.Lock()
+	g := tm.games[roomID][f.GameID]
+	if g == nil || g.Status == gameStatusOpen || g.recorded || !g.inRoster(me) || !f.Result.valid(len(g.Roster)) {
+		tm.mu.Unlock()
+		return
+	}
+	if g.reports == nil {
+		g.reports = make(map[string]resultReport)
+	}
+	g.reports[me] = s.report(string(report))
+	if confirmations(g.reports, string(report)) >= resultConfirmations {
+		g.recorded = true
+		finished = *g
+		finished.Roster = append([]string{}, g.Roster...)
+	}
+	tm.mu.Unlock()
+	if finished.ID == "" {
+		return
+	}
+
+	rec := gameRecord{
+		GameID:      finished.ID,
+		RoomID:      roomID,
+		Variant:     finished.Variant,
+		Ended:       time.Now().UTC(),
+		DurationSec: int(time.Since(finished.started).Seconds()),
+	}
+	for i, p := range tm.eventPlayers(roomID, finished.Roster) {
+		res := f.Result.Players[i]
+		rec.Turns += res.Turns
+		rec.Players = append(rec.Players, recordPlayer{ClientID: p.ClientID, Name: p.Name, playerResult: res})
+	}
+	if w := f.Result.Winner; w >= 0 {
+		rec.Winner = finished.Roster[w]
+	}
+	tm.stats.add(rec)
+}
+
+// leaderboardEntry is one player's line on the leaderboard.
+type leaderboardEntry struct {
+	Rank          int     `json:"rank"`
+	ClientID      string  `json:"clientID"`
+	Name          string  `json:"name,omitempty"`
+	Games         int     `json:"games"`
+	Wins          int     `json:"wins"`
+	WinRate       float64 `json:"winRate"`
+	AvgScore      float64 `json:"avgScore"`
+	LongestStreak int     `json:"longestStreak"`
+	BiggestTurn   int     `json:"biggestTurn"`
+
+	totalScore int
+	lastSeen   time.Time
+}
+
+type leaderboardQuery struct {
+	Variant string
+	RoomID  string
+	Limit   int
+}
+
+type leaderboard struct {
+	Variant string             `json:"variant,omitempty"`
+	RoomID  string             `json:"roomID,omitempty"`
+	Games   int                `json:"games"`
+	Players []leaderboardEntry `json:"players"`
+}
+
+// leaderboard ranks players by wins, then win rate, then games played.
+func (s *gameStats) leaderboard(q leaderboardQuery) leaderboard {
+	out := leaderboard{Variant: q.Variant, RoomID: q.RoomID, Players: []leaderboardEntry{}}
+	byPlayer := map[string]*leaderboardEntry{}
+	s.mu.Lock()
+	for _, r := range s.records {
+		if (q.Variant != "" && r.Variant != q.Variant) || (q.RoomID != "" && r.RoomID != q.RoomID) {
+			continue
+		}
+		out.Games++
+		for _, p := range r.Players {
+			e := byPlayer[p.ClientID]
+			if e == nil {
+				e = &leaderboardEntry{ClientID: p.ClientID}
+				byPlayer[p.ClientID] = e
+			}
+			if p.Name != "" && !r.Ended.Before(e.lastSeen) {
+				e.Name, e.lastSeen = p.Name, r.Ended
+			}
+			e.Games++
+			if r.Winner == p.ClientID {
+				e.Wins++
+			}
+			e.totalScore += p.Score
+			e.LongestStreak = max(e.LongestStreak, p.LongestStreak)
+			e.BiggestTurn = max(e.BiggestTurn, p.BiggestTurn)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range byPlayer {
+		e.WinRate = float64(e.Wins) / float64(e.Games)
+		e.AvgScore = float64(e.totalScore) / float64(e.Games)
+		out.Players = append(out.Players, *e)
+	}
+	sort.Slice(out.Players, func(i, j int) bool {
+		a, b := out.Players[i], out.Players[j]
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		if a.WinRate != b.WinRate {
+			return a.WinRate > b.WinRate
+		}
+		if a.Games != b.Games {
+			return a.Games > b.Games
+		}
+		return a.ClientID < b.ClientID
+	})
+	if len(out.Players) > q.Limit {
+		out.Players = out.Players[:q.Limit]
+	}
+	for i := range out.Players {
+		out.Players[i].Rank = i + 1
+	}
+	return out
+}
+
+// WinPercent is the win rate for display, e.g. "67%".
+func (e leaderboardEntry) WinPercent() string {
+	return fmt.Sprintf("%.0f%%", e.WinRate*100)
+}
+
+// parseLeaderboardQuery reads ?variant=&room=&limit=.
+func parseLeaderboardQuery(r *http.Request) (leaderboardQuery, error) {
+	v := r.URL.Query()
+	q := leaderboardQuery{RoomID: v.Get("room"), Limit: defaultLeaderboardLen}
+	switch variant := v.Get("variant"); variant {
+	case "", "pig", "bigpig":
+		q.Variant = variant
+	default:
+		return q, fmt.Errorf("unknown variant %q", variant)
+	}
+	if q.RoomID != "" && !validID(q.RoomID) {
+		return q, fmt.Errorf("bad room %q", q.RoomID)
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("bad limit %q", s)
+		}
+		q.Limit = min(n, maxLeaderboardLen)
+	}
+	return q, nil
+}
+
+// GET /api/leaderboard?variant=&room=&limit= – the leaderboard as JSON.
+func LeaderboardAPI(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseLeaderboardQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(tm.stats.leaderboard(q))
+	}
+}
+
+type leaderboardPage struct {
+	Nonce string
+	leaderboard
+}
+
+// GET /leaderboard?variant=&room= – the leaderboard page.
+func Leaderboard(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseLeaderboardQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl, err := parseTemplates(leaderboardTemplatePath...)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		data := leaderboardPage{Nonce: cspNonce(r), leaderboard: tm.stats.leaderboard(q)}
+		if err := tmpl.Execute(w, data); err != nil {
+			log.Printf("[Stats] render: %v", err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/accounts"
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+// statsGames polls until the stats hold want games, or times out.
+func statsGames(t *testing.T, tm *TopicManager, want int) leaderboard {
+	t.Helper()
+	var lb leaderboard
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if lb = tm.stats.leaderboard(leaderboardQuery{Limit: 10}); lb.Games >= want {
+			break
+		}
+	}
+	return lb
+}
+
+// joinRoomFrom is joinRoom from the loopback address ip, so the server
+// sees players on different machines.
+func joinRoomFrom(t *testing.T, serverURL, roomID, clientID, ip string) *roomclient.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	local := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	c, err := roomclient.Dial(ctx, serverURL, roomID, clientID, roomclient.WithReconnect(0, 0),
+		roomclient.WithDialer(&websocket.Dialer{NetDialContext: local.DialContext}))
+	if err != nil {
+		t.Fatalf("dial %s: %v", clientID, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGameResultNeedsTwoMatchingReports(t *testing.T) {
+	srv, tm := newTestServer(t)
+	a := joinRoomFrom(t, srv.URL, "statroom", "playeraa", "127.0.0.1")
+	waitFor[roomclient.Peers](t, a)
+	b := joinRoomFrom(t, srv.URL, "statroom", "playerbb", "127.0.0.2")
+	waitFor[roomclient.Peers](t, b)
+	// playercc is a second tab of playerbb's.
+	c := joinRoomFrom(t, srv.URL, "statroom", "playercc", "127.0.0.2")
+	waitFor[roomclient.Peers](t, c)
+	a.StartGame("stattable", "bigpig", []string{"playeraa", "playerbb", "playercc"})
+	waitFor[roomclient.GameStart](t, c)
+
+	result := roomclient.GameResult{Winner: 1, Players: []roomclient.PlayerResult{
+		{Score: 64, Turns: 9, BiggestTurn: 30, LongestStreak: 4},
+		{Score: 101, Turns: 9, BiggestTurn: 48, LongestStreak: 6},
+		{Score: 0, Turns: 8, BiggestTurn: 12, LongestStreak: 2},
+	}}
+	tampered := result
+	tampered.Winner = 2
+
+	b.ReportGameResult("stattable", result)
+	c.ReportGameResult("stattable", result)
+	a.EndGame("stattable", 1)
+	if lb := statsGames(t, tm, 1); lb.Games != 0 {
+		t.Fatalf("recorded a game confirmed from one address: %+v", lb)
+	}
+	a.ReportGameResult("stattable", tampered)
+	if lb := statsGames(t, tm, 1); lb.Games != 0 {
+		t.Fatalf("recorded a game from disagreeing reports: %+v", lb)
+	}
+
+	a.ReportGameResult("stattable", result)
+	lb := statsGames(t, tm, 1)
+	if lb.Games != 1 || len(lb.Players) != 3 {
+		t.Fatalf("expected one game of three players, got %+v", lb)
+	}
+	top := lb.Players[0]
+	if top.ClientID != "playerbb" || top.Wins != 1 || top.WinRate != 1 || top.AvgScore != 101 ||
+		top.BiggestTurn != 48 || top.LongestStreak != 6 || top.Rank != 1 {
+		t.Fatalf("unexpected leader %+v", top)
+	}
+
+	// Late reports don't count the game twice.
+	c.ReportGameResult("stattable", result)
+	time.Sleep(50 * time.Millisecond)
+	tm.stats.mu.Lock()
+	rec := tm.stats.records
+	tm.stats.mu.Unlock()
+	if len(rec) != 1 || rec[0].Variant != "bigpig" || rec[0].Turns != 26 || rec[0].Winner != "playerbb" {
+		t.Fatalf("unexpected records %+v", rec)
+	}
+}
+
+func TestResultConfirmationsMergeAccountAndAddress(t *testing.T) {
+	account := accounts.ClientIDPrefix + "ada"
+	for _, tc := range []struct {
+		name    string
+		reports map[string]resultReport
+		want    int
+	}{
+		{"two addresses", map[string]resultReport{
+			"playeraa": {result: "r", ip: "192.0.2.1"},
+			"playerbb": {result: "r", ip: "192.0.2.2"},
+		}, 2},
+		{"account and anonymous seat on one address", map[string]resultReport{
+			account:    {result: "r", account: account, ip: "192.0.2.1"},
+			"playerbb": {result: "r", ip: "192.0.2.1"},
+		}, 1},
+		{"two accounts on one address", map[string]resultReport{
+			account:                          {result: "r", account: account, ip: "192.0.2.1"},
+			accounts.ClientIDPrefix + "bert": {result: "r", account: accounts.ClientIDPrefix + "bert", ip: "192.0.2.1"},
+		}, 2},
+		{"account and anonymous elsewhere", map[string]resultReport{
+			account:    {result: "r", account: account, ip: "192.0.2.1"},
+			"playerbb": {result: "r", ip: "192.0.2.2"},
+			"playercc": {result: "x", ip: "192.0.2.3"},
+		}, 2},
+	} {
+		if got := confirmations(tc.reports, "r"); got != tc.want {
+			t.Errorf("%s: %d confirmations, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLeaderboardFiltersAndPersists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "stats", "games.jsonl")
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	if err := tm.EnableStats(StatsConfig{File: file}); err != nil {
+		t.Fatal(err)
+	}
+	game := func(roomID, variant, winner string, scores ...int) gameRecord {
+		r := gameRecord{GameID: "gameid01", RoomID: roomID, Variant: variant, Ended: time.Now(), Winner: winner}
+		for i, id := range []string{"playeraa", "playerbb"} {
+			r.Players = append(r.Players, recordPlayer{ClientID: id, Name: strings.ToUpper(id[6:]), playerResult: playerResult{Score: scores[i]}})
+		}
+		return r
+	}
+	tm.stats.add(game("roomone1", "pig", "playeraa", 100, 40))
+	tm.stats.add(game("roomone1", "pig", "playerbb", 80, 100))
+	tm.stats.add(game("roomtwo2", "bigpig", "playerbb", 20, 100))
+
+	reloaded := NewTopicManager()
+	t.Cleanup(func() { close(reloaded.shutdown) })
+	if err := reloaded.EnableStats(StatsConfig{File: file}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) (int, leaderboard) {
+		rec := httptest.NewRecorder()
+		Router(reloaded, DefaultConfig()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var lb leaderboard
+		json.Unmarshal(rec.Body.Bytes(), &lb)
+		return rec.Code, lb
+	}
+	if _, lb := get("/api/leaderboard"); lb.Games != 3 || lb.Players[0].ClientID != "playerbb" || lb.Players[0].Wins != 2 {
+		t.Fatalf("all-time: got %+v", lb)
+	}
+	// Tied on wins, rate and games, so clientID decides.
+	if _, lb := get("/api/leaderboard?variant=pig"); lb.Games != 2 || lb.Players[0].ClientID != "playeraa" ||
+		lb.Players[0].AvgScore != 90 || lb.Players[1].AvgScore != 70 {
+		t.Fatalf("pig only: got %+v", lb)
+	}
+	if _, lb := get("/api/leaderboard?room=roomtwo2&limit=1"); lb.Games != 1 || len(lb.Players) != 1 {
+		t.Fatalf("one room: got %+v", lb)
+	}
+	if code, _ := get("/api/leaderboard?variant=yahtzee"); code != http.StatusBadRequest {
+		t.Fatalf("bad variant: got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	Router(reloaded, DefaultConfig()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/leaderboard?variant=pig", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<td>BB</td>") || !strings.Contains(rec.Body.String(), "50%") {
+		t.Fatalf("leaderboard page: got %d", rec.Code)
+	}
+}
@@ -1,8 +1,9 @@
 package controllers
 
 import (
-	"html/template"
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -11,22 +12,83 @@ var videoTemplatePath = append([]string{templatePath + "video.gohtml"}, baseTemp
 
 type videoPage struct {
 	RoomID string
+	// Code is the room's word code, if it was created with one.
+	Code  string
+	Nonce string
+	// Open Graph preview: absolute page and card URLs plus the card's text.
+	PageURL       string
+	CardURL       string
+	OGTitle       string
+	OGDescription string
+	// ICEServers is the JSON RTCIceServer list video.js passes to every
+	// RTCPeerConnection.
+	ICEServers string
+	// ClientID and Username are the signed-in account's, if any; video.js
+	// then plays as that clientID instead of its stored one.
+	ClientID string
+	Username string
 }
 
-func Video(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	roomID := vars["roomID"]
+func Video(tm *TopicManager, cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["roomID"]
 
-	tmpl, err := template.ParseFS(ffs, videoTemplatePath...)
-	if err != nil {
-		internalError(err, w)
-		return
-	}
+		// A scheduled room shows its lobby until it opens.
+		now := time.Now()
+		if opens := tm.roomOpensAt(roomID, now); !opens.IsZero() {
+			s, _ := tm.roomSchedule(roomID)
+			next, _ := s.next(now)
+			renderLobby(w, r, lobbyPage{
+				Nonce:    cspNonce(r),
+				RoomID:   roomID,
+				Code:     tm.roomCode(roomID),
+				PageURL:  inviteURL(r, cfg.Security, tm.roomLink(roomID)),
+				Schedule: s,
+				Next:     next,
+				Opens:    opens,
+			})
+			return
+		}
+
+		tmpl, err := parseTemplates(videoTemplatePath...)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+
+		clientID, err := turnIdentity(tm, cfg, w, r)
+		if err != nil {
+			internalError(err, w)
+			return
+		}
+		user, signedIn := tm.currentUser(r)
+		iceServers, err := json.Marshal(cfg.ICE.iceServers(r, clientID))
+		if err != nil {
+			internalError(err, w)
+			return
+		}
 
-	data := videoPage{RoomID: roomID}
+		// The card URL carries its state key so link unfurlers, which
+		// cache by URL, fetch a fresh card when the room changes.
+		card, _ := tm.roomCardState(roomID)
+		data := videoPage{
+			RoomID:        roomID,
+			Code:          tm.roomCode(roomID),
+			Nonce:         cspNonce(r),
+			PageURL:       inviteURL(r, cfg.Security, tm.roomLink(roomID)),
+			CardURL:       inviteURL(r, cfg.Security, "/rooms/"+roomID+"/card.png?v="+card.key()),
+			OGTitle:       card.Title,
+			OGDescription: card.description(),
+			ICEServers:    string(iceServers),
+		}
+		if signedIn {
+			data.ClientID, data.Username = user.ClientID(), user.Username
+		}
 
-	if err := tmpl.Execute(w, data); err != nil {
-		internalError(err, w)
-		return
+		if err := tmpl.Execute(w, data); err != nil {
+			internalError(err, w)
+			return
+		}
 	}
 }
@@ -11,6 +11,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/asyncpig"
 )
 
 type channelWrapper struct {
@@ -26,6 +28,65 @@ type TopicManager struct {
 	// Slot assignments are append-only for the lifetime of the room: a client
 	// that disconnects and rejoins with the same clientID gets the same slot.
 	roomSlots map[string][]string
+	// roomID -> settings fixed when the room was created through POST /rooms.
+	// Rooms reached by a bare link have no entry and run as mesh rooms.
+	roomInfo map[string]*roomInfo
+	// session token -> session, for clients on the SSE + POST transport.
+	httpSessions map[string]*roomSession
+	// roomID -> clientID -> presence of connected members.
+	presence map[string]map[string]Presence
+	// roomID -> chat history; dropped with the room's settings, or after
+	// roomInfoTTL of silence for rooms without any.
+	chat map[string]*chatLog
+	// roomID -> breakout groups and assignments; pruned like chat.
+	breakouts map[string]*roomBreakouts
+	// roomID -> gameID -> dice-game table.
+	games map[string]map[string]*gameTable
+	// word code -> roomID, for rooms created with one; dropped with the
+	// room's settings.
+	roomCodes map[string]string
+	// rendered invite cards, one per room; dropped with the room.
+	cards *cardCache
+	// eventHooks receive lifecycle events (see lifecycle.go).
+	eventHooks []func(LifecycleEvent)
+	// webhooks delivers lifecycle events to subscribers; nil until
+	// EnableWebhooks.
+	webhooks *webhookDispatcher
+	// audit records room activity; nil until EnableAudit.
+	audit *auditLog
+	// roomID -> clientID -> open session, so admins can disconnect one.
+	sessions map[string]map[string]*roomSession
+	// clientID -> ban; banned clients cannot join any room.
+	bans map[string]clientBan
+	// roomID -> when an admin closed it; closed rooms cannot be joined
+	// until roomInfoTTL has passed.
+	closedRooms map[string]time.Time
+	// stats records finished dice games for the leaderboard.
+	stats *gameStats
+	// accounts signs users in; nil until EnableAccounts.
+	accounts *userAccounts
+	// asyncGames keeps play-by-turn Pig games; in memory until
+	// EnableAsyncGames.
+	asyncGames asyncpig.Store
+	// roomID:clientID -> recent reconnects (see health.go); pruned a
+	// reconnectWindow after the client leaves.
+	reconnects map[string]*clientReconnects
+	// reconnectsTotal counts reconnects since the process started.
+	reconnectsTotal uint64
+	// roomID -> the last room_health sent, so unchanged ones are skipped.
+	healthSent map[string]string
+	// IP -> recent failed room-code lookups (see roomcodes.go).
+	codeMisses map[string]*codeMisses
+	// quickplayRooms counts rooms quick play created since
+	// quickplayWindow began (see directory.go).
+	quickplayRooms  int
+	quickplayWindow time.Time
+	// admin dashboard session nonce -> expiry (see admin.go).
+	adminSessions map[string]time.Time
+
+	// sfu forwards media for SFU-mode rooms; nil until EnableSFU.
+	sfu                *sfuManager
+	sfuMaxParticipants int
 
 	control  chan topicOperation
 	shutdown chan struct{}
@@ -45,6 +106,8 @@ const (
 	controlChannelBuffer = 200
 	writeTimeout         = 5 * time.Second
 	maxRoomParticipants  = 10
+	// roomInfoTTL is how long settings are kept for a room nobody is in.
+	roomInfoTTL = 24 * time.Hour
 )
 
 var upgrader = websocket.Upgrader{
@@ -53,17 +116,50 @@ var upgrader = websocket.Upgrader{
 
 func NewTopicManager() *TopicManager {
 	tm := &TopicManager{
-		topics:    make(map[string][]*channelWrapper),
-		rooms:     make(map[string]map[string]struct{}),
-		roomSlots: make(map[string][]string),
-		control:   make(chan topicOperation, controlChannelBuffer),
-		shutdown:  make(chan struct{}),
+		topics:        make(map[string][]*channelWrapper),
+		rooms:         make(map[string]map[string]struct{}),
+		roomSlots:     make(map[string][]string),
+		roomInfo:      make(map[string]*roomInfo),
+		httpSessions:  make(map[string]*roomSession),
+		presence:      make(map[string]map[string]Presence),
+		chat:          make(map[string]*chatLog),
+		breakouts:     make(map[string]*roomBreakouts),
+		games:         make(map[string]map[string]*gameTable),
+		roomCodes:     make(map[string]string),
+		cards:         &cardCache{cards: make(map[string]renderedCard)},
+		sessions:      make(map[string]map[string]*roomSession),
+		bans:          make(map[string]clientBan),
+		closedRooms:   make(map[string]time.Time),
+		stats:         &gameStats{},
+		asyncGames:    asyncpig.NewMemoryStore(),
+		reconnects:    make(map[string]*clientReconnects),
+		healthSent:    make(map[string]string),
+		codeMisses:    make(map[string]*codeMisses),
+		adminSessions: make(map[string]time.Time),
+		control:       make(chan topicOperation, controlChannelBuffer),
+		shutdown:      make(chan struct{}),
 	}
 
 	go tm.run()
+	go tm.sweepAsyncGames()
+	go tm.reportHealth()
 	return tm
 }
 
+// EnableSFU turns on the server-side media path, letting rooms be created
+// in SFU mode.
+func (tm *TopicManager) EnableSFU(cfg SFUConfig) error {
+	sfu, err := newSFUManager(tm, cfg)
+	if err != nil {
+		return err
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.sfu = sfu
+	tm.sfuMaxParticipants = cfg.MaxParticipants
+	return nil
+}
+
 func (tm *TopicManager) run() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
@@ -134,6 +230,13 @@ func (tm *TopicManager) handlePublish(op topicOperation) {
 }
 
 func (tm *TopicManager) cleanupTopics() {
+	expired := map[string]map[string]interface{}{}
+	defer func() {
+		// Announced once the lock below is released.
+		for roomID, data := range expired {
+			tm.emit(EventRoomExpired, roomID, data)
+		}
+	}()
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -143,6 +246,97 @@ func (tm *TopicManager) cleanupTopics() {
 		}
 	}
 	// rooms map is kept small by VideoConnections removing members on disconnect
+	for roomID, info := range tm.roomInfo {
+		if _, active := tm.rooms[roomID]; !active && time.Since(info.idleSince()) > roomInfoTTL {
+			delete(tm.roomInfo, roomID)
+			expired[roomID] = roomEventData(*info)
+			if info.Code != "" {
+				delete(tm.roomCodes, info.Code)
+			}
+		}
+	}
+	for roomID, l := range tm.chat {
+		_, active := tm.rooms[roomID]
+		_, registered := tm.roomInfo[roomID]
+		if !active && !registered && time.Since(l.updated) > roomInfoTTL {
+			delete(tm.chat, roomID)
+		}
+	}
+	for roomID, closed := range tm.closedRooms {
+		if time.Since(closed) > roomInfoTTL {
+			delete(tm.closedRooms, roomID)
+		}
+	}
+	for _, roomID := range tm.cards.roomIDs() {
+		_, active := tm.rooms[roomID]
+		_, registered := tm.roomInfo[roomID]
+		if !active && !registered {
+			tm.cards.forget(roomID)
+		}
+	}
+	for roomID, rb := range tm.breakouts {
+		_, active := tm.rooms[roomID]
+		_, registered := tm.roomInfo[roomID]
+		if !active && !registered && time.Since(rb.updated) > roomInfoTTL {
+			delete(tm.breakouts, roomID)
+		}
+	}
+	tm.pruneReconnectsLocked(time.Now())
+	tm.pruneCodeMissesLocked(time.Now())
+}
+
+// sendTo queues a frame for one client in a room.
+func (tm *TopicManager) sendTo(roomID, clientID string, message []byte) {
+	tm.control <- topicOperation{
+		opType:  "pub",
+		topic:   roomID + ":" + clientID,
+		message: message,
+	}
+}
+
+// roomInfo holds the settings a room was created with.
+type roomInfo struct {
+	Type    string // "video" or "dice"
+	Mode    string // roomModeMesh or roomModeSFU
+	Variant string // dice rooms: the variant tables default to
+	Public  bool   // listed in the room directory
+	Code    string // word code resolving to the room, if any
+	Created time.Time
+	// Schedule is set for rooms created ahead of time (see schedule.go).
+	Schedule *roomSchedule
+
+	// holds are quick-play seat reservations, holder -> expiry.
+	holds map[quickplayHolder]time.Time
+}
+
+func (tm *TopicManager) registerRoom(roomID string, info roomInfo) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.roomInfo[roomID] = &info
+}
+
+// sfuEnabled reports whether SFU rooms can be created.
+func (tm *TopicManager) sfuEnabled() bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.sfu != nil
+}
+
+// sfuFor returns the SFU if roomID is an SFU room, else nil.
+func (tm *TopicManager) sfuFor(roomID string) *sfuManager {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if info, ok := tm.roomInfo[roomID]; ok && info.Mode == roomModeSFU {
+		return tm.sfu
+	}
+	return nil
+}
+
+func (tm *TopicManager) capacityLocked(roomID string) int {
+	if info, ok := tm.roomInfo[roomID]; ok && info.Mode == roomModeSFU && tm.sfu != nil {
+		return tm.sfuMaxParticipants
+	}
+	return maxRoomParticipants
 }
 
 // helpers for room membership
@@ -162,7 +356,7 @@ func (tm *TopicManager) addRoomMember(roomID, userID string) (ok bool, count int
 		members = make(map[string]struct{})
 		tm.rooms[roomID] = members
 	}
-	if len(members) >= maxRoomParticipants {
+	if len(members) >= tm.capacityLocked(roomID) {
 		return false, len(members)
 	}
 	members[userID] = struct{}{}
@@ -210,6 +404,32 @@ func (tm *TopicManager) assignSlot(roomID, clientID string) (slot int, slots map
 	return slot, slots
 }
 
+// slotOf returns clientID's slot in the room, or -1.
+func (tm *TopicManager) slotOf(roomID, clientID string) int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for i, id := range tm.roomSlots[roomID] {
+		if id == clientID {
+			return i
+		}
+	}
+	return -1
+}
+
+// roomHost returns the connected member holding the lowest slot, or "" if
+// the room is empty.
+func (tm *TopicManager) roomHost(roomID string) string {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	members := tm.rooms[roomID]
+	for _, id := range tm.roomSlots[roomID] {
+		if _, ok := members[id]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
 // getRoomMembers returns all member IDs in a room excluding the given userID.
 func (tm *TopicManager) getRoomMembers(roomID, excludeID string) []string {
 	tm.mu.Lock()
@@ -229,21 +449,33 @@ func (tm *TopicManager) getRoomMembers(roomID, excludeID string) []string {
 // which peers are already in the room (so they can initiate WebRTC offers)
 // and the room's slot assignments (so the dice game can use authoritative
 // player numbers instead of racing on a sorted client-ID list).
+//
+// In SFU rooms Mode is "sfu" and SFUPeer names the virtual peer the client
+// should exchange media with instead of building a mesh. CanRecord and
+// Recording say whether the room can be recorded and whether it is now.
+// Presence covers every connected member, including the recipient.
 type peersMessage struct {
-	Type   string         `json:"type"`
-	RoomID string         `json:"roomID"`
-	Peers  []string       `json:"peers"`
-	Slots  map[string]int `json:"slots"`
-	MySlot int            `json:"mySlot"`
+	Type      string         `json:"type"`
+	RoomID    string         `json:"roomID"`
+	Peers     []string       `json:"peers"`
+	Slots     map[string]int `json:"slots"`
+	MySlot    int            `json:"mySlot"`
+	Mode      string         `json:"mode"`
+	SFUPeer   string         `json:"sfuPeer,omitempty"`
+	CanRecord bool           `json:"canRecord,omitempty"`
+	Recording bool           `json:"recording,omitempty"`
+
+	Presence map[string]Presence `json:"presence"`
 }
 
 // playerJoinedMessage is broadcast to existing room members when a new client
 // connects, carrying the new client's server-assigned slot.
 type playerJoinedMessage struct {
-	Type   string `json:"type"`
-	RoomID string `json:"roomID"`
-	PeerID string `json:"peerID"`
-	Slot   int    `json:"slot"`
+	Type     string   `json:"type"`
+	RoomID   string   `json:"roomID"`
+	PeerID   string   `json:"peerID"`
+	Slot     int      `json:"slot"`
+	Presence Presence `json:"presence"`
 }
 
 // playerLeftMessage is broadcast to remaining room members when a client
@@ -278,36 +510,19 @@ func VideoConnections(tm *TopicManager) http.HandlerFunc {
 			http.Error(w, "invalid id", http.StatusBadRequest)
 			return
 		}
+		if !tm.clientIDAllowed(r, userID) {
+			http.Error(w, "sign in to use this clientID", http.StatusForbidden)
+			return
+		}
 
-		if ok, count := tm.addRoomMember(roomID, userID); !ok {
-			log.Printf("[Connection] room %s full (%d users)", roomID, count)
-			http.Error(w, "room full", http.StatusConflict)
+		session, err := tm.openSession(roomID, userID, transportWebSocket)
+		if err != nil {
+			http.Error(w, err.Error(), sessionErrorStatus(err))
 			return
 		}
-		defer func() {
-			tm.removeRoomMember(roomID, userID)
-			// Notify remaining peers so they can tear down stale WebRTC
-			// connections and dice-game state without waiting for an ICE timeout.
-			remaining := tm.getRoomMembers(roomID, userID)
-			if len(remaining) == 0 {
-				return
-			}
-			data, err := json.Marshal(playerLeftMessage{
-				Type:   "player_left",
-				RoomID: roomID,
-				PeerID: userID,
-			})
-			if err != nil {
-				return
-			}
-			for _, memberID := range remaining {
-				tm.control <- topicOperation{
-					opType:  "pub",
-					topic:   roomID + ":" + memberID,
-					message: data,
-				}
-			}
-		}()
+		defer session.close()
+		session.presence = parsePresence([]byte(r.URL.Query().Get("presence")))
+		session.ip = clientIP(r)
 
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
@@ -315,61 +530,32 @@ func VideoConnections(tm *TopicManager) http.HandlerFunc {
 			return
 		}
 
-		log.Printf("[Connection] %s joined room %s", userID, roomID)
-
 		ctx, cancel := context.WithTimeout(r.Context(), keepAliveInterval)
 		defer func() {
 			conn.Close()
 			cancel()
 		}()
 
-		msgChan := make(chan []byte, messageBufferSize)
-		topicSelf := roomID + ":" + userID
-
-		tm.control <- topicOperation{opType: "sub", topic: topicSelf, ch: msgChan}
-		defer func() {
-			tm.control <- topicOperation{opType: "unsub", topic: topicSelf, ch: msgChan}
-		}()
-
-		// Assign (or restore) this client's player slot and snapshot the room's slot map.
-		mySlot, slots := tm.assignSlot(roomID, userID)
-		log.Printf("[Connection] %s in room %s assigned slot %d", userID, roomID, mySlot)
-
-		// Tell the new user about peers already in the room (for WebRTC offers)
-		// and the full slot map (for dice-game player ordering).
-		existing := tm.getRoomMembers(roomID, userID)
-		if data, err := json.Marshal(peersMessage{
-			Type:   "peers",
-			RoomID: roomID,
-			Peers:  existing,
-			Slots:  slots,
-			MySlot: mySlot,
-		}); err == nil {
-			msgChan <- data
-		}
-
-		// Tell existing peers that this client joined and what slot they got.
-		if joined, err := json.Marshal(playerJoinedMessage{
-			Type:   "player_joined",
-			RoomID: roomID,
-			PeerID: userID,
-			Slot:   mySlot,
-		}); err == nil {
-			for _, memberID := range existing {
-				tm.control <- topicOperation{
-					opType:  "pub",
-					topic:   roomID + ":" + memberID,
-					message: joined,
-				}
+		// Pongs echo the probe IDs of the write pump's pings.
+		conn.SetPongHandler(func(data string) error {
+			if id, ok := parsePingPayload([]byte(data)); ok {
+				session.link.answered(id, time.Now())
 			}
-		}
+			return nil
+		})
+		session.start()
 
 		// Write pump
 		go func() {
 			defer cancel()
+			probe := time.NewTicker(healthInterval)
+			defer probe.Stop()
 			for {
 				select {
-				case msg := <-msgChan:
+				case msg, ok := <-session.out:
+					if !ok {
+						return
+					}
 					conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 					if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
 						if !websocket.IsUnexpectedCloseError(err) {
@@ -377,6 +563,19 @@ func VideoConnections(tm *TopicManager) http.HandlerFunc {
 						}
 						return
 					}
+				case <-session.ended:
+					// Removed by the server: say why, then hang up, which
+					// also ends the read pump.
+					conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+					conn.WriteMessage(websocket.TextMessage, session.removedFrame())
+					conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, session.endReason))
+					conn.Close()
+					return
+				case now := <-probe.C:
+					if err := conn.WriteControl(websocket.PingMessage, pingPayload(session.link.probe(now)), now.Add(writeTimeout)); err != nil {
+						return
+					}
 				case <-ctx.Done():
 					return
 				}
@@ -396,39 +595,7 @@ func VideoConnections(tm *TopicManager) http.HandlerFunc {
 					}
 					return
 				}
-
-				var sig signalMessage
-				if err := json.Unmarshal(message, &sig); err != nil {
-					log.Printf("[Read] invalid JSON: %v", err)
-					continue
-				}
-
-				// Basic validation: enforce room + sender ID.
-				// sig.To may be a specific userID or "room" (broadcast to all members).
-				if sig.RoomID != roomID || !validID(sig.From) {
-					continue
-				}
-				if sig.To != "room" && !validID(sig.To) {
-					continue
-				}
-
-				if sig.To == "room" {
-					// Broadcast to every other member of this room.
-					for _, memberID := range tm.getRoomMembers(roomID, sig.From) {
-						tm.control <- topicOperation{
-							opType:  "pub",
-							topic:   roomID + ":" + memberID,
-							message: message,
-						}
-					}
-				} else {
-					// Forward to a specific peer.
-					tm.control <- topicOperation{
-						opType:  "pub",
-						topic:   roomID + ":" + sig.To,
-						message: message,
-					}
-				}
+				session.handleFrame(message)
 			}
 		}
 	}
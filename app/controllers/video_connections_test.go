@@ -1,8 +1,9 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
-	"net/http"
+	"fmt"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
 )
 
 // ─── TopicManager unit tests ──────────────────────────────────────────────────
@@ -194,79 +196,217 @@ func newTestServer(t *testing.T) (*httptest.Server, *TopicManager) {
 	return srv, tm
 }
 
-func TestFirstUserReceivesNoPeersMessage(t *testing.T) {
-	srv, _ := newTestServer(t)
+// joinRoom connects a roomclient with reconnecting disabled.
+func joinRoom(t *testing.T, serverURL, roomID, clientID string) *roomclient.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := roomclient.Dial(ctx, serverURL, roomID, clientID, roomclient.WithReconnect(0, 0))
+	if err != nil {
+		t.Fatalf("dial %s: %v", clientID, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// nextEvent returns c's next event, skipping any types listed in skip.
+func nextEvent(t *testing.T, c *roomclient.Client, skip ...string) roomclient.Event {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				t.Fatalf("%s: event stream closed", c.ID())
+			}
+			if skipped(ev, skip) {
+				continue
+			}
+			return ev
+		case <-deadline:
+			t.Fatalf("%s: timed out waiting for an event", c.ID())
+		}
+	}
+}
 
-	conn := dialWS(t, srv.URL, "roomAAA1", "useraaa1")
-	defer conn.Close()
+func skipped(ev roomclient.Event, skip []string) bool {
+	name := fmt.Sprintf("%T", ev)
+	for _, s := range skip {
+		if name == "roomclient."+s {
+			return true
+		}
+	}
+	return false
+}
 
-	// The first user in a room should not receive any message immediately.
-	conn.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
-	_, _, err := conn.ReadMessage()
-	if err == nil {
-		t.Fatal("first user should not receive a message on join")
+func TestFirstUserReceivesEmptyPeers(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	a := joinRoom(t, srv.URL, "roomAAA1", "useraaa1")
+	peers, ok := nextEvent(t, a).(roomclient.Peers)
+	if !ok {
+		t.Fatal("expected a peers event first")
+	}
+	if len(peers.Peers) != 0 || peers.MySlot != 0 || peers.Mode != roomModeMesh {
+		t.Fatalf("unexpected peers for the first user: %+v", peers)
+	}
+	if a.MySlot() != 0 {
+		t.Fatalf("client tracked slot %d, want 0", a.MySlot())
 	}
 }
 
 func TestSecondUserReceivesPeersMessage(t *testing.T) {
 	srv, _ := newTestServer(t)
 
-	connA := dialWS(t, srv.URL, "roomBBB2", "userbbb2")
-	defer connA.Close()
+	a := joinRoom(t, srv.URL, "roomBBB2", "userbbb2")
+	nextEvent(t, a)
+	b := joinRoom(t, srv.URL, "roomBBB2", "userbbb3")
+
+	peers, ok := nextEvent(t, b).(roomclient.Peers)
+	if !ok {
+		t.Fatal("expected a peers event")
+	}
+	if len(peers.Peers) != 1 || peers.Peers[0] != "userbbb2" {
+		t.Fatalf("expected peer userbbb2, got %v", peers.Peers)
+	}
+	if peers.MySlot != 1 || peers.Slots["userbbb2"] != 0 {
+		t.Fatalf("unexpected slots %v (mine %d)", peers.Slots, peers.MySlot)
+	}
 
-	// Give the server time to register user A before B joins.
-	time.Sleep(20 * time.Millisecond)
+	joined, ok := nextEvent(t, a).(roomclient.PlayerJoined)
+	if !ok || joined.PeerID != "userbbb3" || joined.Slot != 1 {
+		t.Fatalf("expected player_joined for userbbb3 in slot 1, got %#v", joined)
+	}
+	if got := a.Slots()["userbbb3"]; got != 1 {
+		t.Fatalf("A tracked slot %d for B, want 1", got)
+	}
+}
 
-	connB := dialWS(t, srv.URL, "roomBBB2", "userbbb3")
-	defer connB.Close()
+func TestSignalingForwardsBetweenPeers(t *testing.T) {
+	srv, _ := newTestServer(t)
 
-	msg := readJSON(t, connB, 500*time.Millisecond)
+	a := joinRoom(t, srv.URL, "roomCCC3", "userccc3")
+	nextEvent(t, a)
+	b := joinRoom(t, srv.URL, "roomCCC3", "userccc4")
+	nextEvent(t, b)
 
-	if msg["type"] != "peers" {
-		t.Fatalf("expected type=peers, got %v", msg["type"])
+	const sdp = "v=0\r\no=fake 0 0 IN IP4 127.0.0.1\r\n"
+	if err := b.SendOffer("userccc3", sdp); err != nil {
+		t.Fatalf("B send: %v", err)
+	}
+	offer, ok := nextEvent(t, a, "PlayerJoined").(roomclient.Signal)
+	if !ok || offer.Type != "offer" || offer.From != "userccc4" || offer.SDP != sdp {
+		t.Fatalf("unexpected offer %#v", offer)
 	}
-	peers, ok := msg["peers"].([]interface{})
-	if !ok || len(peers) != 1 {
-		t.Fatalf("expected 1 peer, got %v", msg["peers"])
+
+	if err := a.SendCandidate("userccc4", map[string]string{"candidate": "c0"}); err != nil {
+		t.Fatalf("A send: %v", err)
 	}
-	if peers[0].(string) != "userbbb2" {
-		t.Fatalf("expected peer userbbb2, got %v", peers[0])
+	cand, ok := nextEvent(t, b).(roomclient.Signal)
+	if !ok || cand.Type != "candidate" || string(cand.ICE) != `{"candidate":"c0"}` {
+		t.Fatalf("unexpected candidate %#v", cand)
 	}
 }
 
-func TestSignalingForwardsBetweenPeers(t *testing.T) {
+func TestGameMessagesBroadcastToRoom(t *testing.T) {
 	srv, _ := newTestServer(t)
+	const roomID = "roomGGG1"
 
-	connA := dialWS(t, srv.URL, "roomCCC3", "userccc3")
-	defer connA.Close()
-	time.Sleep(20 * time.Millisecond)
+	host := joinRoom(t, srv.URL, roomID, "hostggg1")
+	nextEvent(t, host)
+	guests := []*roomclient.Client{
+		joinRoom(t, srv.URL, roomID, "guestgg1"),
+		joinRoom(t, srv.URL, roomID, "guestgg2"),
+	}
+	for _, g := range guests {
+		nextEvent(t, g)
+	}
 
-	connB := dialWS(t, srv.URL, "roomCCC3", "userccc4")
-	defer connB.Close()
+	host.StartGame("gameggg1", "bigpig", []string{"hostggg1", "guestgg1", "guestgg2"})
+	host.SendGameEvent("gameggg1", map[string]string{"action": "roll"})
+	host.SendKick("gameggg1", 2)
+	for _, g := range guests {
+		start, ok := nextEvent(t, g, "PlayerJoined").(roomclient.GameStart)
+		if !ok || start.From != "hostggg1" || start.GameID != "gameggg1" || start.Variant != "bigpig" || len(start.Roster) != 3 {
+			t.Fatalf("%s: unexpected game_start %#v", g.ID(), start)
+		}
+		ev, ok := nextEvent(t, g, "Games").(roomclient.GameEvent)
+		if !ok || string(ev.Event) != `{"action":"roll"}` {
+			t.Fatalf("%s: unexpected game_event %#v", g.ID(), ev)
+		}
+		kick, ok := nextEvent(t, g, "Games").(roomclient.Kick)
+		if !ok || kick.Slot != 2 || kick.GameID != "gameggg1" {
+			t.Fatalf("%s: unexpected kick %#v", g.ID(), kick)
+		}
+	}
+	// Relayed game frames are not echoed to the sender; only the server's
+	// game_start and table list are.
+	deadline := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case ev := <-host.Events():
+			if !skipped(ev, []string{"PlayerJoined", "GameStart", "Games"}) {
+				t.Fatalf("host received its own broadcast: %#v", ev)
+			}
+			continue
+		case <-deadline:
+		}
+		break
+	}
+}
 
-	// Drain the "peers" message B receives.
-	_ = readJSON(t, connB, 500*time.Millisecond)
+func TestRejoinRestoresSlot(t *testing.T) {
+	srv, _ := newTestServer(t)
+	const roomID = "roomDDD4"
+
+	a := joinRoom(t, srv.URL, roomID, "userddd1")
+	nextEvent(t, a)
+	b := joinRoom(t, srv.URL, roomID, "userddd2")
+	nextEvent(t, b)
+	nextEvent(t, a) // player_joined
+
+	b.Close()
+	left, ok := nextEvent(t, a).(roomclient.PlayerLeft)
+	if !ok || left.PeerID != "userddd2" {
+		t.Fatalf("expected player_left for userddd2, got %#v", left)
+	}
+	if len(a.Peers()) != 0 {
+		t.Fatalf("A still tracks peers %v", a.Peers())
+	}
 
-	// B sends an offer to A.
-	offer := map[string]interface{}{
-		"type":   "offer",
-		"from":   "userccc4",
-		"to":     "userccc3",
-		"roomID": "roomCCC3",
-		"sdp":    "v=0\r\no=fake 0 0 IN IP4 127.0.0.1\r\n",
+	joinRoom(t, srv.URL, roomID, "userddd3")
+	b = joinRoom(t, srv.URL, roomID, "userddd2")
+	peers, ok := nextEvent(t, b).(roomclient.Peers)
+	if !ok || peers.MySlot != 1 {
+		t.Fatalf("rejoin should restore slot 1, got %#v", peers)
 	}
-	raw, _ := json.Marshal(offer)
-	if err := connB.WriteMessage(websocket.TextMessage, raw); err != nil {
-		t.Fatalf("B write: %v", err)
+	if peers.Slots["userddd3"] != 2 {
+		t.Fatalf("newcomer should have slot 2, got %v", peers.Slots)
 	}
+}
 
-	// A should receive the offer.
-	msg := readJSON(t, connA, 500*time.Millisecond)
-	if msg["type"] != "offer" {
-		t.Fatalf("expected offer, got %v", msg["type"])
+func TestSupersededSessionLeavesReplacementAlone(t *testing.T) {
+	srv, tm := newTestServer(t)
+	const roomID = "roomEEE5"
+
+	a := joinRoom(t, srv.URL, roomID, "usereee1")
+	waitFor[roomclient.Peers](t, a)
+	old := joinRoom(t, srv.URL, roomID, "usereee2")
+	waitFor[roomclient.Peers](t, old)
+	waitFor[roomclient.PlayerJoined](t, a)
+	// The client reconnects before its old connection has gone.
+	b := joinRoom(t, srv.URL, roomID, "usereee2")
+	waitFor[roomclient.Peers](t, b)
+	waitFor[roomclient.PlayerJoined](t, a)
+
+	old.Close()
+	expectNone[roomclient.PlayerLeft](t, a)
+	if n := tm.memberCount(roomID); n != 2 {
+		t.Fatalf("replacement lost its membership: %d members", n)
 	}
-	if msg["from"] != "userccc4" {
-		t.Fatalf("expected from=userccc4, got %v", msg["from"])
+	b.Close()
+	if left := waitFor[roomclient.PlayerLeft](t, a); left.PeerID != "usereee2" {
+		t.Fatalf("expected player_left for usereee2, got %#v", left)
 	}
 }
 
@@ -274,10 +414,8 @@ func TestInvalidIDsRejected(t *testing.T) {
 	srv, _ := newTestServer(t)
 
 	// Too short userID
-	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/rooms/validroom1/ws?userID=ab"
-	_, resp, _ := websocket.DefaultDialer.Dial(url, nil)
-	if resp == nil || resp.StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected 400 for short userID, got %v", resp)
+	if _, err := roomclient.Dial(context.Background(), srv.URL, "validroom1", "ab"); err != roomclient.ErrInvalidID {
+		t.Fatalf("expected ErrInvalidID for short userID, got %v", err)
 	}
 }
 
@@ -285,24 +423,12 @@ func TestRoomFullRejected(t *testing.T) {
 	srv, _ := newTestServer(t)
 	roomID := "fullroomX1"
 
-	conns := make([]*websocket.Conn, maxRoomParticipants)
 	for i := 0; i < maxRoomParticipants; i++ {
-		userID := strings.Repeat(string(rune('a'+i)), 8)
-		conns[i] = dialWS(t, srv.URL, roomID, userID)
-		time.Sleep(5 * time.Millisecond)
-	}
-	defer func() {
-		for _, c := range conns {
-			if c != nil {
-				c.Close()
-			}
-		}
-	}()
+		joinRoom(t, srv.URL, roomID, strings.Repeat(string(rune('a'+i)), 8))
+	}
 
 	// One more should be rejected.
-	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/rooms/" + roomID + "/ws?userID=overflowXX"
-	_, resp, _ := websocket.DefaultDialer.Dial(url, nil)
-	if resp == nil || resp.StatusCode != http.StatusConflict {
-		t.Fatalf("expected 409 for full room, got %v", resp)
+	if _, err := roomclient.Dial(context.Background(), srv.URL, roomID, "overflowXX"); err != roomclient.ErrRoomFull {
+		t.Fatalf("expected ErrRoomFull, got %v", err)
 	}
 }
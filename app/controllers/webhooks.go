@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Webhooks POST lifecycle events (see lifecycle.go) to subscribers' URLs.
+// Each body is the event as JSON, signed with the subscription's secret:
+//
+//	X-Webhook-Signature: sha256=<hex HMAC-SHA256 of the body>
+//
+// along with X-Webhook-Event (the event type) and X-Webhook-Delivery (an
+// ID that stays the same across retries). Deliveries wait in a bounded
+// queue, so a slow receiver can never hold up a room; when the queue is
+// full new deliveries are dropped. Failed deliveries are retried with
+// exponential backoff, and the outcome of recent deliveries is kept for
+// admins at /admin/webhooks.
+
+// WebhookSubscription is one receiver of lifecycle events.
+type WebhookSubscription struct {
+	URL string `json:"url"`
+	// Secret signs deliveries; empty sends them unsigned.
+	Secret string `json:"secret"`
+	// Events filters by event type; empty receives every event.
+	Events []string `json:"events"`
+}
+
+func (s WebhookSubscription) wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookConfig configures outbound webhooks.
+type WebhookConfig struct {
+	Subscriptions []WebhookSubscription
+	// QueueSize bounds deliveries waiting to be sent.
+	QueueSize int
+	// MaxAttempts is how often a delivery is tried before it fails.
+	MaxAttempts int
+	// RetryBase is the wait before the first retry; it doubles each time,
+	// up to maxWebhookBackoff.
+	RetryBase time.Duration
+	// Timeout bounds one attempt.
+	Timeout time.Duration
+}
+
+// DefaultWebhookConfig has no subscriptions.
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		QueueSize:   1000,
+		MaxAttempts: 6,
+		RetryBase:   2 * time.Second,
+		Timeout:     10 * time.Second,
+	}
+}
+
+const (
+	webhookWorkers    = 2
+	maxWebhookBackoff = 10 * time.Minute
+	// webhookLogSize is how many recent deliveries admins can see.
+	webhookLogSize = 200
+
+	deliveryPending   = "pending"
+	deliveryRetrying  = "retrying"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+	deliveryDropped   = "dropped"
+)
+
+// webhookDelivery is one event on its way to one subscription. Its log
+// entry is updated in place as attempts are made.
+type webhookDelivery struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"eventID"`
+	Event      string    `json:"event"`
+	RoomID     string    `json:"roomID"`
+	URL        string    `json:"url"`
+	Status     string    `json:"status"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+
+	sub  WebhookSubscription
+	body []byte
+}
+
+type webhookDispatcher struct {
+	cfg    WebhookConfig
+	client *http.Client
+	queue  chan *webhookDelivery
+	done   chan struct{}
+
+	mu  sync.Mutex
+	log []*webhookDelivery // oldest first, at most webhookLogSize
+}
+
+// EnableWebhooks starts delivering lifecycle events to cfg's subscribers.
+func (tm *TopicManager) EnableWebhooks(cfg WebhookConfig) {
+	d := &webhookDispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan *webhookDelivery, cfg.QueueSize),
+		done:   tm.shutdown,
+	}
+	for i := 0; i < webhookWorkers; i++ {
+		go d.work()
+	}
+	tm.mu.Lock()
+	tm.webhooks = d
+	tm.mu.Unlock()
+	tm.OnEvent(d.publish)
+}
+
+// publish queues ev for every subscription that wants it.
+func (d *webhookDispatcher) publish(ev LifecycleEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("[Webhooks] encode %s: %v", ev.Type, err)
+		return
+	}
+	for _, sub := range d.cfg.Subscriptions {
+		if !sub.wants(ev.Type) {
+			continue
+		}
+		id, err := generateRoomID(16)
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		dl := &webhookDelivery{
+			ID:      id,
+			EventID: ev.ID,
+			Event:   ev.Type,
+			RoomID:  ev.RoomID,
+			URL:     sub.URL,
+			Status:  deliveryPending,
+			Created: now,
+			Updated: now,
+			sub:     sub,
+			body:    body,
+		}
+		d.record(dl)
+		d.enqueue(dl)
+	}
+}
+
+// enqueue hands a delivery to the workers, dropping it if the queue is full.
+func (d *webhookDispatcher) enqueue(dl *webhookDelivery) {
+	select {
+	case d.queue <- dl:
+	default:
+		log.Printf("[Webhooks] queue full, dropping %s to %s", dl.Event, dl.URL)
+		d.update(dl, func() { dl.Status = deliveryDropped })
+	}
+}
+
+func (d *webhookDispatcher) work() {
+	for {
+		select {
+		case dl := <-d.queue:
+			d.attempt(dl)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// attempt makes one try at a delivery and schedules a retry if it failed
+// in a way that might not fail again.
+func (d *webhookDispatcher) attempt(dl *webhookDelivery) {
+	code, err := d.send(dl)
+	delivered := err == nil && code >= 200 && code < 300
+	// Client errors other than timeouts and rate limits won't improve.
+	permanent := err == nil && code >= 400 && code < 500 &&
+		code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+
+	var retryIn time.Duration
+	d.update(dl, func() {
+		dl.Attempts++
+		dl.StatusCode = code
+		dl.Error = ""
+		if err != nil {
+			dl.Error = err.Error()
+		}
+		switch {
+		case delivered:
+			dl.Status = deliveryDelivered
+		case permanent || dl.Attempts >= d.cfg.MaxAttempts:
+			dl.Status = deliveryFailed
+		default:
+			dl.Status = deliveryRetrying
+			retryIn = d.backoff(dl.Attempts)
+		}
+	})
+	if retryIn == 0 {
+		if !delivered {
+			log.Printf("[Webhooks] %s to %s failed: status %d, %v", dl.Event, dl.URL, code, err)
+		}
+		return
+	}
+	time.AfterFunc(retryIn, func() {
+		select {
+		case <-d.done:
+			// Pending retries are abandoned on shutdown.
+		default:
+			d.enqueue(dl)
+		}
+	})
+}
+
+// backoff is the wait after the given number of failed attempts.
+func (d *webhookDispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.RetryBase
+	for i := 1; i < attempts && wait < maxWebhookBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxWebhookBackoff {
+		wait = maxWebhookBackoff
+	}
+	return wait
+}
+
+// send POSTs the delivery once and returns the response status.
+func (d *webhookDispatcher) send(dl *webhookDelivery) (int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-d.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "josephhammerman.com-webhooks")
+	req.Header.Set("X-Webhook-Event", dl.Event)
+	req.Header.Set("X-Webhook-Delivery", dl.ID)
+	if dl.sub.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", signWebhook(dl.sub.Secret, dl.body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// signWebhook is the X-Webhook-Signature value for body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// record adds a delivery to the log, forgetting the oldest past
+// webhookLogSize.
+func (d *webhookDispatcher) record(dl *webhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, dl)
+	if len(d.log) > webhookLogSize {
+		d.log = append([]*webhookDelivery{}, d.log[len(d.log)-webhookLogSize:]...)
+	}
+}
+
+// update changes a delivery's log entry under the lock.
+func (d *webhookDispatcher) update(dl *webhookDelivery, fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn()
+	dl.Updated = time.Now()
+}
+
+// deliveries returns copies of the logged deliveries, newest first.
+func (d *webhookDispatcher) deliveries() []webhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]webhookDelivery, 0, len(d.log))
+	for i := len(d.log) - 1; i >= 0; i-- {
+		out = append(out, *d.log[i])
+	}
+	return out
+}
+
+// webhookLogResponse is the body of GET /admin/webhooks. Secrets are left
+// out.
+type webhookLogResponse struct {
+	Subscriptions []webhookSubscriptionView `json:"subscriptions"`
+	Deliveries    []webhookDelivery         `json:"deliveries"`
+}
+
+type webhookSubscriptionView struct {
+	URL    string   `json:"url"`
+	Signed bool     `json:"signed"`
+	Events []string `json:"events"`
+}
+
+// GET /admin/webhooks – subscriptions and recent deliveries.
+func WebhookLog(tm *TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tm.mu.Lock()
+		d := tm.webhooks
+		tm.mu.Unlock()
+		resp := webhookLogResponse{Subscriptions: []webhookSubscriptionView{}, Deliveries: []webhookDelivery{}}
+		if d != nil {
+			for _, s := range d.cfg.Subscriptions {
+				events := s.Events
+				if len(events) == 0 {
+					events = EventTypes
+				}
+				resp.Subscriptions = append(resp.Subscriptions, webhookSubscriptionView{URL: s.URL, Signed: s.Secret != "", Events: events})
+			}
+			resp.Deliveries = d.deliveries()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("[Webhooks] encode log: %v", err)
+		}
+	}
+}
+
+// ParseWebhookSubscriptions reads subscriptions from JSON, as given in
+// the WEBHOOKS environment variable:
+//
+//	[{"url": "https://example.com/hook", "secret": "s3cret", "events": ["game.over"]}]
+func ParseWebhookSubscriptions(v string) ([]WebhookSubscription, error) {
+	var subs []WebhookSubscription
+	if err := json.Unmarshal([]byte(v), &subs); err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, e := range EventTypes {
+		known[e] = true
+	}
+	for _, s := range subs {
+		if s.URL == "" {
+			return nil, fmt.Errorf("webhook subscription without a url")
+		}
+		for _, e := range s.Events {
+			if !known[e] {
+				return nil, fmt.Errorf("webhook %s: unknown event %q", s.URL, e)
+			}
+		}
+	}
+	return subs, nil
+}
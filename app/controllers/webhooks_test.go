@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+// receivedHook is one request a test receiver got.
+type receivedHook struct {
+	header http.Header
+	body   []byte
+	event  LifecycleEvent
+}
+
+// hookReceiver is an httptest webhook receiver answering with status(n)
+// for its nth request.
+func hookReceiver(t *testing.T, status func(n int32) int) (*httptest.Server, chan receivedHook) {
+	t.Helper()
+	got := make(chan receivedHook, 100)
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h := receivedHook{header: r.Header, body: body}
+		json.Unmarshal(body, &h.event)
+		got <- h
+		w.WriteHeader(status(n.Add(1)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func alwaysOK(int32) int { return http.StatusOK }
+
+// nextHook returns the next request for an event of type eventType.
+func nextHook(t *testing.T, got chan receivedHook, eventType string) receivedHook {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case h := <-got:
+			if h.event.Type == eventType {
+				return h
+			}
+		case <-deadline:
+			t.Fatalf("no %s webhook", eventType)
+		}
+	}
+}
+
+func testWebhookConfig(subs ...WebhookSubscription) WebhookConfig {
+	cfg := DefaultWebhookConfig()
+	cfg.Subscriptions = subs
+	cfg.RetryBase = 10 * time.Millisecond
+	return cfg
+}
+
+func TestWebhookSignedAndFiltered(t *testing.T) {
+	created, createdHooks := hookReceiver(t, alwaysOK)
+	over, overHooks := hookReceiver(t, alwaysOK)
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	tm.EnableWebhooks(testWebhookConfig(
+		WebhookSubscription{URL: created.URL, Secret: "s3cret", Events: []string{EventRoomCreated}},
+		WebhookSubscription{URL: over.URL, Events: []string{EventGameOver}},
+	))
+
+	req := httptest.NewRequest(http.MethodPost, "/rooms", strings.NewReader("type=dice&variant=bigpig&public=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	Router(tm, DefaultConfig()).ServeHTTP(rec, req)
+	roomID := strings.TrimPrefix(strings.SplitN(rec.Header().Get("Location"), "?", 2)[0], "/rooms/")
+
+	h := nextHook(t, createdHooks, EventRoomCreated)
+	if h.header.Get("X-Webhook-Signature") != signWebhook("s3cret", h.body) {
+		t.Fatalf("bad signature %q", h.header.Get("X-Webhook-Signature"))
+	}
+	if h.header.Get("X-Webhook-Event") != EventRoomCreated || h.header.Get("X-Webhook-Delivery") == "" {
+		t.Fatalf("missing headers: %v", h.header)
+	}
+	if h.event.RoomID != roomID || h.event.Data["variant"] != "bigpig" || h.event.Data["public"] != true {
+		t.Fatalf("unexpected event %+v", h.event)
+	}
+	select {
+	case h := <-overHooks:
+		t.Fatalf("filtered subscription got %s", h.event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetriesAndGivesUp(t *testing.T) {
+	// Fails twice, then succeeds.
+	flaky, flakyHooks := hookReceiver(t, func(n int32) int {
+		if n < 3 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	gone, _ := hookReceiver(t, func(int32) int { return http.StatusGone })
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	tm.EnableWebhooks(testWebhookConfig(
+		WebhookSubscription{URL: flaky.URL},
+		WebhookSubscription{URL: gone.URL},
+	))
+
+	tm.emit(EventRoomExpired, "retryroom", nil)
+	first := nextHook(t, flakyHooks, EventRoomExpired)
+	for i := 0; i < 2; i++ {
+		if h := nextHook(t, flakyHooks, EventRoomExpired); h.header.Get("X-Webhook-Delivery") != first.header.Get("X-Webhook-Delivery") {
+			t.Fatal("retry changed the delivery ID")
+		}
+	}
+
+	status := map[string]webhookDelivery{}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, d := range tm.webhooks.deliveries() {
+			status[d.URL] = d
+		}
+		if status[flaky.URL].Status == deliveryDelivered && status[gone.URL].Status == deliveryFailed {
+			break
+		}
+	}
+	if d := status[flaky.URL]; d.Status != deliveryDelivered || d.Attempts != 3 {
+		t.Fatalf("flaky receiver: %+v", d)
+	}
+	// A 410 is not worth retrying.
+	if d := status[gone.URL]; d.Status != deliveryFailed || d.Attempts != 1 || d.StatusCode != http.StatusGone {
+		t.Fatalf("gone receiver: %+v", d)
+	}
+
+	if got := tm.webhooks.backoff(20); got != maxWebhookBackoff {
+		t.Fatalf("backoff not capped: %v", got)
+	}
+}
+
+func TestWebhookQueueDropsWhenFull(t *testing.T) {
+	d := &webhookDispatcher{queue: make(chan *webhookDelivery, 1)}
+	a, b := &webhookDelivery{ID: "a"}, &webhookDelivery{ID: "b"}
+	d.record(a)
+	d.record(b)
+	d.enqueue(a)
+	d.enqueue(b)
+	if a.Status == deliveryDropped || b.Status != deliveryDropped {
+		t.Fatalf("expected only the second delivery dropped: %q %q", a.Status, b.Status)
+	}
+}
+
+func TestWebhookMemberAndGameEvents(t *testing.T) {
+	hooks, got := hookReceiver(t, alwaysOK)
+	srv, tm := newTestServer(t)
+	tm.EnableWebhooks(testWebhookConfig(WebhookSubscription{URL: hooks.URL}))
+
+	a := joinRoom(t, srv.URL, "hookroom", "playeraa")
+	waitFor[roomclient.Peers](t, a)
+	if h := nextHook(t, got, EventMemberJoined); h.event.Data["clientID"] != "playeraa" || h.event.Data["members"] != 1.0 {
+		t.Fatalf("unexpected member.joined %+v", h.event)
+	}
+	b := joinRoom(t, srv.URL, "hookroom", "playerbb")
+	waitFor[roomclient.Peers](t, b)
+
+	a.StartGame("hookgame", "pig", []string{"playeraa", "playerbb"})
+	waitFor[roomclient.GameStart](t, b)
+	if h := nextHook(t, got, EventGameStarted); h.event.Data["gameID"] != "hookgame" || h.event.Data["host"] != "playeraa" {
+		t.Fatalf("unexpected game.started %+v", h.event)
+	}
+	a.EndGame("hookgame", 1)
+	h := nextHook(t, got, EventGameOver)
+	if winner, _ := h.event.Data["winner"].(map[string]interface{}); winner["clientID"] != "playerbb" {
+		t.Fatalf("unexpected game.over %+v", h.event)
+	}
+
+	b.Close()
+	if h := nextHook(t, got, EventMemberLeft); h.event.Data["clientID"] != "playerbb" || h.event.Data["members"] != 1.0 {
+		t.Fatalf("unexpected member.left %+v", h.event)
+	}
+}
+
+func TestAdminWebhookLogRequiresToken(t *testing.T) {
+	tm := NewTopicManager()
+	t.Cleanup(func() { close(tm.shutdown) })
+	tm.EnableWebhooks(testWebhookConfig(WebhookSubscription{URL: "http://127.0.0.1:1/hook", Secret: "s3cret"}))
+
+	get := func(cfg Config, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		Router(tm, cfg).ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get(DefaultConfig(), "Bearer "); rec.Code != http.StatusNotFound {
+		t.Fatalf("without a configured token: got %d", rec.Code)
+	}
+	cfg := DefaultConfig()
+	cfg.AdminToken = "letmein"
+	if rec := get(cfg, "Bearer wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: got %d", rec.Code)
+	}
+	rec := get(cfg, "Bearer letmein")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("right token: got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "s3cret") {
+		t.Fatal("webhook log leaks the secret")
+	}
+	var body webhookLogResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Subscriptions) != 1 || !body.Subscriptions[0].Signed || len(body.Subscriptions[0].Events) != len(EventTypes) {
+		t.Fatalf("unexpected subscriptions %+v", body.Subscriptions)
+	}
+}
@@ -0,0 +1,342 @@
+package roomclient
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is one of the types below.
+type Event interface{ isEvent() }
+
+// Peers is the server's first frame after every (re)connect.
+type Peers struct {
+	RoomID string
+	// Peers are the other members connected when we joined.
+	Peers  []string
+	Slots  map[string]int
+	MySlot int
+	// Mode is "mesh" or "sfu"; in SFU rooms media goes to SFUPeer.
+	Mode    string
+	SFUPeer string
+	// Presence covers every connected member, including us.
+	Presence map[string]Presence
+}
+
+// Presence is a member's display name, avatar and media state.
+type Presence struct {
+	Name          string `json:"name,omitempty"`
+	Avatar        string `json:"avatar,omitempty"`
+	MicMuted      bool   `json:"micMuted"`
+	CameraOff     bool   `json:"cameraOff"`
+	ScreenSharing bool   `json:"screenSharing"`
+	HandRaised    bool   `json:"handRaised"`
+}
+
+// PlayerJoined announces a new member and its slot.
+type PlayerJoined struct {
+	PeerID   string
+	Slot     int
+	Presence Presence
+}
+
+// PresenceUpdated reports a member's new presence.
+type PresenceUpdated struct {
+	PeerID   string
+	Presence Presence
+}
+
+// PlayerLeft announces that a member disconnected. Its slot is kept for
+// when it rejoins.
+type PlayerLeft struct {
+	PeerID string
+}
+
+// Signal is a WebRTC offer, answer or candidate.
+type Signal struct {
+	Type string // "offer", "answer" or "candidate"
+	From string
+	To   string
+	SDP  string
+	ICE  json.RawMessage
+}
+
+// GameStart starts (or restarts) a game table. The server sends it to the
+// whole group, the starting host included, with the table's roster.
+type GameStart struct {
+	From    string
+	To      string
+	GameID  string
+	Roster  []string
+	Variant string
+	Kicked  []int
+}
+
+// GameEvent is an opaque game action.
+type GameEvent struct {
+	From   string
+	To     string
+	GameID string
+	Event  json.RawMessage
+}
+
+// Kick removes a slot from a game's roster.
+type Kick struct {
+	From   string
+	GameID string
+	Slot   int
+}
+
+// Games lists the game tables in our group, after Peers and whenever a
+// table changes.
+type Games struct {
+	Games []Game
+}
+
+// Game is one game table.
+type Game struct {
+	ID      string   `json:"id"`
+	Host    string   `json:"host"`
+	Variant string   `json:"variant"`
+	Status  string   `json:"status"` // "open", "playing" or "finished"
+	Roster  []string `json:"roster"`
+	Kicked  []int    `json:"kicked"`
+}
+
+// GameResult is a player's account of how a game ended, reported with
+// ReportGameResult. Players is in roster order.
+type GameResult struct {
+	Winner  int            `json:"winner"` // roster index, or -1
+	Players []PlayerResult `json:"players"`
+}
+
+// PlayerResult is one player's final line in a GameResult.
+type PlayerResult struct {
+	Score         int  `json:"score"`
+	Turns         int  `json:"turns"`
+	BiggestTurn   int  `json:"biggestTurn"`
+	LongestStreak int  `json:"longestStreak"`
+	Kicked        bool `json:"kicked"`
+}
+
+// Chat is a chat line, stamped by the server. Our own messages come back
+// as Chat events too.
+type Chat struct {
+	ID     string    `json:"id"`
+	From   string    `json:"from"`
+	Name   string    `json:"name,omitempty"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+// ChatHistory carries recent chat, sent right after Peers when the room
+// has any.
+type ChatHistory struct {
+	Messages []Chat
+}
+
+// ChatDeleted reports that the host deleted a chat message.
+type ChatDeleted struct {
+	ID string
+}
+
+// Breakouts is the room's breakout layout, sent whenever it or its
+// membership changes. Being moved is followed by a fresh Peers event for
+// the new group.
+type Breakouts struct {
+	Host   string
+	Main   []string // connected members not in a breakout
+	Groups []BreakoutGroup
+}
+
+// BreakoutGroup is one breakout and its connected members.
+type BreakoutGroup struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// Announcement is a host's message to the whole room, across breakouts.
+// Operators' notices arrive as announcements From "server".
+type Announcement struct {
+	From   string
+	Text   string
+	SentAt time.Time
+}
+
+// RoomHealth is the server's periodic report of every member's
+// connection, by clientID, sent every few seconds.
+type RoomHealth struct {
+	Members map[string]LinkQuality
+}
+
+// LinkQuality is one member's connection as the server measures it.
+type LinkQuality struct {
+	Transport  string `json:"transport"` // "websocket" or "sse"
+	RTTMs      int    `json:"rttMs"`
+	JitterMs   int    `json:"jitterMs"`
+	Reconnects int    `json:"reconnects"` // in the last 10 minutes
+	Bars       int    `json:"bars"`       // 1 (poor) to 4 (good), 0 if not yet measured
+}
+
+// Removed reports that the server disconnected us: Reason is
+// "disconnected", "banned" or "closed". The client does not reconnect;
+// a Disconnected event with ErrRemoved follows.
+type Removed struct {
+	Reason string
+}
+
+// Other is any frame without a dedicated type, e.g. recording status.
+type Other struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+// Disconnected reports a dropped connection or failed reconnect attempt.
+type Disconnected struct {
+	Err error
+}
+
+// Reconnected reports that the connection is back. A Peers event follows.
+type Reconnected struct{}
+
+func (Peers) isEvent()           {}
+func (PlayerJoined) isEvent()    {}
+func (PlayerLeft) isEvent()      {}
+func (PresenceUpdated) isEvent() {}
+func (Signal) isEvent()          {}
+func (GameStart) isEvent()       {}
+func (GameEvent) isEvent()       {}
+func (Kick) isEvent()            {}
+func (Games) isEvent()           {}
+func (Chat) isEvent()            {}
+func (ChatHistory) isEvent()     {}
+func (ChatDeleted) isEvent()     {}
+func (Breakouts) isEvent()       {}
+func (Announcement) isEvent()    {}
+func (RoomHealth) isEvent()      {}
+func (Removed) isEvent()         {}
+func (Other) isEvent()           {}
+func (Disconnected) isEvent()    {}
+func (Reconnected) isEvent()     {}
+
+// frame is the wire format shared by every message type.
+type frame struct {
+	Type   string          `json:"type"`
+	From   string          `json:"from,omitempty"`
+	To     string          `json:"to,omitempty"`
+	RoomID string          `json:"roomID"`
+	SDP    json.RawMessage `json:"sdp,omitempty"`
+	ICE    json.RawMessage `json:"ice,omitempty"`
+	Event  json.RawMessage `json:"event,omitempty"`
+
+	// peers
+	Peers   []string       `json:"peers,omitempty"`
+	Slots   map[string]int `json:"slots,omitempty"`
+	MySlot  int            `json:"mySlot,omitempty"`
+	Mode    string         `json:"mode,omitempty"`
+	SFUPeer string         `json:"sfuPeer,omitempty"`
+
+	// player_joined / player_left / presence_updated; Presence is a
+	// map in peers and a single value otherwise.
+	PeerID   string          `json:"peerID,omitempty"`
+	Presence json.RawMessage `json:"presence,omitempty"`
+
+	// game_start / player_kick / game_over; Slot is shared with
+	// player_joined.
+	GameID  string      `json:"gameID,omitempty"`
+	Games   []Game      `json:"games,omitempty"`
+	Roster  []string    `json:"roster,omitempty"`
+	Variant string      `json:"variant,omitempty"`
+	Kicked  []int       `json:"kicked,omitempty"`
+	Slot    *int        `json:"slot,omitempty"`
+	Winner  *int        `json:"winner,omitempty"`
+	Result  *GameResult `json:"result,omitempty"`
+
+	// chat / chat_history / chat_delete(d)
+	ID       string    `json:"id,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Text     string    `json:"text,omitempty"`
+	SentAt   time.Time `json:"sentAt,omitzero"`
+	Messages []Chat    `json:"messages,omitempty"`
+
+	// breakouts and the host's breakout_* requests
+	Host       string          `json:"host,omitempty"`
+	Main       []string        `json:"main,omitempty"`
+	Breakouts  []BreakoutGroup `json:"breakouts,omitempty"`
+	ClientID   string          `json:"clientID,omitempty"`
+	BreakoutID string          `json:"breakoutID,omitempty"`
+
+	// removed
+	Reason string `json:"reason,omitempty"`
+
+	// room_health
+	Members map[string]LinkQuality `json:"members,omitempty"`
+}
+
+func decode(data []byte) (Event, error) {
+	var f frame
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	slot := -1
+	if f.Slot != nil {
+		slot = *f.Slot
+	}
+	switch f.Type {
+	case "peers":
+		p := Peers{RoomID: f.RoomID, Peers: f.Peers, Slots: f.Slots, MySlot: f.MySlot, Mode: f.Mode, SFUPeer: f.SFUPeer}
+		if len(f.Presence) > 0 {
+			if err := json.Unmarshal(f.Presence, &p.Presence); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	case "player_joined":
+		p := PlayerJoined{PeerID: f.PeerID, Slot: slot}
+		if len(f.Presence) > 0 {
+			if err := json.Unmarshal(f.Presence, &p.Presence); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	case "presence_updated":
+		p := PresenceUpdated{PeerID: f.PeerID}
+		if err := json.Unmarshal(f.Presence, &p.Presence); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "player_left":
+		return PlayerLeft{PeerID: f.PeerID}, nil
+	case "offer", "answer", "candidate":
+		s := Signal{Type: f.Type, From: f.From, To: f.To, ICE: f.ICE}
+		if len(f.SDP) > 0 {
+			if err := json.Unmarshal(f.SDP, &s.SDP); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case "game_start":
+		return GameStart{From: f.From, To: f.To, GameID: f.GameID, Roster: f.Roster, Variant: f.Variant, Kicked: f.Kicked}, nil
+	case "game_event":
+		return GameEvent{From: f.From, To: f.To, GameID: f.GameID, Event: f.Event}, nil
+	case "player_kick":
+		return Kick{From: f.From, GameID: f.GameID, Slot: slot}, nil
+	case "games":
+		return Games{Games: f.Games}, nil
+	case "chat":
+		return Chat{ID: f.ID, From: f.From, Name: f.Name, Text: f.Text, SentAt: f.SentAt}, nil
+	case "chat_history":
+		return ChatHistory{Messages: f.Messages}, nil
+	case "chat_deleted":
+		return ChatDeleted{ID: f.ID}, nil
+	case "breakouts":
+		return Breakouts{Host: f.Host, Main: f.Main, Groups: f.Breakouts}, nil
+	case "announcement":
+		return Announcement{From: f.From, Text: f.Text, SentAt: f.SentAt}, nil
+	case "removed":
+		return Removed{Reason: f.Reason}, nil
+	case "room_health":
+		return RoomHealth{Members: f.Members}, nil
+	}
+	return Other{Type: f.Type, Raw: append(json.RawMessage(nil), data...)}, nil
+}
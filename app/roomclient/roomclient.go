@@ -0,0 +1,574 @@
+// Package roomclient joins a room over the /rooms/{roomID}/ws signaling
+// protocol, for bots, load tests and native games. It decodes the server's
+// frames into typed events, tracks player slots, and reconnects with the
+// same clientID so the server restores the client's slot.
+//
+//	c, err := roomclient.Dial(ctx, "https://example.com", "room123abc", "bot000001")
+//	if err != nil { ... }
+//	defer c.Close()
+//	for ev := range c.Events() {
+//		switch ev := ev.(type) {
+//		case roomclient.PlayerJoined:
+//			c.SendChat("hello " + ev.PeerID)
+//		}
+//	}
+package roomclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrRoomFull is returned when the room is at capacity.
+	ErrRoomFull = errors.New("roomclient: room full")
+	// ErrInvalidID is returned when the server rejects the room or client ID.
+	ErrInvalidID = errors.New("roomclient: invalid room or client id")
+	// ErrNotConnected is returned by sends while the client is reconnecting.
+	ErrNotConnected = errors.New("roomclient: not connected")
+	// ErrClosed is returned by sends after Close.
+	ErrClosed = errors.New("roomclient: closed")
+	// ErrBanned is returned when the server has banned the client ID.
+	ErrBanned = errors.New("roomclient: banned")
+	// ErrRoomClosed is returned when an operator has closed the room.
+	ErrRoomClosed = errors.New("roomclient: room closed")
+	// ErrNotOpen is returned when a scheduled room hasn't opened yet.
+	ErrNotOpen = errors.New("roomclient: room not open yet")
+	// ErrRemoved ends the connection after a Removed event.
+	ErrRemoved = errors.New("roomclient: removed by the server")
+)
+
+const (
+	// Broadcast is the To value that addresses every other room member.
+	Broadcast = "room"
+
+	eventBuffer = 64
+	writeWait   = 5 * time.Second
+	// backoffFloor is the smallest reconnect delay, so a zero minimum
+	// still doubles towards the maximum instead of redialling in a loop.
+	backoffFloor = 100 * time.Millisecond
+)
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithReconnect sets the reconnect backoff bounds. A max of 0 disables
+// reconnecting: the event channel closes when the connection drops. A
+// min below 100ms is raised to 100ms, or to max if that is smaller.
+func WithReconnect(min, max time.Duration) Option {
+	return func(c *Client) {
+		if max > 0 && min < backoffFloor {
+			min = backoffFloor
+			if max < min {
+				min = max
+			}
+		}
+		c.minBackoff, c.maxBackoff = min, max
+	}
+}
+
+// WithPresence sets the presence announced on join. The client keeps the
+// latest value sent with SendPresence and re-announces it on reconnect.
+func WithPresence(p Presence) Option {
+	return func(c *Client) { c.presence = p }
+}
+
+// WithDialer replaces the WebSocket dialer, e.g. to set a proxy or TLS
+// config.
+func WithDialer(d *websocket.Dialer) Option {
+	return func(c *Client) { c.dialer = d }
+}
+
+// Client is one member of a room. Its methods are safe for concurrent use.
+type Client struct {
+	roomID   string
+	clientID string
+	baseURL  string
+	dialer   *websocket.Dialer
+
+	minBackoff, maxBackoff time.Duration
+
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+
+	writeMu sync.Mutex
+	conn    *websocket.Conn // nil while reconnecting
+
+	mu       sync.Mutex
+	mySlot   int
+	slots    map[string]int
+	peers    map[string]struct{}
+	presence Presence
+	members  map[string]Presence
+}
+
+// Dial joins roomID on the server at baseURL (http, https, ws or wss) as
+// clientID. ctx bounds the initial connection only; the client then runs
+// until Close.
+func Dial(ctx context.Context, baseURL, roomID, clientID string, opts ...Option) (*Client, error) {
+	if _, err := socketURL(baseURL, roomID, clientID, Presence{}); err != nil {
+		return nil, err
+	}
+	c := &Client{
+		roomID:     roomID,
+		clientID:   clientID,
+		baseURL:    baseURL,
+		dialer:     websocket.DefaultDialer,
+		minBackoff: 250 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+		events:     make(chan Event, eventBuffer),
+		done:       make(chan struct{}),
+		mySlot:     -1,
+		slots:      make(map[string]int),
+		peers:      make(map[string]struct{}),
+		members:    make(map[string]Presence),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.run(conn)
+	return c, nil
+}
+
+func socketURL(baseURL, roomID, clientID string, p Presence) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("roomclient: unsupported scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/rooms/" + url.PathEscape(roomID) + "/ws"
+	q := url.Values{"userID": {clientID}}
+	if p != (Presence{}) {
+		q.Set("presence", string(mustJSON(p)))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	c.mu.Lock()
+	p := c.presence
+	c.mu.Unlock()
+	wsURL, err := socketURL(c.baseURL, c.roomID, c.clientID, p)
+	if err != nil {
+		return nil, err
+	}
+	conn, resp, err := c.dialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		if resp != nil {
+			switch resp.StatusCode {
+			case http.StatusConflict:
+				return nil, ErrRoomFull
+			case http.StatusBadRequest:
+				return nil, ErrInvalidID
+			case http.StatusForbidden:
+				return nil, ErrBanned
+			case http.StatusGone:
+				return nil, ErrRoomClosed
+			case http.StatusTooEarly:
+				return nil, ErrNotOpen
+			}
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// run reads frames until the connection drops, then reconnects.
+func (c *Client) run(conn *websocket.Conn) {
+	defer close(c.events)
+	backoff := c.minBackoff
+	for {
+		err := c.readLoop(conn)
+
+		c.writeMu.Lock()
+		c.conn = nil
+		c.writeMu.Unlock()
+		conn.Close()
+		c.resetPeers()
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		if !c.emit(Disconnected{Err: err}) || c.maxBackoff == 0 || err == ErrRemoved {
+			return
+		}
+
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-c.done:
+				return
+			}
+			backoff = min(backoff*2, c.maxBackoff)
+			next, err := c.dial(context.Background())
+			if err == nil {
+				conn = next
+				break
+			}
+			if !c.emit(Disconnected{Err: err}) || err == ErrBanned || err == ErrRoomClosed {
+				return
+			}
+		}
+		backoff = c.minBackoff
+
+		c.writeMu.Lock()
+		c.conn = conn
+		c.writeMu.Unlock()
+		if !c.emit(Reconnected{}) {
+			return
+		}
+	}
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		ev, err := decode(data)
+		if err != nil {
+			continue
+		}
+		c.track(ev)
+		if !c.emit(ev) {
+			return ErrClosed
+		}
+		if _, ok := ev.(Removed); ok {
+			return ErrRemoved
+		}
+	}
+}
+
+// emit delivers ev, blocking while the consumer is behind. It reports
+// false once the client is closed.
+func (c *Client) emit(ev Event) bool {
+	select {
+	case c.events <- ev:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *Client) track(ev Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch ev := ev.(type) {
+	case Peers:
+		c.mySlot = ev.MySlot
+		c.slots = make(map[string]int, len(ev.Slots))
+		for id, slot := range ev.Slots {
+			c.slots[id] = slot
+		}
+		c.peers = make(map[string]struct{}, len(ev.Peers))
+		for _, id := range ev.Peers {
+			c.peers[id] = struct{}{}
+		}
+		c.members = make(map[string]Presence, len(ev.Presence))
+		for id, p := range ev.Presence {
+			c.members[id] = p
+		}
+	case PlayerJoined:
+		c.slots[ev.PeerID] = ev.Slot
+		c.peers[ev.PeerID] = struct{}{}
+		c.members[ev.PeerID] = ev.Presence
+	case PlayerLeft:
+		delete(c.peers, ev.PeerID)
+		delete(c.members, ev.PeerID)
+	case PresenceUpdated:
+		c.members[ev.PeerID] = ev.Presence
+	}
+}
+
+func (c *Client) resetPeers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peers = make(map[string]struct{})
+	c.members = make(map[string]Presence)
+}
+
+// Events returns the stream of events. It is closed after Close, or when
+// the connection drops and reconnecting is disabled.
+func (c *Client) Events() <-chan Event { return c.events }
+
+// ID returns the client's ID.
+func (c *Client) ID() string { return c.clientID }
+
+// RoomID returns the room the client joined.
+func (c *Client) RoomID() string { return c.roomID }
+
+// MySlot returns the client's player slot, or -1 before the first Peers
+// event.
+func (c *Client) MySlot() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mySlot
+}
+
+// Slots returns a copy of the room's clientID → slot map. Slots outlive
+// disconnects, so it includes members who have left.
+func (c *Client) Slots() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int, len(c.slots))
+	for id, slot := range c.slots {
+		out[id] = slot
+	}
+	return out
+}
+
+// Peers returns the other members currently connected.
+func (c *Client) Peers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]string, 0, len(c.peers))
+	for id := range c.peers {
+		out = append(out, id)
+	}
+	return out
+}
+
+// Presence returns the last known presence of a connected member (or of
+// this client), and whether the member is known.
+func (c *Client) Presence(clientID string) (Presence, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.members[clientID]
+	return p, ok
+}
+
+// Close leaves the room.
+func (c *Client) Close() error {
+	c.once.Do(func() { close(c.done) })
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+	return c.conn.Close()
+}
+
+// Send writes one raw frame. The typed helpers below fill in from and
+// roomID; frames sent here must carry them.
+func (c *Client) Send(frame interface{}) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Client) frame(typ, to string) frame {
+	return frame{Type: typ, From: c.clientID, To: to, RoomID: c.roomID}
+}
+
+// SendOffer sends an SDP offer to a peer.
+func (c *Client) SendOffer(to, sdp string) error {
+	f := c.frame("offer", to)
+	f.SDP = mustJSON(sdp)
+	return c.Send(f)
+}
+
+// SendAnswer sends an SDP answer to a peer.
+func (c *Client) SendAnswer(to, sdp string) error {
+	f := c.frame("answer", to)
+	f.SDP = mustJSON(sdp)
+	return c.Send(f)
+}
+
+// SendCandidate sends an ICE candidate (any JSON-encodable value, usually
+// an RTCIceCandidateInit) to a peer.
+func (c *Client) SendCandidate(to string, candidate interface{}) error {
+	ice, err := json.Marshal(candidate)
+	if err != nil {
+		return err
+	}
+	f := c.frame("candidate", to)
+	f.ICE = ice
+	return c.Send(f)
+}
+
+// SendPresence replaces this client's presence and broadcasts it to the
+// room.
+func (c *Client) SendPresence(p Presence) error {
+	c.mu.Lock()
+	c.presence = p
+	c.mu.Unlock()
+	f := c.frame("presence_update", Broadcast)
+	f.Presence = mustJSON(p)
+	return c.Send(f)
+}
+
+func (c *Client) gameFrame(typ, gameID string) frame {
+	f := c.frame(typ, Broadcast)
+	f.GameID = gameID
+	return f
+}
+
+// OpenGame opens a game table with us as host and only player; others
+// JoinGame it until we StartGame.
+func (c *Client) OpenGame(gameID, variant string) error {
+	f := c.gameFrame("game_open", gameID)
+	f.Variant = variant
+	return c.Send(f)
+}
+
+// JoinGame adds us to an open table's roster.
+func (c *Client) JoinGame(gameID string) error {
+	return c.Send(c.gameFrame("game_join", gameID))
+}
+
+// LeaveGame takes us off an open table's roster.
+func (c *Client) LeaveGame(gameID string) error {
+	return c.Send(c.gameFrame("game_leave", gameID))
+}
+
+// StartGame starts or restarts a table we host. A nil roster plays with
+// the table's own; otherwise roster replaces it. An unknown gameID opens
+// and starts a new table in one step. The server answers with GameStart.
+func (c *Client) StartGame(gameID, variant string, roster []string) error {
+	f := c.gameFrame("game_start", gameID)
+	f.Variant = variant
+	f.Roster = roster
+	return c.Send(f)
+}
+
+// SendGameEvent broadcasts a game event to the table's group. Only
+// players of a game in progress are relayed.
+func (c *Client) SendGameEvent(gameID string, event interface{}) error {
+	return c.SendGameEventTo(Broadcast, gameID, event)
+}
+
+// SendGameEventTo sends a game event to one peer (or Broadcast).
+func (c *Client) SendGameEventTo(to, gameID string, event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	f := c.gameFrame("game_event", gameID)
+	f.To = to
+	f.Event = data
+	return c.Send(f)
+}
+
+// SendKick removes a game-roster slot; only the game's host is obeyed.
+func (c *Client) SendKick(gameID string, slot int) error {
+	f := c.gameFrame("player_kick", gameID)
+	f.Slot = &slot
+	return c.Send(f)
+}
+
+// EndGame marks a table we host as finished, won by the player at roster
+// index winner; a negative winner reports none.
+func (c *Client) EndGame(gameID string, winner int) error {
+	f := c.gameFrame("game_over", gameID)
+	if winner >= 0 {
+		f.Winner = &winner
+	}
+	return c.Send(f)
+}
+
+// ReportGameResult reports how a game we played in ended. The server
+// records it for the leaderboard once another player reports the same.
+func (c *Client) ReportGameResult(gameID string, r GameResult) error {
+	f := c.gameFrame("game_result", gameID)
+	f.Result = &r
+	return c.Send(f)
+}
+
+// CloseGame removes a table we host.
+func (c *Client) CloseGame(gameID string) error {
+	return c.Send(c.gameFrame("game_close", gameID))
+}
+
+// SendChat posts a chat message to the room. The server echoes it back as
+// a Chat event with its ID and timestamp.
+func (c *Client) SendChat(text string) error {
+	f := c.frame("chat", Broadcast)
+	f.Text = text
+	return c.Send(f)
+}
+
+// DeleteChat deletes a chat message; only the room's host is obeyed.
+func (c *Client) DeleteChat(id string) error {
+	f := c.frame("chat_delete", Broadcast)
+	f.ID = id
+	return c.Send(f)
+}
+
+// SendAnnouncement broadcasts to the whole room, across breakouts; only
+// the room's host is obeyed.
+func (c *Client) SendAnnouncement(text string) error {
+	f := c.frame("announcement", Broadcast)
+	f.Text = text
+	return c.Send(f)
+}
+
+// CreateBreakout adds a named breakout group (host only). A Breakouts
+// event carries its ID.
+func (c *Client) CreateBreakout(name string) error {
+	f := c.frame("breakout_create", Broadcast)
+	f.Name = name
+	return c.Send(f)
+}
+
+// MoveToBreakout moves a member into a breakout, or back to the main room
+// with an empty breakoutID (host only).
+func (c *Client) MoveToBreakout(clientID, breakoutID string) error {
+	f := c.frame("breakout_move", Broadcast)
+	f.ClientID = clientID
+	f.BreakoutID = breakoutID
+	return c.Send(f)
+}
+
+// CloseBreakout deletes a breakout, returning its members to the main room
+// (host only).
+func (c *Client) CloseBreakout(breakoutID string) error {
+	f := c.frame("breakout_close", Broadcast)
+	f.BreakoutID = breakoutID
+	return c.Send(f)
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,127 @@
+package roomclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/controllers"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(controllers.Router(controllers.NewTopicManager(), controllers.DefaultConfig()))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func next(t *testing.T, c *Client) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-c.Events():
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func TestReconnectKeepsSlot(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+
+	a, err := Dial(ctx, srv.URL, "reconnect1", "clientaa1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	next(t, a)
+	b, err := Dial(ctx, srv.URL, "reconnect1", "clientbb1", WithReconnect(10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if p := next(t, b).(Peers); p.MySlot != 1 {
+		t.Fatalf("expected slot 1, got %d", p.MySlot)
+	}
+
+	// Drop B's socket out from under it.
+	b.writeMu.Lock()
+	b.conn.Close()
+	b.writeMu.Unlock()
+
+	if _, ok := next(t, b).(Disconnected); !ok {
+		t.Fatal("expected Disconnected")
+	}
+	if err := b.SendChat("x"); err != ErrNotConnected && err != nil {
+		t.Fatalf("send while reconnecting: %v", err)
+	}
+	if _, ok := next(t, b).(Reconnected); !ok {
+		t.Fatal("expected Reconnected")
+	}
+	p, ok := next(t, b).(Peers)
+	if !ok || p.MySlot != 1 || b.MySlot() != 1 {
+		t.Fatalf("expected slot 1 restored, got %#v", p)
+	}
+	if len(b.Peers()) != 1 || b.Peers()[0] != "clientaa1" {
+		t.Fatalf("unexpected peers %v", b.Peers())
+	}
+}
+
+func TestCloseEndsEvents(t *testing.T) {
+	srv := newServer(t)
+	c, err := Dial(context.Background(), srv.URL, "closeroom1", "clientcc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(t, c)
+	c.Close()
+	for range c.Events() {
+	}
+	if err := c.SendChat("x"); err != ErrClosed {
+		t.Fatalf("send after close: %v", err)
+	}
+}
+
+func TestReconnectFloorsZeroMin(t *testing.T) {
+	for _, tc := range []struct{ min, max, want time.Duration }{
+		{0, 5 * time.Second, backoffFloor},
+		{0, 50 * time.Millisecond, 50 * time.Millisecond},
+		{time.Second, 5 * time.Second, time.Second},
+		{0, 0, 0},
+	} {
+		var c Client
+		WithReconnect(tc.min, tc.max)(&c)
+		if c.minBackoff != tc.want {
+			t.Errorf("WithReconnect(%v, %v): min backoff %v, want %v", tc.min, tc.max, c.minBackoff, tc.want)
+		}
+	}
+}
+
+func TestDecodeUnknownFrame(t *testing.T) {
+	ev, err := decode([]byte(`{"type":"recording_started","roomID":"r","recordingID":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, ok := ev.(Other)
+	if !ok || other.Type != "recording_started" || len(other.Raw) == 0 {
+		t.Fatalf("unexpected %#v", ev)
+	}
+}
+
+func TestSocketURL(t *testing.T) {
+	got, err := socketURL("https://example.com/", "room123", "client1", Presence{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "wss://example.com/rooms/room123/ws?userID=client1"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if _, err := socketURL("ftp://example.com", "r", "c", Presence{}); err == nil {
+		t.Fatal("expected an error for ftp")
+	}
+}
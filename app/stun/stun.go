@@ -0,0 +1,161 @@
+// Package stun implements a minimal RFC 5389 STUN server: it answers
+// Binding requests with the client's reflexive transport address so WebRTC
+// clients can discover their public candidates without a third-party
+// STUN service.
+package stun
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"log"
+	"net"
+)
+
+const (
+	headerSize  = 20
+	magicCookie = 0x2112A442
+
+	typeBindingRequest  = 0x0001
+	typeBindingResponse = 0x0101
+
+	attrXORMappedAddress = 0x0020
+	attrSoftware         = 0x8022
+	attrFingerprint      = 0x8028
+
+	fingerprintXOR = 0x5354554e
+
+	familyIPv4 = 0x01
+	familyIPv6 = 0x02
+
+	maxPacketSize = 1500
+)
+
+var errNotBindingRequest = errors.New("stun: not a binding request")
+
+// Server answers STUN Binding requests on a single PacketConn.
+type Server struct {
+	conn     net.PacketConn
+	software string
+}
+
+// NewServer wraps conn. software is advertised in the SOFTWARE attribute
+// of every response; leave it empty to omit the attribute.
+func NewServer(conn net.PacketConn, software string) *Server {
+	return &Server{conn: conn, software: software}
+}
+
+// ListenAndServe listens on the UDP address addr and serves until the
+// socket is closed.
+func ListenAndServe(addr, software string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("[STUN] listening on udp %s", conn.LocalAddr())
+	return NewServer(conn, software).Serve()
+}
+
+// Addr returns the local address the server is bound to.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// Serve reads requests until the connection is closed. Packets that are not
+// well-formed Binding requests are dropped silently, as RFC 5389 requires
+// for anything that cannot be identified as STUN.
+func (s *Server) Serve() error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		resp, err := s.handle(buf[:n], udpAddr)
+		if err != nil {
+			continue
+		}
+		if _, err := s.conn.WriteTo(resp, addr); err != nil {
+			log.Printf("[STUN] write to %s: %v", addr, err)
+		}
+	}
+}
+
+// handle validates a Binding request and builds the success response.
+func (s *Server) handle(req []byte, from *net.UDPAddr) ([]byte, error) {
+	if len(req) < headerSize || req[0]&0xC0 != 0 {
+		return nil, errNotBindingRequest
+	}
+	msgType := binary.BigEndian.Uint16(req[0:2])
+	msgLen := int(binary.BigEndian.Uint16(req[2:4]))
+	if msgType != typeBindingRequest ||
+		binary.BigEndian.Uint32(req[4:8]) != magicCookie ||
+		msgLen%4 != 0 || headerSize+msgLen != len(req) {
+		return nil, errNotBindingRequest
+	}
+	txID := req[8:20]
+
+	body := xorMappedAddress(from, txID)
+	if s.software != "" {
+		body = appendAttr(body, attrSoftware, []byte(s.software))
+	}
+
+	resp := make([]byte, headerSize, headerSize+len(body)+8)
+	binary.BigEndian.PutUint16(resp[0:2], typeBindingResponse)
+	binary.BigEndian.PutUint32(resp[4:8], magicCookie)
+	copy(resp[8:20], txID)
+	resp = append(resp, body...)
+
+	// FINGERPRINT covers the message with its length already including the
+	// fingerprint attribute itself.
+	binary.BigEndian.PutUint16(resp[2:4], uint16(len(body)+8))
+	crc := crc32.ChecksumIEEE(resp) ^ fingerprintXOR
+	fp := make([]byte, 4)
+	binary.BigEndian.PutUint32(fp, crc)
+	resp = appendAttr(resp, attrFingerprint, fp)
+	return resp, nil
+}
+
+// xorMappedAddress encodes the XOR-MAPPED-ADDRESS attribute for addr.
+func xorMappedAddress(addr *net.UDPAddr, txID []byte) []byte {
+	var cookie [4]byte
+	binary.BigEndian.PutUint32(cookie[:], magicCookie)
+
+	family, ip := byte(familyIPv4), addr.IP.To4()
+	if ip == nil {
+		family, ip = familyIPv6, addr.IP.To16()
+	}
+	value := make([]byte, 4+len(ip))
+	value[1] = family
+	binary.BigEndian.PutUint16(value[2:4], uint16(addr.Port)^uint16(magicCookie>>16))
+	key := append(cookie[:], txID...)
+	for i := range ip {
+		value[4+i] = ip[i] ^ key[i]
+	}
+	return appendAttr(nil, attrXORMappedAddress, value)
+}
+
+// appendAttr appends a TLV attribute padded to a 4-byte boundary.
+func appendAttr(b []byte, typ uint16, value []byte) []byte {
+	var hdr [4]byte
+	binary.BigEndian.PutUint16(hdr[0:2], typ)
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(len(value)))
+	b = append(b, hdr[:]...)
+	b = append(b, value...)
+	if pad := len(value) % 4; pad != 0 {
+		b = append(b, make([]byte, 4-pad)...)
+	}
+	return b
+}
@@ -0,0 +1,153 @@
+package stun
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := NewServer(conn, "test")
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func bindingRequest(t *testing.T) (req, txID []byte) {
+	t.Helper()
+	req = make([]byte, headerSize)
+	binary.BigEndian.PutUint16(req[0:2], typeBindingRequest)
+	binary.BigEndian.PutUint32(req[4:8], magicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		t.Fatal(err)
+	}
+	return req, req[8:20]
+}
+
+// parseAttrs splits a STUN message body into its attributes.
+func parseAttrs(t *testing.T, body []byte) map[uint16][]byte {
+	t.Helper()
+	attrs := map[uint16][]byte{}
+	for len(body) >= 4 {
+		typ := binary.BigEndian.Uint16(body[0:2])
+		n := int(binary.BigEndian.Uint16(body[2:4]))
+		if 4+n > len(body) {
+			t.Fatalf("truncated attribute %#x", typ)
+		}
+		attrs[typ] = body[4 : 4+n]
+		padded := (n + 3) &^ 3
+		body = body[4+padded:]
+	}
+	return attrs
+}
+
+func TestBindingRequestReturnsXORMappedAddress(t *testing.T) {
+	s := startServer(t)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	req, txID := bindingRequest(t)
+	if _, err := client.WriteTo(req, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, maxPacketSize)
+	n, _, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	resp := buf[:n]
+
+	if typ := binary.BigEndian.Uint16(resp[0:2]); typ != typeBindingResponse {
+		t.Fatalf("expected binding success response, got %#x", typ)
+	}
+	if !bytes.Equal(resp[8:20], txID) {
+		t.Fatal("transaction ID mismatch")
+	}
+	if int(binary.BigEndian.Uint16(resp[2:4])) != n-headerSize {
+		t.Fatal("length field does not match payload")
+	}
+
+	attrs := parseAttrs(t, resp[headerSize:])
+	xma, ok := attrs[attrXORMappedAddress]
+	if !ok {
+		t.Fatal("missing XOR-MAPPED-ADDRESS")
+	}
+	port := int(binary.BigEndian.Uint16(xma[2:4]) ^ uint16(magicCookie>>16))
+	var ip net.IP = make([]byte, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(xma[4:8])^magicCookie)
+
+	local := client.LocalAddr().(*net.UDPAddr)
+	if port != local.Port || !ip.Equal(local.IP) {
+		t.Fatalf("mapped address %s:%d, want %s", ip, port, local)
+	}
+	if string(attrs[attrSoftware]) != "test" {
+		t.Fatalf("unexpected SOFTWARE %q", attrs[attrSoftware])
+	}
+
+	fp, ok := attrs[attrFingerprint]
+	if !ok {
+		t.Fatal("missing FINGERPRINT")
+	}
+	want := crc32.ChecksumIEEE(resp[:n-8]) ^ fingerprintXOR
+	if binary.BigEndian.Uint32(fp) != want {
+		t.Fatal("bad FINGERPRINT")
+	}
+}
+
+func TestNonSTUNPacketsIgnored(t *testing.T) {
+	s := &Server{}
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+
+	if _, err := s.handle([]byte("hello"), from); err == nil {
+		t.Fatal("short packet should be rejected")
+	}
+
+	req, _ := bindingRequest(t)
+	binary.BigEndian.PutUint32(req[4:8], 0xdeadbeef)
+	if _, err := s.handle(req, from); err == nil {
+		t.Fatal("bad magic cookie should be rejected")
+	}
+
+	req, _ = bindingRequest(t)
+	binary.BigEndian.PutUint16(req[0:2], 0x0111)
+	if _, err := s.handle(req, from); err == nil {
+		t.Fatal("non-request types should be rejected")
+	}
+}
+
+func TestXORMappedAddressIPv6(t *testing.T) {
+	txID := make([]byte, 12)
+	rand.Read(txID)
+	addr := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 3478}
+
+	attr := xorMappedAddress(addr, txID)
+	value := attr[4:]
+	if value[1] != familyIPv6 || len(value) != 20 {
+		t.Fatalf("unexpected IPv6 encoding %x", value)
+	}
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint32(key, magicCookie)
+	copy(key[4:], txID)
+	ip := make(net.IP, 16)
+	for i := range ip {
+		ip[i] = value[4+i] ^ key[i]
+	}
+	if !ip.Equal(addr.IP) {
+		t.Fatalf("decoded %s, want %s", ip, addr.IP)
+	}
+}
@@ -0,0 +1,281 @@
+// Package turnserver runs an optional TURN relay (RFC 5766) inside the site
+// binary so players behind symmetric NATs and corporate firewalls can still
+// reach each other. Clients authenticate with time-limited credentials in
+// the TURN REST API format: the username is "<expiry-unix>:<clientID>" and
+// the password is base64(HMAC-SHA1(secret, username)), so the HTTP side can
+// mint credentials without sharing any state with the relay. The clientID
+// in a username is whatever the minting side vouches for; per-user quotas
+// are only as strong as that ID, so it should be one the server issued.
+package turnserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/turn/v4"
+)
+
+// Config describes the relay's listeners, relay port range and quotas.
+type Config struct {
+	// ListenAddr is the host:port the server accepts TURN traffic on, over
+	// both UDP and TCP.
+	ListenAddr string
+	Realm      string
+	// Secret is the shared HMAC secret used to mint and verify credentials.
+	Secret string
+
+	// RelayIP is the address advertised to clients in XOR-RELAYED-ADDRESS;
+	// it must be reachable by peers. RelayBindAddr is the local address the
+	// relay sockets bind to (default "0.0.0.0").
+	RelayIP       net.IP
+	RelayBindAddr string
+	// MinPort and MaxPort bound the relay sockets (inclusive).
+	MinPort, MaxPort uint16
+
+	// MaxAllocationsPerUser caps concurrent allocations per credential
+	// clientID and MaxAllocations caps them server-wide; 0 means
+	// unlimited.
+	MaxAllocationsPerUser int
+	MaxAllocations        int
+}
+
+var errNoSecret = errors.New("turnserver: a shared secret is required")
+
+// reservationTimeout is how long a slot reserved by the quota check waits
+// for its allocation to be created. Allocations that fail after the check
+// (no free relay port, say) report nothing, so their slots are released
+// this way.
+const reservationTimeout = 10 * time.Second
+
+// Credentials mints TURN credentials for clientID that expire after ttl.
+func Credentials(secret, clientID string, ttl time.Duration, now time.Time) (username, password string) {
+	username = strconv.FormatInt(now.Add(ttl).Unix(), 10) + ":" + clientID
+	return username, sign(secret, username)
+}
+
+func sign(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Server is a running TURN relay.
+type Server struct {
+	cfg  Config
+	turn *turn.Server
+	udp  net.PacketConn
+	tcp  net.Listener
+
+	// perUser and total count live allocations plus reservations; pending
+	// holds the reservations, by client transport address, until their
+	// allocations are created.
+	mu      sync.Mutex
+	perUser map[string]int
+	total   int
+	pending map[string]reservation
+}
+
+// reservation is a quota slot taken by an allocation being created.
+type reservation struct {
+	user string
+	at   time.Time
+}
+
+// Start binds the UDP and TCP listeners and starts relaying.
+func Start(cfg Config) (*Server, error) {
+	if cfg.Secret == "" {
+		return nil, errNoSecret
+	}
+	if cfg.RelayBindAddr == "" {
+		cfg.RelayBindAddr = "0.0.0.0"
+	}
+	if cfg.RelayIP == nil {
+		return nil, errors.New("turnserver: RelayIP is required")
+	}
+
+	udp, err := net.ListenPacket("udp", cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	// Bind TCP to the port UDP actually got, so ":0" works in tests.
+	tcpAddr := net.JoinHostPort(hostOf(cfg.ListenAddr), strconv.Itoa(udp.LocalAddr().(*net.UDPAddr).Port))
+	tcp, err := net.Listen("tcp", tcpAddr)
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+
+	s := &Server{cfg: cfg, udp: udp, tcp: tcp, perUser: make(map[string]int), pending: make(map[string]reservation)}
+
+	newRelayGen := func() turn.RelayAddressGenerator {
+		if cfg.MinPort == 0 || cfg.MaxPort == 0 {
+			return &turn.RelayAddressGeneratorStatic{RelayAddress: cfg.RelayIP, Address: cfg.RelayBindAddr}
+		}
+		return &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: cfg.RelayIP,
+			Address:      cfg.RelayBindAddr,
+			MinPort:      cfg.MinPort,
+			MaxPort:      cfg.MaxPort,
+		}
+	}
+
+	s.turn, err = turn.NewServer(turn.ServerConfig{
+		Realm:        cfg.Realm,
+		AuthHandler:  s.authenticate,
+		QuotaHandler: s.allowAllocation,
+		EventHandler: turn.EventHandler{
+			OnAllocationCreated: func(src, _ net.Addr, _, username, _ string, _ net.Addr, _ int) {
+				s.created(src, username)
+			},
+			OnAllocationDeleted: func(_, _ net.Addr, _, username, _ string) {
+				s.release(username)
+			},
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{PacketConn: udp, RelayAddressGenerator: newRelayGen()}},
+		ListenerConfigs:   []turn.ListenerConfig{{Listener: tcp, RelayAddressGenerator: newRelayGen()}},
+	})
+	if err != nil {
+		udp.Close()
+		tcp.Close()
+		return nil, err
+	}
+	log.Printf("[TURN] listening on %s (udp+tcp), relaying via %s", udp.LocalAddr(), cfg.RelayIP)
+	return s, nil
+}
+
+// Addr returns the UDP address the server is listening on; TCP uses the
+// same port.
+func (s *Server) Addr() net.Addr {
+	return s.udp.LocalAddr()
+}
+
+// Allocations returns the number of live allocations.
+func (s *Server) Allocations() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// Close stops the relay and releases every allocation.
+func (s *Server) Close() error {
+	return s.turn.Close()
+}
+
+// authenticate verifies time-limited REST API credentials.
+func (s *Server) authenticate(username, realm string, _ net.Addr) ([]byte, bool) {
+	expiry, _, ok := parseUsername(username)
+	if !ok || time.Now().Unix() > expiry {
+		return nil, false
+	}
+	return turn.GenerateAuthKey(username, realm, sign(s.cfg.Secret, username)), true
+}
+
+// allowAllocation checks the quotas and, if they allow it, reserves a slot
+// for the allocation, so concurrent requests cannot all pass the check.
+func (s *Server) allowAllocation(username, _ string, src net.Addr) bool {
+	_, user, ok := parseUsername(username)
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireReservationsLocked(now)
+	key := addrKey(src)
+	if _, retry := s.pending[key]; retry {
+		return true
+	}
+	if s.cfg.MaxAllocations > 0 && s.total >= s.cfg.MaxAllocations {
+		log.Printf("[TURN] server allocation quota reached (%d)", s.total)
+		return false
+	}
+	if s.cfg.MaxAllocationsPerUser > 0 && s.perUser[user] >= s.cfg.MaxAllocationsPerUser {
+		log.Printf("[TURN] allocation quota reached for %s (%d)", user, s.perUser[user])
+		return false
+	}
+	s.pending[key] = reservation{user: user, at: now}
+	s.total++
+	s.perUser[user]++
+	return true
+}
+
+// created turns src's reservation into a live allocation.
+func (s *Server) created(src net.Addr, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := addrKey(src)
+	if _, ok := s.pending[key]; ok {
+		delete(s.pending, key)
+		return
+	}
+	// The reservation expired first; count the allocation again.
+	if _, user, ok := parseUsername(username); ok {
+		s.total++
+		s.perUser[user]++
+	}
+}
+
+// release gives back a deleted allocation's slot.
+func (s *Server) release(username string) {
+	_, user, ok := parseUsername(username)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked(user)
+}
+
+func (s *Server) releaseLocked(user string) {
+	s.total--
+	if s.perUser[user]--; s.perUser[user] <= 0 {
+		delete(s.perUser, user)
+	}
+}
+
+// expireReservationsLocked releases reservations whose allocations were
+// never created.
+func (s *Server) expireReservationsLocked(now time.Time) {
+	for key, r := range s.pending {
+		if now.Sub(r.at) > reservationTimeout {
+			delete(s.pending, key)
+			s.releaseLocked(r.user)
+		}
+	}
+}
+
+func addrKey(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.Network() + "/" + a.String()
+}
+
+// parseUsername splits "<expiry-unix>:<clientID>".
+func parseUsername(username string) (expiry int64, user string, ok bool) {
+	i := strings.IndexByte(username, ':')
+	if i <= 0 || i == len(username)-1 {
+		return 0, "", false
+	}
+	expiry, err := strconv.ParseInt(username[:i], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return expiry, username[i+1:], true
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
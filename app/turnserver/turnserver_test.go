@@ -0,0 +1,228 @@
+package turnserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4"
+)
+
+const testSecret = "s3cret"
+
+func startTestServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.Realm = "test"
+	cfg.Secret = testSecret
+	cfg.RelayIP = net.ParseIP("127.0.0.1")
+	cfg.RelayBindAddr = "127.0.0.1"
+	s, err := Start(cfg)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func newUDPClient(t *testing.T, s *Server, username, password string) *turn.Client {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return newClient(t, s, conn, username, password)
+}
+
+func newClient(t *testing.T, s *Server, conn net.PacketConn, username, password string) *turn.Client {
+	t.Helper()
+	c, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: s.Addr().String(),
+		TURNServerAddr: s.Addr().String(),
+		Username:       username,
+		Password:       password,
+		Realm:          "test",
+		Conn:           conn,
+		RTO:            100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if err := c.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// relayRoundTrip sends a datagram from a plain UDP peer to the relayed
+// address and back again, proving the allocation forwards both ways.
+func relayRoundTrip(t *testing.T, relay net.PacketConn) {
+	t.Helper()
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	// Permission is created by the first send from the relay side.
+	if _, err := relay.WriteTo([]byte("hello peer"), peer.LocalAddr()); err != nil {
+		t.Fatalf("relay write: %v", err)
+	}
+	buf := make([]byte, 1500)
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, from, err := peer.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("peer read: %v", err)
+	}
+	if string(buf[:n]) != "hello peer" {
+		t.Fatalf("peer got %q", buf[:n])
+	}
+	if from.String() != relay.LocalAddr().String() {
+		t.Fatalf("peer saw source %s, want relayed address %s", from, relay.LocalAddr())
+	}
+
+	if _, err := peer.WriteTo([]byte("hello relay"), from); err != nil {
+		t.Fatalf("peer write: %v", err)
+	}
+	relay.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err = relay.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("relay read: %v", err)
+	}
+	if string(buf[:n]) != "hello relay" {
+		t.Fatalf("relay got %q", buf[:n])
+	}
+}
+
+func TestUDPAllocationRelaysTraffic(t *testing.T) {
+	s := startTestServer(t, Config{MinPort: 40000, MaxPort: 40100})
+
+	user, pass := Credentials(testSecret, "client01", time.Hour, time.Now())
+	c := newUDPClient(t, s, user, pass)
+
+	relay, err := c.Allocate()
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	defer relay.Close()
+
+	port := relay.LocalAddr().(*net.UDPAddr).Port
+	if port < 40000 || port > 40100 {
+		t.Fatalf("relay port %d outside configured range", port)
+	}
+	if got := s.Allocations(); got != 1 {
+		t.Fatalf("expected 1 allocation, got %d", got)
+	}
+	relayRoundTrip(t, relay)
+}
+
+func TestTCPClientAllocation(t *testing.T) {
+	s := startTestServer(t, Config{})
+
+	tcpConn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("dial tcp: %v", err)
+	}
+	defer tcpConn.Close()
+
+	user, pass := Credentials(testSecret, "client02", time.Hour, time.Now())
+	c := newClient(t, s, turn.NewSTUNConn(tcpConn), user, pass)
+
+	relay, err := c.Allocate()
+	if err != nil {
+		t.Fatalf("allocate over tcp: %v", err)
+	}
+	defer relay.Close()
+	relayRoundTrip(t, relay)
+}
+
+func TestExpiredCredentialsRejected(t *testing.T) {
+	s := startTestServer(t, Config{})
+
+	user, pass := Credentials(testSecret, "client03", time.Minute, time.Now().Add(-time.Hour))
+	c := newUDPClient(t, s, user, pass)
+	if relay, err := c.Allocate(); err == nil {
+		relay.Close()
+		t.Fatal("expected expired credentials to be rejected")
+	}
+}
+
+func TestWrongSecretRejected(t *testing.T) {
+	s := startTestServer(t, Config{})
+
+	user, pass := Credentials("not-the-secret", "client04", time.Hour, time.Now())
+	c := newUDPClient(t, s, user, pass)
+	if relay, err := c.Allocate(); err == nil {
+		relay.Close()
+		t.Fatal("expected credentials signed with another secret to be rejected")
+	}
+}
+
+func TestPerUserQuota(t *testing.T) {
+	s := startTestServer(t, Config{MaxAllocationsPerUser: 1})
+
+	user, pass := Credentials(testSecret, "client05", time.Hour, time.Now())
+	first, err := newUDPClient(t, s, user, pass).Allocate()
+	if err != nil {
+		t.Fatalf("first allocate: %v", err)
+	}
+	defer first.Close()
+
+	if relay, err := newUDPClient(t, s, user, pass).Allocate(); err == nil {
+		relay.Close()
+		t.Fatal("expected second allocation for the same clientID to hit the quota")
+	}
+
+	other, otherPass := Credentials(testSecret, "client06", time.Hour, time.Now())
+	relay, err := newUDPClient(t, s, other, otherPass).Allocate()
+	if err != nil {
+		t.Fatalf("another clientID should still allocate: %v", err)
+	}
+	relay.Close()
+}
+
+func TestQuotaReservesBeforeCreation(t *testing.T) {
+	s := &Server{cfg: Config{MaxAllocationsPerUser: 1}, perUser: make(map[string]int), pending: make(map[string]reservation)}
+	user, _ := Credentials(testSecret, "client08", time.Hour, time.Now())
+	a := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4001}
+	b := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4002}
+
+	if !s.allowAllocation(user, "test", a) {
+		t.Fatal("first allocation refused")
+	}
+	if !s.allowAllocation(user, "test", a) {
+		t.Fatal("a retried request should reuse its reservation")
+	}
+	if s.allowAllocation(user, "test", b) {
+		t.Fatal("a concurrent allocation got past the reservation")
+	}
+
+	// A reservation whose allocation never appears is released.
+	s.pending[addrKey(a)] = reservation{user: "client08", at: time.Now().Add(-2 * reservationTimeout)}
+	if !s.allowAllocation(user, "test", b) {
+		t.Fatal("stale reservation was not released")
+	}
+	s.created(b, user)
+	if s.Allocations() != 1 || len(s.pending) != 0 {
+		t.Fatalf("after creation: %d allocations, %d pending", s.Allocations(), len(s.pending))
+	}
+	s.release(user)
+	if s.Allocations() != 0 || len(s.perUser) != 0 {
+		t.Fatalf("after deletion: %d allocations, %v", s.Allocations(), s.perUser)
+	}
+}
+
+func TestParseUsername(t *testing.T) {
+	if _, _, ok := parseUsername("nocolon"); ok {
+		t.Fatal("expected failure without a clientID")
+	}
+	if _, _, ok := parseUsername("abc:client"); ok {
+		t.Fatal("expected failure for a non-numeric expiry")
+	}
+	expiry, user, ok := parseUsername("1700000000:client07")
+	if !ok || expiry != 1700000000 || user != "client07" {
+		t.Fatalf("unexpected parse %d %q %v", expiry, user, ok)
+	}
+}
@@ -20,6 +20,16 @@ echo "==> Building pig.wasm …"
 )
 echo "    pig.wasm -> $WASM_OUT_DIR/pig.wasm"
 
+# Precompressed siblings are negotiated by Accept-Encoding at serve time.
+echo "==> Precompressing pig.wasm …"
+gzip -9 -k -f "$WASM_OUT_DIR/pig.wasm"
+if command -v brotli >/dev/null 2>&1; then
+  brotli -q 11 -f -o "$WASM_OUT_DIR/pig.wasm.br" "$WASM_OUT_DIR/pig.wasm"
+else
+  rm -f "$WASM_OUT_DIR/pig.wasm.br"
+  echo "    brotli not installed, skipping pig.wasm.br"
+fi
+
 echo "==> Copying wasm_exec.js from Go toolchain …"
 GOROOT="$(go env GOROOT)"
 WASM_EXEC_SRC=""
@@ -0,0 +1,320 @@
+// Command roomctl manages live rooms through the server's admin API
+// (/admin/api). It needs the server's ADMIN_TOKEN.
+//
+//	roomctl rooms
+//	roomctl room ROOM
+//	roomctl notice [-room ROOM] TEXT...
+//	roomctl disconnect ROOM CLIENT
+//	roomctl close ROOM
+//	roomctl reset-slots ROOM
+//	roomctl bans
+//	roomctl ban CLIENT [REASON...]
+//	roomctl unban CLIENT
+//
+// The server and token come from -url and -token, or ROOMCTL_URL and
+// ADMIN_TOKEN:
+//
+//	ADMIN_TOKEN=s3cret go run ./cmd/roomctl -url https://example.com rooms
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type member struct {
+	ClientID string `json:"clientID"`
+	Name     string `json:"name"`
+	Slot     int    `json:"slot"`
+	Breakout string `json:"breakout"`
+	Link     *link  `json:"link"`
+}
+
+// link is a member's connection health.
+type link struct {
+	Transport  string `json:"transport"`
+	RTTMs      int    `json:"rttMs"`
+	Reconnects int    `json:"reconnects"`
+	Bars       int    `json:"bars"`
+}
+
+type room struct {
+	RoomID  string     `json:"roomID"`
+	Type    string     `json:"type"`
+	Mode    string     `json:"mode"`
+	Variant string     `json:"variant"`
+	Public  bool       `json:"public"`
+	Code    string     `json:"code"`
+	Created *time.Time `json:"created"`
+	Host    string     `json:"host"`
+	Members []member   `json:"members"`
+	Slots   []string   `json:"slots"`
+	Games   int        `json:"games"`
+}
+
+type ban struct {
+	ClientID string    `json:"clientID"`
+	Reason   string    `json:"reason"`
+	Created  time.Time `json:"created"`
+}
+
+// api calls the admin API.
+type api struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// call sends in (if not nil) as JSON and decodes the reply into out (if
+// not nil).
+func (a *api) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, a.base+"/admin/api"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: roomctl [flags] rooms | room ROOM | notice [-room ROOM] TEXT... |")
+		fmt.Fprintln(os.Stderr, "       disconnect ROOM CLIENT | close ROOM | reset-slots ROOM |")
+		fmt.Fprintln(os.Stderr, "       bans | ban CLIENT [REASON...] | unban CLIENT")
+		flag.PrintDefaults()
+	}
+	base := flag.String("url", envOr("ROOMCTL_URL", "http://localhost:8000"), "server base URL")
+	token := flag.String("token", os.Getenv("ADMIN_TOKEN"), "admin token")
+	asJSON := flag.Bool("json", false, "print raw JSON replies")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *token == "" {
+		fail(errors.New("no admin token; set -token or ADMIN_TOKEN"))
+	}
+	a := &api{base: strings.TrimSuffix(*base, "/"), token: *token, http: &http.Client{Timeout: 15 * time.Second}}
+	if err := run(a, flag.Arg(0), flag.Args()[1:], *asJSON, os.Stdout); err != nil {
+		fail(err)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "roomctl:", err)
+	os.Exit(1)
+}
+
+var errUsage = errors.New("wrong arguments; see roomctl -h")
+
+func run(a *api, cmd string, args []string, asJSON bool, w io.Writer) error {
+	need := func(n int) error {
+		if len(args) < n {
+			return errUsage
+		}
+		return nil
+	}
+	esc := url.PathEscape
+
+	switch cmd {
+	case "rooms":
+		var out struct {
+			Rooms []room `json:"rooms"`
+		}
+		if err := a.call(http.MethodGet, "/rooms", nil, &out); err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(w, out)
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROOM\tTYPE\tMODE\tMEMBERS\tHOST\tCODE\tPUBLIC")
+		for _, r := range out.Rooms {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%v\n", r.RoomID, orDash(r.Type), r.Mode, len(r.Members), orDash(r.Host), orDash(r.Code), r.Public)
+		}
+		return tw.Flush()
+
+	case "room":
+		if err := need(1); err != nil {
+			return err
+		}
+		var r room
+		if err := a.call(http.MethodGet, "/rooms/"+esc(args[0]), nil, &r); err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(w, r)
+		}
+		fmt.Fprintf(w, "room %s: %s %s room", r.RoomID, orDash(r.Type), r.Mode)
+		if r.Variant != "" {
+			fmt.Fprintf(w, " (%s)", r.Variant)
+		}
+		if r.Code != "" {
+			fmt.Fprintf(w, ", code %s", r.Code)
+		}
+		if r.Created != nil {
+			fmt.Fprintf(w, ", created %s", r.Created.Format(time.RFC3339))
+		}
+		fmt.Fprintf(w, "\n%d game table(s); slot list: %s\n\n", r.Games, strings.Join(r.Slots, " "))
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SLOT\tCLIENT\tNAME\tBREAKOUT\tHOST\tRTT\tRECONNECTS")
+		for _, m := range r.Members {
+			rtt, reconnects := "-", 0
+			if m.Link != nil {
+				reconnects = m.Link.Reconnects
+				if m.Link.Bars > 0 {
+					rtt = fmt.Sprintf("%dms", m.Link.RTTMs)
+				}
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%v\t%s\t%d\n", m.Slot, m.ClientID, orDash(m.Name), orDash(m.Breakout), m.ClientID == r.Host, rtt, reconnects)
+		}
+		return tw.Flush()
+
+	case "notice":
+		fs := flag.NewFlagSet("notice", flag.ContinueOnError)
+		roomID := fs.String("room", "", "only this room")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		text := strings.Join(fs.Args(), " ")
+		if text == "" {
+			return errUsage
+		}
+		var out struct {
+			Recipients int `json:"recipients"`
+		}
+		if err := a.call(http.MethodPost, "/notice", map[string]string{"text": text, "roomID": *roomID}, &out); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "notice sent to %d client(s)\n", out.Recipients)
+		return nil
+
+	case "disconnect":
+		if err := need(2); err != nil {
+			return err
+		}
+		if err := a.call(http.MethodPost, "/rooms/"+esc(args[0])+"/clients/"+esc(args[1])+"/disconnect", nil, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "disconnected %s from %s\n", args[1], args[0])
+		return nil
+
+	case "close":
+		if err := need(1); err != nil {
+			return err
+		}
+		var out struct {
+			Disconnected int `json:"disconnected"`
+		}
+		if err := a.call(http.MethodPost, "/rooms/"+esc(args[0])+"/close", nil, &out); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "closed %s, disconnecting %d client(s)\n", args[0], out.Disconnected)
+		return nil
+
+	case "reset-slots":
+		if err := need(1); err != nil {
+			return err
+		}
+		var out struct {
+			Slots []string `json:"slots"`
+		}
+		if err := a.call(http.MethodPost, "/rooms/"+esc(args[0])+"/reset-slots", nil, &out); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "slots of %s: %s\n", args[0], strings.Join(out.Slots, " "))
+		return nil
+
+	case "bans":
+		var out struct {
+			Bans []ban `json:"bans"`
+		}
+		if err := a.call(http.MethodGet, "/bans", nil, &out); err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(w, out)
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLIENT\tSINCE\tREASON")
+		for _, b := range out.Bans {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", b.ClientID, b.Created.Format(time.RFC3339), orDash(b.Reason))
+		}
+		return tw.Flush()
+
+	case "ban":
+		if err := need(1); err != nil {
+			return err
+		}
+		body := map[string]string{"clientID": args[0], "reason": strings.Join(args[1:], " ")}
+		if err := a.call(http.MethodPost, "/bans", body, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "banned %s\n", args[0])
+		return nil
+
+	case "unban":
+		if err := need(1); err != nil {
+			return err
+		}
+		if err := a.call(http.MethodDelete, "/bans/"+esc(args[0]), nil, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "unbanned %s\n", args[0])
+		return nil
+	}
+	return fmt.Errorf("unknown command %q; see roomctl -h", cmd)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,456 @@
+// Command roomload load-tests room signaling. It opens -rooms rooms with
+// -clients simulated members each; every member trades fake offer, answer
+// and candidate frames with random peers and, once the room's first member
+// has started a game table with everyone on it, broadcasts game_event
+// frames, at the configured rates. Each payload carries a per-stream sequence number
+// and send time, so receivers can measure latency and spot drops.
+//
+// With no -url it starts an in-process server and targets that:
+//
+//	go run ./cmd/roomload -rooms 50 -clients 8 -duration 30s
+//	go run ./cmd/roomload -url https://staging.example.com -rooms 5
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josephhammerman1979/josephhammerman.com/app/controllers"
+	"github.com/josephhammerman1979/josephhammerman.com/app/roomclient"
+)
+
+type config struct {
+	url        string
+	rooms      int
+	clients    int
+	duration   time.Duration
+	ramp       time.Duration
+	signalRate float64 // offers per second per client
+	gameRate   float64 // game_event broadcasts per second per client
+	verbose    bool
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.url, "url", "", "target base URL; empty starts an in-process server")
+	flag.IntVar(&cfg.rooms, "rooms", 10, "number of rooms")
+	flag.IntVar(&cfg.clients, "clients", 4, "simulated clients per room")
+	flag.DurationVar(&cfg.duration, "duration", 20*time.Second, "how long to send traffic once everyone has joined")
+	flag.DurationVar(&cfg.ramp, "ramp", 2*time.Millisecond, "delay between client connects")
+	flag.Float64Var(&cfg.signalRate, "signal-rate", 1, "offer/answer/candidate exchanges started per second per client")
+	flag.Float64Var(&cfg.gameRate, "game-rate", 2, "game_event broadcasts per second per client")
+	flag.BoolVar(&cfg.verbose, "v", false, "keep server and client logs")
+	flag.Parse()
+
+	if !cfg.verbose {
+		log.SetOutput(io.Discard)
+	}
+	if cfg.url == "" {
+		url, stop, err := startServer()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "roomload:", err)
+			os.Exit(1)
+		}
+		defer stop()
+		cfg.url = url
+		fmt.Printf("in-process server at %s\n", url)
+	}
+
+	st := newStats()
+	run(cfg, st)
+	st.report(os.Stdout, cfg)
+}
+
+// startServer serves the site's router on a loopback port.
+func startServer() (string, func(), error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	srv := &http.Server{Handler: controllers.Router(controllers.NewTopicManager(), controllers.DefaultConfig())}
+	go srv.Serve(ln)
+	return "http://" + ln.Addr().String(), func() { srv.Close() }, nil
+}
+
+// payload is carried in SDP, candidate and game_event bodies.
+type payload struct {
+	Seq  uint64 `json:"seq"`
+	Sent int64  `json:"sent"` // unix nanos
+}
+
+func run(cfg config, st *stats) {
+	prefix := randomHex(3)
+	var joined, done sync.WaitGroup
+	start := make(chan struct{})
+
+	for r := 0; r < cfg.rooms; r++ {
+		roomID := fmt.Sprintf("load-%s-%04d", prefix, r)
+		for c := 0; c < cfg.clients; c++ {
+			clientID := fmt.Sprintf("%s-c%02d", roomID, c)
+			joined.Add(1)
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				sim := dialClient(cfg, st, roomID, clientID)
+				joined.Done()
+				if sim == nil {
+					return
+				}
+				if c == 0 {
+					sim.hostGame(roomID, cfg.clients)
+				}
+				sim.run(cfg, start)
+			}()
+			time.Sleep(cfg.ramp)
+		}
+	}
+	joined.Wait()
+	fmt.Printf("%d/%d clients connected; sending traffic for %s\n",
+		st.connected(), cfg.rooms*cfg.clients, cfg.duration)
+	st.begin()
+	close(start)
+	done.Wait()
+	st.end()
+}
+
+// sim is one simulated room member.
+type sim struct {
+	st *stats
+	c  *roomclient.Client
+
+	// sendMu keeps sequence order and wire order the same when the ticker
+	// and the answering receive loop send at once.
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	sendSeq map[string]uint64 // stream -> last sequence sent
+	recvSeq map[string]uint64 // stream -> last sequence received
+	gameID  string            // set once the room's game_start arrives
+
+	// startGame, if set, is the table this member opens for the room.
+	startGame func() error
+}
+
+func dialClient(cfg config, st *stats, roomID, clientID string) *sim {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := roomclient.Dial(ctx, cfg.url, roomID, clientID, roomclient.WithReconnect(0, 0))
+	if err != nil {
+		st.connectFailed(err)
+		return nil
+	}
+	st.connectOK()
+	return &sim{st: st, c: c, sendSeq: make(map[string]uint64), recvSeq: make(map[string]uint64)}
+}
+
+// hostGame makes s start the room's game table, with every member on the
+// roster, when traffic begins.
+func (s *sim) hostGame(roomID string, clients int) {
+	roster := make([]string, clients)
+	for i := range roster {
+		roster[i] = fmt.Sprintf("%s-c%02d", roomID, i)
+	}
+	gameID := "game-" + roomID
+	s.startGame = func() error { return s.c.StartGame(gameID, "pig", roster) }
+}
+
+func (s *sim) run(cfg config, start <-chan struct{}) {
+	stop := make(chan struct{})
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		s.receive()
+	}()
+
+	<-start
+	if s.startGame != nil {
+		s.sent(s.startGame())
+	}
+	var wg sync.WaitGroup
+	if cfg.signalRate > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.every(cfg.signalRate, stop, s.sendOffer)
+		}()
+	}
+	if cfg.gameRate > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.every(cfg.gameRate, stop, s.sendGameEvent)
+		}()
+	}
+	time.Sleep(cfg.duration)
+	close(stop)
+	wg.Wait()
+	// Let in-flight frames land before hanging up.
+	time.Sleep(500 * time.Millisecond)
+	s.c.Close()
+	<-received
+}
+
+// every calls fn at rate per second, with jitter so clients don't send in
+// lockstep.
+func (s *sim) every(rate float64, stop <-chan struct{}, fn func()) {
+	interval := time.Duration(float64(time.Second) / rate)
+	time.Sleep(time.Duration(mrand.Int63n(int64(interval))))
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			fn()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *sim) next(stream string) payload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendSeq[stream]++
+	return payload{Seq: s.sendSeq[stream], Sent: time.Now().UnixNano()}
+}
+
+func (s *sim) randomPeer() string {
+	peers := s.c.Peers()
+	if len(peers) == 0 {
+		return ""
+	}
+	return peers[mrand.Intn(len(peers))]
+}
+
+func (s *sim) sendOffer() {
+	to := s.randomPeer()
+	if to == "" {
+		return
+	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.sent(s.c.SendOffer(to, encodeSDP(s.next("signal:"+to))))
+	s.sent(s.c.SendCandidate(to, s.next("signal:"+to)))
+}
+
+func (s *sim) sendAnswer(to string) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.sent(s.c.SendAnswer(to, encodeSDP(s.next("signal:"+to))))
+}
+
+// sendGameEvent is a no-op until the room's game has started; the server
+// drops events for tables that are not being played.
+func (s *sim) sendGameEvent() {
+	s.mu.Lock()
+	gameID := s.gameID
+	s.mu.Unlock()
+	if gameID == "" {
+		return
+	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.sent(s.c.SendGameEvent(gameID, s.next("game")))
+}
+
+func (s *sim) sent(err error) {
+	if err != nil {
+		s.st.sendFailed(err)
+		return
+	}
+	s.st.sentOne()
+}
+
+func (s *sim) receive() {
+	for ev := range s.c.Events() {
+		switch ev := ev.(type) {
+		case roomclient.Signal:
+			var p payload
+			var ok bool
+			if ev.Type == "candidate" {
+				ok = json.Unmarshal(ev.ICE, &p) == nil
+			} else {
+				p, ok = decodeSDP(ev.SDP)
+			}
+			if !ok {
+				continue
+			}
+			s.received("signal:"+ev.From, p)
+			if ev.Type == "offer" {
+				s.sendAnswer(ev.From)
+			}
+		case roomclient.GameStart:
+			s.mu.Lock()
+			s.gameID = ev.GameID
+			s.mu.Unlock()
+		case roomclient.GameEvent:
+			var p payload
+			if json.Unmarshal(ev.Event, &p) == nil {
+				s.received("game:"+ev.From, p)
+			}
+		case roomclient.Disconnected:
+			s.st.disconnected(ev.Err)
+		}
+	}
+}
+
+// received records latency and any gap in the sender's sequence. Streams
+// are keyed by sender, and per-sender signal streams are shared by offers,
+// answers and candidates sent to us.
+func (s *sim) received(stream string, p payload) {
+	s.mu.Lock()
+	last := s.recvSeq[stream]
+	if p.Seq > last {
+		s.recvSeq[stream] = p.Seq
+	}
+	s.mu.Unlock()
+	var gap uint64
+	if p.Seq > last+1 {
+		gap = p.Seq - last - 1
+	}
+	s.st.receivedOne(time.Duration(time.Now().UnixNano()-p.Sent), gap, p.Seq <= last)
+}
+
+func encodeSDP(p payload) string {
+	return "v=0\r\ns=roomload seq=" + strconv.FormatUint(p.Seq, 10) + " sent=" + strconv.FormatInt(p.Sent, 10) + "\r\n"
+}
+
+func decodeSDP(sdp string) (payload, bool) {
+	var p payload
+	_, err := fmt.Sscanf(strings.TrimPrefix(sdp, "v=0\r\n"), "s=roomload seq=%d sent=%d", &p.Seq, &p.Sent)
+	return p, err == nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// stats aggregates results across all clients.
+type stats struct {
+	mu          sync.Mutex
+	connects    int
+	connectErrs map[string]int
+	sendErrs    map[string]int
+	disconnects map[string]int
+	sent        int
+	recv        int
+	dropped     uint64
+	reordered   int
+	latencies   []time.Duration
+	started     time.Time
+	elapsed     time.Duration
+}
+
+func newStats() *stats {
+	return &stats{
+		connectErrs: make(map[string]int),
+		sendErrs:    make(map[string]int),
+		disconnects: make(map[string]int),
+	}
+}
+
+func (st *stats) connectOK() {
+	st.mu.Lock()
+	st.connects++
+	st.mu.Unlock()
+}
+
+func (st *stats) connected() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.connects
+}
+
+func (st *stats) connectFailed(err error) {
+	st.mu.Lock()
+	st.connectErrs[err.Error()]++
+	st.mu.Unlock()
+}
+
+func (st *stats) sendFailed(err error) {
+	st.mu.Lock()
+	st.sendErrs[err.Error()]++
+	st.mu.Unlock()
+}
+
+func (st *stats) disconnected(err error) {
+	st.mu.Lock()
+	st.disconnects[err.Error()]++
+	st.mu.Unlock()
+}
+
+func (st *stats) sentOne() {
+	st.mu.Lock()
+	st.sent++
+	st.mu.Unlock()
+}
+
+func (st *stats) receivedOne(latency time.Duration, gap uint64, reordered bool) {
+	st.mu.Lock()
+	st.recv++
+	st.dropped += gap
+	if reordered {
+		st.reordered++
+	}
+	st.latencies = append(st.latencies, latency)
+	st.mu.Unlock()
+}
+
+func (st *stats) begin() { st.started = time.Now() }
+func (st *stats) end()   { st.elapsed = time.Since(st.started) }
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+func (st *stats) report(w io.Writer, cfg config) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	total := cfg.rooms * cfg.clients
+	fmt.Fprintf(w, "\nconnections   %d/%d ok\n", st.connects, total)
+	fmt.Fprintf(w, "frames        %d sent, %d received in %s (%.0f/s received)\n",
+		st.sent, st.recv, st.elapsed.Round(time.Millisecond), float64(st.recv)/st.elapsed.Seconds())
+
+	sort.Slice(st.latencies, func(i, j int) bool { return st.latencies[i] < st.latencies[j] })
+	fmt.Fprintf(w, "latency       p50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(st.latencies, 50), percentile(st.latencies, 90),
+		percentile(st.latencies, 99), percentile(st.latencies, 100))
+	fmt.Fprintf(w, "drops         %d missing by sequence, %d out of order\n", st.dropped, st.reordered)
+
+	printErrors(w, "connect errors", st.connectErrs)
+	printErrors(w, "send errors", st.sendErrs)
+	printErrors(w, "disconnects", st.disconnects)
+}
+
+func printErrors(w io.Writer, label string, errs map[string]int) {
+	if len(errs) == 0 {
+		fmt.Fprintf(w, "%-13s none\n", label)
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", label)
+	for msg, n := range errs {
+		fmt.Fprintf(w, "  %6d  %s\n", n, msg)
+	}
+}
@@ -18,6 +18,12 @@ type Player struct {
 	TurnScore  int
 	IsActive   bool
 	Kicked     bool // multiplayer only: host removed this player, turns skipped
+
+	// Multiplayer statistics, reported to the server when the game ends.
+	Turns         int // turns finished, by holding or by rolling out
+	BiggestTurn   int // most points banked by one hold
+	LongestStreak int // most scoring rolls in one turn
+	rollStreak    int // scoring rolls so far this turn
 }
 
 type PigGame struct {
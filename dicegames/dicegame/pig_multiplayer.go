@@ -74,10 +74,13 @@ type StateSnapshot struct {
 
 // PlayerStateSummary is the per-player slice of StateSnapshot.
 type PlayerStateSummary struct {
-	ID         int  `json:"id"`
-	TotalScore int  `json:"totalScore"`
-	TurnScore  int  `json:"turnScore"`
-	Kicked     bool `json:"kicked"`
+	ID            int  `json:"id"`
+	TotalScore    int  `json:"totalScore"`
+	TurnScore     int  `json:"turnScore"`
+	Kicked        bool `json:"kicked"`
+	Turns         int  `json:"turns"`
+	BiggestTurn   int  `json:"biggestTurn"`
+	LongestStreak int  `json:"longestStreak"`
 }
 
 // RequestRoll asks the game to roll on the next Update, as if the local
@@ -111,6 +114,7 @@ func (g *MultiplayerPigGame) Kick(slot int) {
 	}
 	g.Players[slot].Kicked = true
 	g.Players[slot].TurnScore = 0
+	g.Players[slot].rollStreak = 0
 	g.Players[slot].IsActive = false
 
 	// Count remaining un-kicked players.
@@ -192,10 +196,13 @@ func (g *MultiplayerPigGame) snapshot() StateSnapshot {
 	players := make([]PlayerStateSummary, len(g.Players))
 	for i, p := range g.Players {
 		players[i] = PlayerStateSummary{
-			ID:         p.ID,
-			TotalScore: p.TotalScore,
-			TurnScore:  p.TurnScore,
-			Kicked:     p.Kicked,
+			ID:            p.ID,
+			TotalScore:    p.TotalScore,
+			TurnScore:     p.TurnScore,
+			Kicked:        p.Kicked,
+			Turns:         p.Turns,
+			BiggestTurn:   p.BiggestTurn,
+			LongestStreak: p.LongestStreak,
 		}
 	}
 	rolling := g.diceAnimating() || g.localRolling
@@ -401,6 +408,7 @@ func (g *MultiplayerPigGame) applyRollResult() {
 	cur := g.Players[g.CurrentIndex]
 	if g.Die.Value == 1 {
 		cur.TurnScore = 0
+		cur.endTurn()
 		if g.CurrentIndex == g.myPlayerIdx {
 			g.Message = "You rolled 1 — turn lost!"
 		} else {
@@ -409,6 +417,7 @@ func (g *MultiplayerPigGame) applyRollResult() {
 		g.nextPlayer()
 	} else {
 		cur.TurnScore += g.Die.Value
+		cur.scoredRoll()
 		if g.CurrentIndex == g.myPlayerIdx {
 			g.Message = fmt.Sprintf("You rolled %d! Turn total: %d — SPACE to roll again, ENTER to hold",
 				g.Die.Value, cur.TurnScore)
@@ -435,6 +444,7 @@ func (g *MultiplayerPigGame) applyBigPigRollResult() {
 		// Snake eyes — wipe everything for this player.
 		cur.TurnScore = 0
 		cur.TotalScore = 0
+		cur.endTurn()
 		if isMe {
 			g.Message = "Snake eyes! You lose ALL your points!"
 		} else {
@@ -444,6 +454,7 @@ func (g *MultiplayerPigGame) applyBigPigRollResult() {
 
 	case d1 == 1 || d2 == 1:
 		cur.TurnScore = 0
+		cur.endTurn()
 		if isMe {
 			g.Message = fmt.Sprintf("You rolled %d + %d — turn lost!", d1, d2)
 		} else {
@@ -455,6 +466,7 @@ func (g *MultiplayerPigGame) applyBigPigRollResult() {
 		// Doubles (2..6): score 2x the sum, player continues.
 		gain := 2 * (d1 + d2)
 		cur.TurnScore += gain
+		cur.scoredRoll()
 		if isMe {
 			g.Message = fmt.Sprintf("Doubles! %d + %d × 2 = %d. Turn total: %d — Roll or Hold",
 				d1, d2, gain, cur.TurnScore)
@@ -466,6 +478,7 @@ func (g *MultiplayerPigGame) applyBigPigRollResult() {
 	default:
 		gain := d1 + d2
 		cur.TurnScore += gain
+		cur.scoredRoll()
 		if isMe {
 			g.Message = fmt.Sprintf("You rolled %d + %d = %d. Turn total: %d — Roll or Hold",
 				d1, d2, gain, cur.TurnScore)
@@ -483,7 +496,9 @@ func (g *MultiplayerPigGame) applyHold(playerIdx int) {
 	}
 	cur := g.Players[g.CurrentIndex]
 	cur.TotalScore += cur.TurnScore
+	cur.BiggestTurn = max(cur.BiggestTurn, cur.TurnScore)
 	cur.TurnScore = 0
+	cur.endTurn()
 
 	if cur.TotalScore >= WinningScore {
 		g.GameOver = true
@@ -507,6 +522,18 @@ func (g *MultiplayerPigGame) applyHold(playerIdx int) {
 	}
 }
 
+// scoredRoll counts a roll that added to the turn.
+func (p *Player) scoredRoll() {
+	p.rollStreak++
+	p.LongestStreak = max(p.LongestStreak, p.rollStreak)
+}
+
+// endTurn counts a finished turn.
+func (p *Player) endTurn() {
+	p.Turns++
+	p.rollStreak = 0
+}
+
 func (g *MultiplayerPigGame) nextPlayer() {
 	g.Players[g.CurrentIndex].IsActive = false
 
@@ -0,0 +1,26 @@
+package game
+
+import "testing"
+
+// Statistics follow rolls and holds: a hold banks the turn and ends it, a
+// 1 ends it with nothing banked.
+func TestMultiplayerTurnStatistics(t *testing.T) {
+	g := NewMultiplayerPigGame(2, 0, VariantPig, nil)
+	for _, v := range []int{4, 3, 6} {
+		g.Die.Value = v
+		g.applyRollResult()
+	}
+	g.applyHold(0)
+	g.Die.Value = 5
+	g.applyRollResult()
+	g.Die.Value = 1
+	g.applyRollResult()
+
+	p1, p2 := g.Players[0], g.Players[1]
+	if p1.Turns != 1 || p1.BiggestTurn != 13 || p1.LongestStreak != 3 || p1.TotalScore != 13 {
+		t.Errorf("player 1: got %+v", *p1)
+	}
+	if p2.Turns != 1 || p2.BiggestTurn != 0 || p2.LongestStreak != 1 || p2.TotalScore != 0 {
+		t.Errorf("player 2: got %+v", *p2)
+	}
+}